@@ -0,0 +1,100 @@
+package devd
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cortesi/termlog"
+)
+
+// clientIP returns the address of the client that made a request
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+type authFailures struct {
+	count int
+	last  time.Time
+	until time.Time
+}
+
+// authAudit logs authentication failures on the "auth" log channel, and
+// optionally locks out client addresses with too many recent failures.
+type authAudit struct {
+	log termlog.Logger
+	// Failures before an address is locked out, or 0 to never lock out
+	maxFailures int
+	lockout     time.Duration
+
+	sync.Mutex
+	failures map[string]*authFailures
+}
+
+func newAuthAudit(log termlog.Logger, maxFailures int, lockout time.Duration) *authAudit {
+	return &authAudit{
+		log:         log,
+		maxFailures: maxFailures,
+		lockout:     lockout,
+		failures:    make(map[string]*authFailures),
+	}
+}
+
+// failed records an authentication failure
+func (a *authAudit) failed(r *http.Request, user string) {
+	ip := clientIP(r)
+	a.log.WarnAs("auth", "Authentication failed from %s for user %q: %s %s", ip, user, r.Method, r.RequestURI)
+	if a.maxFailures <= 0 {
+		return
+	}
+	a.Lock()
+	defer a.Unlock()
+	now := time.Now()
+	for k, f := range a.failures {
+		if now.Sub(f.last) > a.lockout && now.After(f.until) {
+			delete(a.failures, k)
+		}
+	}
+	f, ok := a.failures[ip]
+	if !ok {
+		f = &authFailures{}
+		a.failures[ip] = f
+	}
+	f.count++
+	f.last = now
+	if f.count >= a.maxFailures {
+		f.count = 0
+		f.until = now.Add(a.lockout)
+		a.log.WarnAs("auth", "Locking out %s for %s", ip, a.lockout)
+	}
+}
+
+// lockedUntil returns the time until which an address is locked out, or the
+// zero time if it isn't
+func (a *authAudit) lockedUntil(ip string) time.Time {
+	a.Lock()
+	defer a.Unlock()
+	if f, ok := a.failures[ip]; ok && time.Now().Before(f.until) {
+		return f.until
+	}
+	return time.Time{}
+}
+
+// handler refuses requests from locked out addresses
+func (a *authAudit) handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if until := a.lockedUntil(clientIP(r)); !until.IsZero() {
+			retry := int(time.Until(until).Seconds()) + 1
+			w.Header().Set("Retry-After", strconv.Itoa(retry))
+			http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,48 @@
+package devd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cortesi/termlog"
+)
+
+func TestAuthAudit(t *testing.T) {
+	logger := termlog.NewLog()
+	logger.Quiet()
+	a := newAuthAudit(logger, 3, time.Minute)
+	h := a.handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	request := func(addr string) *http.Request {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = addr
+		return r
+	}
+	serve := func(addr string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, request(addr))
+		return w
+	}
+
+	for i := 0; i < 2; i++ {
+		a.failed(request("10.0.0.1:1234"), "user")
+	}
+	AssertCode(t, serve("10.0.0.1:1234"), http.StatusOK)
+	a.failed(request("10.0.0.1:1234"), "user")
+	w := serve("10.0.0.1:4321")
+	AssertCode(t, w, http.StatusTooManyRequests)
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("Expected a Retry-After header")
+	}
+	AssertCode(t, serve("10.0.0.2:1234"), http.StatusOK)
+
+	a = newAuthAudit(logger, 0, time.Minute)
+	for i := 0; i < 10; i++ {
+		a.failed(request("10.0.0.1:1234"), "user")
+	}
+	if !a.lockedUntil("10.0.0.1").IsZero() {
+		t.Error("Expected no lockout when lockout is disabled")
+	}
+}
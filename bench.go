@@ -0,0 +1,135 @@
+package devd
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cortesi/termlog"
+)
+
+// BenchResult summarises a load test
+type BenchResult struct {
+	Requests int
+	// Requests that failed without a response
+	Errors int
+	// Response counts by status code
+	Statuses map[int]int
+	// Total size of the response bodies
+	Bytes    int64
+	Duration time.Duration
+	// Latencies of the requests that got a response, sorted
+	Latencies []time.Duration
+}
+
+// Percentile returns the latency that p percent of requests came in under
+func (r *BenchResult) Percentile(p float64) time.Duration {
+	if len(r.Latencies) == 0 {
+		return 0
+	}
+	i := int(math.Ceil(p/100*float64(len(r.Latencies)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return r.Latencies[i]
+}
+
+// RequestsPerSecond returns the throughput of the test
+func (r *BenchResult) RequestsPerSecond() float64 {
+	if r.Duration == 0 {
+		return 0
+	}
+	return float64(r.Requests) / r.Duration.Seconds()
+}
+
+// benchURL makes requests requests for url, with concurrency requests in
+// flight at a time
+func benchURL(client *http.Client, url string, concurrency int, requests int) *BenchResult {
+	res := &BenchResult{Statuses: make(map[int]int)}
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	jobs := make(chan struct{})
+	start := time.Now()
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range jobs {
+				t := time.Now()
+				resp, err := client.Get(url)
+				var n int64
+				if err == nil {
+					n, err = io.Copy(ioutil.Discard, resp.Body)
+					resp.Body.Close()
+				}
+				elapsed := time.Since(t)
+				lock.Lock()
+				res.Requests++
+				if err != nil {
+					res.Errors++
+				} else {
+					res.Statuses[resp.StatusCode]++
+					res.Bytes += n
+					res.Latencies = append(res.Latencies, elapsed)
+				}
+				lock.Unlock()
+			}
+		}()
+	}
+	for i := 0; i < requests; i++ {
+		jobs <- struct{}{}
+	}
+	close(jobs)
+	wg.Wait()
+	res.Duration = time.Since(start)
+	sort.Slice(res.Latencies, func(i, j int) bool { return res.Latencies[i] < res.Latencies[j] })
+	return res
+}
+
+// Bench starts the server on a free local port, and load tests a path
+// through it. Requests go through everything a browser's would, including
+// latency and bandwidth shaping and livereload injection. Request logging
+// is turned off for the duration.
+func (dd *Devd) Bench(certFile string, path string, concurrency int, requests int) (*BenchResult, error) {
+	if concurrency < 1 || requests < 1 {
+		return nil, fmt.Errorf("Concurrency and number of requests must be at least 1")
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	logger := termlog.NewLog()
+	logger.Quiet()
+	server, hl, _, err := dd.listen("127.0.0.1", 0, certFile, logger)
+	if err != nil {
+		return nil, err
+	}
+	go server.Serve(hl)
+	defer func() {
+		server.Close()
+		dd.shutdown()
+	}()
+
+	scheme := "http"
+	if certFile != "" || len(dd.HostCerts) > 0 {
+		scheme = "https"
+	}
+	client := &http.Client{
+		Transport: &http.Transport{
+			MaxIdleConnsPerHost: concurrency,
+			TLSClientConfig:     &tls.Config{InsecureSkipVerify: true},
+		},
+		// Redirects are part of the response we're measuring
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	url := fmt.Sprintf("%s://%s%s", scheme, hl.Addr().String(), path)
+	return benchURL(client, url, concurrency, requests), nil
+}
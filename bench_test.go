@@ -0,0 +1,64 @@
+package devd
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPercentile(t *testing.T) {
+	res := &BenchResult{}
+	if res.Percentile(50) != 0 {
+		t.Error("Expected 0 for no latencies")
+	}
+	for i := 1; i <= 100; i++ {
+		res.Latencies = append(res.Latencies, time.Duration(i)*time.Millisecond)
+	}
+	var percentileTests = []struct {
+		p        float64
+		expected time.Duration
+	}{
+		{0, time.Millisecond},
+		{50, 50 * time.Millisecond},
+		{99, 99 * time.Millisecond},
+		{100, 100 * time.Millisecond},
+	}
+	for i, tt := range percentileTests {
+		if d := res.Percentile(tt.p); d != tt.expected {
+			t.Errorf("Test %d: expected %s, got %s", i, tt.expected, d)
+		}
+	}
+}
+
+func TestBenchURL(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "hello")
+	}))
+	defer ts.Close()
+	res := benchURL(http.DefaultClient, ts.URL, 4, 50)
+	if res.Requests != 50 || res.Errors != 0 || res.Statuses[200] != 50 || res.Bytes != 250 {
+		t.Errorf("Unexpected result: %#v", res)
+	}
+	if len(res.Latencies) != 50 || res.Latencies[0] > res.Latencies[49] {
+		t.Error("Expected sorted latencies for every request")
+	}
+}
+
+func TestBench(t *testing.T) {
+	dd := Devd{}
+	if err := dd.AddRoutes([]string{"./testdata"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dd.Bench("", "/", 0, 10); err == nil {
+		t.Error("Expected error for zero concurrency")
+	}
+	res, err := dd.Bench("", "nonexistent", 2, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Requests != 10 || res.Statuses[404] != 10 {
+		t.Errorf("Unexpected result: %#v", res)
+	}
+}
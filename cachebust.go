@@ -0,0 +1,222 @@
+package devd
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The query parameter that carries an asset's version
+const cacheBustParam = "v"
+
+// bustRefs rewrites the stylesheet and script URLs in an HTML document. The
+// version function returns a new URL for a reference, or false to leave it
+// as it is.
+func bustRefs(html []byte, version func(ref string) (string, bool)) []byte {
+	return assetTagRegexp.ReplaceAllFunc(html, func(tag []byte) []byte {
+		m := assetTagRegexp.FindSubmatchIndex(tag)
+		attrs := tag[m[4]:m[5]]
+		want := "src"
+		if strings.ToLower(string(tag[m[2]:m[3]])) == "link" {
+			rels := strings.Fields(strings.ToLower(tagAttrs(string(attrs))["rel"]))
+			want = ""
+			for _, rel := range rels {
+				if rel == "stylesheet" {
+					want = "href"
+				}
+			}
+			if want == "" {
+				return tag
+			}
+		}
+		for _, a := range attrRegexp.FindAllSubmatchIndex(attrs, -1) {
+			if strings.ToLower(string(attrs[a[2]:a[3]])) != want {
+				continue
+			}
+			// The value is in whichever of the quoted or bare groups matched
+			for g := 4; g < len(a); g += 2 {
+				if a[g] < 0 {
+					continue
+				}
+				ref, ok := version(string(attrs[a[g]:a[g+1]]))
+				if !ok {
+					return tag
+				}
+				start, end := m[4]+a[g], m[4]+a[g+1]
+				ret := append([]byte{}, tag[:start]...)
+				ret = append(ret, ref...)
+				return append(ret, tag[end:]...)
+			}
+		}
+		return tag
+	})
+}
+
+type fileVersion struct {
+	modTime time.Time
+	size    int64
+	hash    string
+}
+
+// assetVersions hashes the contents of asset files, re-hashing them only
+// when they change
+type assetVersions struct {
+	sync.Mutex
+	files map[string]fileVersion
+}
+
+func newAssetVersions() *assetVersions {
+	return &assetVersions{files: make(map[string]fileVersion)}
+}
+
+// version returns the hash of the file a static route serves at a path, or
+// false if no static route has a file there
+func (av *assetVersions) version(routes RouteCollection, host, urlPath string) (string, bool) {
+	f, err := routes.openStatic(host, urlPath)
+	if err != nil {
+		return "", false
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil || fi.IsDir() {
+		return "", false
+	}
+	key := host + urlPath
+	av.Lock()
+	v, ok := av.files[key]
+	av.Unlock()
+	if ok && v.modTime.Equal(fi.ModTime()) && v.size == fi.Size() {
+		return v.hash, true
+	}
+	h := sha1.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", false
+	}
+	v = fileVersion{fi.ModTime(), fi.Size(), hex.EncodeToString(h.Sum(nil))[:10]}
+	av.Lock()
+	av.files[key] = v
+	av.Unlock()
+	return v.hash, true
+}
+
+// cacheBust returns a version function for bustRefs, which adds a hash of
+// the file's contents to the URLs of assets served by static routes
+func (dd *Devd) cacheBust(r *http.Request, reqPath string) func(string) (string, bool) {
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = r.Host
+	}
+	return func(ref string) (string, bool) {
+		u, err := url.Parse(ref)
+		if err != nil {
+			return "", false
+		}
+		if u.Scheme != "" || u.Host != "" {
+			if (u.Scheme != "http" && u.Scheme != "https") || u.Host != r.Host {
+				return "", false
+			}
+		}
+		q := u.Query()
+		if _, ok := q[cacheBustParam]; ok {
+			return "", false
+		}
+		base := &url.URL{Path: reqPath}
+		target := base.ResolveReference(&url.URL{Path: u.Path})
+		hash, ok := dd.versions.version(dd.Routes, host, target.Path)
+		if !ok {
+			return "", false
+		}
+		head, frag := ref, ""
+		if i := strings.Index(ref, "#"); i >= 0 {
+			head, frag = ref[:i], ref[i:]
+		}
+		switch {
+		case !strings.Contains(head, "?"):
+			head += "?"
+		case !strings.HasSuffix(head, "?") && !strings.HasSuffix(head, "&"):
+			head += "&"
+		}
+		return head + cacheBustParam + "=" + hash + frag, true
+	}
+}
+
+// cacheBustWriter holds back HTML responses, and adds versions to the URLs
+// of their stylesheets and scripts once they're complete
+type cacheBustWriter struct {
+	http.ResponseWriter
+	version     func(string) (string, bool)
+	code        int
+	wroteHeader bool
+	held        bool
+	body        bytes.Buffer
+}
+
+func (cw *cacheBustWriter) WriteHeader(code int) {
+	if cw.wroteHeader {
+		return
+	}
+	if code >= 100 && code < 200 {
+		cw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	cw.wroteHeader = true
+	h := cw.Header()
+	if code == http.StatusOK && h.Get("Content-Encoding") == "" && isHTML(h) {
+		cw.code = code
+		cw.held = true
+		return
+	}
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+func (cw *cacheBustWriter) Write(data []byte) (int, error) {
+	if !cw.wroteHeader {
+		if cw.Header().Get("Content-Type") == "" {
+			cw.Header().Set("Content-Type", http.DetectContentType(data))
+		}
+		cw.WriteHeader(http.StatusOK)
+	}
+	if !cw.held {
+		return cw.ResponseWriter.Write(data)
+	}
+	return cw.body.Write(data)
+}
+
+// finish sends a held response. Its validators are dropped, since they
+// describe the page as it was before its asset URLs changed.
+func (cw *cacheBustWriter) finish() {
+	if !cw.held {
+		return
+	}
+	cw.held = false
+	body := bustRefs(cw.body.Bytes(), cw.version)
+	cw.Header().Del("ETag")
+	cw.Header().Del("Last-Modified")
+	cw.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	cw.ResponseWriter.WriteHeader(cw.code)
+	cw.ResponseWriter.Write(body)
+}
+
+// Flush does nothing until we know whether the response is held, and nothing
+// for held responses, which can't be sent until they're complete
+func (cw *cacheBustWriter) Flush() {
+	if !cw.wroteHeader || cw.held {
+		return
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (cw *cacheBustWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return hijack(cw.ResponseWriter)
+}
@@ -0,0 +1,109 @@
+package devd
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/GeertJohan/go.rice"
+	"github.com/cortesi/devd/ricetemp"
+	"github.com/cortesi/termlog"
+)
+
+var bustRefsTests = []struct {
+	html   string
+	expect string
+}{
+	{`<script src="a.js"></script>`, `<script src="a.js?v=1"></script>`},
+	{`<SCRIPT SRC='a.js'>`, `<SCRIPT SRC='a.js?v=1'>`},
+	{`<script src=a.js>`, `<script src=a.js?v=1>`},
+	{`<link rel="stylesheet" href="a.css">`, `<link rel="stylesheet" href="a.css?v=1">`},
+	{`<link href="a.css" rel="alternate stylesheet">`, `<link href="a.css?v=1" rel="alternate stylesheet">`},
+	{`<link rel="icon" href="a.ico">`, `<link rel="icon" href="a.ico">`},
+	{`<script>var x;</script>`, `<script>var x;</script>`},
+	{`<script src="other.js"></script>`, `<script src="other.js"></script>`},
+	{
+		`<link rel=stylesheet href=a.css><script src="b.js"></script>`,
+		`<link rel=stylesheet href=a.css?v=1><script src="b.js?v=1"></script>`,
+	},
+}
+
+func TestBustRefs(t *testing.T) {
+	version := func(ref string) (string, bool) {
+		if strings.HasPrefix(ref, "other") {
+			return "", false
+		}
+		return ref + "?v=1", true
+	}
+	for i, tt := range bustRefsTests {
+		if got := string(bustRefs([]byte(tt.html), version)); got != tt.expect {
+			t.Errorf("Test %d: expected %s, got %s", i, tt.expect, got)
+		}
+	}
+}
+
+func TestCacheBust(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "devdtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	files := map[string]string{
+		"app.js":        "one",
+		"css/style.css": "two",
+	}
+	for name, content := range files {
+		p := filepath.Join(tmp, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	page := `<link rel="stylesheet" href="../css/style.css?x=1#top">` +
+		`<script src="/app.js"></script>` +
+		`<script src="/missing.js"></script>` +
+		`<script src="https://cdn.example.com/app.js"></script>` +
+		`<script src="/app.js?v=old"></script>`
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("ETag", `"page"`)
+		w.Write([]byte(page))
+	}))
+	defer backend.Close()
+	logger := termlog.NewLog()
+	logger.Quiet()
+	templates := ricetemp.MustMakeTemplates(rice.MustFindBox("templates"))
+
+	devd := Devd{CacheBust: true}
+	if err := devd.AddRoutes([]string{"/=" + tmp, "/pages/=" + backend.URL}, nil); err != nil {
+		t.Fatal(err)
+	}
+	h, err := devd.Router(logger, templates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ht := handlerTester{t, h}
+	resp := ht.Request("GET", "/pages/index.html", nil)
+	expected := `<link rel="stylesheet" href="../css/style.css?x=1&v=ad782ecdac#top">` +
+		`<script src="/app.js?v=fe05bcdcdc"></script>` +
+		`<script src="/missing.js"></script>` +
+		`<script src="https://cdn.example.com/app.js"></script>` +
+		`<script src="/app.js?v=old"></script>`
+	if resp.Body.String() != expected {
+		t.Errorf("Expected %s, got %s", expected, resp.Body.String())
+	}
+	if resp.Header().Get("ETag") != "" {
+		t.Error("Expected the page's ETag to be dropped")
+	}
+
+	resp = ht.Request("GET", "/app.js?v=fe05bcdcdc", nil)
+	if resp.Code != 200 || resp.Body.String() != "one" {
+		t.Errorf("Expected the asset to be served, got %d %q", resp.Code, resp.Body.String())
+	}
+}
@@ -20,8 +20,17 @@ func TestGenerateCert(t *testing.T) {
 		t.Error(err)
 	}
 
-	_, err = getTLSConfig(dst)
+	_, err = getTLSConfig(dst, nil)
 	if err != nil {
 		t.Error(err)
 	}
+
+	cert, err := LoadCert(dst)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if len(cert.DNSNames) != 2 || cert.DNSNames[0] != "devd.io" {
+		t.Errorf("Unexpected DNS names: %v", cert.DNSNames)
+	}
 }
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/cortesi/devd"
+	"github.com/cortesi/termlog"
+	"github.com/dustin/go-humanize"
+)
+
+// runBench load tests a path, and prints a report
+func runBench(dd *devd.Devd, certFile string, path string, concurrency int, requests int, logger termlog.Logger) error {
+	logger.Say("Making %d requests for %s, %d at a time", requests, path, concurrency)
+	res, err := dd.Bench(certFile, path, concurrency, requests)
+	if err != nil {
+		return err
+	}
+	codes := []int{}
+	for c := range res.Statuses {
+		codes = append(codes, c)
+	}
+	sort.Ints(codes)
+	ms := func(d time.Duration) string {
+		return fmt.Sprintf("%.2fms", float64(d)/float64(time.Millisecond))
+	}
+
+	fmt.Printf("requests:    %d in %s (%d errors)\n", res.Requests, res.Duration.Round(time.Millisecond), res.Errors)
+	for _, c := range codes {
+		fmt.Printf("status:      %d x %d\n", c, res.Statuses[c])
+	}
+	fmt.Printf("throughput:  %.1f requests/s, %s/s\n",
+		res.RequestsPerSecond(),
+		humanize.Bytes(uint64(float64(res.Bytes)/res.Duration.Seconds())),
+	)
+	if len(res.Latencies) > 0 {
+		fmt.Printf("latency:     min %s, p50 %s, p90 %s, p99 %s, max %s\n",
+			ms(res.Latencies[0]),
+			ms(res.Percentile(50)),
+			ms(res.Percentile(90)),
+			ms(res.Percentile(99)),
+			ms(res.Latencies[len(res.Latencies)-1]),
+		)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os/exec"
+	"strings"
+
+	"github.com/toqueteos/webbrowser"
+)
+
+// browserURL works out the URL to open in the browser, given the serving URL
+// and an optional path or absolute URL.
+func browserURL(servingURL string, target string) string {
+	if target == "" {
+		return servingURL
+	}
+	if u, err := url.Parse(target); err == nil && u.IsAbs() {
+		return target
+	}
+	if !strings.HasPrefix(target, "/") {
+		target = "/" + target
+	}
+	return strings.TrimSuffix(servingURL, "/") + target
+}
+
+// withToken adds an access token to a URL, so that a browser opening it is let
+// in when --token is in use.
+func withToken(u string, token string) string {
+	if token == "" {
+		return u
+	}
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return u
+	}
+	q := parsed.Query()
+	q.Set("token", token)
+	parsed.RawQuery = q.Encode()
+	return parsed.String()
+}
+
+// splitCommand splits a command line into words on whitespace. Single or
+// double quotes group words containing spaces.
+func splitCommand(s string) ([]string, error) {
+	words := []string{}
+	var current strings.Builder
+	var quote rune
+	inWord := false
+	for _, c := range s {
+		switch {
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote != 0:
+			current.WriteRune(c)
+		case c == '"' || c == '\'':
+			quote = c
+			inWord = true
+		case c == ' ' || c == '\t':
+			if inWord {
+				words = append(words, current.String())
+				current.Reset()
+				inWord = false
+			}
+		default:
+			current.WriteRune(c)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote in %q", s)
+	}
+	if inWord {
+		words = append(words, current.String())
+	}
+	return words, nil
+}
+
+// launchBrowser opens a URL in the system default browser, or with a specified
+// browser command, which is passed the URL as its final argument.
+func launchBrowser(u string, browser string) error {
+	if browser == "" {
+		return webbrowser.Open(u)
+	}
+	args, err := splitCommand(browser)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("empty browser command")
+	}
+	return exec.Command(args[0], append(args[1:], u)...).Start()
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/cortesi/devd"
+)
+
+// regenerateCert replaces a self-signed certificate bundle with a fresh one.
+func regenerateCert(path string) error {
+	if err := devd.GenerateCert(path); err != nil {
+		return fmt.Errorf("Could not generate cert: %s", err)
+	}
+	fmt.Printf("Generated new certificate in %s\n", path)
+	return certInfo(path)
+}
+
+// certInfo prints the names and validity period of a certificate bundle.
+func certInfo(path string) error {
+	cert, err := devd.LoadCert(path)
+	if err != nil {
+		return fmt.Errorf("Could not read certificate: %s", err)
+	}
+	fmt.Printf("file:        %s\n", path)
+	fmt.Printf("names:       %s\n", strings.Join(cert.DNSNames, ", "))
+	fmt.Printf("not before:  %s\n", cert.NotBefore.Local().Format(time.RFC1123))
+	fmt.Printf("not after:   %s\n", cert.NotAfter.Local().Format(time.RFC1123))
+	if time.Now().After(cert.NotAfter) {
+		fmt.Printf("status:      expired - run \"devd cert regenerate\"\n")
+	} else {
+		fmt.Printf("status:      valid\n")
+	}
+	return nil
+}
+
+// certExpired checks whether the certificate in a bundle has expired. A
+// bundle that can't be read is treated as valid, so that the error surfaces
+// when the server loads it.
+func certExpired(path string) bool {
+	cert, err := devd.LoadCert(path)
+	if err != nil {
+		return false
+	}
+	return time.Now().After(cert.NotAfter)
+}
+
+// parseCerts splits the values given to --cert into the default certificate
+// bundle, and the bundles for particular hosts, which are given as HOST=PATH.
+func parseCerts(specs []string) (string, map[string]string, error) {
+	certFile := ""
+	var hosts map[string]string
+	for _, spec := range specs {
+		host, path := "", spec
+		if i := strings.Index(spec, "="); i >= 0 {
+			host, path = spec[:i], spec[i+1:]
+		}
+		fi, err := os.Stat(path)
+		if err != nil {
+			return "", nil, fmt.Errorf("Could not read certificate: %s", err)
+		}
+		if fi.IsDir() {
+			return "", nil, fmt.Errorf("Certificate is a directory: %s", path)
+		}
+		switch {
+		case host != "":
+			if hosts == nil {
+				hosts = make(map[string]string)
+			}
+			hosts[host] = path
+		case certFile != "":
+			return "", nil, fmt.Errorf("Only one certificate can be given without a host")
+		default:
+			certFile = path
+		}
+	}
+	return certFile, hosts, nil
+}
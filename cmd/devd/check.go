@@ -0,0 +1,221 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/cortesi/devd"
+	"github.com/cortesi/devd/livereload"
+	"github.com/cortesi/moddwatch/filter"
+)
+
+// checkConfig validates the parts of the configuration that are only
+// exercised once the server starts, and prints the fully resolved
+// configuration. It never binds a port.
+func checkConfig(dd *devd.Devd, address string, port int, certFile string, selfSigned bool) error {
+	errs := []string{}
+
+	fmt.Printf("address:     %s\n", address)
+	if port > 0 {
+		fmt.Printf("port:        %d\n", port)
+		if port > 65535 {
+			errs = append(errs, fmt.Sprintf("invalid port: %d", port))
+		}
+	} else {
+		fmt.Printf("port:        auto\n")
+	}
+
+	switch {
+	case selfSigned:
+		fmt.Printf("tls:         self-signed certificate (%s)\n", defaultDotfile(".devd.cert"))
+	case certFile != "":
+		fmt.Printf("tls:         %s\n", certFile)
+		if _, err := tls.LoadX509KeyPair(certFile, certFile); err != nil {
+			errs = append(errs, fmt.Sprintf("could not load certificate bundle %s: %s", certFile, err))
+		}
+	case len(dd.HostCerts) == 0:
+		fmt.Printf("tls:         off\n")
+	}
+	hosts := make([]string, 0, len(dd.HostCerts))
+	for h := range dd.HostCerts {
+		hosts = append(hosts, h)
+	}
+	sort.Strings(hosts)
+	for _, h := range hosts {
+		p := dd.HostCerts[h]
+		fmt.Printf("tls:         %s (%s)\n", p, h)
+		if _, err := tls.LoadX509KeyPair(p, p); err != nil {
+			errs = append(errs, fmt.Sprintf("could not load certificate bundle %s: %s", p, err))
+		}
+	}
+
+	matches := make([]string, 0, len(dd.Routes))
+	for m := range dd.Routes {
+		matches = append(matches, m)
+	}
+	sort.Strings(matches)
+	for _, m := range matches {
+		fmt.Printf("route:       %s -> %s\n", m, dd.Routes[m].Endpoint.String())
+	}
+	if dd.HasLivereload() && dd.NoInject {
+		fmt.Printf("livereload:  true, without injection\n")
+	} else {
+		fmt.Printf("livereload:  %v\n", dd.HasLivereload())
+	}
+	if dd.LegacyLivereload {
+		fmt.Printf("compat:      /livereload.js and port %d\n", livereload.LegacyPort)
+	}
+	for _, p := range dd.WatchPaths {
+		fmt.Printf("watch:       %s\n", p)
+		base, _ := filter.SplitPattern(p)
+		if _, err := os.Stat(base); err != nil {
+			errs = append(errs, fmt.Sprintf("watch path %s: %s", p, err))
+		}
+	}
+	for _, p := range dd.Excludes {
+		fmt.Printf("exclude:     %s\n", p)
+		if _, err := filter.MatchAny(p, []string{p}); err != nil {
+			errs = append(errs, fmt.Sprintf("exclude pattern %s: %s", p, err))
+		}
+	}
+	for _, n := range dd.Allow {
+		fmt.Printf("allow:       %s\n", n)
+	}
+	for _, n := range dd.Deny {
+		fmt.Printf("deny:        %s\n", n)
+	}
+	for _, n := range dd.TrustProxy {
+		fmt.Printf("trust proxy: %s\n", n)
+	}
+	if dd.AddHeaders != nil {
+		names := []string{}
+		for h := range *dd.AddHeaders {
+			names = append(names, h)
+		}
+		sort.Strings(names)
+		for _, h := range names {
+			for _, v := range (*dd.AddHeaders)[h] {
+				fmt.Printf("header:      %s: %s\n", h, v)
+			}
+		}
+	}
+	for _, c := range dd.SetCookies {
+		fmt.Printf("set cookie:  %s=%s\n", c.Name, c.Value)
+	}
+	for _, n := range dd.StripCookies {
+		fmt.Printf("strip cookie: %s\n", n)
+	}
+	for _, r := range dd.IgnoreLogs {
+		fmt.Printf("ignore:      %s\n", r)
+	}
+	fmt.Printf("latency:     %dms\n", dd.Latency)
+	for _, t := range dd.TTFB {
+		ct := t.ContentType
+		if ct == "" {
+			ct = "all responses"
+		}
+		fmt.Printf("ttfb:        %s after %s\n", ct, t.Delay)
+	}
+	fmt.Printf("throttle:    down %d kb/s, up %d kb/s (0 is unlimited)\n", dd.DownKbps, dd.UpKbps)
+	fmt.Printf("max body:    %d bytes (0 is unlimited)\n", dd.MaxBodySize)
+	fmt.Printf("preload:     %v\n", dd.Preload)
+	fmt.Printf("push:        %v\n", dd.Push)
+	fmt.Printf("pretty:      %v\n", dd.Pretty)
+	fmt.Printf("cache bust:  %v\n", dd.CacheBust)
+	if dd.SourceMaps != "" {
+		fmt.Printf("sourcemaps:  %s\n", dd.SourceMaps)
+	}
+	fmt.Printf("replay:      %d requests\n", dd.ReplayHistory)
+	fmt.Printf("cors:        %v\n", dd.Cors)
+	for _, o := range dd.CorsOrigins {
+		fmt.Printf("cors origin: %s\n", o)
+		if _, err := path.Match(o, ""); err != nil {
+			errs = append(errs, fmt.Sprintf("cors origin %s: %s", o, err))
+		}
+	}
+	if dd.CorsMethods != "" {
+		fmt.Printf("cors method: %s\n", dd.CorsMethods)
+	}
+	if dd.CorsHeaders != "" {
+		fmt.Printf("cors header: %s\n", dd.CorsHeaders)
+	}
+	if dd.CorsMaxAge > 0 {
+		fmt.Printf("cors maxage: %s\n", dd.CorsMaxAge)
+	}
+	if dd.CorsExpose != "" {
+		fmt.Printf("cors expose: %s\n", dd.CorsExpose)
+	}
+	fmt.Printf("password:    %v\n", dd.Credentials != nil)
+	if dd.LoginForm {
+		fmt.Printf("auth:        login form\n")
+		if dd.Credentials == nil && dd.Htpasswd == nil {
+			errs = append(errs, "--login-form needs --password or --htpasswd")
+		}
+	}
+	fmt.Printf("token:       %v\n", dd.Token != "")
+	if dd.AuthLockout > 0 {
+		fmt.Printf("lockout:     %s after %d failures\n", dd.AuthLockoutTime, dd.AuthLockout)
+	}
+	if dd.DigestAuth {
+		fmt.Printf("auth:        digest\n")
+		if dd.Credentials == nil || dd.Htpasswd != nil {
+			errs = append(errs, "--digest needs --password, and can't be used with --htpasswd")
+		}
+	}
+	if dd.Htpasswd != nil {
+		fmt.Printf("htpasswd:    %d users\n", len(dd.Htpasswd))
+	}
+	for _, f := range dd.Fallbacks {
+		scope := f.Scope
+		if scope == "" {
+			scope = "proxied routes"
+		}
+		fmt.Printf("fallback:    %s -> %s\n", scope, f.Root)
+	}
+	resolved := make([]string, 0, len(dd.Resolve))
+	for host := range dd.Resolve {
+		resolved = append(resolved, host)
+	}
+	sort.Strings(resolved)
+	for _, host := range resolved {
+		fmt.Printf("resolve:     %s -> %s\n", host, dd.Resolve[host])
+	}
+	if dd.UpstreamProxy != nil {
+		u := *dd.UpstreamProxy
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), "xxxxx")
+		}
+		fmt.Printf("upstream:    via %s\n", u.String())
+	}
+	for _, t := range dd.Transforms {
+		scope := t.Scope
+		if scope == "" {
+			scope = "all routes"
+		}
+		fmt.Printf("transform:   %s -> %s\n", scope, t.Command)
+	}
+	if dd.Hooks.OnStart != "" {
+		fmt.Printf("on start:    %s\n", dd.Hooks.OnStart)
+	}
+	if dd.Hooks.OnRequest != "" {
+		fmt.Printf("on request:  %s\n", dd.Hooks.OnRequest)
+	}
+	if dd.Hooks.OnReload != "" {
+		fmt.Printf("on reload:   %s\n", dd.Hooks.OnReload)
+	}
+
+	// The same check refuses to serve the configuration
+	if err := dd.Check(); err != nil {
+		errs = append(errs, err.Error())
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration:\n\t%s", strings.Join(errs, "\n\t"))
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Config files we look for in the working directory when devd is started
+// without arguments, in priority order.
+var configFiles = []string{"devd.conf", ".devd.yml"}
+
+// readArgsFile reads a devd.conf file. The format mirrors a command line: one
+// argument per line, with blank lines and lines starting with # ignored.
+// Files given to --routes-file use the same format, with a route per line.
+func readArgsFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	args := []string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		args = append(args, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return args, nil
+}
+
+// readYAMLFile reads a .devd.yml file. Keys are long flag names, and the
+// special key "routes" holds a list of route specifications. For example:
+//
+//     livewatch: true
+//     port: 8000
+//     exclude: ["**.less"]
+//     routes:
+//       - ./static
+//       - /api/=http://localhost:8888
+func readYAMLFile(path string) ([]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	conf := map[string]interface{}{}
+	if err := yaml.Unmarshal(data, &conf); err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(conf))
+	for k := range conf {
+		if k != "routes" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	args := []string{}
+	for _, k := range keys {
+		switch v := conf[k].(type) {
+		case bool:
+			if v {
+				args = append(args, "--"+k)
+			} else {
+				args = append(args, "--no-"+k)
+			}
+		case []interface{}:
+			for _, i := range v {
+				args = append(args, fmt.Sprintf("--%s=%v", k, i))
+			}
+		case nil:
+		default:
+			args = append(args, fmt.Sprintf("--%s=%v", k, v))
+		}
+	}
+	switch v := conf["routes"].(type) {
+	case []interface{}:
+		for _, i := range v {
+			args = append(args, fmt.Sprint(i))
+		}
+	case nil:
+	default:
+		args = append(args, fmt.Sprint(v))
+	}
+	return args, nil
+}
+
+// discoverConfig looks for a project-local config file in the working
+// directory. It returns the arguments it specifies and the file name, or an
+// empty file name if no config file exists.
+func discoverConfig() ([]string, string, error) {
+	for _, name := range configFiles {
+		if _, err := os.Stat(name); err != nil {
+			continue
+		}
+		var args []string
+		var err error
+		if strings.HasSuffix(name, ".yml") {
+			args, err = readYAMLFile(name)
+		} else {
+			args, err = readArgsFile(name)
+		}
+		if err != nil {
+			return nil, name, fmt.Errorf("Could not read %s: %s", name, err)
+		}
+		return args, name, nil
+	}
+	return nil, "", nil
+}
+
+// serveAfterDashes makes "--" mark the start of the routes for the default
+// serve command, so that "devd -- stop" serves a directory named stop rather
+// than running the stop command. Kingpin matches command names even after
+// "--", so we name the serve command explicitly, unless one of commands
+// already comes before the dashes.
+func serveAfterDashes(args []string, commands []string) []string {
+	for i, a := range args {
+		if a == "--" {
+			ret := append([]string{}, args[:i]...)
+			ret = append(ret, "serve")
+			return append(ret, args[i:]...)
+		}
+		for _, c := range commands {
+			if a == c {
+				return args
+			}
+		}
+	}
+	return args
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/go-homedir"
+)
+
+// How long we watch a freshly started daemon for early exits, e.g. due to a
+// port that's already in use.
+const daemonStartupWait = time.Millisecond * 500
+
+// daemonChildEnv is set in the environment of the background process, so it
+// knows not to daemonize again.
+const daemonChildEnv = "DEVD_DAEMON_CHILD"
+
+// defaultDotfile returns the path to a dotfile in the user's home directory,
+// falling back to the working directory if the home directory is unknown.
+func defaultDotfile(name string) string {
+	home, err := homedir.Dir()
+	if err != nil {
+		return name
+	}
+	return path.Join(home, name)
+}
+
+// startDaemon re-executes devd with the same arguments in the background,
+// detached from the terminal, with output sent to logFile. The pid of the
+// background process is written to pidFile.
+func startDaemon(args []string, pidFile string, logFile string) error {
+	if pid, err := readPidFile(pidFile); err == nil && processAlive(pid) {
+		return fmt.Errorf("devd is already running with pid %d (%s)", pid, pidFile)
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("Could not find devd executable: %s", err)
+	}
+	logf, err := os.OpenFile(logFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("Could not open log file: %s", err)
+	}
+	defer logf.Close()
+
+	cmd := exec.Command(exe, args...)
+	cmd.Env = append(os.Environ(), daemonChildEnv+"=1")
+	cmd.Stdout = logf
+	cmd.Stderr = logf
+	cmd.SysProcAttr = detachedProcAttr()
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("Could not start daemon: %s", err)
+	}
+
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+	select {
+	case err := <-exited:
+		return fmt.Errorf("devd exited on startup (%v) - see %s", err, logFile)
+	case <-time.After(daemonStartupWait):
+	}
+
+	pid := cmd.Process.Pid
+	err = ioutil.WriteFile(pidFile, []byte(strconv.Itoa(pid)+"\n"), 0644)
+	if err != nil {
+		return fmt.Errorf("Could not write pid file: %s", err)
+	}
+	fmt.Printf("devd running in the background with pid %d, logging to %s\n", pid, logFile)
+	return nil
+}
+
+func readPidFile(pidFile string) (int, error) {
+	data, err := ioutil.ReadFile(pidFile)
+	if err != nil {
+		return 0, err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, fmt.Errorf("Invalid pid file %s: %s", pidFile, err)
+	}
+	return pid, nil
+}
+
+// stopDaemon terminates the daemon recorded in pidFile, and removes the pid
+// file.
+func stopDaemon(pidFile string) error {
+	pid, err := readPidFile(pidFile)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("devd is not running (no pid file at %s)", pidFile)
+	} else if err != nil {
+		return err
+	}
+	if processAlive(pid) {
+		if err := terminateProcess(pid); err != nil {
+			return fmt.Errorf("Could not stop devd with pid %d: %s", pid, err)
+		}
+		fmt.Printf("Stopped devd with pid %d\n", pid)
+	} else {
+		fmt.Printf("devd with pid %d was not running\n", pid)
+	}
+	return os.Remove(pidFile)
+}
+
+// daemonStatus reports whether the daemon recorded in pidFile is running, and
+// returns an error if it isn't.
+func daemonStatus(pidFile string) error {
+	pid, err := readPidFile(pidFile)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("devd is not running")
+	} else if err != nil {
+		return err
+	}
+	if !processAlive(pid) {
+		return fmt.Errorf("devd is not running (stale pid file %s)", pidFile)
+	}
+	fmt.Printf("devd is running with pid %d\n", pid)
+	return nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+const detachedProcess = 0x00000008
+
+// detachedProcAttr starts the daemon without a console, in its own process
+// group, so that it survives the console it was started from.
+func detachedProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{
+		CreationFlags: detachedProcess | syscall.CREATE_NEW_PROCESS_GROUP,
+	}
+}
+
+// On Windows, FindProcess opens a handle to the process, and fails if it
+// doesn't exist.
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	_ = p.Release()
+	return true
+}
+
+func terminateProcess(pid int) error {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return p.Kill()
+}
@@ -1,14 +1,18 @@
 package main
 
 import (
-	"net/http"
+	"context"
 	"os"
+	"os/signal"
 	"path"
+	"path/filepath"
+	"syscall"
 
+	"github.com/atotto/clipboard"
 	"github.com/cortesi/devd"
 	"github.com/cortesi/termlog"
+	"github.com/fatih/color"
 	"github.com/mitchellh/go-homedir"
-	"github.com/toqueteos/webbrowser"
 	"gopkg.in/alecthomas/kingpin.v2"
 )
 
@@ -22,10 +26,10 @@ func main() {
 		Short('a').
 		Bool()
 
-	certFile := kingpin.Flag("cert", "Certificate bundle file - enables TLS").
+	certs := kingpin.Flag("cert", "Certificate bundle file - enables TLS. Give HOST=PATH to use a bundle for one host, picked by SNI").
 		Short('c').
-		PlaceHolder("PATH").
-		ExistingFile()
+		PlaceHolder("[HOST=]PATH").
+		Strings()
 
 	forceColor := kingpin.Flag("color", "Enable colour output, even if devd is not connected to a terminal").
 		Short('C').
@@ -40,8 +44,12 @@ func main() {
 		Default("0").
 		Uint()
 
-	notfound := kingpin.Flag("notfound", "Default when a static file is not found").
-		PlaceHolder("PATH").
+	routesFile := kingpin.Flag("routes-file", "Read routes from a file, one per line, as well as from the command line").
+		PlaceHolder("FILE").
+		String()
+
+	notfound := kingpin.Flag("notfound", "Default when a static file is not found - prefix with ROUTE@ to apply to one route").
+		PlaceHolder("[ROUTE@]SPEC").
 		Short('f').
 		Strings()
 
@@ -52,10 +60,10 @@ func main() {
 
 	ignoreLogs := kingpin.Flag(
 		"ignore",
-		"Disable logging matching requests. Regexes are matched over 'host/path'",
+		"Disable logging matching requests. Regexes are matched over 'host/path', optionally with a method before and a status like 200 or 4xx after",
 	).
 		Short('I').
-		PlaceHolder("REGEX").
+		PlaceHolder("[METHOD] REGEX [STATUS]").
 		Strings()
 
 	livereloadNaked := kingpin.Flag("livereload", "Enable livereload").
@@ -63,6 +71,20 @@ func main() {
 		Default("false").
 		Bool()
 
+	noInject := kingpin.Flag(
+		"no-inject",
+		"Serve the livereload endpoints, but don't inject the script - for pages that load /.devd.livereload.js themselves",
+	).
+		Default("false").
+		Bool()
+
+	legacyLivereload := kingpin.Flag(
+		"livereload-compat",
+		"Also serve the classic LiveReload client at /livereload.js and accept connections on port 35729",
+	).
+		Default("false").
+		Bool()
+
 	livereloadRoutes := kingpin.Flag("livewatch", "Enable livereload and watch for static file changes").
 		Short('l').
 		Default("false").
@@ -78,11 +100,42 @@ func main() {
 		Default("0").
 		Int()
 
+	ttfb := kingpin.Flag(
+		"ttfb",
+		"Hold up response headers for N milliseconds - prefix with TYPE= to apply to one content type, like text/html or image/*",
+	).
+		PlaceHolder("[TYPE=]N").
+		Strings()
+
 	openBrowser := kingpin.Flag("open", "Open browser window on startup").
 		Short('o').
 		Default("false").
 		Bool()
 
+	openPath := kingpin.Flag("open-path", "Open browser window at a path or URL on startup - implies --open").
+		PlaceHolder("PATH").
+		String()
+
+	browser := kingpin.Flag("browser", "Browser command used to open URLs, e.g. \"firefox --private-window\"").
+		PlaceHolder("CMD").
+		String()
+
+	copyURL := kingpin.Flag("copy-url", "Copy the serving URL to the clipboard on startup").
+		Default("false").
+		Bool()
+
+	tunnelSpec := kingpin.Flag("tunnel", "Expose devd publicly through an SSH reverse tunnel to a relay host").
+		PlaceHolder("[USER@]HOST[:PORT]").
+		String()
+
+	tunnelInsecure := kingpin.Flag("tunnel-insecure", "Accept tunnel relays that aren't in ~/.ssh/known_hosts, with a warning").
+		Default("false").
+		Bool()
+
+	showQR := kingpin.Flag("qr", "Show a QR code of the serving URL on startup, when attached to a terminal").
+		Default("false").
+		Bool()
+
 	port := kingpin.Flag(
 		"port",
 		"Port to listen on - if not specified, devd will auto-pick a sensible port",
@@ -98,6 +151,236 @@ func main() {
 		Short('P').
 		String()
 
+	htpasswd := kingpin.Flag(
+		"htpasswd",
+		"HTTP basic password protection with an htpasswd file (bcrypt, MD5 or SHA)",
+	).
+		PlaceHolder("FILE").
+		ExistingFile()
+
+	loginForm := kingpin.Flag(
+		"login-form",
+		"Let browsers log in with a form and session cookie instead of an auth dialog",
+	).
+		Default("false").
+		Bool()
+
+	token := kingpin.Flag(
+		"token",
+		"Require a bearer token - browsers can pass it once with ?token=TOKEN",
+	).
+		PlaceHolder("TOKEN").
+		String()
+
+	allow := kingpin.Flag(
+		"allow",
+		"Only allow clients in this CIDR range or IP address (repeatable) - loopback is always allowed",
+	).
+		PlaceHolder("CIDR").
+		Strings()
+
+	deny := kingpin.Flag("deny", "Refuse clients in this CIDR range or IP address (repeatable)").
+		PlaceHolder("CIDR").
+		Strings()
+
+	trustProxy := kingpin.Flag(
+		"trust-proxy",
+		"Trust X-Forwarded-For, -Host and -Proto from proxies in this CIDR range or IP address (repeatable)",
+	).
+		PlaceHolder("CIDR").
+		Strings()
+
+	headers := kingpin.Flag(
+		"header",
+		"Add a header to every response (repeatable) - the value can use {{path}}, {{host}}, {{method}}, {{timestamp}} and {{uuid}}",
+	).
+		PlaceHolder("NAME:VALUE").
+		Strings()
+
+	setCookies := kingpin.Flag("set-cookie", "Set a cookie on every response (repeatable)").
+		PlaceHolder("NAME=VALUE").
+		Strings()
+
+	stripCookies := kingpin.Flag(
+		"strip-cookie",
+		"Remove a cookie from requests before they reach static files or upstreams (repeatable)",
+	).
+		PlaceHolder("NAME").
+		Strings()
+
+	maxBodySize := kingpin.Flag("max-body-size", "Refuse request bodies larger than this with a 413, e.g. 10MB").
+		PlaceHolder("SIZE").
+		Default("0").
+		Bytes()
+
+	inFlightNotice := kingpin.Flag(
+		"inflight-notice",
+		"Note requests that are still running after this long, and again each time the wait doubles - 0 turns this off",
+	).
+		PlaceHolder("DURATION").
+		Default(devd.DefaultInFlightNotice.String()).
+		Duration()
+
+	serverTiming := kingpin.Flag(
+		"server-timing",
+		"Add a Server-Timing header to responses, showing devd's timings in browser developer tools",
+	).
+		Default("false").
+		Bool()
+
+	noKeepAlive := kingpin.Flag(
+		"no-keepalive",
+		"Close each connection after one response, rather than keeping it open for more requests",
+	).
+		Default("false").
+		Bool()
+
+	authLockout := kingpin.Flag(
+		"auth-lockout",
+		"Refuse clients for --auth-lockout-time after this many authentication failures",
+	).
+		PlaceHolder("N").
+		Default("0").
+		Int()
+
+	authLockoutTime := kingpin.Flag("auth-lockout-time", "How long --auth-lockout refuses clients for").
+		PlaceHolder("DURATION").
+		Default("10m").
+		Duration()
+
+	digest := kingpin.Flag(
+		"digest",
+		"Use HTTP digest rather than basic authentication for --password",
+	).
+		Default("false").
+		Bool()
+
+	preload := kingpin.Flag(
+		"preload",
+		"Add Link preload headers for stylesheets and scripts in HTML, and send 103 Early Hints",
+	).
+		Default("false").
+		Bool()
+
+	push := kingpin.Flag(
+		"push",
+		"Push stylesheets and scripts in HTML to HTTP/2 clients (needs TLS)",
+	).
+		Default("false").
+		Bool()
+
+	pretty := kingpin.Flag(
+		"pretty",
+		"Re-indent JSON and XML responses",
+	).
+		Default("false").
+		Bool()
+
+	cacheBust := kingpin.Flag(
+		"cache-bust",
+		"Add a hash of their contents to the URLs of local stylesheets and scripts in HTML pages",
+	).
+		Default("false").
+		Bool()
+
+	sourceMaps := kingpin.Flag(
+		"sourcemaps",
+		"Block source maps, as production sites often do, or serve them and add SourceMap headers to scripts and stylesheets",
+	).
+		PlaceHolder("block|serve").
+		Enum(devd.SourceMapsBlock, devd.SourceMapsServe)
+
+	onRequest := kingpin.Flag(
+		"on-request",
+		"Run a shell command after each request, with a JSON description on stdin",
+	).
+		PlaceHolder("CMD").
+		String()
+
+	onReload := kingpin.Flag(
+		"on-reload",
+		"Run a shell command on each livereload, with a JSON description on stdin",
+	).
+		PlaceHolder("CMD").
+		String()
+
+	faviconLetter := kingpin.Flag(
+		"favicon-letter",
+		"When a site has no favicon, serve one with the first letter of the current directory's name, rather than devd's",
+	).
+		Default("false").
+		Bool()
+
+	replay := kingpin.Flag(
+		"replay",
+		"Keep recent requests, and replay them by typing r and enter, or through /.devd/replay",
+	).
+		Default("false").
+		Bool()
+
+	remoteControl := kingpin.Flag(
+		"remote-control",
+		"Let other machines use devd's control endpoints, like /.devd/replay and /.devd/events",
+	).
+		Default("false").
+		Bool()
+
+	waterfall := kingpin.Flag(
+		"waterfall",
+		"Log a summary of the requests made by each page, once it has finished loading",
+	).
+		Default("false").
+		Bool()
+
+	countTraffic := kingpin.Flag(
+		"traffic",
+		"Count the bytes going in and out of each route and path, serve the totals at /.devd/stats, and log them on exit",
+	).
+		Default("false").
+		Bool()
+
+	pinRecent := kingpin.Flag(
+		"pin-recent",
+		"List files changed in the last few minutes first in directory listings",
+	).
+		Default("false").
+		Bool()
+
+	fallbacks := kingpin.Flag(
+		"fallback",
+		"Serve files from a directory when a proxied route's upstream returns 404 - prefix with ROUTE@ to apply to one route",
+	).
+		PlaceHolder("[ROUTE@]DIR").
+		Strings()
+
+	resolves := kingpin.Flag(
+		"resolve",
+		"Connect proxied routes to ADDR in place of HOST:PORT, overriding DNS",
+	).
+		PlaceHolder("HOST:PORT:ADDR").
+		Strings()
+
+	upstreamProxy := kingpin.Flag(
+		"upstream-proxy",
+		"Reach proxied routes' upstream servers through an http:// or socks5:// proxy",
+	).
+		PlaceHolder("URL").
+		String()
+
+	transforms := kingpin.Flag(
+		"transform",
+		"Rewrite requests and responses with an external shell command, run twice per request, that edits a JSON description - prefix with ROUTE@ to apply to one route",
+	).
+		PlaceHolder("[ROUTE@]CMD").
+		Strings()
+
+	onStart := kingpin.Flag(
+		"on-start",
+		"Run a shell command once the server is listening, with a JSON description on stdin",
+	).
+		PlaceHolder("CMD").
+		String()
+
 	quiet := kingpin.Flag("quiet", "Silence all logs").
 		Short('q').
 		Default("false").
@@ -113,6 +396,25 @@ func main() {
 		Default("false").
 		Bool()
 
+	timeFormat := kingpin.Flag(
+		"time-format",
+		"Layout for log timestamps, written the Go way, e.g. \"2006-01-02 15:04:05.000\"",
+	).
+		PlaceHolder("LAYOUT").
+		Default("15:04:05").
+		String()
+
+	utc := kingpin.Flag("utc", "Show log timestamps in UTC rather than local time").
+		Default("false").
+		Bool()
+
+	noTruncate := kingpin.Flag(
+		"no-truncate",
+		"Log long URLs and header values in full, rather than shortening them to fit the terminal",
+	).
+		Default("false").
+		Bool()
+
 	logTime := kingpin.Flag("logtime", "Log timing").
 		Short('T').
 		Default("false").
@@ -137,6 +439,36 @@ func main() {
 		Default("false").
 		Bool()
 
+	corsOrigins := kingpin.Flag(
+		"cors-origin",
+		"Only allow this CORS origin, which may contain * wildcards (repeatable, implies -X)",
+	).
+		PlaceHolder("ORIGIN").
+		Strings()
+
+	corsMethods := kingpin.Flag(
+		"cors-methods",
+		"Comma-separated methods allowed by CORS preflights (default: whatever is requested)",
+	).
+		PlaceHolder("LIST").
+		String()
+
+	corsHeaders := kingpin.Flag(
+		"cors-headers",
+		"Comma-separated headers allowed by CORS preflights (default: whatever is requested)",
+	).
+		PlaceHolder("LIST").
+		String()
+
+	corsMaxAge := kingpin.Flag("cors-max-age", "How long browsers may cache CORS preflights").
+		PlaceHolder("DURATION").
+		Default("0s").
+		Duration()
+
+	corsExpose := kingpin.Flag("cors-expose", "Comma-separated response headers that CORS scripts may read").
+		PlaceHolder("LIST").
+		String()
+
 	excludes := kingpin.Flag("exclude", "Glob pattern for files to exclude from livereload").
 		PlaceHolder("PATTERN").
 		Short('x').
@@ -146,7 +478,42 @@ func main() {
 		Default("false").
 		Bool()
 
-	routes := kingpin.Arg(
+	daemon := kingpin.Flag("daemon", "Detach and run in the background, logging to --logfile").
+		Short('D').
+		Default("false").
+		Bool()
+
+	exitOnStdinClose := kingpin.Flag(
+		"exit-on-stdin-close",
+		"Shut down when stdin is closed, so devd doesn't outlive the process that started it",
+	).
+		Default("false").
+		Bool()
+
+	pidFile := kingpin.Flag("pidfile", "Pid file for daemon mode, used by the stop and status commands").
+		PlaceHolder("PATH").
+		Default(defaultDotfile(".devd.pid")).
+		String()
+
+	logFile := kingpin.Flag("logfile", "Log file for daemon mode").
+		PlaceHolder("PATH").
+		Default(defaultDotfile(".devd.log")).
+		String()
+
+	check := kingpin.Flag("check", "Validate the configuration, print it and exit without serving").
+		Default("false").
+		Bool()
+
+	serviceDir := kingpin.Flag("service-dir", "Working directory when run as an installed service").
+		Hidden().
+		String()
+
+	serve := kingpin.Command(
+		"serve",
+		"Serve routes (the default command) - put routes named like a command after --",
+	).Default()
+
+	routes := serve.Arg(
 		"route",
 		`Routes have the following forms:
 			[SUBDOMAIN]/<PATH>=<DIR>
@@ -154,12 +521,167 @@ func main() {
 			<DIR>
 			<URL>
 		`,
-	).Required().Strings()
+	).Envar("DEVD_ROUTES").Strings()
+
+	export := kingpin.Command("export", "Crawl the routes and write the site to a directory, reporting broken links")
+	exportDir := export.Arg("outdir", "Directory to write the site to").Required().String()
+	exportRoutes := export.Arg("route", "Routes to export, as for the serve command").Strings()
+
+	bench := kingpin.Command("bench", "Load test a path through the configured routes, and report latencies")
+	benchPath := bench.Arg("path", "URL path to request").Required().String()
+	benchRoutes := bench.Arg("route", "Routes to serve, as for the serve command").Strings()
+	benchConcurrency := bench.Flag("concurrency", "Number of requests in flight at once").
+		PlaceHolder("N").
+		Default("10").
+		Int()
+	benchRequests := bench.Flag("requests", "Total number of requests").
+		PlaceHolder("N").
+		Default("200").
+		Int()
+
+	stop := kingpin.Command("stop", "Stop a devd running in daemon mode")
+
+	status := kingpin.Command("status", "Show whether a devd is running in daemon mode")
+
+	cert := kingpin.Command("cert", "Manage the self-signed certificate used by --tls")
+	certRegenerate := cert.Command("regenerate", "Generate a new self-signed certificate")
+	certShow := cert.Command("info", "Show the names and expiry date of a certificate")
+
+	service := kingpin.Command("service", "Run devd as a background service that survives reboots (macOS and Windows)")
+	serviceInstall := service.Command("install", "Install a service serving the given routes, with the current flags")
+	serviceInstall.Arg("route", "Routes to serve, as for the serve command").Required().Strings()
+	serviceUninstall := service.Command("uninstall", "Stop and remove the installed service")
+
+	doctor := kingpin.Command("doctor", "Check for common problems with DNS, ports, file watching, certificates and LAN access")
+
+	version := kingpin.Command("version", "Show build information")
+	versionUpdate := version.Flag("update", "Also check for a newer release").Bool()
 
 	kingpin.CommandLine.HelpFlag.Short('h')
 	kingpin.Version(devd.Version)
 
-	kingpin.Parse()
+	// Every flag can also be set through a DEVD_* environment variable, e.g.
+	// DEVD_PORT=8000 or DEVD_LIVEWATCH=true.
+	kingpin.CommandLine.Name = "devd"
+	kingpin.CommandLine.DefaultEnvars()
+	kingpin.CommandLine.HelpFlag.NoEnvar()
+	kingpin.CommandLine.VersionFlag.NoEnvar()
+
+	args := os.Args[1:]
+	var configFile string
+	if len(args) == 0 {
+		var err error
+		args, configFile, err = discoverConfig()
+		if err != nil {
+			kingpin.Fatalf("%s", err)
+		}
+	}
+	commands := []string{}
+	for _, c := range kingpin.CommandLine.Model().Commands {
+		commands = append(commands, c.Name)
+	}
+	args = serveAfterDashes(args, commands)
+	command := kingpin.MustParse(kingpin.CommandLine.Parse(args))
+
+	certFile, hostCerts, err := parseCerts(*certs)
+	if err != nil {
+		kingpin.Fatalf("%s", err)
+	}
+
+	switch command {
+	case stop.FullCommand():
+		if err := stopDaemon(*pidFile); err != nil {
+			kingpin.Fatalf("%s", err)
+		}
+		return
+	case status.FullCommand():
+		if err := daemonStatus(*pidFile); err != nil {
+			kingpin.Fatalf("%s", err)
+		}
+		return
+	case certRegenerate.FullCommand():
+		if err := regenerateCert(defaultDotfile(".devd.cert")); err != nil {
+			kingpin.Fatalf("%s", err)
+		}
+		return
+	case certShow.FullCommand():
+		dst := certFile
+		if dst == "" {
+			dst = defaultDotfile(".devd.cert")
+		}
+		if err := certInfo(dst); err != nil {
+			kingpin.Fatalf("%s", err)
+		}
+		return
+	case serviceInstall.FullCommand():
+		sargs, err := serviceArgs(args, *logFile)
+		if err != nil {
+			kingpin.Fatalf("%s", err)
+		}
+		if err := installService(sargs, *logFile); err != nil {
+			kingpin.Fatalf("%s", err)
+		}
+		return
+	case doctor.FullCommand():
+		addr := *address
+		if *allInterfaces {
+			addr = "0.0.0.0"
+		}
+		if err := runDoctor(addr, *port, certFile, hostCerts, *tls); err != nil {
+			kingpin.Fatalf("%s", err)
+		}
+		return
+	case version.FullCommand():
+		printVersion()
+		if *versionUpdate {
+			if err := checkLatest(); err != nil {
+				kingpin.Fatalf("%s", err)
+			}
+		}
+		return
+	case serviceUninstall.FullCommand():
+		if err := uninstallService(); err != nil {
+			kingpin.Fatalf("%s", err)
+		}
+		return
+	}
+
+	switch command {
+	case export.FullCommand():
+		routes = exportRoutes
+	case bench.FullCommand():
+		routes = benchRoutes
+	}
+	if *routesFile != "" {
+		fileRoutes, err := readArgsFile(*routesFile)
+		if err != nil {
+			kingpin.Fatalf("Could not read routes file: %s", err)
+		}
+		*routes = append(fileRoutes, *routes...)
+	}
+	if len(*routes) == 0 {
+		kingpin.Fatalf("no routes given - pass them as arguments, or with --routes-file")
+	}
+
+	if *serviceDir != "" {
+		if err := enterServiceDir(*serviceDir); err != nil {
+			kingpin.Fatalf("%s", err)
+		}
+		if err := runService(*logFile); err != nil {
+			kingpin.Fatalf("%s", err)
+		}
+	}
+
+	if *daemon && *exitOnStdinClose {
+		kingpin.Fatalf("--exit-on-stdin-close can't be used with --daemon, which has no stdin")
+	}
+
+	if *daemon && !*check && os.Getenv(daemonChildEnv) == "" {
+		if err := startDaemon(args, *pidFile, *logFile); err != nil {
+			kingpin.Fatalf("%s", err)
+		}
+		return
+	}
 
 	if *moddMode {
 		*forceColor = true
@@ -182,9 +704,13 @@ func main() {
 		}
 	}
 
-	hdrs := make(http.Header)
-	if *cors {
-		hdrs.Set("Access-Control-Allow-Credentials", "true")
+	var htpasswdUsers devd.Htpasswd
+	if *htpasswd != "" {
+		var err error
+		htpasswdUsers, err = devd.HtpasswdFromFile(*htpasswd)
+		if err != nil {
+			kingpin.Fatalf("Could not read htpasswd file: %s", err)
+		}
 	}
 
 	var servingScheme string
@@ -201,27 +727,119 @@ func main() {
 		UpKbps:        *upKbps,
 		ServingScheme: servingScheme,
 
-		AddHeaders: &hdrs,
-
 		// Livereload
 		LivereloadRoutes: *livereloadRoutes,
 		Livereload:       *livereloadNaked,
+		NoInject:         *noInject,
+		LegacyLivereload: *legacyLivereload,
 		WatchPaths:       *watch,
 		Excludes:         *excludes,
 
-		Cors: *cors,
-
-		Credentials: creds,
+		Cors:        *cors || len(*corsOrigins) > 0,
+		CorsOrigins: *corsOrigins,
+		CorsMethods: *corsMethods,
+		CorsHeaders: *corsHeaders,
+		CorsMaxAge:  *corsMaxAge,
+		CorsExpose:  *corsExpose,
+
+		Credentials:    creds,
+		Htpasswd:       htpasswdUsers,
+		DigestAuth:     *digest,
+		LoginForm:      *loginForm,
+		Token:          *token,
+		MaxBodySize:    int64(*maxBodySize),
+		NoKeepAlive:    *noKeepAlive,
+		InFlightNotice: *inFlightNotice,
+		ServerTiming:   *serverTiming,
+		Preload:        *preload,
+		Push:           *push,
+		Pretty:         *pretty,
+		CacheBust:      *cacheBust,
+		SourceMaps:     *sourceMaps,
+		Waterfall:      *waterfall,
+		CountTraffic:   *countTraffic,
+		PinRecent:      *pinRecent,
+		RemoteControl:  *remoteControl,
+		HostCerts:      hostCerts,
+
+		AuthLockout:     *authLockout,
+		AuthLockoutTime: *authLockoutTime,
+
+		Hooks: devd.Hooks{
+			OnRequest: *onRequest,
+			OnReload:  *onReload,
+			OnStart:   *onStart,
+		},
 	}
 
 	if err := dd.AddRoutes(*routes, *notfound); err != nil {
 		kingpin.Fatalf("%s", err)
 	}
 
+	if err := dd.AddTransforms(*transforms); err != nil {
+		kingpin.Fatalf("%s", err)
+	}
+
+	if err := dd.AddFallbacks(*fallbacks); err != nil {
+		kingpin.Fatalf("%s", err)
+	}
+
+	if err := dd.AddTTFBs(*ttfb); err != nil {
+		kingpin.Fatalf("%s", err)
+	}
+
+	if err := dd.AddResolves(*resolves); err != nil {
+		kingpin.Fatalf("%s", err)
+	}
+
+	if *upstreamProxy != "" {
+		u, err := devd.ParseUpstreamProxy(*upstreamProxy)
+		if err != nil {
+			kingpin.Fatalf("%s", err)
+		}
+		dd.UpstreamProxy = u
+	}
+
+	if *replay {
+		dd.ReplayHistory = devd.DefaultReplayHistory
+	}
+
+	if *faviconLetter {
+		wd, err := os.Getwd()
+		if err != nil {
+			kingpin.Fatalf("%s", err)
+		}
+		dd.FaviconName = filepath.Base(wd)
+	}
+
 	if err := dd.AddIgnores(*ignoreLogs); err != nil {
 		kingpin.Fatalf("%s", err)
 	}
 
+	if err := dd.AddIPFilters(*allow, *deny); err != nil {
+		kingpin.Fatalf("%s", err)
+	}
+
+	if err := dd.AddTrustedProxies(*trustProxy); err != nil {
+		kingpin.Fatalf("%s", err)
+	}
+
+	if err := dd.AddHeaderSpecs(*headers); err != nil {
+		kingpin.Fatalf("%s", err)
+	}
+
+	if err := dd.AddSetCookies(*setCookies); err != nil {
+		kingpin.Fatalf("%s", err)
+	}
+	dd.StripCookies = *stripCookies
+
+	if *check {
+		if err := checkConfig(&dd, realAddr, *port, certFile, *tls); err != nil {
+			kingpin.Fatalf("%s", err)
+		}
+		return
+	}
+
 	logger := termlog.NewLog()
 	if *quiet {
 		logger.Quiet()
@@ -235,40 +853,122 @@ func main() {
 	if *logHeaders {
 		logger.Enable("headers")
 	}
+	// Authentication failures have their own channel, which is always on
+	logger.Enable("auth")
 	if *forceColor {
 		logger.Color(true)
 	}
-	if *noTimestamps {
+	switch {
+	case *noTimestamps:
 		logger.TimeFmt = ""
+	case *utc:
+		w, stamp := newUTCWriter(color.Output, *timeFormat)
+		termlog.SetOutput(w)
+		logger.TimeFmt = stamp + ": "
+	default:
+		logger.TimeFmt = *timeFormat + ": "
+	}
+	if !*noTruncate {
+		dd.LogWidth = terminalWidth()
 	}
 
+	if configFile != "" {
+		logger.Say("Read configuration from %s", configFile)
+	}
 	for _, i := range dd.Routes {
 		logger.Say("Route %s -> %s", i.MuxMatch(), i.Endpoint.String())
 	}
 
+	if command == export.FullCommand() {
+		if err := exportSite(&dd, *exportDir, logger); err != nil {
+			kingpin.Fatalf("%s", err)
+		}
+		return
+	}
+
 	if *tls {
 		home, err := homedir.Dir()
 		if err != nil {
 			kingpin.Fatalf("Could not get user's homedir: %s", err)
 		}
 		dst := path.Join(home, ".devd.cert")
-		if _, err := os.Stat(dst); os.IsNotExist(err) {
+		if _, err := os.Stat(dst); os.IsNotExist(err) || certExpired(dst) {
 			err := devd.GenerateCert(dst)
 			if err != nil {
 				kingpin.Fatalf("Could not generate cert: %s", err)
 			}
 		}
-		*certFile = dst
+		certFile = dst
+	}
+	if command == bench.FullCommand() {
+		if err := runBench(&dd, certFile, *benchPath, *benchConcurrency, *benchRequests, logger); err != nil {
+			kingpin.Fatalf("%s", err)
+		}
+		return
+	}
+	if *push && certFile == "" && len(hostCerts) == 0 {
+		logger.Warn("--push has no effect without TLS, since browsers only speak HTTP/2 over TLS")
+	}
+
+	if *tunnelSpec != "" {
+		dd.Tunnel = func(addr string) {
+			go openTunnel(*tunnelSpec, addr, *tunnelInsecure, logger)
+		}
 	}
 
-	err := dd.Serve(
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stdinClosed := func() {
+		logger.Say("stdin closed - shutting down")
+		cancel()
+	}
+	if *countTraffic {
+		// Shut down cleanly on interrupt, so that the totals are logged
+		c := make(chan os.Signal, 1)
+		signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-c
+			signal.Stop(c)
+			cancel()
+		}()
+	}
+	err = dd.ServeContext(
+		ctx,
 		realAddr,
 		*port,
-		*certFile,
+		certFile,
 		logger,
 		func(url string) {
-			if *openBrowser {
-				err := webbrowser.Open(url)
+			replaying := *replay && stdinIsTerminal()
+			if replaying {
+				go func() {
+					replayCommands(&dd, logger)
+					if *exitOnStdinClose {
+						stdinClosed()
+					}
+				}()
+			}
+			if *exitOnStdinClose && !replaying {
+				go func() {
+					waitStdinClose()
+					stdinClosed()
+				}()
+			}
+			if dd.ServesPAC() {
+				logger.Say("Proxy auto-config for devices at %s", reachableURL(url, realAddr)+devd.PACPath)
+			}
+			if *copyURL {
+				if err := clipboard.WriteAll(withToken(reachableURL(url, realAddr), *token)); err != nil {
+					logger.Warn("Could not copy URL to clipboard: %s", err)
+				}
+			}
+			if *showQR {
+				if err := printQR(withToken(reachableURL(url, realAddr), *token)); err != nil {
+					logger.Warn("Could not render QR code: %s", err)
+				}
+			}
+			if *openBrowser || *openPath != "" {
+				err := launchBrowser(withToken(browserURL(url, *openPath), *token), *browser)
 				if err != nil {
 					kingpin.Fatalf("Failed to open browser: %s", err)
 				}
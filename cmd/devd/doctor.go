@@ -0,0 +1,236 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cortesi/devd"
+)
+
+// Certificates that expire sooner than this are flagged
+const certExpiryWarning = 30 * 24 * time.Hour
+
+// Below this many inotify watches - the old Linux default is 8192 - large
+// projects are likely to run out
+const minInotifyWatches = 16384
+
+// doctor prints the results of a set of checks, and counts the problems
+type doctor struct {
+	problems int
+}
+
+func (d *doctor) ok(name string, format string, args ...interface{}) {
+	fmt.Printf("%-12s ok - %s\n", name+":", fmt.Sprintf(format, args...))
+}
+
+func (d *doctor) problem(name string, hint string, format string, args ...interface{}) {
+	d.problems++
+	fmt.Printf("%-12s PROBLEM - %s\n", name+":", fmt.Sprintf(format, args...))
+	if hint == "" {
+		return
+	}
+	for _, l := range strings.Split(hint, "\n") {
+		fmt.Printf("%-12s %s\n", "", l)
+	}
+}
+
+// checkDNS checks that devd.io and its subdomains resolve to the local
+// machine. Some routers and resolvers drop answers that point at private
+// addresses, which leaves devd.io without an A record.
+func (d *doctor) checkDNS() {
+	hint := "Some routers and DNS resolvers drop answers that point to 127.0.0.1, as\n" +
+		"protection against DNS rebinding. Use http://localhost:PORT, or add\n" +
+		"\"127.0.0.1 devd.io\" (and any subdomains you use) to your hosts file."
+	for _, host := range []string{"devd.io", "doctor.devd.io"} {
+		addrs, err := net.LookupHost(host)
+		if err != nil {
+			d.problem("dns", hint, "%s does not resolve: %s", host, err)
+			return
+		}
+		found, v4 := false, false
+		for _, a := range addrs {
+			ip := net.ParseIP(a)
+			if ip != nil && ip.To4() != nil {
+				v4 = true
+			}
+			if ip != nil && ip.Equal(net.IPv4(127, 0, 0, 1)) {
+				found = true
+			}
+		}
+		if !v4 {
+			d.problem("dns", hint, "%s has no A record (got %s)", host, strings.Join(addrs, ", "))
+			return
+		}
+		if !found {
+			d.problem("dns", hint, "%s resolves to %s, not 127.0.0.1", host, strings.Join(addrs, ", "))
+			return
+		}
+	}
+	d.ok("dns", "devd.io and its subdomains resolve to 127.0.0.1")
+}
+
+// checkPort checks the port we'll listen on
+func (d *doctor) checkPort(address string, port int, tls bool) {
+	if port > 0 {
+		l, err := net.Listen("tcp", net.JoinHostPort(address, strconv.Itoa(port)))
+		if err != nil {
+			d.problem(
+				"port",
+				"Pick another port with -p, or leave it out to have devd find a free one.",
+				"can't listen on %s port %d: %s", address, port, err,
+			)
+			return
+		}
+		l.Close()
+		d.ok("port", "%s port %d is free", address, port)
+		return
+	}
+	p, err := devd.AutoPort(address, tls)
+	if err != nil {
+		d.problem(
+			"port",
+			"Check the address given with -A, and what's using ports 8000 to 10000.",
+			"no free port on %s: %s", address, err,
+		)
+		return
+	}
+	d.ok("port", "devd will listen on %s port %d", address, p)
+}
+
+// checkInotify compares the inotify watch limit with the number of
+// directories under the working directory, since devd watches each
+// directory it serves with livereload.
+func (d *doctor) checkInotify() {
+	if runtime.GOOS != "linux" {
+		return
+	}
+	data, err := ioutil.ReadFile("/proc/sys/fs/inotify/max_user_watches")
+	if err != nil {
+		d.problem("inotify", "", "could not read the watch limit: %s", err)
+		return
+	}
+	limit, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		d.problem("inotify", "", "could not read the watch limit: %s", err)
+		return
+	}
+	dirs := 0
+	filepath.Walk(".", func(path string, fi os.FileInfo, err error) error {
+		if err == nil && fi.IsDir() {
+			dirs++
+		}
+		return nil
+	})
+	hint := "Raise the limit with \"sudo sysctl fs.inotify.max_user_watches=524288\", and\n" +
+		"add it to /etc/sysctl.conf to keep it after a reboot."
+	switch {
+	case dirs >= limit:
+		d.problem(
+			"inotify", hint,
+			"the watch limit is %d, but there are %d directories here", limit, dirs,
+		)
+	case limit < minInotifyWatches:
+		d.problem(
+			"inotify", hint,
+			"the watch limit is %d, which larger projects will run into", limit,
+		)
+	default:
+		d.ok("inotify", "the watch limit is %d, for %d directories here", limit, dirs)
+	}
+}
+
+// checkCert checks the expiry of a certificate bundle
+func (d *doctor) checkCert(path string, explicit bool) {
+	if _, err := os.Stat(path); os.IsNotExist(err) && !explicit {
+		d.ok("certificate", "none yet, one is made in %s when --tls is first used", path)
+		return
+	}
+	cert, err := devd.LoadCert(path)
+	if err != nil {
+		d.problem("certificate", "", "%s", err)
+		return
+	}
+	hint := "Make a new one with \"devd cert regenerate\"."
+	if explicit {
+		hint = "Renew the certificate in " + path + "."
+	}
+	expiry := cert.NotAfter.Local().Format("2006-01-02")
+	switch {
+	case time.Now().After(cert.NotAfter):
+		d.problem("certificate", hint, "%s expired on %s", path, expiry)
+	case time.Until(cert.NotAfter) < certExpiryWarning:
+		d.problem("certificate", hint, "%s expires soon, on %s", path, expiry)
+	default:
+		d.ok("certificate", "%s is valid until %s", path, expiry)
+	}
+}
+
+// checkLAN checks that a server listening on all interfaces can be reached
+// through the machine's LAN address. This catches local firewalls, but not
+// ones between here and other devices.
+func (d *doctor) checkLAN() {
+	ip := lanIP()
+	if ip == nil {
+		d.problem(
+			"lan",
+			"Other devices won't be able to reach devd until this machine joins a network.",
+			"no LAN address found",
+		)
+		return
+	}
+	l, err := net.Listen("tcp", "0.0.0.0:0")
+	if err != nil {
+		d.problem("lan", "", "can't listen on all interfaces: %s", err)
+		return
+	}
+	defer l.Close()
+	go func() {
+		if c, err := l.Accept(); err == nil {
+			c.Close()
+		}
+	}()
+	port := l.Addr().(*net.TCPAddr).Port
+	c, err := net.DialTimeout("tcp", net.JoinHostPort(ip.String(), strconv.Itoa(port)), 2*time.Second)
+	if err != nil {
+		d.problem(
+			"lan",
+			"Check your firewall settings - with -a, devd needs to accept incoming\nconnections.",
+			"could not connect to %s when listening on all interfaces: %s", ip, err,
+		)
+		return
+	}
+	c.Close()
+	d.ok("lan", "with -a, devd is reachable at %s, firewalls between devices permitting", ip)
+}
+
+// runDoctor checks the things that commonly stop devd working, and prints
+// hints for fixing them
+func runDoctor(address string, port int, certFile string, hostCerts map[string]string, tls bool) error {
+	d := &doctor{}
+	d.checkDNS()
+	d.checkPort(address, port, tls || certFile != "" || len(hostCerts) > 0)
+	d.checkInotify()
+	if certFile != "" {
+		d.checkCert(certFile, true)
+	} else {
+		d.checkCert(defaultDotfile(".devd.cert"), false)
+	}
+	for _, path := range hostCerts {
+		d.checkCert(path, true)
+	}
+	d.checkLAN()
+	switch {
+	case d.problems == 1:
+		return fmt.Errorf("1 problem found")
+	case d.problems > 1:
+		return fmt.Errorf("%d problems found", d.problems)
+	}
+	return nil
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/cortesi/devd"
+	"github.com/cortesi/termlog"
+)
+
+// exportSite writes the site to outdir, and fails if any links are broken
+func exportSite(dd *devd.Devd, outdir string, logger termlog.Logger) error {
+	res, err := dd.Export(outdir, logger)
+	if err != nil {
+		return err
+	}
+	for _, b := range res.Broken {
+		logger.Warn("Broken link: %s", b)
+	}
+	logger.Say("Wrote %d files to %s", len(res.Files), outdir)
+	if len(res.Broken) > 0 {
+		return fmt.Errorf("%d broken links", len(res.Broken))
+	}
+	return nil
+}
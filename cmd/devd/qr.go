@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+
+	"github.com/mattn/go-isatty"
+	"github.com/skip2/go-qrcode"
+)
+
+// lanIP returns the first non-loopback IPv4 address of this machine, or nil
+// if there is none.
+func lanIP() net.IP {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil
+	}
+	for _, a := range addrs {
+		if ipnet, ok := a.(*net.IPNet); ok {
+			ip := ipnet.IP.To4()
+			if ip != nil && !ip.IsLoopback() && !ip.IsLinkLocalUnicast() {
+				return ip
+			}
+		}
+	}
+	return nil
+}
+
+// reachableURL rewrites a serving URL so that it can be used from other
+// devices. When we're listening on all interfaces, the devd.io host only
+// resolves to the local machine, so we substitute a LAN address.
+func reachableURL(servingURL string, address string) string {
+	if address != "0.0.0.0" {
+		return servingURL
+	}
+	ip := lanIP()
+	if ip == nil {
+		return servingURL
+	}
+	u, err := url.Parse(servingURL)
+	if err != nil {
+		return servingURL
+	}
+	if port := u.Port(); port != "" {
+		u.Host = net.JoinHostPort(ip.String(), port)
+	} else {
+		u.Host = ip.String()
+	}
+	return u.String()
+}
+
+// printQR renders a QR code for a URL to the terminal. Nothing is printed if
+// stdout is not a terminal.
+func printQR(u string) error {
+	if !isatty.IsTerminal(os.Stdout.Fd()) && !isatty.IsCygwinTerminal(os.Stdout.Fd()) {
+		return nil
+	}
+	q, err := qrcode.New(u, qrcode.Low)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Scan to open %s\n%s", u, q.ToSmallString(false))
+	return nil
+}
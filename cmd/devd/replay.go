@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/cortesi/devd"
+	"github.com/cortesi/termlog"
+)
+
+// replayCommands reads replay commands from the terminal, one per line, until
+// stdin is closed:
+//
+//	r [ID] [NAME: VALUE]   replay a request, the most recent by default
+//	l                      list the requests that can be replayed
+func replayCommands(dd *devd.Devd, logger termlog.TermLog) {
+	logger.Say("Type r and enter to replay the last request, or l to list requests")
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+		case line == "l":
+			for _, r := range dd.History() {
+				logger.Say("%d: %s %s%s", r.ID, r.Method, r.Host, r.URI)
+			}
+		case line == "r" || strings.HasPrefix(line, "r "):
+			id := 0
+			args := strings.TrimSpace(line[1:])
+			if f := strings.Fields(args); len(f) > 0 {
+				if n, err := strconv.Atoi(f[0]); err == nil {
+					id = n
+					args = strings.TrimSpace(args[len(f[0]):])
+				}
+			}
+			specs := []string{}
+			if args != "" {
+				specs = append(specs, args)
+			}
+			header, err := devd.ParseReplayHeaders(specs)
+			if err != nil {
+				logger.Warn("%s", err)
+				continue
+			}
+			if _, err := dd.Replay(id, header); err != nil {
+				logger.Warn("%s", err)
+			}
+		default:
+			logger.Warn("Unknown command %q - use r [ID] [NAME: VALUE] or l", line)
+		}
+	}
+}
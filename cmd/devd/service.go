@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// serviceName identifies devd to the platform's service manager
+const serviceName = "devd"
+
+// serviceArgs builds the command line for an installed service from the
+// arguments of a "service install" invocation. The working directory and log
+// file are recorded explicitly, because services start elsewhere and may run
+// as a different user.
+func serviceArgs(args []string, logFile string) ([]string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	ret := []string{"--service-dir", dir, "--logfile", logFile}
+	for i := 0; i < len(args); i++ {
+		if i+1 < len(args) && args[i] == "service" && args[i+1] == "install" {
+			ret = append(ret, args[i+2:]...)
+			break
+		}
+		ret = append(ret, args[i])
+	}
+	return ret, nil
+}
+
+// enterServiceDir moves to the directory recorded by "service install", so
+// that relative routes resolve as they did when the service was installed.
+func enterServiceDir(dir string) error {
+	if err := os.Chdir(dir); err != nil {
+		return fmt.Errorf("Could not enter service directory: %s", err)
+	}
+	return nil
+}
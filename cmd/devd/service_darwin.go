@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+
+	"github.com/mitchellh/go-homedir"
+)
+
+const launchdLabel = "io.devd"
+
+func launchdPlist() (string, error) {
+	home, err := homedir.Dir()
+	if err != nil {
+		return "", err
+	}
+	return path.Join(home, "Library", "LaunchAgents", launchdLabel+".plist"), nil
+}
+
+func plistString(b *bytes.Buffer, s string) {
+	b.WriteString("<string>")
+	_ = xml.EscapeText(b, []byte(s))
+	b.WriteString("</string>")
+}
+
+// installService installs and loads a launchd agent that runs devd with args
+// at login, restarting it if it exits.
+func installService(args []string, logFile string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("Could not find devd executable: %s", err)
+	}
+	dst, err := launchdPlist()
+	if err != nil {
+		return err
+	}
+
+	b := &bytes.Buffer{}
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+	<key>Label</key>`)
+	plistString(b, launchdLabel)
+	b.WriteString("\n\t<key>ProgramArguments</key>\n\t<array>\n")
+	for _, a := range append([]string{exe}, args...) {
+		b.WriteString("\t\t")
+		plistString(b, a)
+		b.WriteString("\n")
+	}
+	b.WriteString("\t</array>\n\t<key>StandardOutPath</key>")
+	plistString(b, logFile)
+	b.WriteString("\n\t<key>StandardErrorPath</key>")
+	plistString(b, logFile)
+	b.WriteString(`
+	<key>RunAtLoad</key>
+	<true/>
+	<key>KeepAlive</key>
+	<true/>
+</dict>
+</plist>
+`)
+
+	if err := os.MkdirAll(path.Dir(dst), 0755); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(dst, b.Bytes(), 0644); err != nil {
+		return fmt.Errorf("Could not write %s: %s", dst, err)
+	}
+	out, err := exec.Command("launchctl", "load", "-w", dst).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("launchctl load failed: %s %s", err, out)
+	}
+	fmt.Printf("Installed launchd agent %s, logging to %s\n", dst, logFile)
+	return nil
+}
+
+// uninstallService unloads and removes the launchd agent.
+func uninstallService() error {
+	dst, err := launchdPlist()
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(dst); os.IsNotExist(err) {
+		return fmt.Errorf("devd service is not installed (no %s)", dst)
+	}
+	out, err := exec.Command("launchctl", "unload", "-w", dst).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("launchctl unload failed: %s %s", err, out)
+	}
+	if err := os.Remove(dst); err != nil {
+		return err
+	}
+	fmt.Printf("Removed launchd agent %s\n", dst)
+	return nil
+}
+
+// runService does nothing on macOS - launchd redirects our output itself.
+func runService(logFile string) error {
+	return nil
+}
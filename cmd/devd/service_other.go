@@ -0,0 +1,18 @@
+//go:build !darwin && !windows
+// +build !darwin,!windows
+
+package main
+
+import "fmt"
+
+func installService(args []string, logFile string) error {
+	return fmt.Errorf("devd can only be installed as a service on macOS and Windows")
+}
+
+func uninstallService() error {
+	return fmt.Errorf("devd can only be installed as a service on macOS and Windows")
+}
+
+func runService(logFile string) error {
+	return nil
+}
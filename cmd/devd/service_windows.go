@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/cortesi/termlog"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+// installService registers devd with the Windows service manager to run with
+// args at boot, and starts it. This needs an elevated prompt.
+func installService(args []string, logFile string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("Could not find devd executable: %s", err)
+	}
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("Could not connect to the service manager: %s", err)
+	}
+	defer m.Disconnect()
+	if s, err := m.OpenService(serviceName); err == nil {
+		s.Close()
+		return fmt.Errorf("devd service is already installed")
+	}
+	s, err := m.CreateService(
+		serviceName,
+		exe,
+		mgr.Config{
+			DisplayName: "devd",
+			Description: "devd development web server",
+			StartType:   mgr.StartAutomatic,
+		},
+		args...,
+	)
+	if err != nil {
+		return fmt.Errorf("Could not create service: %s", err)
+	}
+	defer s.Close()
+	if err := s.Start(); err != nil {
+		return fmt.Errorf("Could not start service: %s", err)
+	}
+	fmt.Printf("Installed service %s, logging to %s\n", serviceName, logFile)
+	return nil
+}
+
+// uninstallService stops devd and removes it from the service manager.
+func uninstallService() error {
+	m, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("Could not connect to the service manager: %s", err)
+	}
+	defer m.Disconnect()
+	s, err := m.OpenService(serviceName)
+	if err != nil {
+		return fmt.Errorf("devd service is not installed")
+	}
+	defer s.Close()
+	_, _ = s.Control(svc.Stop)
+	if err := s.Delete(); err != nil {
+		return fmt.Errorf("Could not remove service: %s", err)
+	}
+	fmt.Printf("Removed service %s\n", serviceName)
+	return nil
+}
+
+type serviceHandler struct{}
+
+func (serviceHandler) Execute(args []string, r <-chan svc.ChangeRequest, s chan<- svc.Status) (bool, uint32) {
+	s <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	for c := range r {
+		switch c.Cmd {
+		case svc.Interrogate:
+			s <- c.CurrentStatus
+		case svc.Stop, svc.Shutdown:
+			s <- svc.Status{State: svc.StopPending}
+			return false, 0
+		}
+	}
+	return false, 0
+}
+
+// runService sends our output to logFile, and answers the service manager in
+// the background. Devd exits when the service is stopped.
+func runService(logFile string) error {
+	f, err := os.OpenFile(logFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("Could not open log file: %s", err)
+	}
+	termlog.SetOutput(f)
+	os.Stdout = f
+	os.Stderr = f
+	go func() {
+		if err := svc.Run(serviceName, serviceHandler{}); err != nil {
+			fmt.Fprintf(f, "Service error: %s\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}()
+	return nil
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/mattn/go-isatty"
+)
+
+// stdinIsTerminal tells us if we can read commands from the terminal
+func stdinIsTerminal() bool {
+	return isatty.IsTerminal(os.Stdin.Fd()) || isatty.IsCygwinTerminal(os.Stdin.Fd())
+}
+
+// waitStdinClose reads and discards stdin until it's closed. When devd runs
+// under another process with a pipe for stdin, this is when the parent goes
+// away.
+func waitStdinClose() {
+	io.Copy(ioutil.Discard, os.Stdin)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// terminalWidth returns the width of the terminal devd is logging to, or 0
+// if output isn't going to a terminal
+func terminalWidth() int {
+	width, _, err := terminal.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		return 0
+	}
+	return width
+}
+
+// utcWriter writes log output with its timestamps in UTC. termlog only
+// formats timestamps in local time, so the log's time format is set to
+// stamp, which has no layout elements and is passed through as it is, and
+// the writer replaces it with the time.
+type utcWriter struct {
+	io.Writer
+	layout string
+	stamp  []byte
+}
+
+// newUTCWriter makes a utcWriter for timestamps with a layout, and returns
+// the stamp to use as the log's time format. The stamp is as wide as a
+// timestamp, so that log lines are truncated to the same width.
+func newUTCWriter(w io.Writer, layout string) (*utcWriter, string) {
+	width := utf8.RuneCountInString(time.Now().UTC().Format(layout))
+	stamp := strings.Repeat("\x00", width)
+	return &utcWriter{w, layout, []byte(stamp)}, stamp
+}
+
+func (w *utcWriter) Write(p []byte) (int, error) {
+	ts := []byte(time.Now().UTC().Format(w.layout))
+	if _, err := w.Writer.Write(bytes.Replace(p, w.stamp, ts, -1)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
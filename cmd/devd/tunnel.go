@@ -0,0 +1,21 @@
+package main
+
+import (
+	"github.com/cortesi/devd/tunnel"
+	"github.com/cortesi/termlog"
+)
+
+// openTunnel establishes a tunnel through a relay to local, the address devd
+// listens on for tunnelled connections, and logs the public URL.
+func openTunnel(spec string, local string, insecure bool, logger termlog.Logger) {
+	t, err := tunnel.Open(spec, local, insecure, logger)
+	if err != nil {
+		logger.Shout("Could not open tunnel: %s", err)
+		return
+	}
+	if t.URL != "" {
+		logger.Say("Tunnel open at %s", t.URL)
+	} else {
+		logger.Say("Tunnel open through %s", spec)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cortesi/devd"
+)
+
+// commit is the git revision devd was built from, set at build time with
+// -ldflags "-X main.commit=...". Without it, we fall back on the revision the
+// go tool records in builds from a checkout.
+var commit = ""
+
+const latestReleaseURL = "https://api.github.com/repos/cortesi/devd/releases/latest"
+
+// printVersion prints detailed build information.
+func printVersion() {
+	fmt.Printf("devd %s\n", devd.Version)
+	if info, ok := debug.ReadBuildInfo(); ok {
+		fmt.Printf("module:      %s %s\n", info.Main.Path, info.Main.Version)
+	}
+	rev := commit
+	if rev == "" {
+		rev = vcsRevision()
+	}
+	if rev != "" {
+		fmt.Printf("commit:      %s\n", rev)
+	} else {
+		fmt.Printf("commit:      unknown\n")
+	}
+	fmt.Printf("go:          %s\n", runtime.Version())
+	fmt.Printf("platform:    %s/%s\n", runtime.GOOS, runtime.GOARCH)
+}
+
+// versionNewer checks whether dotted version a is newer than b. A leading "v"
+// is ignored, and missing components count as 0.
+func versionNewer(a, b string) bool {
+	ap := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	bp := strings.Split(strings.TrimPrefix(b, "v"), ".")
+	for i := 0; i < len(ap) || i < len(bp); i++ {
+		var av, bv int
+		if i < len(ap) {
+			av, _ = strconv.Atoi(ap[i])
+		}
+		if i < len(bp) {
+			bv, _ = strconv.Atoi(bp[i])
+		}
+		if av != bv {
+			return av > bv
+		}
+	}
+	return false
+}
+
+// checkLatest asks GitHub for the latest devd release, and tells the user how
+// to install it if it's newer than this build.
+func checkLatest() error {
+	client := &http.Client{Timeout: time.Second * 10}
+	resp, err := client.Get(latestReleaseURL)
+	if err != nil {
+		return fmt.Errorf("Could not check for updates: %s", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Could not check for updates: %s", resp.Status)
+	}
+	release := struct {
+		TagName string `json:"tag_name"`
+		HTMLURL string `json:"html_url"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+		return fmt.Errorf("Could not check for updates: %s", err)
+	}
+	if !versionNewer(release.TagName, devd.Version) {
+		fmt.Printf("\ndevd is up to date\n")
+		return nil
+	}
+	fmt.Printf("\nA newer version of devd is available: %s\n", release.TagName)
+	fmt.Printf("Download it from %s, or install it with:\n\n", release.HTMLURL)
+	fmt.Printf("    go install github.com/cortesi/devd/cmd/devd@%s\n", release.TagName)
+	return nil
+}
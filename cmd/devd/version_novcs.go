@@ -0,0 +1,10 @@
+//go:build !go1.18
+// +build !go1.18
+
+package main
+
+// vcsRevision is unavailable before Go 1.18, which started stamping binaries
+// with version control information
+func vcsRevision() string {
+	return ""
+}
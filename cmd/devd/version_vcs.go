@@ -0,0 +1,23 @@
+//go:build go1.18
+// +build go1.18
+
+package main
+
+import (
+	"runtime/debug"
+)
+
+// vcsRevision returns the revision the go tool stamped into the binary, for
+// builds from a checkout that don't set commit with -ldflags
+func vcsRevision() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	for _, s := range info.Settings {
+		if s.Key == "vcs.revision" {
+			return s.Value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,67 @@
+package devd
+
+import (
+	"context"
+	"net"
+	"net/http"
+)
+
+// tunnelKey marks the contexts of requests that arrived through a tunnel
+type tunnelKey struct{}
+
+// withTunnel marks a context as belonging to a tunnelled connection
+func withTunnel(ctx context.Context) context.Context {
+	return context.WithValue(ctx, tunnelKey{}, true)
+}
+
+// isTunnelled tells us if a request arrived through a tunnel. These come
+// from a relay on this machine, but on behalf of clients anywhere.
+func isTunnelled(r *http.Request) bool {
+	tunnelled, _ := r.Context().Value(tunnelKey{}).(bool)
+	return tunnelled
+}
+
+// isLoopback tells us if a request's remote address is on this machine
+func isLoopback(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		host = remoteAddr
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// loopbackOnly refuses requests that don't come from this machine, including
+// tunnelled ones
+func loopbackOnly(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isTunnelled(r) || !isLoopback(r.RemoteAddr) {
+			http.Error(
+				w,
+				"devd's control endpoints can only be used from the machine it runs on",
+				http.StatusForbidden,
+			)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// handleControl mounts one of devd's control endpoints - the ones that
+// expose or act on devd itself, rather than the sites it serves - at a path,
+// and at the same path on each routed host. Unless RemoteControl is set,
+// they're only available to clients on this machine, even when devd listens
+// on all interfaces.
+func (dd *Devd) handleControl(mux *http.ServeMux, path string, h http.Handler) {
+	if !dd.RemoteControl {
+		h = loopbackOnly(h)
+	}
+	mux.Handle(path, h)
+	seen := make(map[string]bool)
+	for _, route := range dd.Routes {
+		if route.Host != "" && !seen[route.Host] {
+			mux.Handle(route.Host+path, h)
+			seen[route.Host] = true
+		}
+	}
+}
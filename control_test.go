@@ -0,0 +1,124 @@
+package devd
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/cortesi/termlog"
+)
+
+func TestIsLoopback(t *testing.T) {
+	var loopbackTests = []struct {
+		addr     string
+		expected bool
+	}{
+		{"127.0.0.1:1234", true},
+		{"[::1]:1234", true},
+		{"127.0.0.1", true},
+		{"192.168.1.10:1234", false},
+		{"[fe80::1]:1234", false},
+		{"", false},
+	}
+	for i, tt := range loopbackTests {
+		if got := isLoopback(tt.addr); got != tt.expected {
+			t.Errorf("Test %d: expected %v for %q, got %v", i, tt.expected, tt.addr, got)
+		}
+	}
+}
+
+func TestHandleControl(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	routes := make(RouteCollection)
+	if err := routes.Add("foo/./", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, remote := range []bool{false, true} {
+		dd := Devd{Routes: routes, RemoteControl: remote}
+		mux := http.NewServeMux()
+		dd.handleControl(mux, "/.devd/test", ok)
+		for _, host := range []string{"devd.io", "foo.devd.io"} {
+			local := httptest.NewRequest("GET", "http://"+host+"/.devd/test", nil)
+			local.RemoteAddr = "127.0.0.1:1234"
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, local)
+			AssertCode(t, rec, http.StatusOK)
+
+			rec = httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest("GET", "http://"+host+"/.devd/test", nil))
+			if remote {
+				AssertCode(t, rec, http.StatusOK)
+			} else {
+				AssertCode(t, rec, http.StatusForbidden)
+			}
+		}
+	}
+}
+
+// serveTunnelled serves dd, and returns its local and tunnel addresses and a
+// function that shuts it down
+func serveTunnelled(t *testing.T, dd *Devd) (string, string, func()) {
+	logger := termlog.NewLog()
+	logger.Quiet()
+	tunnels := make(chan string, 1)
+	dd.Tunnel = func(addr string) { tunnels <- addr }
+	ctx, cancel := context.WithCancel(context.Background())
+	urls := make(chan string, 1)
+	served := make(chan error, 1)
+	go func() {
+		served <- dd.ServeContext(ctx, "127.0.0.1", 0, "", logger, func(u string) { urls <- u })
+	}()
+	u, err := url.Parse(<-urls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return net.JoinHostPort("127.0.0.1", u.Port()), <-tunnels, func() {
+		cancel()
+		<-served
+	}
+}
+
+func TestTunnelIsRemote(t *testing.T) {
+	for _, allow := range [][]string{nil, {"10.0.0.0/8"}} {
+		dd := Devd{}
+		if err := dd.AddRoutes([]string{"./testdata"}, nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := dd.AddIPFilters(allow, nil); err != nil {
+			t.Fatal(err)
+		}
+		local, tunnelled, stop := serveTunnelled(t, &dd)
+		siteCode := http.StatusOK
+		if allow != nil {
+			siteCode = http.StatusForbidden
+		}
+		tests := []struct {
+			addr string
+			path string
+			code int
+		}{
+			{local, "/", http.StatusOK},
+			{local, routesPath, http.StatusOK},
+			{tunnelled, "/", siteCode},
+			{tunnelled, routesPath, http.StatusForbidden},
+		}
+		for i, tt := range tests {
+			resp, err := http.Get("http://" + tt.addr + tt.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.code {
+				t.Errorf(
+					"Test %d, allow %v: expected %d for %s, got %d",
+					i, allow, tt.code, tt.path, resp.StatusCode,
+				)
+			}
+		}
+		stop()
+	}
+}
@@ -0,0 +1,50 @@
+package devd
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// AddSetCookies sets cookies on all responses from specifications of the form
+// "name=value". The cookies apply to the whole site.
+func (dd *Devd) AddSetCookies(specs []string) error {
+	for _, s := range specs {
+		parts := strings.SplitN(s, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("Invalid cookie specification: %s", s)
+		}
+		c := &http.Cookie{Name: strings.TrimSpace(parts[0]), Value: parts[1], Path: "/"}
+		// String returns nothing for cookies with invalid names
+		if c.String() == "" {
+			return fmt.Errorf("Invalid cookie name: %s", s)
+		}
+		dd.SetCookies = append(dd.SetCookies, c)
+	}
+	return nil
+}
+
+// stripCookies removes the named cookies from a request
+func stripCookies(r *http.Request, names []string) {
+	cookies := r.Cookies()
+	if len(cookies) == 0 {
+		return
+	}
+	strip := make(map[string]bool)
+	for _, n := range names {
+		strip[n] = true
+	}
+	kept := []string{}
+	for _, c := range cookies {
+		if !strip[c.Name] {
+			kept = append(kept, c.String())
+		}
+	}
+	if len(kept) == len(cookies) {
+		return
+	}
+	r.Header.Del("Cookie")
+	if len(kept) > 0 {
+		r.Header.Set("Cookie", strings.Join(kept, "; "))
+	}
+}
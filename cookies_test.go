@@ -0,0 +1,71 @@
+package devd
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/cortesi/devd/httpctx"
+	"github.com/cortesi/termlog"
+)
+
+func TestAddSetCookies(t *testing.T) {
+	for _, spec := range []string{"novalue", "bad name=x", "=x"} {
+		dd := Devd{}
+		if err := dd.AddSetCookies([]string{spec}); err == nil {
+			t.Errorf("Expected error for %q", spec)
+		}
+	}
+}
+
+var stripCookiesTests = []struct {
+	cookie   string
+	names    []string
+	expected []string
+}{
+	{"", []string{"a"}, nil},
+	{"a=1; b=2", []string{"c"}, []string{"a=1; b=2"}},
+	{"a=1; b=2; c=3", []string{"b"}, []string{"a=1; c=3"}},
+	{"a=1; b=2", []string{"a", "b"}, nil},
+}
+
+func TestStripCookies(t *testing.T) {
+	for i, tt := range stripCookiesTests {
+		r := httptest.NewRequest("GET", "/", nil)
+		if tt.cookie != "" {
+			r.Header.Set("Cookie", tt.cookie)
+		}
+		stripCookies(r, tt.names)
+		if !reflect.DeepEqual(r.Header["Cookie"], tt.expected) {
+			t.Errorf("Test %d: expected %v, got %v", i, tt.expected, r.Header["Cookie"])
+		}
+	}
+}
+
+func TestCookies(t *testing.T) {
+	logger := termlog.NewLog()
+	logger.Quiet()
+	dd := Devd{StripCookies: []string{"session"}}
+	if err := dd.AddSetCookies([]string{"consent=yes"}); err != nil {
+		t.Fatal(err)
+	}
+	var seen string
+	h := dd.WrapHandler(
+		logger,
+		httpctx.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			seen = r.Header.Get("Cookie")
+		}),
+	)
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "http://devd.io/", nil)
+	req.Header.Set("Cookie", "session=abc; theme=dark")
+	h.ServeHTTP(rec, req)
+	if seen != "theme=dark" {
+		t.Errorf("Unexpected request cookies: %q", seen)
+	}
+	if c := rec.Header().Get("Set-Cookie"); c != "consent=yes; Path=/" {
+		t.Errorf("Unexpected Set-Cookie: %q", c)
+	}
+}
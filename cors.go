@@ -0,0 +1,97 @@
+package devd
+
+import (
+	"context"
+	"net/http"
+	"path"
+	"strconv"
+
+	"github.com/cortesi/devd/httpctx"
+	"github.com/cortesi/devd/inject"
+	"github.com/cortesi/termlog"
+)
+
+// corsOriginAllowed checks an origin against a list of allowed origins, which
+// may contain * wildcards, e.g. "http://localhost:*". An empty list allows
+// everything.
+func corsOriginAllowed(allowed []string, origin string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, pattern := range allowed {
+		if ok, _ := path.Match(pattern, origin); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// isPreflight checks whether a request is a CORS preflight request
+func isPreflight(r *http.Request) bool {
+	return r.Method == "OPTIONS" &&
+		r.Header.Get("Origin") != "" &&
+		r.Header.Get("Access-Control-Request-Method") != ""
+}
+
+// corsHeaders sets CORS headers on a response. The request's Origin is
+// echoed back, along with permission to send credentials, which browsers
+// refuse to combine with a wildcard origin. Origins that aren't allowed get
+// no CORS headers at all, so browsers block them.
+func (dd *Devd) corsHeaders(w http.ResponseWriter, r *http.Request) {
+	h := w.Header()
+	inject.AddVary(h, "Origin")
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		h.Set("Access-Control-Allow-Origin", "*")
+		return
+	}
+	if !corsOriginAllowed(dd.CorsOrigins, origin) {
+		return
+	}
+	h.Set("Access-Control-Allow-Origin", origin)
+	h.Set("Access-Control-Allow-Credentials", "true")
+	if isPreflight(r) {
+		dd.preflightHeaders(h, r)
+	} else if dd.CorsExpose != "" {
+		h.Set("Access-Control-Expose-Headers", dd.CorsExpose)
+	}
+}
+
+// preflightHeaders sets the headers that answer a preflight request. Unless
+// they're configured, we allow whatever methods and headers the browser asks
+// for, and leave the preflight cache time to the browser's default, which is
+// short enough that configuration changes take effect quickly.
+func (dd *Devd) preflightHeaders(h http.Header, r *http.Request) {
+	methods := dd.CorsMethods
+	if methods == "" {
+		methods = r.Header.Get("Access-Control-Request-Method")
+	}
+	h.Set("Access-Control-Allow-Methods", methods)
+	headers := dd.CorsHeaders
+	if headers == "" {
+		headers = r.Header.Get("Access-Control-Request-Headers")
+	}
+	if headers != "" {
+		h.Set("Access-Control-Allow-Headers", headers)
+	}
+	if dd.CorsMaxAge > 0 {
+		h.Set("Access-Control-Max-Age", strconv.Itoa(int(dd.CorsMaxAge.Seconds())))
+	}
+}
+
+// answerPreflights answers CORS preflight requests ahead of authentication,
+// since browsers send them without credentials. They get the usual request
+// handling, which answers them without reaching a route.
+func (dd *Devd) answerPreflights(logger termlog.TermLog, next http.Handler) http.Handler {
+	preflight := dd.WrapHandler(
+		logger,
+		httpctx.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {}),
+	)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isPreflight(r) {
+			preflight.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,164 @@
+package devd
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/GeertJohan/go.rice"
+	"github.com/cortesi/devd/httpctx"
+	"github.com/cortesi/devd/ricetemp"
+	"github.com/cortesi/termlog"
+)
+
+var corsOriginTests = []struct {
+	allowed []string
+	origin  string
+	ok      bool
+}{
+	{nil, "http://example.com", true},
+	{[]string{"http://example.com"}, "http://example.com", true},
+	{[]string{"http://example.com"}, "http://evil.com", false},
+	{[]string{"http://localhost:*"}, "http://localhost:3000", true},
+	{[]string{"https://*.example.com"}, "https://app.example.com", true},
+	{[]string{"https://*.example.com"}, "http://app.example.com", false},
+}
+
+func TestCorsOriginAllowed(t *testing.T) {
+	for i, tt := range corsOriginTests {
+		if ok := corsOriginAllowed(tt.allowed, tt.origin); ok != tt.ok {
+			t.Errorf("Test %d: expected %v, got %v", i, tt.ok, ok)
+		}
+	}
+}
+
+func TestCorsHeaders(t *testing.T) {
+	logger := termlog.NewLog()
+	logger.Quiet()
+	devd := Devd{Cors: true, CorsOrigins: []string{"http://localhost:*"}}
+	h := devd.WrapHandler(
+		logger,
+		httpctx.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {}),
+	)
+	get := func(origin string) http.Header {
+		r := httptest.NewRequest("GET", "/", nil)
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Header()
+	}
+
+	hdrs := get("http://localhost:3000")
+	if hdrs.Get("Access-Control-Allow-Origin") != "http://localhost:3000" {
+		t.Errorf("Origin not reflected: %v", hdrs)
+	}
+	if hdrs.Get("Access-Control-Allow-Credentials") != "true" {
+		t.Errorf("Credentials not allowed: %v", hdrs)
+	}
+	if hdrs.Get("Vary") != "Origin" {
+		t.Errorf("Expected Vary header: %v", hdrs)
+	}
+
+	hdrs = get("http://evil.com")
+	if hdrs.Get("Access-Control-Allow-Origin") != "" || hdrs.Get("Access-Control-Allow-Credentials") != "" {
+		t.Errorf("Unexpected CORS headers for disallowed origin: %v", hdrs)
+	}
+
+	hdrs = get("")
+	if hdrs.Get("Access-Control-Allow-Origin") != "*" {
+		t.Errorf("Expected wildcard origin: %v", hdrs)
+	}
+}
+
+func TestCorsPreflight(t *testing.T) {
+	logger := termlog.NewLog()
+	logger.Quiet()
+	called := false
+	devd := Devd{Cors: true}
+	h := devd.WrapHandler(
+		logger,
+		httpctx.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			called = true
+			w.Header().Set("X-Custom", "foo")
+		}),
+	)
+	preflight := func() *httptest.ResponseRecorder {
+		r := httptest.NewRequest("OPTIONS", "/", nil)
+		r.Header.Set("Origin", "http://example.com")
+		r.Header.Set("Access-Control-Request-Method", "PUT")
+		r.Header.Set("Access-Control-Request-Headers", "X-Token")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	w := preflight()
+	AssertCode(t, w, http.StatusNoContent)
+	if called {
+		t.Error("Preflight was passed to the handler")
+	}
+	if w.Header().Get("Access-Control-Allow-Methods") != "PUT" ||
+		w.Header().Get("Access-Control-Allow-Headers") != "X-Token" ||
+		w.Header().Get("Access-Control-Max-Age") != "" {
+		t.Errorf("Unexpected preflight headers: %v", w.Header())
+	}
+
+	devd.CorsMethods = "GET, POST"
+	devd.CorsHeaders = "Content-Type"
+	devd.CorsMaxAge = time.Minute
+	devd.CorsExpose = "X-Custom"
+	w = preflight()
+	if w.Header().Get("Access-Control-Allow-Methods") != "GET, POST" ||
+		w.Header().Get("Access-Control-Allow-Headers") != "Content-Type" ||
+		w.Header().Get("Access-Control-Max-Age") != "60" ||
+		w.Header().Get("Access-Control-Expose-Headers") != "" {
+		t.Errorf("Unexpected preflight headers: %v", w.Header())
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Origin", "http://example.com")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if !called {
+		t.Error("Request was not passed to the handler")
+	}
+	if w.Header().Get("Access-Control-Expose-Headers") != "X-Custom" ||
+		w.Header().Get("Access-Control-Allow-Methods") != "" {
+		t.Errorf("Unexpected response headers: %v", w.Header())
+	}
+}
+
+func TestCorsPreflightWithAuth(t *testing.T) {
+	logger := termlog.NewLog()
+	logger.Quiet()
+	templates := ricetemp.MustMakeTemplates(rice.MustFindBox("templates"))
+	devd := Devd{Cors: true, Token: "secret"}
+	if err := devd.AddRoutes([]string{"./testdata"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	h, err := devd.Router(logger, templates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer devd.shutdown()
+
+	r := httptest.NewRequest("OPTIONS", "/", nil)
+	r.Header.Set("Origin", "http://example.com")
+	r.Header.Set("Access-Control-Request-Method", "GET")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	AssertCode(t, w, http.StatusNoContent)
+	if w.Header().Get("Access-Control-Allow-Origin") != "http://example.com" {
+		t.Errorf("Unexpected preflight headers: %v", w.Header())
+	}
+
+	r = httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Origin", "http://example.com")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	AssertCode(t, w, http.StatusUnauthorized)
+}
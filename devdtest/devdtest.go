@@ -0,0 +1,205 @@
+// Package devdtest has helpers for testing routes and handlers served by
+// devd. It starts a configured Devd on a free local port, makes requests
+// against it, and checks responses and livereload behaviour.
+package devdtest
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cortesi/devd"
+	"github.com/cortesi/devd/livereload"
+	"github.com/cortesi/termlog"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// How long we wait for a livereload message
+	reloadTimeout = time.Second * 5
+	// How often we re-trigger a reload while waiting
+	reloadRetry = time.Millisecond * 100
+)
+
+// Server is a Devd running on a local port for the duration of a test
+type Server struct {
+	*devd.Devd
+	// URL is the base URL of the server. It uses 127.0.0.1 rather than
+	// devd.io, so tests don't depend on DNS.
+	URL string
+
+	t testing.TB
+}
+
+// Response is a response read in full
+type Response struct {
+	Code   int
+	Header http.Header
+	Body   string
+}
+
+// freePort asks the kernel for an unused port
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+// NewServer starts a Devd configured with opts on a free port on 127.0.0.1.
+// Logging is silenced unless opts include devd.WithLogger. Call Close when
+// the test is done.
+func NewServer(t testing.TB, opts ...devd.Option) *Server {
+	t.Helper()
+	port, err := freePort()
+	if err != nil {
+		t.Fatalf("Could not find a free port: %s", err)
+	}
+	logger := termlog.NewLog()
+	logger.Quiet()
+	opts = append(
+		[]devd.Option{devd.WithLogger(logger)},
+		append(opts, devd.WithAddress("127.0.0.1"), devd.WithPort(port))...,
+	)
+	dd, err := devd.New(opts...)
+	if err != nil {
+		t.Fatalf("Could not configure devd: %s", err)
+	}
+	if _, err := dd.Start(); err != nil {
+		t.Fatalf("Could not start devd: %s", err)
+	}
+	return &Server{
+		Devd: dd,
+		URL:  "http://127.0.0.1:" + strconv.Itoa(port),
+		t:    t,
+	}
+}
+
+// Close stops the server
+func (s *Server) Close() {
+	if err := s.Stop(); err != nil {
+		s.t.Errorf("Could not stop devd: %s", err)
+	}
+}
+
+// Do makes a request to the server. Relative request URLs are resolved
+// against the server's URL.
+func (s *Server) Do(req *http.Request) *Response {
+	s.t.Helper()
+	if req.URL.Host == "" {
+		req.URL.Scheme = "http"
+		req.URL.Host = strings.TrimPrefix(s.URL, "http://")
+	}
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		s.t.Fatalf("Request failed: %s", err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		s.t.Fatalf("Could not read response: %s", err)
+	}
+	return &Response{resp.StatusCode, resp.Header, string(body)}
+}
+
+// Request makes a request with an optional body to a path on the server
+func (s *Server) Request(method string, path string, body io.Reader) *Response {
+	s.t.Helper()
+	req, err := http.NewRequest(method, s.URL+path, body)
+	if err != nil {
+		s.t.Fatalf("Invalid request: %s", err)
+	}
+	return s.Do(req)
+}
+
+// Get requests a path from the server. Redirects are not followed.
+func (s *Server) Get(path string) *Response {
+	s.t.Helper()
+	return s.Request("GET", path, nil)
+}
+
+// ExpectReload connects a livereload client, calls trigger, and waits for
+// the server to tell the client to reload. It returns the livereload
+// command, which is "page" or "css".
+func (s *Server) ExpectReload(trigger func()) string {
+	s.t.Helper()
+	wsURL := "ws" + strings.TrimPrefix(s.URL, "http") + livereload.EndpointPath
+	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
+	if err != nil {
+		s.t.Fatalf("Could not connect to livereload: %s", err)
+	}
+	defer conn.Close()
+
+	msgs := make(chan string, 1)
+	errs := make(chan error, 1)
+	go func() {
+		conn.SetReadDeadline(time.Now().Add(reloadTimeout))
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			errs <- err
+			return
+		}
+		msgs <- string(msg)
+	}()
+	// The server registers clients just after the websocket handshake, so a
+	// reload triggered straight away can be missed. We keep triggering until
+	// one gets through.
+	for {
+		trigger()
+		select {
+		case msg := <-msgs:
+			return msg
+		case err := <-errs:
+			s.t.Fatalf("No livereload message: %s", err)
+			return ""
+		case <-time.After(reloadRetry):
+		}
+	}
+}
+
+// AssertCode checks a response's status code
+func AssertCode(t testing.TB, resp *Response, code int) {
+	t.Helper()
+	if resp.Code != code {
+		t.Errorf("Expected code %d, got %d", code, resp.Code)
+	}
+}
+
+// AssertContains checks that a response body contains a string
+func AssertContains(t testing.TB, resp *Response, s string) {
+	t.Helper()
+	if !strings.Contains(resp.Body, s) {
+		t.Errorf("Expected body to contain %q, got %q", s, resp.Body)
+	}
+}
+
+// AssertInjected checks that the livereload script was injected into a
+// response
+func AssertInjected(t testing.TB, resp *Response) {
+	t.Helper()
+	if !bytes.Contains([]byte(resp.Body), livereload.Injector.Payload) {
+		t.Errorf("Expected livereload script in body, got %q", resp.Body)
+	}
+}
+
+// AssertNotInjected checks that the livereload script was not injected into
+// a response
+func AssertNotInjected(t testing.TB, resp *Response) {
+	t.Helper()
+	if bytes.Contains([]byte(resp.Body), livereload.Injector.Payload) {
+		t.Errorf("Unexpected livereload script in body, got %q", resp.Body)
+	}
+}
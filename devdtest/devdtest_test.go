@@ -0,0 +1,36 @@
+package devdtest
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cortesi/devd"
+)
+
+func TestServer(t *testing.T) {
+	s := NewServer(t, devd.WithRoutes("../testdata"), devd.WithLivereload())
+	defer s.Close()
+
+	resp := s.Get("/index.html")
+	AssertCode(t, resp, 301)
+	resp = s.Get("/")
+	AssertCode(t, resp, 200)
+	AssertContains(t, resp, "This is a test")
+	AssertInjected(t, resp)
+
+	resp = s.Get("/style.css")
+	AssertCode(t, resp, 200)
+	AssertNotInjected(t, resp)
+
+	resp = s.Request("POST", "/style.css", strings.NewReader("foo"))
+	AssertCode(t, resp, 405)
+
+	cmd := s.ExpectReload(func() { s.Reload([]string{"style.css"}) })
+	if cmd != "css" {
+		t.Errorf("Expected css reload, got %s", cmd)
+	}
+	cmd = s.ExpectReload(func() { s.Reload([]string{"index.html"}) })
+	if cmd != "page" {
+		t.Errorf("Expected page reload, got %s", cmd)
+	}
+}
@@ -0,0 +1,182 @@
+package devd
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// How long a digest auth nonce stays valid. After this, clients are asked to
+// retry with a fresh nonce, which browsers do without prompting.
+const digestNonceLifetime = 5 * time.Minute
+
+// digestAuth is a handler that requires HTTP digest authentication (RFC
+// 7616), using MD5 or SHA-256. Nonces are stateless - they carry a timestamp
+// and are signed with a secret generated at startup.
+type digestAuth struct {
+	realm  string
+	creds  *Credentials
+	secret []byte
+	next   http.Handler
+	// Called when a client presents invalid credentials
+	failed func(r *http.Request, user string)
+}
+
+func newDigestAuth(
+	realm string,
+	creds *Credentials,
+	next http.Handler,
+	failed func(*http.Request, string),
+) (*digestAuth, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("Could not generate digest secret: %s", err)
+	}
+	return &digestAuth{realm, creds, secret, next, failed}, nil
+}
+
+func (d *digestAuth) nonce(t time.Time) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	mac := hmac.New(sha256.New, d.secret)
+	mac.Write([]byte(ts))
+	return ts + "-" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// checkNonce returns whether a nonce was issued by us, and whether it has
+// expired
+func (d *digestAuth) checkNonce(nonce string) (valid bool, stale bool) {
+	parts := strings.SplitN(nonce, "-", 2)
+	if len(parts) != 2 {
+		return false, false
+	}
+	ts, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return false, false
+	}
+	issued := time.Unix(ts, 0)
+	if subtle.ConstantTimeCompare([]byte(d.nonce(issued)), []byte(nonce)) != 1 {
+		return false, false
+	}
+	return true, time.Since(issued) > digestNonceLifetime
+}
+
+// parseDigest parses the parameters of a digest Authorization header
+func parseDigest(header string) map[string]string {
+	const prefix = "Digest "
+	if !strings.HasPrefix(header, prefix) {
+		return nil
+	}
+	params := make(map[string]string)
+	s := header[len(prefix):]
+	for {
+		s = strings.TrimLeft(s, " ,")
+		eq := strings.Index(s, "=")
+		if eq < 0 {
+			return params
+		}
+		key := strings.ToLower(strings.TrimSpace(s[:eq]))
+		s = s[eq+1:]
+		var val string
+		if strings.HasPrefix(s, `"`) {
+			end := 1
+			for end < len(s) && s[end] != '"' {
+				if s[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(s) {
+				return nil
+			}
+			val = strings.Replace(s[1:end], `\`, "", -1)
+			s = s[end+1:]
+		} else {
+			end := strings.Index(s, ",")
+			if end < 0 {
+				end = len(s)
+			}
+			val = strings.TrimSpace(s[:end])
+			s = s[end:]
+		}
+		params[key] = val
+	}
+}
+
+func digestHash(algorithm string) func() hash.Hash {
+	switch strings.ToUpper(algorithm) {
+	case "", "MD5":
+		return md5.New
+	case "SHA-256":
+		return sha256.New
+	}
+	return nil
+}
+
+func hexHash(h func() hash.Hash, parts ...string) string {
+	d := h()
+	d.Write([]byte(strings.Join(parts, ":")))
+	return hex.EncodeToString(d.Sum(nil))
+}
+
+// authenticate checks a request's digest credentials. If the nonce is merely
+// stale, the second return value is true.
+func (d *digestAuth) authenticate(r *http.Request) (ok bool, stale bool) {
+	p := parseDigest(r.Header.Get("Authorization"))
+	if p == nil {
+		return false, false
+	}
+	h := digestHash(p["algorithm"])
+	if h == nil || p["realm"] != d.realm || p["uri"] != r.RequestURI {
+		return false, false
+	}
+	valid, stale := d.checkNonce(p["nonce"])
+	if !valid {
+		return false, false
+	}
+	ha1 := hexHash(h, d.creds.username, d.realm, d.creds.password)
+	ha2 := hexHash(h, r.Method, p["uri"])
+	var want string
+	switch p["qop"] {
+	case "auth":
+		want = hexHash(h, ha1, p["nonce"], p["nc"], p["cnonce"], "auth", ha2)
+	case "":
+		want = hexHash(h, ha1, p["nonce"], ha2)
+	default:
+		return false, false
+	}
+	user := sha256.Sum256([]byte(p["username"]))
+	wantUser := sha256.Sum256([]byte(d.creds.username))
+	if subtle.ConstantTimeCompare(user[:], wantUser[:]) != 1 ||
+		subtle.ConstantTimeCompare([]byte(p["response"]), []byte(want)) != 1 {
+		return false, false
+	}
+	return true, stale
+}
+
+func (d *digestAuth) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ok, stale := d.authenticate(r)
+	if ok && !stale {
+		d.next.ServeHTTP(w, r)
+		return
+	}
+	if p := parseDigest(r.Header.Get("Authorization")); !ok && p != nil && d.failed != nil {
+		d.failed(r, p["username"])
+	}
+	nonce := d.nonce(time.Now())
+	for _, alg := range []string{"SHA-256", "MD5"} {
+		w.Header().Add("WWW-Authenticate", fmt.Sprintf(
+			`Digest realm=%q, qop="auth", algorithm=%s, nonce=%q, stale=%v`,
+			d.realm, alg, nonce, stale,
+		))
+	}
+	http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+}
@@ -0,0 +1,74 @@
+package devd
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseDigest(t *testing.T) {
+	p := parseDigest(`Digest username="a\"b", realm="r, s", nc=00000001, qop=auth`)
+	if p["username"] != `a"b` || p["realm"] != "r, s" || p["nc"] != "00000001" || p["qop"] != "auth" {
+		t.Errorf("Unexpected parse: %v", p)
+	}
+	if parseDigest("Basic Zm9vOmJhcg==") != nil {
+		t.Error("Expected nil for basic auth")
+	}
+}
+
+func TestDigestAuth(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	d, err := newDigestAuth("devd", &Credentials{"user", "pass"}, next, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authorization := func(alg, password, nonce, uri string) string {
+		h := digestHash(alg)
+		ha1 := hexHash(h, "user", "devd", password)
+		ha2 := hexHash(h, "GET", uri)
+		resp := hexHash(h, ha1, nonce, "00000001", "abc", "auth", ha2)
+		return fmt.Sprintf(
+			`Digest username="user", realm="devd", nonce="%s", uri="%s", algorithm=%s, qop=auth, nc=00000001, cnonce="abc", response="%s"`,
+			nonce, uri, alg, resp,
+		)
+	}
+	fresh := d.nonce(time.Now())
+	var digestTests = []struct {
+		auth   string
+		status int
+		stale  bool
+	}{
+		{"", http.StatusUnauthorized, false},
+		{authorization("MD5", "pass", fresh, "/foo"), http.StatusOK, false},
+		{authorization("SHA-256", "pass", fresh, "/foo"), http.StatusOK, false},
+		{authorization("MD5", "wrong", fresh, "/foo"), http.StatusUnauthorized, false},
+		{authorization("MD5", "pass", fresh, "/other"), http.StatusUnauthorized, false},
+		{authorization("MD5", "pass", fresh+"x", "/foo"), http.StatusUnauthorized, false},
+		{
+			authorization("MD5", "pass", d.nonce(time.Now().Add(-time.Hour)), "/foo"),
+			http.StatusUnauthorized,
+			true,
+		},
+	}
+	for i, tt := range digestTests {
+		r := httptest.NewRequest("GET", "/foo", nil)
+		if tt.auth != "" {
+			r.Header.Set("Authorization", tt.auth)
+		}
+		w := httptest.NewRecorder()
+		d.ServeHTTP(w, r)
+		if w.Code != tt.status {
+			t.Errorf("Test %d: expected status %d, got %d", i, tt.status, w.Code)
+		}
+		if w.Code == http.StatusUnauthorized {
+			challenge := w.Header().Get("WWW-Authenticate")
+			want := fmt.Sprintf("stale=%v", tt.stale)
+			if len(challenge) < len(want) || challenge[len(challenge)-len(want):] != want {
+				t.Errorf("Test %d: unexpected challenge %s", i, challenge)
+			}
+		}
+	}
+}
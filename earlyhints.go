@@ -0,0 +1,8 @@
+//go:build go1.19
+// +build go1.19
+
+package devd
+
+// From Go 1.19, net/http can send informational responses before the final
+// one
+const earlyHintsSupported = true
@@ -0,0 +1,8 @@
+//go:build !go1.19
+// +build !go1.19
+
+package devd
+
+// Before Go 1.19, net/http treats any status written as final, so we can't
+// send early hints
+const earlyHintsSupported = false
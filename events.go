@@ -0,0 +1,124 @@
+package devd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// EventsPath is the Server-Sent Events stream of file changes
+const EventsPath = "/.devd/events"
+
+// Changes are dropped for clients that fall this far behind
+const eventsBacklog = 16
+
+// changeEvent is the JSON description of a Change sent to event clients
+type changeEvent struct {
+	ID      int      `json:"id"`
+	Route   string   `json:"route"`
+	Added   []string `json:"added"`
+	Deleted []string `json:"deleted"`
+	Changed []string `json:"changed"`
+}
+
+// changeBroker hands file changes to each connected event stream
+type changeBroker struct {
+	sync.Mutex
+	lastID  int
+	clients map[chan changeEvent]bool
+	closed  bool
+	done    chan struct{}
+}
+
+func newChangeBroker() *changeBroker {
+	return &changeBroker{
+		clients: make(map[chan changeEvent]bool),
+		done:    make(chan struct{}),
+	}
+}
+
+// publish sends a change to all clients. Clients that aren't keeping up miss
+// the change, rather than holding up the watcher.
+func (b *changeBroker) publish(c Change) {
+	b.Lock()
+	defer b.Unlock()
+	b.lastID++
+	ev := changeEvent{
+		ID:      b.lastID,
+		Route:   c.Route,
+		Added:   []string{},
+		Deleted: []string{},
+		Changed: []string{},
+	}
+	if c.Mod != nil {
+		ev.Added = append(ev.Added, c.Mod.Added...)
+		ev.Deleted = append(ev.Deleted, c.Mod.Deleted...)
+		ev.Changed = append(ev.Changed, c.Mod.Changed...)
+	}
+	for ch := range b.clients {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
+
+func (b *changeBroker) subscribe() chan changeEvent {
+	b.Lock()
+	defer b.Unlock()
+	ch := make(chan changeEvent, eventsBacklog)
+	b.clients[ch] = true
+	return ch
+}
+
+func (b *changeBroker) unsubscribe(ch chan changeEvent) {
+	b.Lock()
+	defer b.Unlock()
+	delete(b.clients, ch)
+}
+
+// Close ends all event streams
+func (b *changeBroker) Close() {
+	b.Lock()
+	defer b.Unlock()
+	if !b.closed {
+		b.closed = true
+		close(b.done)
+	}
+}
+
+// ServeHTTP streams changes to a client until it goes away, or the broker is
+// closed
+func (b *changeBroker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+	ch := b.subscribe()
+	defer b.unsubscribe(ch)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": devd file changes\n\n")
+	flusher.Flush()
+	for {
+		select {
+		case ev := <-ch:
+			data, err := json.Marshal(ev)
+			if err != nil {
+				return
+			}
+			_, err = fmt.Fprintf(w, "event: change\nid: %d\ndata: %s\n\n", ev.ID, data)
+			if err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		case <-b.done:
+			return
+		}
+	}
+}
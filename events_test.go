@@ -0,0 +1,58 @@
+package devd
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cortesi/moddwatch"
+)
+
+func TestChangeEvents(t *testing.T) {
+	b := newChangeBroker()
+	ts := httptest.NewServer(b)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("Unexpected content type: %s", ct)
+	}
+	rd := bufio.NewReader(resp.Body)
+	// Wait for the stream to start, so the client is subscribed
+	if line, _ := rd.ReadString('\n'); !strings.HasPrefix(line, ":") {
+		t.Fatalf("Unexpected first line: %q", line)
+	}
+	rd.ReadString('\n')
+
+	b.publish(Change{"/", &moddwatch.Mod{Changed: []string{"index.html"}}})
+	var lines []string
+	for len(lines) < 3 {
+		line, err := rd.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(lines, strings.TrimSpace(line))
+	}
+	expected := []string{
+		"event: change",
+		"id: 1",
+		`data: {"id":1,"route":"/","added":[],"deleted":[],"changed":["index.html"]}`,
+	}
+	for i := range expected {
+		if lines[i] != expected[i] {
+			t.Errorf("Expected %q, got %q", expected[i], lines[i])
+		}
+	}
+
+	b.Close()
+	if rest, err := ioutil.ReadAll(rd); err != nil || strings.TrimSpace(string(rest)) != "" {
+		t.Errorf("Expected the stream to end when the broker is closed: %q %v", rest, err)
+	}
+}
@@ -0,0 +1,199 @@
+package devd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/GeertJohan/go.rice"
+	"github.com/cortesi/devd/ricetemp"
+	"github.com/cortesi/termlog"
+)
+
+var htmlLinkRegexp = regexp.MustCompile(`(?is)\b(?:href|src)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s>]+))`)
+var cssLinkRegexp = regexp.MustCompile(`(?is)(?:url\(\s*(?:"([^"]*)"|'([^']*)'|([^)\s]*))\s*\)|@import\s+(?:"([^"]*)"|'([^']*)'))`)
+
+// findLinks returns the links in an HTML or CSS document
+func findLinks(contentType string, body []byte) []string {
+	mt, _, _ := mime.ParseMediaType(contentType)
+	var re *regexp.Regexp
+	switch mt {
+	case "text/html":
+		re = htmlLinkRegexp
+	case "text/css":
+		re = cssLinkRegexp
+	default:
+		return nil
+	}
+	links := []string{}
+	for _, m := range re.FindAllSubmatch(body, -1) {
+		for _, g := range m[1:] {
+			if len(g) > 0 {
+				links = append(links, string(g))
+				break
+			}
+		}
+	}
+	return links
+}
+
+// localPath resolves a link found on the page at base, and returns its path
+// if it refers to the site being exported. Queries and fragments are
+// dropped, since they can't be represented in a directory of files.
+func localPath(base string, link string) (string, bool) {
+	u, err := url.Parse(strings.TrimSpace(link))
+	if err != nil || u.Scheme != "" || u.Host != "" || u.Path == "" {
+		return "", false
+	}
+	p := u.Path
+	if !strings.HasPrefix(p, "/") {
+		p = path.Dir(base+"x") + "/" + p
+	}
+	dir := strings.HasSuffix(p, "/")
+	p = path.Clean(p)
+	if dir && p != "/" {
+		p += "/"
+	}
+	return p, true
+}
+
+// exportFile maps a URL path to the file it's written to. Directories get an
+// index.html.
+func exportFile(outdir string, p string) string {
+	if strings.HasSuffix(p, "/") {
+		p += "index.html"
+	}
+	return filepath.Join(outdir, filepath.FromSlash(p))
+}
+
+// BrokenLink is a link that an export couldn't follow
+type BrokenLink struct {
+	Path   string
+	Status int
+	// The page the link was found on, or empty for the start of a route
+	Referrer string
+}
+
+func (b BrokenLink) String() string {
+	if b.Referrer == "" {
+		return fmt.Sprintf("%s (%d)", b.Path, b.Status)
+	}
+	return fmt.Sprintf("%s (%d), linked from %s", b.Path, b.Status, b.Referrer)
+}
+
+// ExportResult describes the outcome of an export
+type ExportResult struct {
+	// The files written, relative to the output directory
+	Files  []string
+	Broken []BrokenLink
+}
+
+// exportHandler builds a router for exporting. It has the same routes,
+// transforms and headers as dd, but no livereload injection, hooks,
+// authentication or shaping.
+func (dd *Devd) exportHandler() (http.Handler, func(), error) {
+	templates, err := ricetemp.MakeTemplates(rice.MustFindBox("templates"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("Error loading templates: %s", err)
+	}
+	ed := &Devd{
+		Routes:        dd.Routes,
+		ServingScheme: dd.ServingScheme,
+		AddHeaders:    dd.AddHeaders,
+		Transforms:    dd.Transforms,
+		middleware:    dd.middleware,
+	}
+	logger := termlog.NewLog()
+	logger.Quiet()
+	h, err := ed.Router(logger, templates)
+	if err != nil {
+		return nil, nil, err
+	}
+	return h, ed.shutdown, nil
+}
+
+// Export crawls the site served by dd's routes, following local links in
+// HTML and CSS from the root of each route, and writes the responses to
+// outdir. Livereload is never injected. Routes on virtual hosts are skipped.
+func (dd *Devd) Export(outdir string, logger termlog.Logger) (*ExportResult, error) {
+	h, done, err := dd.exportHandler()
+	if err != nil {
+		return nil, err
+	}
+	defer done()
+
+	type link struct {
+		path     string
+		referrer string
+	}
+	queue := []link{}
+	for _, r := range dd.Routes {
+		if r.Host != "" {
+			logger.Warn("Skipping route %s: virtual hosts can't be exported", r.MuxMatch())
+			continue
+		}
+		queue = append(queue, link{r.Path, ""})
+	}
+	sort.Slice(queue, func(i, j int) bool { return queue[i].path < queue[j].path })
+
+	res := &ExportResult{Files: []string{}, Broken: []BrokenLink{}}
+	seen := make(map[string]bool)
+	for len(queue) > 0 {
+		l := queue[0]
+		queue = queue[1:]
+		if seen[l.path] {
+			continue
+		}
+		seen[l.path] = true
+
+		req, err := http.NewRequest("GET", l.path, nil)
+		if err != nil {
+			res.Broken = append(res.Broken, BrokenLink{l.path, 0, l.referrer})
+			continue
+		}
+		req.RequestURI = l.path
+		req.RemoteAddr = "127.0.0.1:0"
+		resp := &bufferedResponse{header: make(http.Header)}
+		h.ServeHTTP(resp, req)
+		if resp.status == 0 {
+			resp.status = http.StatusOK
+		}
+
+		switch {
+		case resp.status >= 300 && resp.status < 400:
+			if p, ok := localPath(l.path, resp.header.Get("Location")); ok {
+				queue = append(queue, link{p, l.referrer})
+			}
+			continue
+		case resp.status >= 400:
+			res.Broken = append(res.Broken, BrokenLink{l.path, resp.status, l.referrer})
+			continue
+		}
+
+		dst := exportFile(outdir, l.path)
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return nil, err
+		}
+		if err := ioutil.WriteFile(dst, resp.body.Bytes(), 0644); err != nil {
+			return nil, err
+		}
+		rel, _ := filepath.Rel(outdir, dst)
+		res.Files = append(res.Files, rel)
+		logger.Say("%s -> %s", l.path, rel)
+
+		for _, ref := range findLinks(resp.header.Get("Content-Type"), resp.body.Bytes()) {
+			if p, ok := localPath(l.path, ref); ok && !seen[p] {
+				queue = append(queue, link{p, l.path})
+			}
+		}
+	}
+	return res, nil
+}
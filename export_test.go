@@ -0,0 +1,98 @@
+package devd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/cortesi/termlog"
+)
+
+var localPathTests = []struct {
+	base string
+	link string
+	path string
+	ok   bool
+}{
+	{"/", "a.html", "/a.html", true},
+	{"/dir/page.html", "b.html", "/dir/b.html", true},
+	{"/dir/", "../c.css?v=1#x", "/c.css", true},
+	{"/dir/", "sub/", "/dir/sub/", true},
+	{"/dir/", "/", "/", true},
+	{"/", "http://example.com/a", "", false},
+	{"/", "//example.com/a", "", false},
+	{"/", "mailto:a@example.com", "", false},
+	{"/", "#top", "", false},
+}
+
+func TestLocalPath(t *testing.T) {
+	for i, tt := range localPathTests {
+		p, ok := localPath(tt.base, tt.link)
+		if p != tt.path || ok != tt.ok {
+			t.Errorf("Test %d: expected %q %v, got %q %v", i, tt.path, tt.ok, p, ok)
+		}
+	}
+}
+
+func TestFindLinks(t *testing.T) {
+	html := `<a href="a.html">a</a><img src='b.png'><link rel=stylesheet href=c.css>`
+	if l := findLinks("text/html; charset=utf-8", []byte(html)); !reflect.DeepEqual(l, []string{"a.html", "b.png", "c.css"}) {
+		t.Errorf("Unexpected HTML links: %v", l)
+	}
+	css := `@import "d.css"; body { background: url( 'e.png' ) } p { background: url(f.png) }`
+	if l := findLinks("text/css", []byte(css)); !reflect.DeepEqual(l, []string{"d.css", "e.png", "f.png"}) {
+		t.Errorf("Unexpected CSS links: %v", l)
+	}
+	if l := findLinks("application/json", []byte(html)); len(l) != 0 {
+		t.Errorf("Expected no links in JSON, got %v", l)
+	}
+}
+
+func TestExport(t *testing.T) {
+	logger := termlog.NewLog()
+	logger.Quiet()
+	tmp, err := ioutil.TempDir("", "devdtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	site := filepath.Join(tmp, "site")
+	writeFixtures(t, site, map[string]string{
+		"index.html":      `<html><head><link rel="stylesheet" href="style.css"></head><body><a href="docs">docs</a><a href="missing.html">x</a></body></html>`,
+		"style.css":       `body { background: url(img/bg.png) }`,
+		"img/bg.png":      `png`,
+		"docs/index.html": `<html><head></head><body><a href="../">home</a></body></html>`,
+		"unlinked.html":   `unlinked`,
+	})
+	dd := Devd{LivereloadRoutes: true}
+	if err := dd.AddRoutes([]string{site}, nil); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(tmp, "out")
+	res, err := dd.Export(out, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(res.Files)
+	expected := []string{"docs/index.html", "img/bg.png", "index.html", "style.css"}
+	for i := range expected {
+		expected[i] = filepath.FromSlash(expected[i])
+	}
+	if !reflect.DeepEqual(res.Files, expected) {
+		t.Errorf("Expected files %v, got %v", expected, res.Files)
+	}
+	if len(res.Broken) != 1 || res.Broken[0] != (BrokenLink{"/missing.html", 404, "/"}) {
+		t.Errorf("Unexpected broken links: %v", res.Broken)
+	}
+	index, err := ioutil.ReadFile(filepath.Join(out, "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(index), "livereload") {
+		t.Error("Livereload should not be injected into exported pages")
+	}
+}
@@ -0,0 +1,161 @@
+package devd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/cortesi/devd/httpctx"
+	"github.com/cortesi/termlog"
+)
+
+// A Fallback serves files from a directory when a proxied route's upstream
+// server returns 404 - the inverse of a static route with --notfound. It suits
+// sites where another server owns most paths, and a few are being developed
+// locally.
+type Fallback struct {
+	// The MuxMatch of the route the fallback applies to, or empty for all
+	// proxied routes
+	Scope string
+	Root  string
+}
+
+// AddFallbacks adds fallbacks from specifications of the form [ROUTE@]DIR
+func (dd *Devd) AddFallbacks(specs []string) error {
+	for _, s := range specs {
+		scope, root := splitRouteScope(s, dd.Routes)
+		if scope != "" {
+			if _, ok := dd.Routes[scope].Endpoint.(*forwardEndpoint); !ok {
+				return fmt.Errorf("Fallback %s is scoped to a route that isn't proxied", s)
+			}
+		}
+		fi, err := os.Stat(root)
+		if err != nil {
+			return fmt.Errorf("Invalid fallback %s: %s", s, err)
+		}
+		if !fi.IsDir() {
+			return fmt.Errorf("Invalid fallback %s: not a directory", s)
+		}
+		dd.Fallbacks = append(dd.Fallbacks, Fallback{scope, root})
+	}
+	return nil
+}
+
+// fallbackFor returns the fallback for a proxied route, preferring one
+// scoped to the route over one that applies to all of them
+func (dd *Devd) fallbackFor(match string) *Fallback {
+	var ret *Fallback
+	for i, f := range dd.Fallbacks {
+		if f.Scope == match {
+			return &dd.Fallbacks[i]
+		}
+		if f.Scope == "" && ret == nil {
+			ret = &dd.Fallbacks[i]
+		}
+	}
+	return ret
+}
+
+// notFoundWriter holds back a 404 response, so that another handler can have
+// a go. Its header map is separate from the real one, so nothing of the 404
+// leaks into the response that's finally sent.
+type notFoundWriter struct {
+	w           http.ResponseWriter
+	header      http.Header
+	code        int
+	wroteHeader bool
+	notFound    bool
+	body        bytes.Buffer
+}
+
+func newNotFoundWriter(w http.ResponseWriter) *notFoundWriter {
+	return &notFoundWriter{w: w, header: make(http.Header)}
+}
+
+func (nw *notFoundWriter) Header() http.Header {
+	return nw.header
+}
+
+func (nw *notFoundWriter) copyHeader() {
+	for k, v := range nw.header {
+		nw.w.Header()[k] = v
+	}
+}
+
+func (nw *notFoundWriter) WriteHeader(code int) {
+	if nw.wroteHeader {
+		return
+	}
+	if code >= 100 && code < 200 {
+		nw.copyHeader()
+		nw.w.WriteHeader(code)
+		return
+	}
+	nw.wroteHeader = true
+	if code == http.StatusNotFound {
+		nw.notFound = true
+		return
+	}
+	nw.copyHeader()
+	nw.w.WriteHeader(code)
+}
+
+func (nw *notFoundWriter) Write(data []byte) (int, error) {
+	if !nw.wroteHeader {
+		nw.WriteHeader(http.StatusOK)
+	}
+	if nw.notFound {
+		return nw.body.Write(data)
+	}
+	return nw.w.Write(data)
+}
+
+// replay sends the 404 that was held back
+func (nw *notFoundWriter) replay() {
+	nw.copyHeader()
+	nw.w.WriteHeader(http.StatusNotFound)
+	nw.w.Write(nw.body.Bytes())
+}
+
+func (nw *notFoundWriter) Flush() {
+	if !nw.wroteHeader || nw.notFound {
+		return
+	}
+	if f, ok := nw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (nw *notFoundWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return hijack(nw.w)
+}
+
+// handler tries a proxied route first, and serves GET and HEAD requests that
+// the upstream server doesn't know from the fallback directory. If the file
+// isn't there either, the upstream server's 404 is sent.
+func (f Fallback) handler(proxy, static httpctx.Handler) httpctx.Handler {
+	return httpctx.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" && r.Method != "HEAD" {
+			proxy.ServeHTTPContext(ctx, w, r)
+			return
+		}
+		// The route's handlers strip its prefix from the path in place
+		path, rawPath := r.URL.Path, r.URL.RawPath
+		pw := newNotFoundWriter(w)
+		proxy.ServeHTTPContext(ctx, pw, r)
+		if !pw.notFound {
+			return
+		}
+		termlog.FromContext(ctx).Say("upstream 404, falling back to %s", f.Root)
+		r.URL.Path, r.URL.RawPath = path, rawPath
+		sw := newNotFoundWriter(w)
+		static.ServeHTTPContext(ctx, sw, r)
+		if sw.notFound {
+			pw.replay()
+		}
+	})
+}
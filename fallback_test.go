@@ -0,0 +1,80 @@
+package devd
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/GeertJohan/go.rice"
+	"github.com/cortesi/devd/ricetemp"
+	"github.com/cortesi/termlog"
+)
+
+func TestFallback(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "devdtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	if err := ioutil.WriteFile(filepath.Join(tmp, "local.txt"), []byte("local"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Upstream", "yes")
+		if r.URL.Path == "/cms/page" || r.Method == "POST" {
+			w.Write([]byte("upstream"))
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("upstream 404"))
+	}))
+	defer backend.Close()
+	logger := termlog.NewLog()
+	logger.Quiet()
+	templates := ricetemp.MustMakeTemplates(rice.MustFindBox("templates"))
+
+	devd := Devd{}
+	if err := devd.AddRoutes([]string{"/cms/=" + backend.URL + "/cms/"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := devd.AddFallbacks([]string{"/nonexistent/@" + tmp}); err == nil {
+		t.Error("Expected an error for a missing route")
+	}
+	if err := devd.AddFallbacks([]string{filepath.Join(tmp, "local.txt")}); err == nil {
+		t.Error("Expected an error for a file")
+	}
+	if err := devd.AddFallbacks([]string{"/cms/@" + tmp}); err != nil {
+		t.Fatal(err)
+	}
+	h, err := devd.Router(logger, templates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ht := handlerTester{t, h}
+
+	var fallbackTests = []struct {
+		method   string
+		path     string
+		code     int
+		body     string
+		upstream bool
+	}{
+		{"GET", "/cms/page", 200, "upstream", true},
+		{"GET", "/cms/local.txt", 200, "local", false},
+		{"GET", "/cms/missing", 404, "upstream 404", true},
+		{"POST", "/cms/local.txt", 200, "upstream", true},
+	}
+	for i, tt := range fallbackTests {
+		resp := ht.Request(tt.method, tt.path, nil)
+		upstream := resp.Header().Get("X-Upstream") != ""
+		if resp.Code != tt.code || resp.Body.String() != tt.body || upstream != tt.upstream {
+			t.Errorf(
+				"Test %d: expected %d %q from upstream %v, got %d %q from upstream %v",
+				i, tt.code, tt.body, tt.upstream, resp.Code, resp.Body.String(), upstream,
+			)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package devd
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"hash/fnv"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"mime"
+	"net/http"
+	"time"
+	"unicode"
+
+	"github.com/cortesi/devd/httpctx"
+	"github.com/cortesi/termlog"
+)
+
+const faviconPath = "/favicon.ico"
+
+// The colour of the built-in favicon
+var faviconColor = color.RGBA{0x2d, 0x7d, 0x9a, 0xff}
+
+// A 5x7 pixel font for favicon letters
+var faviconGlyphs = map[rune][7]string{
+	'A': {" ### ", "#   #", "#   #", "#####", "#   #", "#   #", "#   #"},
+	'B': {"#### ", "#   #", "#   #", "#### ", "#   #", "#   #", "#### "},
+	'C': {" ### ", "#   #", "#    ", "#    ", "#    ", "#   #", " ### "},
+	'D': {"#### ", "#   #", "#   #", "#   #", "#   #", "#   #", "#### "},
+	'E': {"#####", "#    ", "#    ", "#### ", "#    ", "#    ", "#####"},
+	'F': {"#####", "#    ", "#    ", "#### ", "#    ", "#    ", "#    "},
+	'G': {" ### ", "#   #", "#    ", "# ###", "#   #", "#   #", " ####"},
+	'H': {"#   #", "#   #", "#   #", "#####", "#   #", "#   #", "#   #"},
+	'I': {" ### ", "  #  ", "  #  ", "  #  ", "  #  ", "  #  ", " ### "},
+	'J': {"  ###", "   # ", "   # ", "   # ", "   # ", "#  # ", " ##  "},
+	'K': {"#   #", "#  # ", "# #  ", "##   ", "# #  ", "#  # ", "#   #"},
+	'L': {"#    ", "#    ", "#    ", "#    ", "#    ", "#    ", "#####"},
+	'M': {"#   #", "## ##", "# # #", "# # #", "#   #", "#   #", "#   #"},
+	'N': {"#   #", "#   #", "##  #", "# # #", "#  ##", "#   #", "#   #"},
+	'O': {" ### ", "#   #", "#   #", "#   #", "#   #", "#   #", " ### "},
+	'P': {"#### ", "#   #", "#   #", "#### ", "#    ", "#    ", "#    "},
+	'Q': {" ### ", "#   #", "#   #", "#   #", "# # #", "#  # ", " ## #"},
+	'R': {"#### ", "#   #", "#   #", "#### ", "# #  ", "#  # ", "#   #"},
+	'S': {" ####", "#    ", "#    ", " ### ", "    #", "    #", "#### "},
+	'T': {"#####", "  #  ", "  #  ", "  #  ", "  #  ", "  #  ", "  #  "},
+	'U': {"#   #", "#   #", "#   #", "#   #", "#   #", "#   #", " ### "},
+	'V': {"#   #", "#   #", "#   #", "#   #", "#   #", " # # ", "  #  "},
+	'W': {"#   #", "#   #", "#   #", "# # #", "# # #", "# # #", " # # "},
+	'X': {"#   #", "#   #", " # # ", "  #  ", " # # ", "#   #", "#   #"},
+	'Y': {"#   #", "#   #", " # # ", "  #  ", "  #  ", "  #  ", "  #  "},
+	'Z': {"#####", "    #", "   # ", "  #  ", " #   ", "#    ", "#####"},
+	'0': {" ### ", "#   #", "#  ##", "# # #", "##  #", "#   #", " ### "},
+	'1': {"  #  ", " ##  ", "  #  ", "  #  ", "  #  ", "  #  ", " ### "},
+	'2': {" ### ", "#   #", "    #", "   # ", "  #  ", " #   ", "#####"},
+	'3': {"#####", "   # ", "  #  ", "   # ", "    #", "#   #", " ### "},
+	'4': {"   # ", "  ## ", " # # ", "#  # ", "#####", "   # ", "   # "},
+	'5': {"#####", "#    ", "#### ", "    #", "    #", "#   #", " ### "},
+	'6': {"  ## ", " #   ", "#    ", "#### ", "#   #", "#   #", " ### "},
+	'7': {"#####", "    #", "   # ", "  #  ", " #   ", " #   ", " #   "},
+	'8': {" ### ", "#   #", "#   #", " ### ", "#   #", "#   #", " ### "},
+	'9': {" ### ", "#   #", "#   #", " ####", "    #", "   # ", " ##  "},
+}
+
+// nameColor picks a colour for a name, so that different projects get
+// different favicons
+func nameColor(name string) color.RGBA {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	hue := float64(h.Sum32()%360) / 60
+	// HSL with a saturation of 0.6 and a lightness of 0.4
+	c := 0.48
+	x := c * (1 - math.Abs(math.Mod(hue, 2)-1))
+	var r, g, b float64
+	switch int(hue) {
+	case 0:
+		r, g = c, x
+	case 1:
+		r, g = x, c
+	case 2:
+		g, b = c, x
+	case 3:
+		g, b = x, c
+	case 4:
+		r, b = x, c
+	default:
+		r, b = c, x
+	}
+	m := 0.4 - c/2
+	v := func(f float64) uint8 { return uint8(math.Round((f + m) * 255)) }
+	return color.RGBA{v(r), v(g), v(b), 0xff}
+}
+
+// faviconImage draws a 32x32 rounded square, with the first letter or digit
+// of name on it
+func faviconImage(name string, bg color.RGBA) *image.RGBA {
+	const size, radius = 32, 6
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			// Distance into the rounded corners
+			dx := math.Max(0, math.Max(radius-float64(x)-0.5, float64(x)+0.5-(size-radius)))
+			dy := math.Max(0, math.Max(radius-float64(y)-0.5, float64(y)+0.5-(size-radius)))
+			if dx*dx+dy*dy <= radius*radius {
+				img.Set(x, y, bg)
+			}
+		}
+	}
+	var glyph [7]string
+	var ok bool
+	for _, r := range name {
+		if glyph, ok = faviconGlyphs[unicode.ToUpper(r)]; ok {
+			break
+		}
+	}
+	if !ok {
+		return img
+	}
+	// Glyph pixels are 4x3 image pixels, centred
+	const sx, sy, ox, oy = 4, 3, 6, 5
+	for row, line := range glyph {
+		for col, c := range line {
+			if c != '#' {
+				continue
+			}
+			for y := 0; y < sy; y++ {
+				for x := 0; x < sx; x++ {
+					img.Set(ox+col*sx+x, oy+row*sy+y, color.White)
+				}
+			}
+		}
+	}
+	return img
+}
+
+// makeFavicon makes an ICO file holding a PNG image. The built-in icon is
+// used if name is empty, and a letter icon coloured by the name otherwise.
+func makeFavicon(name string) ([]byte, error) {
+	bg := faviconColor
+	if name != "" {
+		bg = nameColor(name)
+	} else {
+		name = "devd"
+	}
+	var img bytes.Buffer
+	if err := png.Encode(&img, faviconImage(name, bg)); err != nil {
+		return nil, err
+	}
+	var ico bytes.Buffer
+	header := []interface{}{
+		// ICONDIR: reserved, type (icon), count
+		uint16(0), uint16(1), uint16(1),
+		// ICONDIRENTRY: width, height, palette size, reserved, planes, bits
+		// per pixel, size and offset of the image
+		uint8(32), uint8(32), uint8(0), uint8(0), uint16(1), uint16(32),
+		uint32(img.Len()), uint32(6 + 16),
+	}
+	for _, v := range header {
+		binary.Write(&ico, binary.LittleEndian, v)
+	}
+	ico.Write(img.Bytes())
+	return ico.Bytes(), nil
+}
+
+// faviconFallback serves a generated favicon in place of a 404 for
+// /favicon.ico, so that browsers stop asking and tabs can be told apart. An
+// HTML page is taken to be a not found over-ride, and replaced too.
+func faviconFallback(icon []byte, next httpctx.Handler) httpctx.Handler {
+	modtime := time.Now()
+	return httpctx.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != faviconPath || (r.Method != "GET" && r.Method != "HEAD") {
+			next.ServeHTTPContext(ctx, w, r)
+			return
+		}
+		br := &bufferedResponse{header: make(http.Header)}
+		next.ServeHTTPContext(ctx, br, r)
+		mt, _, _ := mime.ParseMediaType(br.header.Get("Content-Type"))
+		if br.status != http.StatusNotFound && mt != "text/html" {
+			for k, v := range br.header {
+				w.Header()[k] = v
+			}
+			if br.status == 0 {
+				br.status = http.StatusOK
+			}
+			w.WriteHeader(br.status)
+			w.Write(br.body.Bytes())
+			return
+		}
+		termlog.FromContext(ctx).Say("favicon: none found, serving a generated icon")
+		w.Header().Set("Content-Type", "image/x-icon")
+		http.ServeContent(w, r, faviconPath, modtime, bytes.NewReader(icon))
+	})
+}
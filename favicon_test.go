@@ -0,0 +1,78 @@
+package devd
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cortesi/devd/httpctx"
+	"github.com/cortesi/termlog"
+)
+
+func TestMakeFavicon(t *testing.T) {
+	for _, name := range []string{"", "myproject", "--"} {
+		ico, err := makeFavicon(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.HasPrefix(ico, []byte{0, 0, 1, 0, 1, 0, 32, 32}) {
+			t.Errorf("%q: unexpected ICO header % x", name, ico[:8])
+		}
+		size := binary.LittleEndian.Uint32(ico[14:18])
+		if int(size) != len(ico)-22 {
+			t.Errorf("%q: image size %d doesn't match the file", name, size)
+		}
+		img, err := png.Decode(bytes.NewReader(ico[22:]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if img.Bounds().Dx() != 32 || img.Bounds().Dy() != 32 {
+			t.Errorf("%q: unexpected image size %v", name, img.Bounds())
+		}
+	}
+	if nameColor("foo") == nameColor("bar") {
+		t.Error("Expected different colours for different names")
+	}
+}
+
+func TestFaviconFallback(t *testing.T) {
+	logger := termlog.NewLog()
+	logger.Quiet()
+	ctx := termlog.NewContext(context.Background(), logger)
+	icon := []byte("icon")
+	var faviconTests = []struct {
+		path   string
+		status int
+		ctype  string
+		body   string
+	}{
+		{"/favicon.ico", http.StatusNotFound, "text/plain", "icon"},
+		{"/favicon.ico", http.StatusOK, "text/html; charset=utf-8", "icon"},
+		{"/favicon.ico", http.StatusOK, "image/x-icon", "handler"},
+		{"/favicon.ico", http.StatusNotModified, "", ""},
+		{"/other", http.StatusNotFound, "text/plain", "handler"},
+	}
+	for i, tt := range faviconTests {
+		h := faviconFallback(icon, httpctx.HandlerFunc(
+			func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.ctype)
+				w.WriteHeader(tt.status)
+				if tt.status != http.StatusNotModified {
+					w.Write([]byte("handler"))
+				}
+			},
+		))
+		rec := httptest.NewRecorder()
+		h.ServeHTTPContext(ctx, rec, httptest.NewRequest("GET", tt.path, nil))
+		if rec.Body.String() != tt.body {
+			t.Errorf("Test %d: expected body %q, got %q", i, tt.body, rec.Body.String())
+		}
+		if tt.body == "icon" && rec.Header().Get("Content-Type") != "image/x-icon" {
+			t.Errorf("Test %d: unexpected content type %q", i, rec.Header().Get("Content-Type"))
+		}
+	}
+}
@@ -4,6 +4,7 @@
 package fileserver
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"html/template"
@@ -18,8 +19,6 @@ import (
 	"strings"
 	"time"
 
-	"golang.org/x/net/context"
-
 	"github.com/cortesi/devd/inject"
 	"github.com/cortesi/devd/routespec"
 	"github.com/cortesi/termlog"
@@ -63,10 +62,30 @@ func (p fileSlice) Swap(i, j int) {
 	p[i], p[j] = p[j], p[i]
 }
 
+// The methods a FileServer supports, for the Allow header
+const allowedMethods = "GET, HEAD, OPTIONS"
+
+// headWriter discards response bodies, so that HEAD responses get the same
+// headers as GET, including Content-Length, but no body
+type headWriter struct {
+	http.ResponseWriter
+}
+
+func (hw headWriter) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+// dirEntry is a file in a directory listing
+type dirEntry struct {
+	os.FileInfo
+	// Whether the file changed recently
+	Recent bool
+}
+
 type dirData struct {
 	Version string
 	Name    string
-	Files   fileSlice
+	Files   []dirEntry
 }
 
 type fourohfourData struct {
@@ -94,12 +113,15 @@ var errSeeker = errors.New("seeker can't seek")
 // content must be seeked to the beginning of the file.
 // The sizeFunc is called at most once. Its error, if any, is sent in the HTTP response.
 func serveContent(ci inject.CopyInject, w http.ResponseWriter, r *http.Request, name string, modtime time.Time, sizeFunc func() (int64, error), content io.ReadSeeker) error {
-	if checkLastModified(w, r, modtime) {
-		return nil
-	}
-	done := checkETag(w, r)
-	if done {
-		return nil
+	// With injection on, validators can only be checked once we know whether
+	// the body will be injected
+	if !ci.Enabled() {
+		if checkLastModified(w, r, modtime) {
+			return nil
+		}
+		if checkETag(w, r) {
+			return nil
+		}
 	}
 
 	code := http.StatusOK
@@ -138,15 +160,30 @@ func serveContent(ci inject.CopyInject, w http.ResponseWriter, r *http.Request,
 		return err
 	}
 
-	if injector.Found() {
-		size = size + int64(injector.Extra())
-	}
-
 	if size >= 0 {
 		if w.Header().Get("Content-Encoding") == "" {
 			w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
 		}
 	}
+	if injector.Found() {
+		// The injected response can't be validated by modification time,
+		// since a client may hold a copy from before injection - we use an
+		// ETag that AdjustHeaders marks as injected instead.
+		if w.Header().Get("Etag") == "" && !modtime.IsZero() && size >= 0 {
+			w.Header().Set("Etag", fmt.Sprintf(`"%x-%x"`, modtime.UnixNano(), size))
+		}
+		modtime = time.Time{}
+	}
+	inject.AdjustHeaders(w.Header(), injector)
+
+	if ci.Enabled() {
+		if checkLastModified(w, r, modtime) {
+			return nil
+		}
+		if checkETag(w, r) {
+			return nil
+		}
+	}
 
 	w.WriteHeader(code)
 	if r.Method != "HEAD" {
@@ -199,10 +236,8 @@ func checkETag(w http.ResponseWriter, r *http.Request) (done bool) {
 			return false
 		}
 
-		// TODO(bradfitz): deal with comma-separated or multiple-valued
-		// list of If-None-match values.  For now just handle the common
-		// case of a single item.
-		if inm == etag || inm == "*" {
+		// Injection weakens ETags, so we use weak comparison
+		if inject.ETagMatch(inm, etag) {
 			h := w.Header()
 			delete(h, "Content-Type")
 			delete(h, "Content-Length")
@@ -223,24 +258,87 @@ func localRedirect(w http.ResponseWriter, r *http.Request, newPath string) {
 	w.WriteHeader(http.StatusMovedPermanently)
 }
 
-// FileServer returns a handler that serves HTTP requests
-// with the contents of the file system rooted at root.
+// FileServer is a handler that serves HTTP requests
+// with the contents of the file system rooted at Root.
+//
+// New is the supported way to make one. Constructing the struct directly
+// may break as fields are added.
 //
 // To use the operating system's file system implementation,
 // use http.Dir:
 //
-//     http.Handle("/", &fileserver.FileServer{Root: http.Dir("/tmp")})
+//     http.Handle("/", fileserver.New(fileserver.Options{Root: http.Dir("/tmp")}))
 type FileServer struct {
 	Version        string
 	Root           http.FileSystem
 	Inject         inject.CopyInject
+	ListingInject  inject.CopyInject
 	Templates      *template.Template
 	NotFoundRoutes []routespec.RouteSpec
 	Prefix         string
+	Recent         func(name string) bool
+	PinRecent      bool
+}
+
+// Options configures a FileServer made with New
+type Options struct {
+	// The file system to serve. Defaults to the working directory.
+	Root http.FileSystem
+	// Shown in the footer of generated pages. Defaults to "devd".
+	Version string
+	// Content injected into served files, e.g. the livereload script
+	Inject inject.CopyInject
+	// Content injected into directory listings. Defaults to Inject.
+	ListingInject inject.CopyInject
+	// Templates with 404.html and dirlist.html pages. Plain built-in
+	// templates are used if this is nil.
+	Templates *template.Template
+	// Files served in place of a 404
+	NotFoundRoutes []routespec.RouteSpec
+	// A prefix stripped from request paths before looking up files
+	Prefix string
+	// Tells us if a file, given by its slash-separated path under Root,
+	// changed recently. Recent files are highlighted in directory listings.
+	Recent func(name string) bool
+	// List recently changed files first in directory listings
+	PinRecent bool
+}
+
+var defaultTemplates = template.Must(template.New("404.html").Parse(
+	`<html><body><h1>404: Not found</h1><p>{{.Version}}</p></body></html>` +
+		`{{define "dirlist.html"}}<html><body><h1>{{.Name}}</h1><ul>` +
+		`{{range .Files}}<li><a href="{{.Name}}">{{.Name}}{{if .IsDir}}/{{end}}</a>` +
+		`{{if .Recent}} (changed){{end}}</li>{{end}}` +
+		`</ul><p>{{.Version}}</p></body></html>{{end}}`,
+))
+
+// New makes a FileServer, filling in defaults for unset options
+func New(opts Options) *FileServer {
+	fs := &FileServer{
+		Version:        opts.Version,
+		Root:           opts.Root,
+		Inject:         opts.Inject,
+		ListingInject:  opts.ListingInject,
+		Templates:      opts.Templates,
+		NotFoundRoutes: opts.NotFoundRoutes,
+		Prefix:         opts.Prefix,
+		Recent:         opts.Recent,
+		PinRecent:      opts.PinRecent,
+	}
+	if fs.Version == "" {
+		fs.Version = "devd"
+	}
+	if fs.Root == nil {
+		fs.Root = http.Dir(".")
+	}
+	if fs.Templates == nil {
+		fs.Templates = defaultTemplates
+	}
+	return fs
 }
 
 func (fserver *FileServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	fserver.ServeHTTPContext(context.Background(), w, r)
+	fserver.ServeHTTPContext(r.Context(), w, r)
 }
 
 // ServeHTTPContext is like ServeHTTP, but with added context
@@ -250,6 +348,20 @@ func (fserver *FileServer) ServeHTTPContext(
 	logger := termlog.FromContext(ctx)
 	logger.SayAs("debug", "debug fileserver: serving with FileServer...")
 
+	switch r.Method {
+	case "GET":
+	case "HEAD":
+		w = headWriter{w}
+	case "OPTIONS":
+		w.Header().Set("Allow", allowedMethods)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	default:
+		w.Header().Set("Allow", allowedMethods)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
 	upath := stripPrefix(fserver.Prefix, r.URL.Path)
 	if !strings.HasPrefix(upath, "/") {
 		upath = "/" + upath
@@ -332,12 +444,28 @@ func (fserver *FileServer) dirList(logger termlog.Logger, w http.ResponseWriter,
 	}
 	sortedFiles := fileSlice(files)
 	sort.Sort(sortedFiles)
+	entries := make([]dirEntry, len(sortedFiles))
+	for i, fi := range sortedFiles {
+		entries[i].FileInfo = fi
+		if fserver.Recent != nil {
+			entries[i].Recent = fserver.Recent(path.Join(name, fi.Name()))
+		}
+	}
+	if fserver.PinRecent {
+		sort.SliceStable(entries, func(i, j int) bool {
+			return entries[i].Recent && !entries[j].Recent
+		})
+	}
 	data := dirData{
 		Version: fserver.Version,
 		Name:    name,
-		Files:   sortedFiles,
+		Files:   entries,
+	}
+	ci := fserver.ListingInject
+	if ci.Payload == nil {
+		ci = fserver.Inject
 	}
-	err = fserver.Inject.ServeTemplate(
+	err = ci.ServeTemplate(
 		http.StatusOK,
 		w,
 		fserver.Templates.Lookup("dirlist.html"),
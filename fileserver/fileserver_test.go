@@ -16,6 +16,7 @@ import (
 	"path"
 	"path/filepath"
 	"reflect"
+	"regexp"
 	"runtime"
 	"strconv"
 	"strings"
@@ -36,14 +37,11 @@ func ServeFile(w http.ResponseWriter, r *http.Request, name string) {
 	logger := termlog.NewLog()
 	logger.Quiet()
 
-	fs := FileServer{
-		"version",
-		http.Dir(dir),
-		inject.CopyInject{},
-		ricetemp.MustMakeTemplates(rice.MustFindBox("../templates")),
-		[]routespec.RouteSpec{},
-		"",
-	}
+	fs := New(Options{
+		Version:   "version",
+		Root:      http.Dir(dir),
+		Templates: ricetemp.MustMakeTemplates(rice.MustFindBox("../templates")),
+	})
 	fs.serveFile(logger, w, r, file, false)
 }
 
@@ -164,14 +162,11 @@ func TestFSRedirect(t *testing.T) {
 	ts := httptest.NewServer(
 		http.StripPrefix(
 			"/test",
-			&FileServer{
-				"version",
-				http.Dir("."),
-				inject.CopyInject{},
-				ricetemp.MustMakeTemplates(rice.MustFindBox("../templates")),
-				[]routespec.RouteSpec{},
-				"",
-			},
+			New(Options{
+				Version:   "version",
+				Root:      http.Dir("."),
+				Templates: ricetemp.MustMakeTemplates(rice.MustFindBox("../templates")),
+			}),
 		),
 	)
 	defer ts.Close()
@@ -199,19 +194,16 @@ func (fs *testFileSystem) Open(name string) (http.File, error) {
 func _TestFileServerCleans(t *testing.T) {
 	defer afterTest(t)
 	ch := make(chan string, 1)
-	fs := &FileServer{
-		"version",
-		&testFileSystem{
+	fs := New(Options{
+		Version: "version",
+		Root: &testFileSystem{
 			func(name string) (http.File, error) {
 				ch <- name
 				return nil, errors.New("file does not exist")
 			},
 		},
-		inject.CopyInject{},
-		ricetemp.MustMakeTemplates(rice.MustFindBox("../templates")),
-		[]routespec.RouteSpec{},
-		"",
-	}
+		Templates: ricetemp.MustMakeTemplates(rice.MustFindBox("../templates")),
+	})
 	tests := []struct {
 		reqPath, openArg string
 	}{
@@ -246,14 +238,11 @@ func TestFileServerImplicitLeadingSlash(t *testing.T) {
 	if err := ioutil.WriteFile(filepath.Join(tempDir, "foo.txt"), []byte("Hello world"), 0644); err != nil {
 		t.Fatalf("WriteFile: %v", err)
 	}
-	fs := &FileServer{
-		"version",
-		http.Dir(tempDir),
-		inject.CopyInject{},
-		ricetemp.MustMakeTemplates(rice.MustFindBox("../templates")),
-		[]routespec.RouteSpec{},
-		"",
-	}
+	fs := New(Options{
+		Version:   "version",
+		Root:      http.Dir(tempDir),
+		Templates: ricetemp.MustMakeTemplates(rice.MustFindBox("../templates")),
+	})
 
 	ts := httptest.NewServer(http.StripPrefix("/bar/", fs))
 	defer ts.Close()
@@ -410,14 +399,11 @@ func TestServeIndexHtml(t *testing.T) {
 	defer afterTest(t)
 	const want = "index.html says hello"
 
-	fs := &FileServer{
-		"version",
-		http.Dir("."),
-		inject.CopyInject{},
-		ricetemp.MustMakeTemplates(rice.MustFindBox("../templates")),
-		[]routespec.RouteSpec{},
-		"",
-	}
+	fs := New(Options{
+		Version:   "version",
+		Root:      http.Dir("."),
+		Templates: ricetemp.MustMakeTemplates(rice.MustFindBox("../templates")),
+	})
 	ts := httptest.NewServer(fs)
 	defer ts.Close()
 
@@ -439,14 +425,11 @@ func TestServeIndexHtml(t *testing.T) {
 
 func TestFileServerZeroByte(t *testing.T) {
 	defer afterTest(t)
-	fs := &FileServer{
-		"version",
-		http.Dir("."),
-		inject.CopyInject{},
-		ricetemp.MustMakeTemplates(rice.MustFindBox("../templates")),
-		[]routespec.RouteSpec{},
-		"",
-	}
+	fs := New(Options{
+		Version:   "version",
+		Root:      http.Dir("."),
+		Templates: ricetemp.MustMakeTemplates(rice.MustFindBox("../templates")),
+	})
 	ts := httptest.NewServer(fs)
 	defer ts.Close()
 
@@ -534,16 +517,14 @@ func TestNotFoundOverride(t *testing.T) {
 		"/one/foo.html": ffile,
 	}
 
-	fs := &FileServer{
-		"version",
-		fsys,
-		inject.CopyInject{},
-		ricetemp.MustMakeTemplates(rice.MustFindBox("../templates")),
-		[]routespec.RouteSpec{
+	fs := New(Options{
+		Version:   "version",
+		Root:      fsys,
+		Templates: ricetemp.MustMakeTemplates(rice.MustFindBox("../templates")),
+		NotFoundRoutes: []routespec.RouteSpec{
 			{Host: "", Path: "/", Value: "foo.html"},
 		},
-		"",
-	}
+	})
 
 	ts := httptest.NewServer(fs)
 	defer ts.Close()
@@ -606,14 +587,11 @@ func TestDirectoryIfNotModified(t *testing.T) {
 		"/index.html": indexFile,
 	}
 
-	fs := &FileServer{
-		"version",
-		fsys,
-		inject.CopyInject{},
-		ricetemp.MustMakeTemplates(rice.MustFindBox("../templates")),
-		[]routespec.RouteSpec{},
-		"",
-	}
+	fs := New(Options{
+		Version:   "version",
+		Root:      fsys,
+		Templates: ricetemp.MustMakeTemplates(rice.MustFindBox("../templates")),
+	})
 
 	ts := httptest.NewServer(fs)
 	defer ts.Close()
@@ -835,3 +813,159 @@ func getBody(t *testing.T, testName string, req http.Request) (*http.Response, [
 }
 
 type panicOnSeek struct{ io.ReadSeeker }
+
+func TestNewDefaults(t *testing.T) {
+	defer afterTest(t)
+	fs := New(Options{})
+	if fs.Version != "devd" {
+		t.Errorf("Unexpected default version: %s", fs.Version)
+	}
+	ts := httptest.NewServer(fs)
+	defer ts.Close()
+
+	for path, code := range map[string]int{"/": 200, "/nonexistent": 404} {
+		res, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(res.Body)
+		_ = res.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != code {
+			t.Errorf("%s: got status %d, want %d", path, res.StatusCode, code)
+		}
+		if !strings.Contains(string(b), "devd") {
+			t.Errorf("%s: expected version in page: %s", path, b)
+		}
+	}
+}
+
+func TestMethods(t *testing.T) {
+	defer afterTest(t)
+	fs := New(Options{
+		Version:   "version",
+		Root:      http.Dir("."),
+		Templates: ricetemp.MustMakeTemplates(rice.MustFindBox("../templates")),
+	})
+	tests := []struct {
+		method string
+		path   string
+		code   int
+		body   bool
+		allow  bool
+	}{
+		{"GET", "/testdata/index.html", 301, false, false},
+		{"GET", "/testdata/style.css", 200, true, false},
+		{"HEAD", "/testdata/style.css", 200, false, false},
+		{"HEAD", "/", 200, false, false},
+		{"HEAD", "/nonexistent", 404, false, false},
+		{"OPTIONS", "/testdata/style.css", 204, false, true},
+		{"POST", "/testdata/style.css", 405, true, true},
+		{"DELETE", "/", 405, true, true},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		fs.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+		if w.Code != tt.code {
+			t.Errorf("%s %s: got status %d, want %d", tt.method, tt.path, w.Code, tt.code)
+		}
+		if (w.Body.Len() > 0) != tt.body {
+			t.Errorf("%s %s: unexpected body %q", tt.method, tt.path, w.Body.String())
+		}
+		if (w.Header().Get("Allow") != "") != tt.allow {
+			t.Errorf("%s %s: unexpected Allow header %q", tt.method, tt.path, w.Header().Get("Allow"))
+		}
+	}
+
+	w := httptest.NewRecorder()
+	fs.ServeHTTP(w, httptest.NewRequest("HEAD", "/testdata/style.css", nil))
+	if w.Header().Get("Content-Length") == "" {
+		t.Error("Expected Content-Length on HEAD response")
+	}
+}
+
+func TestDirListRecent(t *testing.T) {
+	defer afterTest(t)
+	tempDir, err := ioutil.TempDir("", "devdtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+	for _, name := range []string{"file", "style.css"} {
+		if err := ioutil.WriteFile(filepath.Join(tempDir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, pin := range []bool{false, true} {
+		fs := New(Options{
+			Version:   "version",
+			Root:      http.Dir(tempDir),
+			Templates: ricetemp.MustMakeTemplates(rice.MustFindBox("../templates")),
+			Recent:    func(name string) bool { return name == "/style.css" },
+			PinRecent: pin,
+		})
+		w := httptest.NewRecorder()
+		fs.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		body := w.Body.String()
+		if strings.Count(body, `class="badge"`) != 1 {
+			t.Errorf("pin %v: expected one recent file in listing: %s", pin, body)
+		}
+		first := strings.Index(body, "style.css") < strings.Index(body, ">file<")
+		if first != pin {
+			t.Errorf("pin %v: unexpected listing order: %s", pin, body)
+		}
+	}
+}
+
+func TestInjectedValidators(t *testing.T) {
+	defer afterTest(t)
+	tempDir, err := ioutil.TempDir("", "devdtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+	page := []byte("<html><head></head></html>")
+	if err := ioutil.WriteFile(filepath.Join(tempDir, "page.html"), page, 0644); err != nil {
+		t.Fatal(err)
+	}
+	fs := New(Options{
+		Root: http.Dir(tempDir),
+		Inject: inject.CopyInject{
+			Within:      1024,
+			ContentType: "text/html",
+			Marker:      regexp.MustCompile(`</head>`),
+			Payload:     []byte("<script></script>"),
+		},
+	})
+	get := func(header string, value string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/page.html", nil)
+		if header != "" {
+			r.Header.Set(header, value)
+		}
+		fs.ServeHTTP(w, r)
+		return w
+	}
+
+	w := get("", "")
+	etag := w.Header().Get("Etag")
+	if w.Code != 200 || !strings.HasPrefix(etag, `W/"`) || !strings.HasSuffix(etag, `+devd"`) {
+		t.Fatalf("Expected a marked ETag, got %d %q", w.Code, etag)
+	}
+	if w.Header().Get("Last-Modified") != "" {
+		t.Error("Unexpected Last-Modified on an injected response")
+	}
+	if w = get("If-None-Match", etag); w.Code != 304 {
+		t.Errorf("Expected the injected copy to be revalidated, got %d", w.Code)
+	}
+	unmarked := strings.TrimSuffix(strings.TrimPrefix(etag, "W/"), `+devd"`) + `"`
+	if w = get("If-None-Match", unmarked); w.Code != 200 {
+		t.Errorf("Expected a copy without injection to be replaced, got %d", w.Code)
+	}
+	future := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	if w = get("If-Modified-Since", future); w.Code != 200 {
+		t.Errorf("Expected a copy without injection to be replaced, got %d", w.Code)
+	}
+}
@@ -0,0 +1,52 @@
+package devd
+
+import (
+	"fmt"
+	"html/template"
+	"net/url"
+	"os"
+
+	"github.com/cortesi/devd/graphqlmock"
+	"github.com/cortesi/devd/httpctx"
+	"github.com/cortesi/devd/inject"
+)
+
+func init() {
+	RegisterEndpoint("graphql", func(value string) (Endpoint, error) { return newGraphQLEndpoint(value) })
+}
+
+// An endpoint that answers GraphQL requests from a directory with a schema
+// and fixtures - see the graphqlmock package
+type graphqlEndpoint struct {
+	Root string
+}
+
+func newGraphQLEndpoint(value string) (*graphqlEndpoint, error) {
+	u, err := url.Parse(value)
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse route URL: %s", err)
+	}
+	root := u.Opaque
+	if root == "" {
+		root = u.Path
+	}
+	if root == "" {
+		return nil, fmt.Errorf("No mock directory: %s", value)
+	}
+	fi, err := os.Stat(root)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read mock directory: %s", err)
+	}
+	if !fi.IsDir() {
+		return nil, fmt.Errorf("Not a directory: %s", root)
+	}
+	return &graphqlEndpoint{root}, nil
+}
+
+func (ep graphqlEndpoint) String() string {
+	return "GraphQL mock from " + ep.Root
+}
+
+func (ep graphqlEndpoint) Handler(prefix string, templates *template.Template, ci inject.CopyInject) httpctx.Handler {
+	return httpctx.StripPrefix(prefix, graphqlmock.New(ep.Root))
+}
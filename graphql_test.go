@@ -0,0 +1,40 @@
+package devd
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/cortesi/devd/inject"
+)
+
+func TestGraphQLEndpoint(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "devdtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	writeFixtures(t, tmp, map[string]string{"Query/hello.json": `"world"`})
+
+	if _, err := newGraphQLEndpoint("graphql:" + filepath.Join(tmp, "nonexistent")); err == nil {
+		t.Error("Expected error for missing directory")
+	}
+	r, err := newRoute("/graphql=graphql:"+tmp, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := r.Endpoint.Handler("", nil, inject.CopyInject{})
+	rec := httptest.NewRecorder()
+	h.ServeHTTPContext(
+		context.Background(),
+		rec,
+		httptest.NewRequest("POST", "/graphql", strings.NewReader(`{"query": "{ hello }"}`)),
+	)
+	if rec.Body.String() != `{"data":{"hello":"world"}}` {
+		t.Errorf("Unexpected response: %s", rec.Body.String())
+	}
+}
@@ -0,0 +1,341 @@
+// Package graphqlmock serves canned responses to GraphQL requests, so that
+// GraphQL frontends can be developed without a backend.
+//
+// A mock is a directory. An optional schema.graphql file holds the schema,
+// which is used to answer introspection queries and to check that queried
+// fields exist. Responses come from JSON fixtures, which are Go templates:
+//
+//	OperationName.json   the whole response for a named operation
+//	Query/field.json     the value of a top-level field of a query
+//	Mutation/field.json  the value of a top-level field of a mutation
+//
+// Nested selections aren't resolved - a field fixture is returned whole,
+// whatever the request selects from it.
+package graphqlmock
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	texttemplate "text/template"
+
+	"github.com/cortesi/termlog"
+)
+
+// SchemaFile is the name of the schema file in a mock directory
+const SchemaFile = "schema.graphql"
+
+// Mock answers GraphQL requests from a directory of fixtures
+type Mock struct {
+	Root string
+}
+
+// New makes a Mock that serves fixtures from root
+func New(root string) *Mock {
+	return &Mock{Root: root}
+}
+
+// Request is a GraphQL request
+type Request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+type gqlError struct {
+	Message string   `json:"message"`
+	Path    []string `json:"path,omitempty"`
+}
+
+// The data available to fixture templates
+type fixtureData struct {
+	OperationName string
+	Variables     map[string]interface{}
+	// Field arguments, for field fixtures
+	Args map[string]interface{}
+}
+
+var fixtureFuncs = texttemplate.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// readRequest gets a GraphQL request from the query string of a GET, or the
+// body of a POST
+func readRequest(r *http.Request) (*Request, error) {
+	req := &Request{}
+	switch r.Method {
+	case "GET", "HEAD":
+		q := r.URL.Query()
+		req.Query = q.Get("query")
+		req.OperationName = q.Get("operationName")
+		if v := q.Get("variables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+				return nil, fmt.Errorf("Invalid variables: %s", err)
+			}
+		}
+	case "POST":
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return nil, err
+		}
+		mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if mt == "application/graphql" {
+			req.Query = string(body)
+		} else if err := json.Unmarshal(body, req); err != nil {
+			return nil, fmt.Errorf("Invalid request body: %s", err)
+		}
+	default:
+		return nil, nil
+	}
+	if req.Variables == nil {
+		req.Variables = make(map[string]interface{})
+	}
+	return req, nil
+}
+
+func writeJSON(w http.ResponseWriter, code int, body []byte) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(body)
+}
+
+func writeErrors(w http.ResponseWriter, code int, errs ...gqlError) {
+	body, _ := json.Marshal(map[string]interface{}{"errors": errs})
+	writeJSON(w, code, body)
+}
+
+// loadSchema reads the mock's schema, or returns nil if it doesn't have one
+func (m *Mock) loadSchema() (*Schema, error) {
+	src, err := ioutil.ReadFile(filepath.Join(m.Root, SchemaFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	s, err := ParseSchema(string(src))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", SchemaFile, err)
+	}
+	return s, nil
+}
+
+// fixture renders a fixture file, and checks that the result is JSON. It
+// returns nil if the file doesn't exist.
+func fixture(path string, data fixtureData) (json.RawMessage, error) {
+	src, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	t, err := texttemplate.New(filepath.Base(path)).Funcs(fixtureFuncs).Parse(string(src))
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+	if !json.Valid(buf.Bytes()) {
+		return nil, fmt.Errorf("%s is not valid JSON", path)
+	}
+	return json.RawMessage(bytes.TrimSpace(buf.Bytes())), nil
+}
+
+// argValues turns GraphQL argument source into values for templates.
+// Variables are looked up, literals that are also JSON are decoded, and
+// anything else - like enum values - is passed on as text.
+func argValues(args map[string]string, vars map[string]interface{}) map[string]interface{} {
+	ret := make(map[string]interface{})
+	for k, v := range args {
+		if strings.HasPrefix(v, "$") {
+			ret[k] = vars[v[1:]]
+			continue
+		}
+		var decoded interface{}
+		if err := json.Unmarshal([]byte(v), &decoded); err == nil {
+			ret[k] = decoded
+		} else {
+			ret[k] = v
+		}
+	}
+	return ret
+}
+
+// rootType finds the name of the root type for an operation
+func rootType(s *Schema, opType string) string {
+	if s != nil {
+		switch opType {
+		case "query":
+			return s.Query
+		case "mutation":
+			return s.Mutation
+		case "subscription":
+			return s.Subscription
+		}
+	}
+	return strings.ToUpper(opType[:1]) + opType[1:]
+}
+
+// resolve builds a response from field fixtures. The response is assembled
+// by hand, so that fields come out in the order they were asked for.
+func (m *Mock) resolve(s *Schema, op *Operation, req *Request) ([]byte, error) {
+	root := rootType(s, op.Type)
+	if root == "" {
+		return nil, fmt.Errorf("Schema has no %s type", op.Type)
+	}
+	errs := []gqlError{}
+	var data bytes.Buffer
+	data.WriteString("{")
+	for i, sel := range op.Selections {
+		var val json.RawMessage
+		var err error
+		switch {
+		case sel.Name == "__typename":
+			val, _ = json.Marshal(root)
+		case sel.Name == "__schema" && s != nil:
+			val, err = json.Marshal(s.Introspect())
+		case sel.Name == "__schema":
+			err = fmt.Errorf("No %s in mock directory", SchemaFile)
+		case s != nil && s.Types[root].Field(sel.Name) == nil:
+			err = fmt.Errorf("Cannot query field %q on type %q", sel.Name, root)
+		default:
+			val, err = fixture(
+				filepath.Join(m.Root, root, sel.Name+".json"),
+				fixtureData{
+					OperationName: op.Name,
+					Variables:     req.Variables,
+					Args:          argValues(sel.Args, req.Variables),
+				},
+			)
+			if err == nil && val == nil {
+				err = fmt.Errorf("No fixture for %s.%s", root, sel.Name)
+			}
+		}
+		if err != nil {
+			errs = append(errs, gqlError{err.Error(), []string{sel.Alias}})
+			val = json.RawMessage("null")
+		}
+		if i > 0 {
+			data.WriteString(",")
+		}
+		key, _ := json.Marshal(sel.Alias)
+		data.Write(key)
+		data.WriteString(":")
+		data.Write(val)
+	}
+	data.WriteString("}")
+
+	var resp bytes.Buffer
+	resp.WriteString(`{"data":`)
+	resp.Write(data.Bytes())
+	if len(errs) > 0 {
+		e, _ := json.Marshal(errs)
+		resp.WriteString(`,"errors":`)
+		resp.Write(e)
+	}
+	resp.WriteString("}")
+	return resp.Bytes(), nil
+}
+
+func wantsHTML(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/html")
+}
+
+// ServeHTTPContext answers a GraphQL request. GET requests from browsers
+// without a query get GraphiQL.
+func (m *Mock) ServeHTTPContext(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	log := termlog.FromContext(ctx)
+	req, err := readRequest(r)
+	if err != nil {
+		writeErrors(w, http.StatusBadRequest, gqlError{Message: err.Error()})
+		return
+	}
+	if req == nil {
+		w.Header().Set("Allow", "GET, HEAD, POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if req.Query == "" && r.Method != "POST" && wantsHTML(r) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		graphiql.Execute(w, nil)
+		return
+	}
+
+	s, err := m.loadSchema()
+	if err != nil {
+		log.Warn("graphql: %s", err)
+		writeErrors(w, http.StatusInternalServerError, gqlError{Message: err.Error()})
+		return
+	}
+	op, err := ParseOperation(req.Query, req.OperationName)
+	if err != nil {
+		writeErrors(w, http.StatusBadRequest, gqlError{Message: err.Error()})
+		return
+	}
+	if op.Name != "" {
+		log.Say("graphql: %s %s", op.Type, op.Name)
+		body, err := fixture(
+			filepath.Join(m.Root, op.Name+".json"),
+			fixtureData{OperationName: op.Name, Variables: req.Variables},
+		)
+		if err != nil {
+			log.Warn("graphql: %s", err)
+			writeErrors(w, http.StatusInternalServerError, gqlError{Message: err.Error()})
+			return
+		}
+		if body != nil {
+			writeJSON(w, http.StatusOK, body)
+			return
+		}
+	}
+	body, err := m.resolve(s, op, req)
+	if err != nil {
+		writeErrors(w, http.StatusBadRequest, gqlError{Message: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, body)
+}
+
+func (m *Mock) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.ServeHTTPContext(r.Context(), w, r)
+}
+
+// The GraphiQL page loads its scripts from a CDN. Versions are pinned, so the
+// page doesn't change underneath us when new releases are published.
+var graphiql = template.Must(template.New("graphiql").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<title>GraphiQL</title>
+<style>
+body { margin: 0; height: 100vh; overflow: hidden; }
+#graphiql { height: 100vh; }
+</style>
+<script crossorigin src="https://unpkg.com/react@18.3.1/umd/react.production.min.js"></script>
+<script crossorigin src="https://unpkg.com/react-dom@18.3.1/umd/react-dom.production.min.js"></script>
+<link rel="stylesheet" href="https://unpkg.com/graphiql@3.0.0/graphiql.min.css" />
+</head>
+<body>
+<div id="graphiql">Loading GraphiQL...</div>
+<script crossorigin src="https://unpkg.com/graphiql@3.0.0/graphiql.min.js"></script>
+<script>
+ReactDOM.createRoot(document.getElementById("graphiql")).render(
+  React.createElement(GraphiQL, {
+    fetcher: GraphiQL.createFetcher({ url: window.location.pathname }),
+  })
+);
+</script>
+</body>
+</html>
+`))
@@ -0,0 +1,152 @@
+package graphqlmock
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func mockDir(t *testing.T, files map[string]string) string {
+	tmp, err := ioutil.TempDir("", "devdtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range files {
+		p := filepath.Join(tmp, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return tmp
+}
+
+func post(m *Mock, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/graphql", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	m.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestMock(t *testing.T) {
+	root := mockDir(t, map[string]string{
+		"schema.graphql":           testSchema,
+		"Query/me.json":            `{"id": "1", "name": "Me"}`,
+		"Query/node.json":          `{"id": {{json .Args.id}}}`,
+		"Mutation/createUser.json": `{"id": "2", "name": {{json .Variables.input.name}}}`,
+		"Named.json":               `{"data": {"me": null}, "extensions": {"op": "{{.OperationName}}"}}`,
+		"Query/search.json":        `not json`,
+	})
+	defer os.RemoveAll(root)
+	m := New(root)
+
+	var mockTests = []struct {
+		body string
+		code int
+		resp string
+	}{
+		{
+			`{"query": "{ me { id } x: node(id: \"7\") { id } __typename }"}`,
+			200,
+			`{"data":{"me":{"id": "1", "name": "Me"},"x":{"id": "7"},"__typename":"Query"}}`,
+		},
+		{
+			`{"query": "query Q($id: ID!) { node(id: $id) { id } }", "variables": {"id": "9"}}`,
+			200,
+			`{"data":{"node":{"id": "9"}}}`,
+		},
+		{
+			`{"query": "mutation M($input: NewUser!) { createUser(input: $input) { id } }", "variables": {"input": {"name": "Al"}}}`,
+			200,
+			`{"data":{"createUser":{"id": "2", "name": "Al"}}}`,
+		},
+		{
+			`{"query": "query Named { me { id } }"}`,
+			200,
+			`{"data": {"me": null}, "extensions": {"op": "Named"}}`,
+		},
+		{
+			`{"query": "{ nope }"}`,
+			200,
+			`{"data":{"nope":null},"errors":[{"message":"Cannot query field \"nope\" on type \"Query\"","path":["nope"]}]}`,
+		},
+		{`{"query": "{ search(text: \"x\") }"}`, 200, ""},
+		{`{"query": "{ me "}`, 400, ""},
+		{`not json`, 400, ""},
+	}
+	for i, tt := range mockTests {
+		rec := post(m, tt.body)
+		if rec.Code != tt.code {
+			t.Errorf("Test %d: expected code %d, got %d: %s", i, tt.code, rec.Code, rec.Body.String())
+			continue
+		}
+		if tt.resp != "" && rec.Body.String() != tt.resp {
+			t.Errorf("Test %d: expected %s, got %s", i, tt.resp, rec.Body.String())
+		}
+		if !json.Valid(rec.Body.Bytes()) {
+			t.Errorf("Test %d: invalid JSON %s", i, rec.Body.String())
+		}
+	}
+
+	rec := post(m, `{"query": "{ __schema { queryType { name } } }"}`)
+	var intro struct {
+		Data struct {
+			Schema struct {
+				QueryType struct{ Name string }
+			} `json:"__schema"`
+		}
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &intro); err != nil {
+		t.Fatal(err)
+	}
+	if intro.Data.Schema.QueryType.Name != "Query" {
+		t.Errorf("Unexpected introspection result: %s", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("GET", "/graphql?query="+url.QueryEscape("{ me { id } }"), nil))
+	if !strings.Contains(rec.Body.String(), `"me":{"id": "1"`) {
+		t.Errorf("Unexpected GET response: %s", rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/graphql", nil)
+	req.Header.Set("Accept", "text/html")
+	m.ServeHTTP(rec, req)
+	if !strings.Contains(rec.Body.String(), "GraphiQL") {
+		t.Error("Expected GraphiQL for browsers")
+	}
+
+	rec = httptest.NewRecorder()
+	m.ServeHTTP(rec, httptest.NewRequest("PUT", "/graphql", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405, got %d", rec.Code)
+	}
+}
+
+func TestMockWithoutSchema(t *testing.T) {
+	root := mockDir(t, map[string]string{"Query/anything.json": `[1, 2]`})
+	defer os.RemoveAll(root)
+	m := New(root)
+	rec := post(m, `{"query": "{ anything missing }"}`)
+	expected := `{"data":{"anything":[1, 2],"missing":null},"errors":[{"message":"No fixture for Query.missing","path":["missing"]}]}`
+	if rec.Body.String() != expected {
+		t.Errorf("Expected %s, got %s", expected, rec.Body.String())
+	}
+	rec = httptest.NewRecorder()
+	req := httptest.NewRequest("POST", "/graphql", strings.NewReader("{ anything }"))
+	req.Header.Set("Content-Type", "application/graphql")
+	m.ServeHTTP(rec, req)
+	if rec.Body.String() != `{"data":{"anything":[1, 2]}}` {
+		t.Errorf("Unexpected response: %s", rec.Body.String())
+	}
+}
@@ -0,0 +1,263 @@
+package graphqlmock
+
+import (
+	"fmt"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokPunct
+	tokName
+	tokString
+	tokNumber
+	tokVariable
+)
+
+type token struct {
+	kind tokenKind
+	// The token's text. Strings are unquoted.
+	val string
+	// Offsets of the token in the source
+	start int
+	end   int
+}
+
+// lexer splits GraphQL source into tokens. Commas and comments are
+// insignificant in GraphQL, so they're skipped along with whitespace.
+type lexer struct {
+	src  string
+	pos  int
+	peek *token
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isNameChar(c byte) bool {
+	return isNameStart(c) || c >= '0' && c <= '9'
+}
+
+func (l *lexer) skipIgnored() {
+	for l.pos < len(l.src) {
+		switch c := l.src[l.pos]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			l.pos++
+		case c == '#':
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' {
+				l.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (l *lexer) lex() (token, error) {
+	l.skipIgnored()
+	start := l.pos
+	if l.pos >= len(l.src) {
+		return token{kind: tokEOF, start: start, end: start}, nil
+	}
+	c := l.src[l.pos]
+	switch {
+	case strings.HasPrefix(l.src[l.pos:], "..."):
+		l.pos += 3
+		return token{tokPunct, "...", start, l.pos}, nil
+	case strings.IndexByte("!():=@[]{}|&", c) >= 0:
+		l.pos++
+		return token{tokPunct, string(c), start, l.pos}, nil
+	case c == '$':
+		l.pos++
+		for l.pos < len(l.src) && isNameChar(l.src[l.pos]) {
+			l.pos++
+		}
+		return token{tokVariable, l.src[start+1 : l.pos], start, l.pos}, nil
+	case isNameStart(c):
+		for l.pos < len(l.src) && isNameChar(l.src[l.pos]) {
+			l.pos++
+		}
+		return token{tokName, l.src[start:l.pos], start, l.pos}, nil
+	case c == '-' || c >= '0' && c <= '9':
+		l.pos++
+		for l.pos < len(l.src) && strings.IndexByte("0123456789.eE+-", l.src[l.pos]) >= 0 {
+			l.pos++
+		}
+		return token{tokNumber, l.src[start:l.pos], start, l.pos}, nil
+	case strings.HasPrefix(l.src[l.pos:], `"""`):
+		end := strings.Index(l.src[l.pos+3:], `"""`)
+		if end < 0 {
+			return token{}, fmt.Errorf("Unterminated block string at offset %d", start)
+		}
+		val := l.src[l.pos+3 : l.pos+3+end]
+		l.pos += end + 6
+		return token{tokString, strings.TrimSpace(val), start, l.pos}, nil
+	case c == '"':
+		var b strings.Builder
+		l.pos++
+		for {
+			if l.pos >= len(l.src) || l.src[l.pos] == '\n' {
+				return token{}, fmt.Errorf("Unterminated string at offset %d", start)
+			}
+			c := l.src[l.pos]
+			l.pos++
+			if c == '"' {
+				break
+			}
+			if c == '\\' && l.pos < len(l.src) {
+				c = l.src[l.pos]
+				l.pos++
+				switch c {
+				case 'n':
+					c = '\n'
+				case 't':
+					c = '\t'
+				}
+			}
+			b.WriteByte(c)
+		}
+		return token{tokString, b.String(), start, l.pos}, nil
+	}
+	return token{}, fmt.Errorf("Unexpected character %q at offset %d", c, start)
+}
+
+// next returns the next token
+func (l *lexer) next() (token, error) {
+	if l.peek != nil {
+		t := *l.peek
+		l.peek = nil
+		return t, nil
+	}
+	return l.lex()
+}
+
+// look returns the next token without consuming it
+func (l *lexer) look() (token, error) {
+	if l.peek == nil {
+		t, err := l.lex()
+		if err != nil {
+			return t, err
+		}
+		l.peek = &t
+	}
+	return *l.peek, nil
+}
+
+// is checks whether the next token is a punctuator or name with value val
+func (l *lexer) is(val string) bool {
+	t, err := l.look()
+	return err == nil && (t.kind == tokPunct || t.kind == tokName) && t.val == val
+}
+
+// skip consumes the next token if it's a punctuator or name with value val
+func (l *lexer) skip(val string) bool {
+	if l.is(val) {
+		l.next()
+		return true
+	}
+	return false
+}
+
+func (l *lexer) expect(val string) error {
+	t, err := l.next()
+	if err != nil {
+		return err
+	}
+	if (t.kind != tokPunct && t.kind != tokName) || t.val != val {
+		return fmt.Errorf("Expected %q at offset %d", val, t.start)
+	}
+	return nil
+}
+
+func (l *lexer) name() (string, error) {
+	t, err := l.next()
+	if err != nil {
+		return "", err
+	}
+	if t.kind != tokName {
+		return "", fmt.Errorf("Expected a name at offset %d", t.start)
+	}
+	return t.val, nil
+}
+
+// value consumes a GraphQL value, and returns its source text
+func (l *lexer) value() (string, error) {
+	t, err := l.next()
+	if err != nil {
+		return "", err
+	}
+	switch {
+	case t.kind == tokPunct && (t.val == "[" || t.val == "{"):
+		closer := "]"
+		if t.val == "{" {
+			closer = "}"
+		}
+		for !l.is(closer) {
+			if t, _ := l.look(); t.kind == tokEOF {
+				return "", fmt.Errorf("Unterminated value at offset %d", t.start)
+			}
+			if closer == "}" {
+				if _, err := l.name(); err != nil {
+					return "", err
+				}
+				if err := l.expect(":"); err != nil {
+					return "", err
+				}
+			}
+			if _, err := l.value(); err != nil {
+				return "", err
+			}
+		}
+		end, _ := l.next()
+		return l.src[t.start:end.end], nil
+	case t.kind == tokPunct:
+		return "", fmt.Errorf("Expected a value at offset %d", t.start)
+	case t.kind == tokEOF:
+		return "", fmt.Errorf("Unexpected end of input")
+	}
+	return l.src[t.start:t.end], nil
+}
+
+// arguments consumes an optional argument list, returning the source text of
+// each value by name
+func (l *lexer) arguments() (map[string]string, error) {
+	args := make(map[string]string)
+	if !l.skip("(") {
+		return args, nil
+	}
+	for !l.skip(")") {
+		name, err := l.name()
+		if err != nil {
+			return nil, err
+		}
+		if err := l.expect(":"); err != nil {
+			return nil, err
+		}
+		v, err := l.value()
+		if err != nil {
+			return nil, err
+		}
+		args[name] = v
+	}
+	return args, nil
+}
+
+// directives consumes directives, and returns their arguments by name
+func (l *lexer) directives() (map[string]map[string]string, error) {
+	dirs := make(map[string]map[string]string)
+	for l.skip("@") {
+		name, err := l.name()
+		if err != nil {
+			return nil, err
+		}
+		args, err := l.arguments()
+		if err != nil {
+			return nil, err
+		}
+		dirs[name] = args
+	}
+	return dirs, nil
+}
@@ -0,0 +1,253 @@
+package graphqlmock
+
+import (
+	"fmt"
+)
+
+// Selection is a top-level field of an operation
+type Selection struct {
+	// The key of the field in the response - the alias if there is one
+	Alias string
+	Name  string
+	// Argument values, as GraphQL source text
+	Args map[string]string
+}
+
+// Operation is the part of a GraphQL request that a mock needs to answer it
+type Operation struct {
+	// query, mutation or subscription
+	Type string
+	// Empty for anonymous operations
+	Name       string
+	Selections []Selection
+}
+
+// ParseOperation parses a GraphQL document, and returns the operation
+// selected by operationName. If operationName is empty, the document must
+// contain exactly one operation. Only top-level fields are returned, with
+// fragments spread into them; nested selections are skipped.
+func ParseOperation(doc string, operationName string) (*Operation, error) {
+	l := &lexer{src: doc}
+	ops := []*Operation{}
+	opSets := []int{}
+	// Offsets of fragment selection sets in the document, by name
+	fragments := make(map[string]int)
+	for {
+		t, err := l.look()
+		if err != nil {
+			return nil, err
+		}
+		if t.kind == tokEOF {
+			break
+		}
+		op := &Operation{Type: "query"}
+		switch {
+		case t.kind == tokPunct && t.val == "{":
+		case t.kind == tokName && t.val == "fragment":
+			l.next()
+			name, err := l.name()
+			if err != nil {
+				return nil, err
+			}
+			if err := l.expect("on"); err != nil {
+				return nil, err
+			}
+			if _, err := l.name(); err != nil {
+				return nil, err
+			}
+			if _, err := l.directives(); err != nil {
+				return nil, err
+			}
+			t, _ := l.look()
+			fragments[name] = t.start
+			if err := skipSelectionSet(l); err != nil {
+				return nil, err
+			}
+			continue
+		case t.kind == tokName && (t.val == "query" || t.val == "mutation" || t.val == "subscription"):
+			l.next()
+			op.Type = t.val
+			if t, _ := l.look(); t.kind == tokName {
+				l.next()
+				op.Name = t.val
+			}
+			if err := skipVariableDefinitions(l); err != nil {
+				return nil, err
+			}
+			if _, err := l.directives(); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("Unexpected %q at offset %d", t.val, t.start)
+		}
+		t, _ = l.look()
+		ops = append(ops, op)
+		opSets = append(opSets, t.start)
+		if err := skipSelectionSet(l); err != nil {
+			return nil, err
+		}
+	}
+
+	idx := -1
+	for i, op := range ops {
+		if operationName == "" || op.Name == operationName {
+			if idx >= 0 {
+				if operationName == "" {
+					return nil, fmt.Errorf("An operation name is needed for documents with several operations")
+				}
+				return nil, fmt.Errorf("Duplicate operation %s", operationName)
+			}
+			idx = i
+		}
+	}
+	if idx < 0 {
+		if operationName != "" {
+			return nil, fmt.Errorf("Unknown operation %s", operationName)
+		}
+		return nil, fmt.Errorf("No operation in document")
+	}
+	op := ops[idx]
+	sels, err := topLevelFields(doc, opSets[idx], fragments, map[string]bool{})
+	if err != nil {
+		return nil, err
+	}
+	op.Selections = sels
+	return op, nil
+}
+
+func skipVariableDefinitions(l *lexer) error {
+	if !l.skip("(") {
+		return nil
+	}
+	for !l.skip(")") {
+		t, err := l.next()
+		if err != nil {
+			return err
+		}
+		if t.kind != tokVariable {
+			return fmt.Errorf("Expected a variable at offset %d", t.start)
+		}
+		if err := l.expect(":"); err != nil {
+			return err
+		}
+		if _, err := parseTypeRef(l); err != nil {
+			return err
+		}
+		if l.skip("=") {
+			if _, err := l.value(); err != nil {
+				return err
+			}
+		}
+		if _, err := l.directives(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// skipSelectionSet consumes a selection set, however deeply nested
+func skipSelectionSet(l *lexer) error {
+	if err := l.expect("{"); err != nil {
+		return err
+	}
+	depth := 1
+	for depth > 0 {
+		t, err := l.next()
+		if err != nil {
+			return err
+		}
+		switch {
+		case t.kind == tokEOF:
+			return fmt.Errorf("Unterminated selection set")
+		case t.kind == tokPunct && t.val == "{":
+			depth++
+		case t.kind == tokPunct && t.val == "}":
+			depth--
+		}
+	}
+	return nil
+}
+
+// topLevelFields reads the fields of the selection set at an offset in a
+// document, expanding fragments
+func topLevelFields(doc string, pos int, fragments map[string]int, seen map[string]bool) ([]Selection, error) {
+	l := &lexer{src: doc, pos: pos}
+	sels := []Selection{}
+	if err := l.expect("{"); err != nil {
+		return nil, err
+	}
+	for !l.skip("}") {
+		if l.skip("...") {
+			fsels, err := spread(l, fragments, seen)
+			if err != nil {
+				return nil, err
+			}
+			sels = append(sels, fsels...)
+			continue
+		}
+		name, err := l.name()
+		if err != nil {
+			return nil, err
+		}
+		sel := Selection{Alias: name, Name: name}
+		if l.skip(":") {
+			if sel.Name, err = l.name(); err != nil {
+				return nil, err
+			}
+		}
+		if sel.Args, err = l.arguments(); err != nil {
+			return nil, err
+		}
+		if _, err := l.directives(); err != nil {
+			return nil, err
+		}
+		if l.is("{") {
+			if err := skipSelectionSet(l); err != nil {
+				return nil, err
+			}
+		}
+		sels = append(sels, sel)
+	}
+	return sels, nil
+}
+
+// spread reads the fields of an inline fragment or fragment spread, just
+// after the "..."
+func spread(l *lexer, fragments map[string]int, seen map[string]bool) ([]Selection, error) {
+	if l.skip("on") {
+		if _, err := l.name(); err != nil {
+			return nil, err
+		}
+	}
+	if l.is("@") || l.is("{") {
+		if _, err := l.directives(); err != nil {
+			return nil, err
+		}
+		t, err := l.look()
+		if err != nil {
+			return nil, err
+		}
+		sels, err := topLevelFields(l.src, t.start, fragments, seen)
+		if err != nil {
+			return nil, err
+		}
+		return sels, skipSelectionSet(l)
+	}
+	name, err := l.name()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := l.directives(); err != nil {
+		return nil, err
+	}
+	pos, ok := fragments[name]
+	if !ok {
+		return nil, fmt.Errorf("Unknown fragment %s", name)
+	}
+	if seen[name] {
+		return nil, fmt.Errorf("Fragment %s spreads itself", name)
+	}
+	seen[name] = true
+	defer delete(seen, name)
+	return topLevelFields(l.src, pos, fragments, seen)
+}
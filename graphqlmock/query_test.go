@@ -0,0 +1,72 @@
+package graphqlmock
+
+import (
+	"reflect"
+	"testing"
+)
+
+var parseOperationTests = []struct {
+	doc    string
+	opName string
+	op     *Operation
+	err    bool
+}{
+	{
+		`{ me { id } }`,
+		"",
+		&Operation{"query", "", []Selection{{"me", "me", map[string]string{}}}},
+		false,
+	},
+	{
+		`query Q($id: ID! = "x") @dir { a: node(id: $id, n: [1, {b: "}"}]) { id } __typename }`,
+		"",
+		&Operation{"query", "Q", []Selection{
+			{"a", "node", map[string]string{"id": "$id", "n": `[1, {b: "}"}]`}},
+			{"__typename", "__typename", map[string]string{}},
+		}},
+		false,
+	},
+	{
+		`query A { a } mutation B { b(x: 1) }`,
+		"B",
+		&Operation{"mutation", "B", []Selection{{"b", "b", map[string]string{"x": "1"}}}},
+		false,
+	},
+	{
+		`query { ...F ... on Query { c } ... @include(if: true) { d } } fragment F on Query { a b { x } }`,
+		"",
+		&Operation{"query", "", []Selection{
+			{"a", "a", map[string]string{}},
+			{"b", "b", map[string]string{}},
+			{"c", "c", map[string]string{}},
+			{"d", "d", map[string]string{}},
+		}},
+		false,
+	},
+	{`query A { a } query B { b }`, "", nil, true},
+	{`query A { a }`, "B", nil, true},
+	{`{ a `, "", nil, true},
+	{`{ ...Missing }`, "", nil, true},
+	{`{ ...F } fragment F on Query { ...F }`, "", nil, true},
+	{`fragment F on Query { a }`, "", nil, true},
+	{``, "", nil, true},
+}
+
+func TestParseOperation(t *testing.T) {
+	for i, tt := range parseOperationTests {
+		op, err := ParseOperation(tt.doc, tt.opName)
+		if tt.err {
+			if err == nil {
+				t.Errorf("Test %d: expected error", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test %d: %s", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(op, tt.op) {
+			t.Errorf("Test %d: expected %#v, got %#v", i, tt.op, op)
+		}
+	}
+}
@@ -0,0 +1,620 @@
+package graphqlmock
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// TypeRef is a reference to a type, possibly wrapped in lists and non-null
+// modifiers
+type TypeRef struct {
+	// NAMED, LIST or NON_NULL
+	Kind   string
+	Name   string
+	OfType *TypeRef
+}
+
+func (t *TypeRef) String() string {
+	switch t.Kind {
+	case "LIST":
+		return "[" + t.OfType.String() + "]"
+	case "NON_NULL":
+		return t.OfType.String() + "!"
+	}
+	return t.Name
+}
+
+// InputValue is an argument or an input object field
+type InputValue struct {
+	Name         string
+	Description  string
+	Type         *TypeRef
+	DefaultValue string
+}
+
+// Field is a field of an object or interface type
+type Field struct {
+	Name              string
+	Description       string
+	Args              []*InputValue
+	Type              *TypeRef
+	Deprecated        bool
+	DeprecationReason string
+}
+
+// EnumValue is a value of an enum type
+type EnumValue struct {
+	Name              string
+	Description       string
+	Deprecated        bool
+	DeprecationReason string
+}
+
+// Type is a named type in a schema
+type Type struct {
+	// SCALAR, OBJECT, INTERFACE, UNION, ENUM or INPUT_OBJECT
+	Kind          string
+	Name          string
+	Description   string
+	Fields        []*Field
+	InputFields   []*InputValue
+	Interfaces    []string
+	PossibleTypes []string
+	EnumValues    []*EnumValue
+}
+
+// Field returns the field with a name, or nil
+func (t *Type) Field(name string) *Field {
+	for _, f := range t.Fields {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// Schema is a GraphQL schema parsed from the schema definition language
+type Schema struct {
+	Types        map[string]*Type
+	Query        string
+	Mutation     string
+	Subscription string
+}
+
+var builtinScalars = []string{"String", "Int", "Float", "Boolean", "ID"}
+
+// ParseSchema parses a schema in the GraphQL schema definition language.
+// Directive definitions are accepted but ignored.
+func ParseSchema(src string) (*Schema, error) {
+	s := &Schema{Types: make(map[string]*Type)}
+	for _, n := range builtinScalars {
+		s.Types[n] = &Type{Kind: "SCALAR", Name: n}
+	}
+	l := &lexer{src: src}
+	for {
+		t, err := l.look()
+		if err != nil {
+			return nil, err
+		}
+		if t.kind == tokEOF {
+			break
+		}
+		if err := s.parseDefinition(l); err != nil {
+			return nil, err
+		}
+	}
+	for _, name := range []string{"Query", "Mutation", "Subscription"} {
+		if _, ok := s.Types[name]; !ok {
+			continue
+		}
+		switch {
+		case name == "Query" && s.Query == "":
+			s.Query = name
+		case name == "Mutation" && s.Mutation == "":
+			s.Mutation = name
+		case name == "Subscription" && s.Subscription == "":
+			s.Subscription = name
+		}
+	}
+	if s.Query == "" {
+		return nil, fmt.Errorf("Schema has no query type")
+	}
+	for _, t := range s.Types {
+		if err := s.checkRefs(t); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (s *Schema) checkRef(ref *TypeRef, where string) error {
+	for ref.OfType != nil {
+		ref = ref.OfType
+	}
+	if _, ok := s.Types[ref.Name]; !ok {
+		return fmt.Errorf("Unknown type %s in %s", ref.Name, where)
+	}
+	return nil
+}
+
+func (s *Schema) checkRefs(t *Type) error {
+	for _, f := range t.Fields {
+		where := t.Name + "." + f.Name
+		if err := s.checkRef(f.Type, where); err != nil {
+			return err
+		}
+		for _, a := range f.Args {
+			if err := s.checkRef(a.Type, where); err != nil {
+				return err
+			}
+		}
+	}
+	for _, f := range t.InputFields {
+		if err := s.checkRef(f.Type, t.Name+"."+f.Name); err != nil {
+			return err
+		}
+	}
+	for _, n := range append(t.Interfaces, t.PossibleTypes...) {
+		if _, ok := s.Types[n]; !ok {
+			return fmt.Errorf("Unknown type %s in %s", n, t.Name)
+		}
+	}
+	return nil
+}
+
+// description consumes an optional description string
+func description(l *lexer) string {
+	if t, err := l.look(); err == nil && t.kind == tokString {
+		l.next()
+		return t.val
+	}
+	return ""
+}
+
+// lookupType finds or creates a named type, which may have been extended
+// before it was defined
+func (s *Schema) lookupType(kind, name string) (*Type, error) {
+	t, ok := s.Types[name]
+	if !ok {
+		t = &Type{Kind: kind, Name: name}
+		s.Types[name] = t
+	} else if t.Kind != kind {
+		return nil, fmt.Errorf("Type %s is defined as both %s and %s", name, t.Kind, kind)
+	}
+	return t, nil
+}
+
+func (s *Schema) parseDefinition(l *lexer) error {
+	desc := description(l)
+	l.skip("extend")
+	keyword, err := l.name()
+	if err != nil {
+		return err
+	}
+	switch keyword {
+	case "schema":
+		if _, err := l.directives(); err != nil {
+			return err
+		}
+		if err := l.expect("{"); err != nil {
+			return err
+		}
+		for !l.skip("}") {
+			op, err := l.name()
+			if err != nil {
+				return err
+			}
+			if err := l.expect(":"); err != nil {
+				return err
+			}
+			name, err := l.name()
+			if err != nil {
+				return err
+			}
+			switch op {
+			case "query":
+				s.Query = name
+			case "mutation":
+				s.Mutation = name
+			case "subscription":
+				s.Subscription = name
+			default:
+				return fmt.Errorf("Unknown operation type %s", op)
+			}
+		}
+		return nil
+	case "directive":
+		// directive @name(args) repeatable on LOCATION | LOCATION
+		if err := l.expect("@"); err != nil {
+			return err
+		}
+		if _, err := l.name(); err != nil {
+			return err
+		}
+		if l.is("(") {
+			if _, err := parseArgDefs(l); err != nil {
+				return err
+			}
+		}
+		l.skip("repeatable")
+		if err := l.expect("on"); err != nil {
+			return err
+		}
+		l.skip("|")
+		for {
+			if _, err := l.name(); err != nil {
+				return err
+			}
+			if !l.skip("|") {
+				return nil
+			}
+		}
+	}
+
+	kinds := map[string]string{
+		"scalar":    "SCALAR",
+		"type":      "OBJECT",
+		"interface": "INTERFACE",
+		"union":     "UNION",
+		"enum":      "ENUM",
+		"input":     "INPUT_OBJECT",
+	}
+	kind, ok := kinds[keyword]
+	if !ok {
+		return fmt.Errorf("Unexpected %q in schema", keyword)
+	}
+	name, err := l.name()
+	if err != nil {
+		return err
+	}
+	t, err := s.lookupType(kind, name)
+	if err != nil {
+		return err
+	}
+	if desc != "" {
+		t.Description = desc
+	}
+	if l.skip("implements") {
+		l.skip("&")
+		for {
+			n, err := l.name()
+			if err != nil {
+				return err
+			}
+			t.Interfaces = append(t.Interfaces, n)
+			if !l.skip("&") {
+				break
+			}
+		}
+	}
+	if _, err := l.directives(); err != nil {
+		return err
+	}
+
+	switch kind {
+	case "OBJECT", "INTERFACE":
+		if !l.skip("{") {
+			return nil
+		}
+		for !l.skip("}") {
+			f, err := parseField(l)
+			if err != nil {
+				return err
+			}
+			t.Fields = append(t.Fields, f)
+		}
+	case "INPUT_OBJECT":
+		if !l.skip("{") {
+			return nil
+		}
+		for !l.skip("}") {
+			v, err := parseInputValue(l)
+			if err != nil {
+				return err
+			}
+			t.InputFields = append(t.InputFields, v)
+		}
+	case "UNION":
+		if !l.skip("=") {
+			return nil
+		}
+		l.skip("|")
+		for {
+			n, err := l.name()
+			if err != nil {
+				return err
+			}
+			t.PossibleTypes = append(t.PossibleTypes, n)
+			if !l.skip("|") {
+				break
+			}
+		}
+	case "ENUM":
+		if !l.skip("{") {
+			return nil
+		}
+		for !l.skip("}") {
+			ev := &EnumValue{Description: description(l)}
+			if ev.Name, err = l.name(); err != nil {
+				return err
+			}
+			dirs, err := l.directives()
+			if err != nil {
+				return err
+			}
+			ev.Deprecated, ev.DeprecationReason = deprecation(dirs)
+			t.EnumValues = append(t.EnumValues, ev)
+		}
+	}
+	return nil
+}
+
+// deprecation reads the @deprecated directive
+func deprecation(dirs map[string]map[string]string) (bool, string) {
+	args, ok := dirs["deprecated"]
+	if !ok {
+		return false, ""
+	}
+	reason := "No longer supported"
+	if r, ok := args["reason"]; ok {
+		json.Unmarshal([]byte(r), &reason)
+	}
+	return true, reason
+}
+
+func parseTypeRef(l *lexer) (*TypeRef, error) {
+	var ref *TypeRef
+	if l.skip("[") {
+		of, err := parseTypeRef(l)
+		if err != nil {
+			return nil, err
+		}
+		if err := l.expect("]"); err != nil {
+			return nil, err
+		}
+		ref = &TypeRef{Kind: "LIST", OfType: of}
+	} else {
+		name, err := l.name()
+		if err != nil {
+			return nil, err
+		}
+		ref = &TypeRef{Kind: "NAMED", Name: name}
+	}
+	if l.skip("!") {
+		ref = &TypeRef{Kind: "NON_NULL", OfType: ref}
+	}
+	return ref, nil
+}
+
+func parseInputValue(l *lexer) (*InputValue, error) {
+	v := &InputValue{Description: description(l)}
+	var err error
+	if v.Name, err = l.name(); err != nil {
+		return nil, err
+	}
+	if err := l.expect(":"); err != nil {
+		return nil, err
+	}
+	if v.Type, err = parseTypeRef(l); err != nil {
+		return nil, err
+	}
+	if l.skip("=") {
+		if v.DefaultValue, err = l.value(); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := l.directives(); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func parseArgDefs(l *lexer) ([]*InputValue, error) {
+	args := []*InputValue{}
+	if err := l.expect("("); err != nil {
+		return nil, err
+	}
+	for !l.skip(")") {
+		v, err := parseInputValue(l)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, v)
+	}
+	return args, nil
+}
+
+func parseField(l *lexer) (*Field, error) {
+	f := &Field{Description: description(l), Args: []*InputValue{}}
+	var err error
+	if f.Name, err = l.name(); err != nil {
+		return nil, err
+	}
+	if l.is("(") {
+		if f.Args, err = parseArgDefs(l); err != nil {
+			return nil, err
+		}
+	}
+	if err := l.expect(":"); err != nil {
+		return nil, err
+	}
+	if f.Type, err = parseTypeRef(l); err != nil {
+		return nil, err
+	}
+	dirs, err := l.directives()
+	if err != nil {
+		return nil, err
+	}
+	f.Deprecated, f.DeprecationReason = deprecation(dirs)
+	return f, nil
+}
+
+// The introspection result is built from generic maps, since its shape is
+// fixed by the GraphQL specification
+type object map[string]interface{}
+
+func nullable(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+func introspectTypeRef(t *TypeRef) object {
+	if t.Kind == "NAMED" {
+		return object{"kind": nil, "name": t.Name, "ofType": nil}
+	}
+	return object{"kind": t.Kind, "name": nil, "ofType": introspectTypeRef(t.OfType)}
+}
+
+func (s *Schema) introspectRef(t *TypeRef) object {
+	o := introspectTypeRef(t)
+	s.fillKinds(o)
+	return o
+}
+
+// fillKinds sets the kinds of named type references, which TypeRef doesn't
+// know by itself
+func (s *Schema) fillKinds(o object) {
+	if o["kind"] == nil {
+		o["kind"] = s.Types[o["name"].(string)].Kind
+		return
+	}
+	s.fillKinds(o["ofType"].(object))
+}
+
+func (s *Schema) introspectInputValues(vals []*InputValue) []object {
+	ret := []object{}
+	for _, v := range vals {
+		ret = append(ret, object{
+			"name":         v.Name,
+			"description":  nullable(v.Description),
+			"type":         s.introspectRef(v.Type),
+			"defaultValue": nullable(v.DefaultValue),
+		})
+	}
+	return ret
+}
+
+func namedRefs(s *Schema, names []string) []object {
+	ret := []object{}
+	for _, n := range names {
+		ret = append(ret, object{"kind": s.Types[n].Kind, "name": n, "ofType": nil})
+	}
+	return ret
+}
+
+func (s *Schema) introspectType(t *Type) object {
+	o := object{
+		"kind":          t.Kind,
+		"name":          t.Name,
+		"description":   nullable(t.Description),
+		"fields":        nil,
+		"inputFields":   nil,
+		"interfaces":    nil,
+		"enumValues":    nil,
+		"possibleTypes": nil,
+	}
+	switch t.Kind {
+	case "OBJECT", "INTERFACE":
+		fields := []object{}
+		for _, f := range t.Fields {
+			fields = append(fields, object{
+				"name":              f.Name,
+				"description":       nullable(f.Description),
+				"args":              s.introspectInputValues(f.Args),
+				"type":              s.introspectRef(f.Type),
+				"isDeprecated":      f.Deprecated,
+				"deprecationReason": nullable(f.DeprecationReason),
+			})
+		}
+		o["fields"] = fields
+		o["interfaces"] = namedRefs(s, t.Interfaces)
+		if t.Kind == "INTERFACE" {
+			impls := []string{}
+			for _, n := range s.typeNames() {
+				for _, i := range s.Types[n].Interfaces {
+					if i == t.Name {
+						impls = append(impls, n)
+					}
+				}
+			}
+			o["possibleTypes"] = namedRefs(s, impls)
+		}
+	case "UNION":
+		o["possibleTypes"] = namedRefs(s, t.PossibleTypes)
+	case "ENUM":
+		vals := []object{}
+		for _, v := range t.EnumValues {
+			vals = append(vals, object{
+				"name":              v.Name,
+				"description":       nullable(v.Description),
+				"isDeprecated":      v.Deprecated,
+				"deprecationReason": nullable(v.DeprecationReason),
+			})
+		}
+		o["enumValues"] = vals
+	case "INPUT_OBJECT":
+		o["inputFields"] = s.introspectInputValues(t.InputFields)
+	}
+	return o
+}
+
+func (s *Schema) typeNames() []string {
+	names := []string{}
+	for n := range s.Types {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func operationType(name string) interface{} {
+	if name == "" {
+		return nil
+	}
+	return object{"name": name}
+}
+
+// The directives every schema has
+func (s *Schema) builtinDirectives() []object {
+	boolArg := []*InputValue{{
+		Name: "if",
+		Type: &TypeRef{Kind: "NON_NULL", OfType: &TypeRef{Kind: "NAMED", Name: "Boolean"}},
+	}}
+	reasonArg := []*InputValue{{
+		Name:         "reason",
+		Type:         &TypeRef{Kind: "NAMED", Name: "String"},
+		DefaultValue: `"No longer supported"`,
+	}}
+	selection := []string{"FIELD", "FRAGMENT_SPREAD", "INLINE_FRAGMENT"}
+	return []object{
+		{"name": "skip", "description": nil, "locations": selection, "args": s.introspectInputValues(boolArg)},
+		{"name": "include", "description": nil, "locations": selection, "args": s.introspectInputValues(boolArg)},
+		{
+			"name":        "deprecated",
+			"description": nil,
+			"locations":   []string{"FIELD_DEFINITION", "ENUM_VALUE"},
+			"args":        s.introspectInputValues(reasonArg),
+		},
+	}
+}
+
+// Introspect returns the schema in the form of the result of the standard
+// introspection query, i.e. the value of the __schema field. Directives
+// defined in the schema aren't included, only the built-in ones.
+func (s *Schema) Introspect() interface{} {
+	types := []object{}
+	for _, n := range s.typeNames() {
+		types = append(types, s.introspectType(s.Types[n]))
+	}
+	return object{
+		"description":      nil,
+		"queryType":        operationType(s.Query),
+		"mutationType":     operationType(s.Mutation),
+		"subscriptionType": operationType(s.Subscription),
+		"types":            types,
+		"directives":       s.builtinDirectives(),
+	}
+}
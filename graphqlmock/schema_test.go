@@ -0,0 +1,151 @@
+package graphqlmock
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const testSchema = `
+"""A person"""
+type User implements Node {
+	id: ID!
+	name: String @deprecated(reason: "Use fullName")
+	friends(first: Int = 10, after: String): [User!]!
+}
+
+interface Node {
+	id: ID!
+}
+
+enum Role { ADMIN USER @deprecated }
+
+union SearchResult = | User
+
+input NewUser {
+	name: String!
+	role: Role = USER
+}
+
+directive @auth(requires: Role = ADMIN) on OBJECT | FIELD_DEFINITION
+
+# Comments are ignored
+type Query {
+	me: User
+	search(text: String!): [SearchResult]
+}
+
+type Mutation {
+	createUser(input: NewUser!): User
+}
+
+extend type Query {
+	node(id: ID!): Node
+}
+`
+
+func TestParseSchema(t *testing.T) {
+	s, err := ParseSchema(testSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Query != "Query" || s.Mutation != "Mutation" || s.Subscription != "" {
+		t.Errorf("Unexpected root types: %s %s %s", s.Query, s.Mutation, s.Subscription)
+	}
+	if s.Types["Query"].Field("node") == nil {
+		t.Error("Extension not applied")
+	}
+	user := s.Types["User"]
+	if user.Description != "A person" || len(user.Interfaces) != 1 {
+		t.Errorf("Unexpected User: %#v", user)
+	}
+	name := user.Field("name")
+	if !name.Deprecated || name.DeprecationReason != "Use fullName" {
+		t.Errorf("Unexpected deprecation: %#v", name)
+	}
+	friends := user.Field("friends")
+	if friends.Type.String() != "[User!]!" || friends.Args[0].DefaultValue != "10" {
+		t.Errorf("Unexpected friends field: %s %#v", friends.Type, friends.Args[0])
+	}
+	if role := s.Types["Role"]; len(role.EnumValues) != 2 || !role.EnumValues[1].Deprecated {
+		t.Errorf("Unexpected Role: %#v", role)
+	}
+
+	custom, err := ParseSchema(`schema { query: Root } type Root { a: Int }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if custom.Query != "Root" {
+		t.Errorf("Unexpected query type: %s", custom.Query)
+	}
+}
+
+func TestParseSchemaErrors(t *testing.T) {
+	for _, src := range []string{
+		`type Foo { a: Int }`,
+		`type Query { a: Missing }`,
+		`type Query { a: Int`,
+		`type Query { a Int }`,
+		`type Query { a: Int } enum Query { A }`,
+		`type Query { a: String @deprecated(reason: "x) }`,
+		`thing Query {}`,
+	} {
+		if _, err := ParseSchema(src); err == nil {
+			t.Errorf("Expected error for %q", src)
+		}
+	}
+}
+
+func TestIntrospect(t *testing.T) {
+	s, err := ParseSchema(testSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(s.Introspect())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var result struct {
+		QueryType struct{ Name string }
+		Types     []struct {
+			Kind          string
+			Name          string
+			PossibleTypes []struct{ Name string }
+			Fields        []struct {
+				Name string
+				Type struct {
+					Kind   string
+					OfType struct {
+						Kind   string
+						OfType struct{ Kind, Name string }
+					}
+				}
+			}
+		}
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		t.Fatal(err)
+	}
+	if result.QueryType.Name != "Query" {
+		t.Errorf("Unexpected query type: %s", result.QueryType.Name)
+	}
+	names := []string{}
+	for _, ty := range result.Types {
+		names = append(names, ty.Name)
+		switch ty.Name {
+		case "Node":
+			if ty.Kind != "INTERFACE" || len(ty.PossibleTypes) != 1 || ty.PossibleTypes[0].Name != "User" {
+				t.Errorf("Unexpected Node: %#v", ty)
+			}
+		case "User":
+			f := ty.Fields[2].Type
+			if f.Kind != "NON_NULL" || f.OfType.Kind != "LIST" || f.OfType.OfType.Kind != "NON_NULL" {
+				t.Errorf("Unexpected friends type: %#v", f)
+			}
+		}
+	}
+	expected := "Boolean Float ID Int Mutation NewUser Node Query Role SearchResult String User"
+	if strings.Join(names, " ") != expected {
+		t.Errorf("Unexpected types: %v", names)
+	}
+}
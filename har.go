@@ -0,0 +1,221 @@
+package devd
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cortesi/devd/httpctx"
+	"github.com/cortesi/devd/inject"
+	"github.com/cortesi/termlog"
+)
+
+func init() {
+	RegisterEndpoint("har", func(value string) (Endpoint, error) { return newHAREndpoint(value) })
+}
+
+// The parts of a HAR file we use - see http://www.softwareishard.com/blog/har-12-spec/
+type harFile struct {
+	Log struct {
+		Entries []harEntry `json:"entries"`
+	} `json:"log"`
+}
+
+type harEntry struct {
+	Request struct {
+		Method string `json:"method"`
+		URL    string `json:"url"`
+	} `json:"request"`
+	Response struct {
+		Status  int `json:"status"`
+		Headers []struct {
+			Name  string `json:"name"`
+			Value string `json:"value"`
+		} `json:"headers"`
+		Content struct {
+			MimeType string `json:"mimeType"`
+			Text     string `json:"text"`
+			Encoding string `json:"encoding"`
+		} `json:"content"`
+	} `json:"response"`
+}
+
+// Response headers that describe the original transfer, rather than the
+// content we serve
+var harSkipHeaders = map[string]bool{
+	"Connection":        true,
+	"Content-Encoding":  true,
+	"Content-Length":    true,
+	"Keep-Alive":        true,
+	"Transfer-Encoding": true,
+}
+
+// harKey identifies the requests an entry answers: the method, path and
+// query, with the query parameters sorted
+func harKey(method string, u *url.URL) string {
+	return method + " " + u.EscapedPath() + "?" + u.Query().Encode()
+}
+
+// harArchive is the loaded contents of a HAR file. When there's more than one
+// entry for a request, they're served in turn.
+type harArchive struct {
+	entries map[string][]*harEntry
+	next    map[string]int
+}
+
+func loadHAR(path string) (*harArchive, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f harFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("Could not parse HAR file %s: %s", path, err)
+	}
+	a := &harArchive{
+		entries: make(map[string][]*harEntry),
+		next:    make(map[string]int),
+	}
+	for i := range f.Log.Entries {
+		e := &f.Log.Entries[i]
+		u, err := url.Parse(e.Request.URL)
+		if err != nil {
+			return nil, fmt.Errorf("Bad URL in HAR file %s: %s", path, err)
+		}
+		k := harKey(e.Request.Method, u)
+		a.entries[k] = append(a.entries[k], e)
+	}
+	return a, nil
+}
+
+// find returns the entry for a request, if there is one
+func (a *harArchive) find(method string, u *url.URL) *harEntry {
+	k := harKey(method, u)
+	entries := a.entries[k]
+	if len(entries) == 0 {
+		return nil
+	}
+	e := entries[a.next[k]%len(entries)]
+	a.next[k]++
+	return e
+}
+
+// An endpoint that serves the responses recorded in a HAR file. Requests are
+// matched on method, path and query string, so the route's path should be
+// the same as it was on the recorded site. The file is read again when it
+// changes.
+type harEndpoint struct {
+	File string
+
+	lock    sync.Mutex
+	archive *harArchive
+	modtime time.Time
+}
+
+func newHAREndpoint(value string) (*harEndpoint, error) {
+	u, err := url.Parse(value)
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse route URL: %s", err)
+	}
+	file := u.Opaque
+	if file == "" {
+		file = u.Path
+	}
+	if file == "" {
+		return nil, fmt.Errorf("No HAR file: %s", value)
+	}
+	fi, err := os.Stat(file)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read HAR file: %s", err)
+	}
+	if fi.IsDir() {
+		return nil, fmt.Errorf("Not a file: %s", file)
+	}
+	return &harEndpoint{File: file}, nil
+}
+
+func (ep *harEndpoint) String() string {
+	return "recorded responses from " + ep.File
+}
+
+func (ep *harEndpoint) Handler(prefix string, templates *template.Template, ci inject.CopyInject) httpctx.Handler {
+	return httpctx.HandlerFunc(ep.serve)
+}
+
+// find loads the HAR file if it has changed, and finds the entry for a
+// request
+func (ep *harEndpoint) find(r *http.Request) (*harEntry, error) {
+	ep.lock.Lock()
+	defer ep.lock.Unlock()
+	fi, err := os.Stat(ep.File)
+	if err != nil {
+		return nil, err
+	}
+	if ep.archive == nil || !fi.ModTime().Equal(ep.modtime) {
+		a, err := loadHAR(ep.File)
+		if err != nil {
+			return nil, err
+		}
+		ep.archive, ep.modtime = a, fi.ModTime()
+	}
+	e := ep.archive.find(r.Method, r.URL)
+	if e == nil && r.Method == "HEAD" {
+		e = ep.archive.find("GET", r.URL)
+	}
+	return e, nil
+}
+
+func (ep *harEndpoint) serve(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	log := termlog.FromContext(ctx)
+	e, err := ep.find(r)
+	if err != nil {
+		log.Warn("har: %s", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if e == nil {
+		log.Say("har: no recorded response")
+		http.NotFound(w, r)
+		return
+	}
+	content := e.Response.Content
+	body := []byte(content.Text)
+	if content.Encoding == "base64" {
+		body, err = base64.StdEncoding.DecodeString(content.Text)
+		if err != nil {
+			log.Warn("har: could not decode response body: %s", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	for _, h := range e.Response.Headers {
+		// HTTP/2 captures include pseudo-headers like :status
+		name := http.CanonicalHeaderKey(h.Name)
+		if strings.HasPrefix(name, ":") || harSkipHeaders[name] {
+			continue
+		}
+		w.Header().Add(name, h.Value)
+	}
+	if w.Header().Get("Content-Type") == "" && content.MimeType != "" {
+		w.Header().Set("Content-Type", content.MimeType)
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	status := e.Response.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.WriteHeader(status)
+	if r.Method != "HEAD" {
+		w.Write(body)
+	}
+}
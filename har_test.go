@@ -0,0 +1,92 @@
+package devd
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cortesi/devd/inject"
+	"github.com/cortesi/termlog"
+)
+
+const testHAR = `{"log": {"entries": [
+	{
+		"request": {"method": "GET", "url": "https://example.com/api/users?b=2&a=1"},
+		"response": {
+			"status": 200,
+			"headers": [
+				{"name": ":status", "value": "200"},
+				{"name": "content-type", "value": "application/json"},
+				{"name": "content-encoding", "value": "gzip"},
+				{"name": "x-request-id", "value": "abc"}
+			],
+			"content": {"mimeType": "application/json", "text": "[1]"}
+		}
+	},
+	{
+		"request": {"method": "GET", "url": "https://example.com/api/users?a=1&b=2"},
+		"response": {"status": 200, "content": {"mimeType": "application/json", "text": "[2]"}}
+	},
+	{
+		"request": {"method": "POST", "url": "https://example.com/api/users"},
+		"response": {"status": 201, "content": {"mimeType": "text/plain", "text": "Y3JlYXRlZA==", "encoding": "base64"}}
+	}
+]}}`
+
+func TestHAREndpoint(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "devdtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	file := filepath.Join(tmp, "capture.har")
+	if err := ioutil.WriteFile(file, []byte(testHAR), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newHAREndpoint("har:" + tmp); err == nil {
+		t.Error("Expected an error for a directory")
+	}
+	ep, err := newHAREndpoint("har:" + file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := termlog.NewLog()
+	logger.Quiet()
+	ctx := termlog.NewContext(context.Background(), logger)
+	h := ep.Handler("/api/", nil, inject.CopyInject{})
+
+	var harTests = []struct {
+		method string
+		path   string
+		status int
+		body   string
+	}{
+		{"GET", "/api/users?a=1&b=2", 200, "[1]"},
+		{"GET", "/api/users?b=2&a=1", 200, "[2]"},
+		{"GET", "/api/users?a=1&b=2", 200, "[1]"},
+		{"HEAD", "/api/users?a=1&b=2", 200, ""},
+		{"GET", "/api/users?a=1", 404, "404 page not found\n"},
+		{"GET", "/users?a=1&b=2", 404, "404 page not found\n"},
+		{"POST", "/api/users", 201, "created"},
+	}
+	for i, tt := range harTests {
+		rec := httptest.NewRecorder()
+		h.ServeHTTPContext(ctx, rec, httptest.NewRequest(tt.method, tt.path, nil))
+		if rec.Code != tt.status || rec.Body.String() != tt.body {
+			t.Errorf("Test %d: expected %d %q, got %d %q", i, tt.status, tt.body, rec.Code, rec.Body.String())
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTPContext(ctx, rec, httptest.NewRequest("GET", "/api/users?a=1&b=2", nil))
+	hdr := rec.Header()
+	if hdr.Get("Content-Type") != "application/json" || hdr.Get("X-Request-Id") != "abc" {
+		t.Errorf("Expected recorded headers, got %v", hdr)
+	}
+	if hdr.Get("Content-Encoding") != "" || hdr.Get(":status") != "" {
+		t.Errorf("Unexpected headers: %v", hdr)
+	}
+}
@@ -0,0 +1,107 @@
+package devd
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"net/http"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// newUUID returns a random (version 4) UUID
+func newUUID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// headerFuncs are the functions available in header value templates
+func headerFuncs(r *http.Request) template.FuncMap {
+	return template.FuncMap{
+		"path":      func() string { return r.URL.Path },
+		"host":      func() string { return r.Host },
+		"method":    func() string { return r.Method },
+		"timestamp": func() string { return time.Now().UTC().Format(time.RFC3339) },
+		"uuid":      newUUID,
+	}
+}
+
+func isHeaderTemplate(value string) bool {
+	return strings.Contains(value, "{{")
+}
+
+func parseHeaderTemplate(value string) (*template.Template, error) {
+	return template.New("header").Funcs(headerFuncs(nil)).Parse(value)
+}
+
+// headerTemplates holds the parsed templates of added header values
+type headerTemplates map[string]*template.Template
+
+func (dd *Devd) parseHeaderTemplates() (headerTemplates, error) {
+	tmpls := make(headerTemplates)
+	if dd.AddHeaders == nil {
+		return tmpls, nil
+	}
+	for h, vals := range *dd.AddHeaders {
+		for _, v := range vals {
+			if !isHeaderTemplate(v) {
+				continue
+			}
+			t, err := parseHeaderTemplate(v)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid template for header %s: %s", h, err)
+			}
+			tmpls[v] = t
+		}
+	}
+	return tmpls, nil
+}
+
+// expand evaluates a header value for a request. Values that aren't templates
+// are returned as they are.
+func (ht headerTemplates) expand(value string, r *http.Request) (string, error) {
+	t, ok := ht[value]
+	if !ok {
+		return value, nil
+	}
+	t, err := t.Clone()
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := t.Funcs(headerFuncs(r)).Execute(&buf, nil); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// AddHeaderSpecs adds headers to all responses from specifications of the
+// form "Name: value". Values can use the template functions path, host,
+// method, timestamp and uuid, which are evaluated for each request, e.g.
+// "X-Trace-Id: {{uuid}}".
+func (dd *Devd) AddHeaderSpecs(specs []string) error {
+	for _, s := range specs {
+		parts := strings.SplitN(s, ":", 2)
+		name := strings.TrimSpace(parts[0])
+		if len(parts) != 2 || name == "" {
+			return fmt.Errorf("Invalid header specification: %s", s)
+		}
+		value := strings.TrimSpace(parts[1])
+		if isHeaderTemplate(value) {
+			if _, err := parseHeaderTemplate(value); err != nil {
+				return fmt.Errorf("Invalid template for header %s: %s", name, err)
+			}
+		}
+		if dd.AddHeaders == nil {
+			dd.AddHeaders = &http.Header{}
+		}
+		dd.AddHeaders.Add(name, value)
+	}
+	return nil
+}
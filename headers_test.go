@@ -0,0 +1,53 @@
+package devd
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/cortesi/devd/httpctx"
+	"github.com/cortesi/termlog"
+)
+
+var uuidRegexp = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestAddHeaderSpecs(t *testing.T) {
+	for _, spec := range []string{"nocolon", ": value", "X-Foo: {{nosuchfunc}}", "X-Foo: {{"} {
+		dd := Devd{}
+		if err := dd.AddHeaderSpecs([]string{spec}); err == nil {
+			t.Errorf("Expected error for %q", spec)
+		}
+	}
+	dd := Devd{}
+	err := dd.AddHeaderSpecs([]string{"X-Plain: a:b", "X-Trace-Id:{{uuid}}", "X-Where: {{method}} {{host}}{{path}}"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := termlog.NewLog()
+	logger.Quiet()
+	h := dd.WrapHandler(
+		logger,
+		httpctx.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {}),
+	)
+	ids := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", "http://devd.io/foo?a=b", nil))
+		if v := rec.Header().Get("X-Plain"); v != "a:b" {
+			t.Errorf("Unexpected X-Plain: %q", v)
+		}
+		if v := rec.Header().Get("X-Where"); v != "GET devd.io/foo" {
+			t.Errorf("Unexpected X-Where: %q", v)
+		}
+		id := rec.Header().Get("X-Trace-Id")
+		if !uuidRegexp.MatchString(id) {
+			t.Errorf("Unexpected X-Trace-Id: %q", id)
+		}
+		ids[id] = true
+	}
+	if len(ids) != 2 {
+		t.Error("Expected a new UUID for each request")
+	}
+}
@@ -0,0 +1,161 @@
+package devd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/cortesi/devd/livereload"
+	"github.com/cortesi/termlog"
+)
+
+// Hooks are shell commands that are run when things happen in devd. Each
+// command gets a JSON description of the event on stdin. Empty commands are
+// not run.
+type Hooks struct {
+	// Run after each request has been served
+	OnRequest string
+	// Run when livereload triggers a reload
+	OnReload string
+	// Run once the server is listening
+	OnStart string
+}
+
+// hookTimeout is how long a hook may run before it's killed
+var hookTimeout = time.Second * 30
+
+// requestHookSlots bounds the number of request hooks running at once. A
+// request that finds every slot taken doesn't run its hook.
+var requestHookSlots = make(chan struct{}, 8)
+
+type requestEvent struct {
+	Event      string  `json:"event"`
+	Method     string  `json:"method"`
+	URL        string  `json:"url"`
+	Status     int     `json:"status"`
+	Duration   float64 `json:"duration_ms"`
+	RemoteAddr string  `json:"remote_addr"`
+}
+
+type reloadEvent struct {
+	Event string   `json:"event"`
+	Paths []string `json:"paths"`
+}
+
+type startEvent struct {
+	Event string `json:"event"`
+	URL   string `json:"url"`
+}
+
+func shellCommand(ctx context.Context, cmd string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", cmd)
+	}
+	return exec.CommandContext(ctx, "sh", "-c", cmd)
+}
+
+// runCommand runs a shell command with stdin as its input, and returns its
+// output. If ctx is done before the command exits, the command is killed and
+// ctx's error is returned.
+func runCommand(ctx context.Context, cmd string, stdin []byte) (stdout []byte, stderr []byte, err error) {
+	var outBuf, errBuf bytes.Buffer
+	c := shellCommand(ctx, cmd)
+	c.Stdin = bytes.NewReader(stdin)
+	c.Stdout = &outBuf
+	c.Stderr = &errBuf
+	if err := c.Start(); err != nil {
+		return nil, nil, err
+	}
+	// Processes the command started can hold its output open after it's
+	// killed, so we don't wait for them
+	done := make(chan error, 1)
+	go func() { done <- c.Wait() }()
+	select {
+	case err = <-done:
+		return outBuf.Bytes(), errBuf.Bytes(), err
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
+	}
+}
+
+// runHook runs a hook command with the JSON encoding of event on stdin,
+// logging its output. It blocks until the command exits, or is killed after
+// timeout, so callers that shouldn't wait for it run it in a goroutine.
+func runHook(log termlog.Logger, cmd string, event interface{}, timeout time.Duration) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Warn("hook: could not encode event: %s", err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	stdout, stderr, err := runCommand(ctx, cmd, append(data, '\n'))
+	if ctx.Err() == context.DeadlineExceeded {
+		log.Warn("hook: %s: killed after %s", cmd, timeout)
+		return
+	}
+	for _, out := range [][]byte{stdout, stderr} {
+		if s := strings.TrimSpace(string(out)); s != "" {
+			log.Say("hook: %s", s)
+		}
+	}
+	if err != nil {
+		log.Warn("hook: %s: %s", cmd, err)
+	}
+}
+
+func (dd *Devd) requestHook(log termlog.Logger, method string, url string, status int, duration time.Duration, remoteAddr string) {
+	if dd.Hooks.OnRequest == "" {
+		return
+	}
+	slots, timeout := requestHookSlots, hookTimeout
+	select {
+	case slots <- struct{}{}:
+	default:
+		log.Warn("hook: too many request hooks running, skipped %s %s", method, url)
+		return
+	}
+	ev := requestEvent{
+		Event:      "request",
+		Method:     method,
+		URL:        url,
+		Status:     status,
+		Duration:   float64(duration) / float64(time.Millisecond),
+		RemoteAddr: remoteAddr,
+	}
+	go func() {
+		defer func() { <-slots }()
+		runHook(log, dd.Hooks.OnRequest, ev, timeout)
+	}()
+}
+
+func (dd *Devd) startHook(log termlog.Logger, url string) {
+	if dd.Hooks.OnStart == "" {
+		return
+	}
+	go runHook(log, dd.Hooks.OnStart, startEvent{Event: "start", URL: url}, hookTimeout)
+}
+
+// hookReloader runs the reload hook whenever a reload is triggered
+type hookReloader struct {
+	livereload.Reloader
+	cmd string
+	log termlog.Logger
+}
+
+func (hr *hookReloader) Reload(paths []string) {
+	hr.Reloader.Reload(paths)
+	go runHook(hr.log, hr.cmd, reloadEvent{Event: "reload", Paths: paths}, hookTimeout)
+}
+
+func (hr *hookReloader) Watch(ch chan []string) {
+	for ei := range ch {
+		if len(ei) > 0 {
+			hr.Reload(ei)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package devd
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/cortesi/devd/httpctx"
+	"github.com/cortesi/termlog"
+)
+
+type testReloader struct {
+	paths [][]string
+}
+
+func (tr *testReloader) Reload(paths []string) {
+	tr.paths = append(tr.paths, paths)
+}
+
+func (tr *testReloader) Watch(ch chan []string) {}
+
+// waitForFile waits for a hook to write a file, and returns its contents
+func waitForFile(t *testing.T, p string) []byte {
+	for i := 0; i < 100; i++ {
+		data, err := ioutil.ReadFile(p)
+		if err == nil && len(data) > 0 {
+			return data
+		}
+		time.Sleep(time.Millisecond * 20)
+	}
+	t.Fatalf("Hook did not write %s", p)
+	return nil
+}
+
+func TestHooks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Hook tests need a POSIX shell")
+	}
+	logger := termlog.NewLog()
+	logger.Quiet()
+	tmp, err := ioutil.TempDir("", "devdtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	out := path.Join(tmp, "start")
+	dd := Devd{Hooks: Hooks{OnStart: "cat > " + out}}
+	dd.startHook(logger, "http://devd.io:8000")
+	ev := startEvent{}
+	if err := json.Unmarshal(waitForFile(t, out), &ev); err != nil {
+		t.Fatal(err)
+	}
+	if ev != (startEvent{"start", "http://devd.io:8000"}) {
+		t.Errorf("Unexpected start event: %#v", ev)
+	}
+
+	out = path.Join(tmp, "reload")
+	tr := &testReloader{}
+	hr := &hookReloader{tr, "cat > " + out, logger}
+	hr.Reload([]string{"foo.css"})
+	rev := reloadEvent{}
+	if err := json.Unmarshal(waitForFile(t, out), &rev); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(rev, reloadEvent{"reload", []string{"foo.css"}}) {
+		t.Errorf("Unexpected reload event: %#v", rev)
+	}
+	if len(tr.paths) != 1 {
+		t.Error("Reload was not passed on")
+	}
+
+	out = path.Join(tmp, "request")
+	dd = Devd{ServingScheme: "http", Hooks: Hooks{OnRequest: "cat > " + out}}
+	h := dd.WrapHandler(
+		logger,
+		httpctx.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTeapot)
+		}),
+	)
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://devd.io/foo?a=b", nil))
+	req := requestEvent{}
+	if err := json.Unmarshal(waitForFile(t, out), &req); err != nil {
+		t.Fatal(err)
+	}
+	if req.Method != "GET" || req.URL != "http://devd.io/foo?a=b" || req.Status != http.StatusTeapot {
+		t.Errorf("Unexpected request event: %#v", req)
+	}
+}
+
+func TestRequestHookLimits(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Hook tests need a POSIX shell")
+	}
+	logger := termlog.NewLog()
+	logger.Quiet()
+	defer func(slots chan struct{}, timeout time.Duration) {
+		requestHookSlots, hookTimeout = slots, timeout
+	}(requestHookSlots, hookTimeout)
+	requestHookSlots = make(chan struct{}, 1)
+	hookTimeout = time.Millisecond * 100
+
+	dd := Devd{Hooks: Hooks{OnRequest: "sleep 10"}}
+	dd.requestHook(logger, "GET", "http://devd.io/", 200, 0, "127.0.0.1:1234")
+	dd.requestHook(logger, "GET", "http://devd.io/", 200, 0, "127.0.0.1:1234")
+	if len(requestHookSlots) != 1 {
+		t.Errorf("Expected one hook to be running, got %d", len(requestHookSlots))
+	}
+	select {
+	case requestHookSlots <- struct{}{}:
+	case <-time.After(time.Second * 5):
+		t.Fatal("Request hook was not killed")
+	}
+}
+
+func TestRunCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Hook tests need a POSIX shell")
+	}
+	stdout, stderr, err := runCommand(context.Background(), "cat; echo oops >&2", []byte("in"))
+	if err != nil || string(stdout) != "in" || string(stderr) != "oops\n" {
+		t.Errorf("Unexpected result: %q %q %v", stdout, stderr, err)
+	}
+	if _, _, err := runCommand(context.Background(), "exit 3", nil); err == nil {
+		t.Error("Expected an error for a failed command")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+	defer cancel()
+	start := time.Now()
+	// The subshell holds the output open after sh is killed
+	_, _, err = runCommand(ctx, "(sleep 10); echo done", nil)
+	if err != context.DeadlineExceeded || time.Since(start) > time.Second*5 {
+		t.Errorf("Expected the command to be killed, got %v after %s", err, time.Since(start))
+	}
+}
@@ -0,0 +1,163 @@
+package devd
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Htpasswd is a set of credentials read from an Apache htpasswd file, mapping
+// user names to password hashes. Bcrypt, MD5-crypt ($apr1$ and $1$) and
+// {SHA} hashes are supported.
+type Htpasswd map[string]string
+
+// HtpasswdFromFile reads an htpasswd file
+func HtpasswdFromFile(path string) (Htpasswd, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := make(Htpasswd)
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("%s:%d: invalid entry", path, n)
+		}
+		if !supportedHash(parts[1]) {
+			return nil, fmt.Errorf(
+				"%s:%d: unsupported hash for user %s - use bcrypt, MD5 or SHA",
+				path, n, parts[0],
+			)
+		}
+		h[parts[0]] = parts[1]
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func supportedHash(hash string) bool {
+	for _, p := range []string{"$2a$", "$2b$", "$2y$", "$apr1$", "$1$", "{SHA}"} {
+		if strings.HasPrefix(hash, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check checks a user name and password against the file
+func (h Htpasswd) Check(user, password string) bool {
+	hash, ok := h[user]
+	if !ok {
+		return false
+	}
+	var computed string
+	switch {
+	case strings.HasPrefix(hash, "$2"):
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	case strings.HasPrefix(hash, "$apr1$"):
+		computed = md5Crypt(password, hashSalt(hash, "$apr1$"), "$apr1$")
+	case strings.HasPrefix(hash, "$1$"):
+		computed = md5Crypt(password, hashSalt(hash, "$1$"), "$1$")
+	case strings.HasPrefix(hash, "{SHA}"):
+		sum := sha1.Sum([]byte(password))
+		computed = "{SHA}" + base64.StdEncoding.EncodeToString(sum[:])
+	default:
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(computed), []byte(hash)) == 1
+}
+
+// Extracts the salt from a crypt-style hash of the form $magic$salt$hash
+func hashSalt(hash string, magic string) string {
+	salt := strings.TrimPrefix(hash, magic)
+	if i := strings.Index(salt, "$"); i >= 0 {
+		salt = salt[:i]
+	}
+	if len(salt) > 8 {
+		salt = salt[:8]
+	}
+	return salt
+}
+
+const itoa64 = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// md5Crypt implements the MD5-based crypt algorithm from FreeBSD, which Apache
+// uses with the $apr1$ magic string.
+func md5Crypt(password, salt, magic string) string {
+	pw := []byte(password)
+
+	alt := md5.New()
+	alt.Write(pw)
+	alt.Write([]byte(salt))
+	alt.Write(pw)
+	mixin := alt.Sum(nil)
+
+	d := md5.New()
+	d.Write(pw)
+	d.Write([]byte(magic))
+	d.Write([]byte(salt))
+	for i := len(pw); i > 0; i -= 16 {
+		if i > 16 {
+			d.Write(mixin)
+		} else {
+			d.Write(mixin[:i])
+		}
+	}
+	for i := len(pw); i > 0; i >>= 1 {
+		if i&1 != 0 {
+			d.Write([]byte{0})
+		} else {
+			d.Write(pw[:1])
+		}
+	}
+	final := d.Sum(nil)
+
+	for i := 0; i < 1000; i++ {
+		d := md5.New()
+		if i&1 != 0 {
+			d.Write(pw)
+		} else {
+			d.Write(final)
+		}
+		if i%3 != 0 {
+			d.Write([]byte(salt))
+		}
+		if i%7 != 0 {
+			d.Write(pw)
+		}
+		if i&1 != 0 {
+			d.Write(final)
+		} else {
+			d.Write(pw)
+		}
+		final = d.Sum(nil)
+	}
+
+	out := []byte(magic + salt + "$")
+	encode := func(v uint, n int) {
+		for ; n > 0; n-- {
+			out = append(out, itoa64[v&0x3f])
+			v >>= 6
+		}
+	}
+	for _, i := range [][3]int{{0, 6, 12}, {1, 7, 13}, {2, 8, 14}, {3, 9, 15}, {4, 10, 5}} {
+		encode(uint(final[i[0]])<<16|uint(final[i[1]])<<8|uint(final[i[2]]), 4)
+	}
+	encode(uint(final[11]), 2)
+	return string(out)
+}
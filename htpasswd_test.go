@@ -0,0 +1,63 @@
+package devd
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestHtpasswd(t *testing.T) {
+	bc, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := ioutil.TempDir("", "devdtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(d) }()
+	f := path.Join(d, "htpasswd")
+	data := "# comment\n" +
+		"bcrypt:" + string(bc) + "\n" +
+		"apr:$apr1$abcdefgh$FBwExRW4dCc8aL.OvjpIE1\n" +
+		"md5:$1$saltsalt$Y.W/rxyzbusnDOkxKcE2b/\n" +
+		"sha:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=\n"
+	if err := ioutil.WriteFile(f, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	h, err := HtpasswdFromFile(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var checkTests = []struct {
+		user     string
+		password string
+		ok       bool
+	}{
+		{"bcrypt", "password", true},
+		{"bcrypt", "wrong", false},
+		{"apr", "password", true},
+		{"apr", "wrong", false},
+		{"md5", "hello world", true},
+		{"md5", "hello", false},
+		{"sha", "password", true},
+		{"sha", "wrong", false},
+		{"nobody", "password", false},
+	}
+	for i, tt := range checkTests {
+		if h.Check(tt.user, tt.password) != tt.ok {
+			t.Errorf("Test %d: expected %v for %s:%s", i, tt.ok, tt.user, tt.password)
+		}
+	}
+
+	if err := ioutil.WriteFile(f, []byte("plain:password\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := HtpasswdFromFile(f); err == nil {
+		t.Error("Expected error for a plain text password")
+	}
+}
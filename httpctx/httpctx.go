@@ -2,10 +2,9 @@
 package httpctx
 
 import (
+	"context"
 	"net/http"
 	"strings"
-
-	"golang.org/x/net/context"
 )
 
 // Handler is a request handler with an added context
@@ -23,7 +22,21 @@ func (h HandlerFunc) ServeHTTPContext(
 	h(ctx, rw, req)
 }
 
-// Adapter turns a context.Handler to an http.Handler
+// Middleware wraps a Handler, returning a Handler that usually does some
+// work before or after calling the wrapped one
+type Middleware func(next Handler) Handler
+
+// Chain wraps a handler in middleware. The first middleware is outermost, so
+// it sees requests first.
+func Chain(h Handler, middleware ...Middleware) Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		h = middleware[i](h)
+	}
+	return h
+}
+
+// Adapter turns a context.Handler to an http.Handler. If Ctx is nil, the
+// request's context is used.
 type Adapter struct {
 	Ctx     context.Context
 	Handler Handler
@@ -32,7 +45,11 @@ type Adapter struct {
 func (ca *Adapter) ServeHTTP(
 	rw http.ResponseWriter, req *http.Request,
 ) {
-	ca.Handler.ServeHTTPContext(ca.Ctx, rw, req)
+	ctx := ca.Ctx
+	if ctx == nil {
+		ctx = req.Context()
+	}
+	ca.Handler.ServeHTTPContext(ctx, rw, req)
 }
 
 // StripPrefix strips a prefix from the request URL
@@ -0,0 +1,152 @@
+package devd
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Methods an ignore rule can name. Anything else in the first field is taken
+// to be part of the regular expression.
+var ignoreMethods = map[string]bool{
+	"GET": true, "HEAD": true, "POST": true, "PUT": true, "PATCH": true,
+	"DELETE": true, "OPTIONS": true, "CONNECT": true, "TRACE": true,
+}
+
+var ignoreStatusRegexp = regexp.MustCompile(`^[1-5][0-9x][0-9x]$`)
+
+// An IgnoreRule stops matching requests from being logged. A rule may also
+// check the request method and the response status, so that noise can be
+// dropped without hiding errors on the same paths.
+type IgnoreRule struct {
+	// Request methods the rule applies to, or empty for all of them
+	Methods []string
+	// Matched over "host/path"
+	Expr *regexp.Regexp
+	// A status like "200", with x standing for any digit as in "4xx", or
+	// empty for all responses
+	Status string
+}
+
+// ParseIgnoreRule parses a specification of the form [METHOD] REGEX
+// [STATUS]. The method may be a comma-separated list of standard methods,
+// like GET,HEAD. A specification without a method or status is a plain
+// regular expression, even if it contains spaces.
+func ParseIgnoreRule(spec string) (IgnoreRule, error) {
+	rule := IgnoreRule{}
+	expr := spec
+	fields := strings.Fields(spec)
+	if len(fields) > 1 {
+		if methods, ok := parseIgnoreMethods(fields[0]); ok {
+			rule.Methods = methods
+			fields = fields[1:]
+		}
+		if n := len(fields); n > 1 && ignoreStatusRegexp.MatchString(fields[n-1]) {
+			rule.Status = fields[n-1]
+			fields = fields[:n-1]
+		}
+		if rule.Methods != nil || rule.Status != "" {
+			if len(fields) != 1 {
+				return rule, fmt.Errorf("Invalid ignore %q: expected [METHOD] REGEX [STATUS]", spec)
+			}
+			expr = fields[0]
+		}
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return rule, fmt.Errorf("Invalid ignore %q: %s", spec, err)
+	}
+	rule.Expr = re
+	return rule, nil
+}
+
+// parseIgnoreMethods parses a comma-separated list of methods, returning
+// false if any of them isn't one we know
+func parseIgnoreMethods(s string) ([]string, bool) {
+	methods := strings.Split(s, ",")
+	for _, m := range methods {
+		if !ignoreMethods[m] {
+			return nil, false
+		}
+	}
+	return methods, true
+}
+
+// matchRequest tells us if a rule matches a request, leaving the status aside
+func (ir IgnoreRule) matchRequest(method, target string) bool {
+	if len(ir.Methods) > 0 {
+		found := false
+		for _, m := range ir.Methods {
+			if m == method {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return ir.Expr.MatchString(target)
+}
+
+// matchStatus tells us if a rule matches a response status
+func (ir IgnoreRule) matchStatus(status int) bool {
+	s := strconv.Itoa(status)
+	if len(s) != len(ir.Status) {
+		return false
+	}
+	for i := range s {
+		if ir.Status[i] != 'x' && ir.Status[i] != s[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (ir IgnoreRule) String() string {
+	s := ir.Expr.String()
+	if len(ir.Methods) > 0 {
+		s = strings.Join(ir.Methods, ",") + " " + s
+	}
+	if ir.Status != "" {
+		s += " " + ir.Status
+	}
+	return s
+}
+
+// ignoreRequest tells us if a request shouldn't be logged, before its
+// response is known. Rules that check the status don't match here.
+func ignoreRequest(rules []IgnoreRule, method, target string) bool {
+	for _, r := range rules {
+		if r.Status == "" && r.matchRequest(method, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// ignoreResponse tells us if a request shouldn't be logged, given its
+// response status
+func ignoreResponse(rules []IgnoreRule, method, target string, status int) bool {
+	for _, r := range rules {
+		if r.Status != "" && r.matchStatus(status) && r.matchRequest(method, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// AddIgnores adds log ignore rules to the server, from specifications of the
+// form [METHOD] REGEX [STATUS] - see ParseIgnoreRule
+func (dd *Devd) AddIgnores(specs []string) error {
+	dd.IgnoreLogs = make([]IgnoreRule, 0, len(specs))
+	for _, s := range specs {
+		rule, err := ParseIgnoreRule(s)
+		if err != nil {
+			return err
+		}
+		dd.IgnoreLogs = append(dd.IgnoreLogs, rule)
+	}
+	return nil
+}
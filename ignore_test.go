@@ -0,0 +1,70 @@
+package devd
+
+import (
+	"testing"
+)
+
+var parseIgnoreRuleTests = []struct {
+	spec   string
+	expect string
+	err    bool
+}{
+	{`\.png$`, `\.png$`, false},
+	{`GET .*\.png 200`, `GET .*\.png 200`, false},
+	{`GET,HEAD /static/`, `GET,HEAD /static/`, false},
+	{`/health 2xx`, `/health 2xx`, false},
+	{`a b`, `a b`, false},
+	{`API docs`, `API docs`, false},
+	{`GET,FOO /x`, `GET,FOO /x`, false},
+	{`GET a b`, "", true},
+	{`GET (`, "", true},
+	{`(`, "", true},
+}
+
+func TestParseIgnoreRule(t *testing.T) {
+	for i, tt := range parseIgnoreRuleTests {
+		rule, err := ParseIgnoreRule(tt.spec)
+		if (err != nil) != tt.err {
+			t.Errorf("Test %d: expected error %v, got %v", i, tt.err, err)
+			continue
+		}
+		if !tt.err && rule.String() != tt.expect {
+			t.Errorf("Test %d: expected %q, got %q", i, tt.expect, rule.String())
+		}
+	}
+}
+
+var ignoreTests = []struct {
+	method   string
+	target   string
+	status   int
+	request  bool
+	response bool
+}{
+	{"GET", "localhost/logo.png", 200, false, true},
+	{"GET", "localhost/logo.png", 404, false, false},
+	{"HEAD", "localhost/logo.png", 200, false, false},
+	{"GET", "localhost/health", 204, false, true},
+	{"GET", "localhost/health", 500, false, false},
+	{"OPTIONS", "localhost/api/", 200, true, false},
+	{"GET", "localhost/api/", 200, false, false},
+	{"GET", "localhost/vendor.js", 500, true, false},
+}
+
+func TestIgnore(t *testing.T) {
+	specs := []string{`GET \.png$ 200`, `/health 2xx`, `OPTIONS .*`, `vendor\.js`}
+	dd := Devd{}
+	if err := dd.AddIgnores(specs); err != nil {
+		t.Fatal(err)
+	}
+	for i, tt := range ignoreTests {
+		request := ignoreRequest(dd.IgnoreLogs, tt.method, tt.target)
+		response := ignoreResponse(dd.IgnoreLogs, tt.method, tt.target, tt.status)
+		if request != tt.request || response != tt.response {
+			t.Errorf(
+				"Test %d: expected ignored %v before and %v after the response, got %v and %v",
+				i, tt.request, tt.response, request, response,
+			)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package devd
+
+import (
+	"time"
+
+	humanize "github.com/dustin/go-humanize"
+)
+
+// DefaultInFlightNotice is how long a request runs before the command-line
+// tool notes that it's still going
+const DefaultInFlightNotice = 5 * time.Second
+
+// watchInFlight notes that a request is still running once notice has
+// passed, and again each time the wait doubles, so a hung upstream or a big
+// download is easy to tell apart from an idle server. It stops when the
+// returned function is called.
+func watchInFlight(say func(string, ...interface{}), notice time.Duration, desc string, sent func() int64) func() {
+	done := make(chan struct{})
+	go func() {
+		start := time.Now()
+		wait := notice
+		t := time.NewTimer(wait)
+		defer t.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-t.C:
+				say(
+					"%s still running after %s, %s sent",
+					desc,
+					time.Since(start).Round(time.Second),
+					humanize.IBytes(uint64(sent())),
+				)
+				t.Reset(wait)
+				wait *= 2
+			}
+		}
+	}()
+	return func() { close(done) }
+}
@@ -0,0 +1,46 @@
+package devd
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWatchInFlight(t *testing.T) {
+	var lock sync.Mutex
+	lines := []string{}
+	say := func(format string, args ...interface{}) {
+		lock.Lock()
+		defer lock.Unlock()
+		lines = append(lines, fmt.Sprintf(format, args...))
+	}
+	count := func() int {
+		lock.Lock()
+		defer lock.Unlock()
+		return len(lines)
+	}
+
+	stop := watchInFlight(say, time.Hour, "GET /", func() int64 { return 0 })
+	stop()
+	if count() != 0 {
+		t.Errorf("Unexpected notes: %v", lines)
+	}
+
+	stop = watchInFlight(say, 20*time.Millisecond, "GET /big", func() int64 { return 2048 })
+	time.Sleep(100 * time.Millisecond)
+	stop()
+	n := count()
+	// Notes come at 20ms, 40ms and 80ms
+	if n < 2 || n > 3 {
+		t.Errorf("Expected 2 or 3 notes, got %v", lines)
+	}
+	if !strings.HasPrefix(lines[0], "GET /big still running after ") || !strings.HasSuffix(lines[0], ", 2.0 KiB sent") {
+		t.Errorf("Unexpected note: %q", lines[0])
+	}
+	time.Sleep(100 * time.Millisecond)
+	if count() != n {
+		t.Errorf("Notes continued after stopping: %v", lines)
+	}
+}
@@ -0,0 +1,129 @@
+package inject
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Headers that describe the exact bytes of a body, and are wrong once we've
+// changed it
+var bodyHeaders = []string{"Content-Md5", "Digest", "Accept-Ranges"}
+
+// Appended to the ETags of injected responses, so that they never match the
+// ETag of the original content
+const injectedETag = "+devd"
+
+// AdjustHeaders makes response headers coherent with a body that the
+// injector is about to change. Content-Length grows by the size of the
+// payload, or is removed if it wasn't a valid length to begin with. ETags are
+// weakened and marked with MarkETag, since the body is no longer
+// byte-for-byte what the validator describes. Last-Modified is removed, since
+// a client holding the original content would otherwise revalidate it
+// against the injected response. Headers like Content-MD5 are removed too.
+// Nothing happens if the injector isn't going to change the body.
+func AdjustHeaders(h http.Header, injector Injector) {
+	if !injector.Found() {
+		return
+	}
+	if cl, err := strconv.ParseInt(h.Get("Content-Length"), 10, 64); err == nil && cl >= 0 {
+		h.Set("Content-Length", strconv.FormatInt(cl+int64(injector.Extra()), 10))
+	} else {
+		h.Del("Content-Length")
+	}
+	BodyChanged(h)
+}
+
+// BodyChanged makes response headers coherent with a body that's been
+// rewritten some other way, like re-indenting, in the same way as
+// AdjustHeaders. Content-Length is left to the caller.
+func BodyChanged(h http.Header) {
+	if etag := h.Get("Etag"); etag != "" {
+		h.Set("Etag", MarkETag(etag))
+	}
+	h.Del("Last-Modified")
+	for _, k := range bodyHeaders {
+		h.Del(k)
+	}
+}
+
+// MarkETag turns the ETag of some content into the weak ETag of the same
+// content with a payload injected. Marked ETags are left alone.
+func MarkETag(etag string) string {
+	opaque := strings.TrimPrefix(etag, "W/")
+	if len(opaque) < 2 || !strings.HasPrefix(opaque, `"`) || !strings.HasSuffix(opaque, `"`) {
+		return etag
+	}
+	if strings.HasSuffix(opaque, injectedETag+`"`) {
+		return "W/" + opaque
+	}
+	return "W/" + opaque[:len(opaque)-1] + injectedETag + `"`
+}
+
+// UnmarkETags rewrites an If-None-Match header for a server that knows
+// nothing of injection, by removing the marks MarkETag adds. If onlyMarked is
+// true, ETags that weren't marked are dropped: a client that sends them holds
+// a copy of the content without the payload. The second return value is true
+// if any of the ETags were marked.
+func UnmarkETags(inm string, onlyMarked bool) (string, bool) {
+	found := false
+	tags := []string{}
+	for _, v := range strings.Split(inm, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		if strings.HasSuffix(v, injectedETag+`"`) {
+			found = true
+			tags = append(tags, strings.TrimSuffix(v, injectedETag+`"`)+`"`)
+		} else if !onlyMarked || v == "*" {
+			tags = append(tags, v)
+		}
+	}
+	return strings.Join(tags, ", "), found
+}
+
+// AddVary adds header names to a response's Vary header. All the Vary values
+// are merged into a single header, without duplicates, so that headers added
+// by different layers - devd's own, and an upstream server's - stay coherent.
+func AddVary(h http.Header, names ...string) {
+	seen := make(map[string]bool)
+	vary := []string{}
+	for _, v := range append(h["Vary"], names...) {
+		for _, name := range strings.Split(v, ",") {
+			name = strings.TrimSpace(name)
+			key := http.CanonicalHeaderKey(name)
+			if name == "" || seen[key] {
+				continue
+			}
+			if name == "*" {
+				h.Set("Vary", "*")
+				return
+			}
+			seen[key] = true
+			vary = append(vary, name)
+		}
+	}
+	if len(vary) == 0 {
+		h.Del("Vary")
+		return
+	}
+	h.Set("Vary", strings.Join(vary, ", "))
+}
+
+// ETagMatch checks an If-None-Match header against an ETag, using the weak
+// comparison that RFC 7232 requires for If-None-Match. This means validators
+// weakened by AdjustHeaders still match.
+func ETagMatch(inm string, etag string) bool {
+	if etag == "" {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, v := range strings.Split(inm, ",") {
+		v = strings.TrimSpace(v)
+		if v == "*" || strings.TrimPrefix(v, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
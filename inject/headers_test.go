@@ -0,0 +1,143 @@
+package inject
+
+import (
+	"bytes"
+	"net/http"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestAdjustHeaders(t *testing.T) {
+	ci := CopyInject{
+		Within:      100,
+		ContentType: "text/html",
+		Marker:      regexp.MustCompile("mark"),
+		Payload:     []byte("inject"),
+	}
+	var adjustTests = []struct {
+		src      string
+		in       http.Header
+		expected http.Header
+	}{
+		{
+			"nomatch",
+			http.Header{"Content-Length": {"7"}, "Etag": {`"x"`}},
+			http.Header{"Content-Length": {"7"}, "Etag": {`"x"`}},
+		},
+		{
+			"imark",
+			http.Header{
+				"Content-Length": {"5"},
+				"Etag":           {`"x"`},
+				"Last-Modified":  {"Mon, 02 Jan 2006 15:04:05 GMT"},
+				"Content-Md5":    {"abc"},
+				"Accept-Ranges":  {"bytes"},
+			},
+			http.Header{"Content-Length": {"11"}, "Etag": {`W/"x+devd"`}},
+		},
+		{
+			"imark",
+			http.Header{"Content-Length": {"bogus"}, "Etag": {`W/"x"`}},
+			http.Header{"Etag": {`W/"x+devd"`}},
+		},
+	}
+	for i, tt := range adjustTests {
+		injector, err := ci.Sniff(bytes.NewBufferString(tt.src), "text/html")
+		if err != nil {
+			t.Fatal(err)
+		}
+		AdjustHeaders(tt.in, injector)
+		if !reflect.DeepEqual(tt.in, tt.expected) {
+			t.Errorf("Test %d: expected %v, got %v", i, tt.expected, tt.in)
+		}
+	}
+}
+
+var addVaryTests = []struct {
+	vary     []string
+	names    []string
+	expected []string
+}{
+	{nil, nil, nil},
+	{nil, []string{"Origin"}, []string{"Origin"}},
+	{[]string{"Origin", "accept-encoding, origin"}, nil, []string{"Origin, accept-encoding"}},
+	{[]string{"Accept-Encoding"}, []string{"Origin", "Accept-Encoding"}, []string{"Accept-Encoding, Origin"}},
+	{[]string{"*"}, []string{"Origin"}, []string{"*"}},
+}
+
+func TestAddVary(t *testing.T) {
+	for i, tt := range addVaryTests {
+		h := http.Header{}
+		if tt.vary != nil {
+			h["Vary"] = tt.vary
+		}
+		AddVary(h, tt.names...)
+		if !reflect.DeepEqual(h["Vary"], tt.expected) {
+			t.Errorf("Test %d: expected %v, got %v", i, tt.expected, h["Vary"])
+		}
+	}
+}
+
+var etagMatchTests = []struct {
+	inm   string
+	etag  string
+	match bool
+}{
+	{`"x"`, `"x"`, true},
+	{`W/"x"`, `"x"`, true},
+	{`"x"`, `W/"x"`, true},
+	{`"y", W/"x"`, `"x"`, true},
+	{"*", `"x"`, true},
+	{`"y"`, `"x"`, false},
+	{`"x"`, "", false},
+}
+
+func TestETagMatch(t *testing.T) {
+	for i, tt := range etagMatchTests {
+		if m := ETagMatch(tt.inm, tt.etag); m != tt.match {
+			t.Errorf("Test %d: expected %v, got %v", i, tt.match, m)
+		}
+	}
+}
+
+var markETagTests = []struct {
+	etag     string
+	expected string
+}{
+	{`"x"`, `W/"x+devd"`},
+	{`W/"x"`, `W/"x+devd"`},
+	{`W/"x+devd"`, `W/"x+devd"`},
+	{`"x+devd"`, `W/"x+devd"`},
+	{"bogus", "bogus"},
+}
+
+func TestMarkETag(t *testing.T) {
+	for i, tt := range markETagTests {
+		if etag := MarkETag(tt.etag); etag != tt.expected {
+			t.Errorf("Test %d: expected %s, got %s", i, tt.expected, etag)
+		}
+	}
+}
+
+var unmarkETagsTests = []struct {
+	inm        string
+	onlyMarked bool
+	expected   string
+	found      bool
+}{
+	{`"x"`, false, `"x"`, false},
+	{`"x"`, true, "", false},
+	{`W/"x+devd", "y"`, false, `W/"x", "y"`, true},
+	{`W/"x+devd", "y"`, true, `W/"x"`, true},
+	{"*", true, "*", false},
+}
+
+func TestUnmarkETags(t *testing.T) {
+	for i, tt := range unmarkETagsTests {
+		inm, found := UnmarkETags(tt.inm, tt.onlyMarked)
+		if inm != tt.expected || found != tt.found {
+			t.Errorf("Test %d: expected %q %v, got %q %v", i, tt.expected, tt.found, inm, found)
+		}
+	}
+}
@@ -81,6 +81,11 @@ func min(a int, b int) int {
 	return a
 }
 
+// Enabled tells us if the CopyInject can inject anything at all
+func (ci *CopyInject) Enabled() bool {
+	return ci.Within > 0 && ci.Marker != nil && len(ci.Payload) > 0
+}
+
 // Sniff reads the first SniffLen bytes of the source, and checks for the
 // marker. Returns an Injector instance.
 func (ci *CopyInject) Sniff(src io.Reader, contentType string) (Injector, error) {
@@ -125,9 +130,8 @@ func (ci *CopyInject) ServeTemplate(statuscode int, w http.ResponseWriter, t *te
 	if err != nil {
 		return err
 	}
-	w.Header().Set(
-		"Content-Length", fmt.Sprintf("%d", length+inj.Extra()),
-	)
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", length))
+	AdjustHeaders(w.Header(), inj)
 	w.WriteHeader(statuscode)
 	_, err = inj.Copy(w)
 	if err != nil {
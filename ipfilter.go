@@ -0,0 +1,89 @@
+package devd
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/cortesi/termlog"
+)
+
+// parseIPNets parses a list of CIDR ranges. Bare IP addresses are treated as
+// ranges containing just that address.
+func parseIPNets(specs []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(specs))
+	for _, s := range specs {
+		if !strings.Contains(s, "/") {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return nil, fmt.Errorf("Invalid IP address: %s", s)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid CIDR range: %s", s)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+func ipInAny(ip net.IP, nets []*net.IPNet) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// AddIPFilters adds CIDR ranges that are allowed and denied access to the
+// server
+func (dd *Devd) AddIPFilters(allow []string, deny []string) error {
+	var err error
+	dd.Allow, err = parseIPNets(allow)
+	if err != nil {
+		return err
+	}
+	dd.Deny, err = parseIPNets(deny)
+	return err
+}
+
+// ipAllowed checks a client address against the allow and deny lists. Denied
+// ranges take precedence. When there's an allow list, only addresses in it
+// and loopback addresses are let through - unless the connection came through
+// a tunnel, in which case loopback is just the relay.
+func (dd *Devd) ipAllowed(ip net.IP, tunnelled bool) bool {
+	if ip == nil {
+		return len(dd.Allow) == 0 && len(dd.Deny) == 0
+	}
+	if ipInAny(ip, dd.Deny) {
+		return false
+	}
+	if len(dd.Allow) > 0 {
+		return (ip.IsLoopback() && !tunnelled) || ipInAny(ip, dd.Allow)
+	}
+	return true
+}
+
+// ipFilter is a handler that refuses requests from clients that aren't
+// allowed by the devd's allow and deny lists
+func (dd *Devd) ipFilter(logger termlog.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := clientIP(r)
+		if !dd.ipAllowed(net.ParseIP(host), isTunnelled(r)) {
+			logger.Warn("Refused %s %s from %s", r.Method, r.RequestURI, host)
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
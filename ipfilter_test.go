@@ -0,0 +1,50 @@
+package devd
+
+import (
+	"net"
+	"testing"
+)
+
+func TestIPFilter(t *testing.T) {
+	var ipFilterTests = []struct {
+		allow []string
+		deny  []string
+		ip    string
+		ok    bool
+	}{
+		{nil, nil, "10.0.0.1", true},
+		{[]string{"10.0.0.0/8"}, nil, "10.1.2.3", true},
+		{[]string{"10.0.0.0/8"}, nil, "192.168.1.1", false},
+		{[]string{"10.0.0.0/8"}, nil, "127.0.0.1", true},
+		{[]string{"10.0.0.0/8"}, nil, "::1", true},
+		{[]string{"10.0.0.0/8"}, []string{"10.0.0.5"}, "10.0.0.5", false},
+		{[]string{"10.0.0.0/8"}, []string{"10.0.0.5"}, "10.0.0.6", true},
+		{nil, []string{"192.168.0.0/16"}, "192.168.3.4", false},
+		{nil, []string{"192.168.0.0/16"}, "10.0.0.1", true},
+		{nil, []string{"127.0.0.1"}, "127.0.0.1", false},
+		{[]string{"fd00::/8"}, nil, "fd00::1", true},
+	}
+	for i, tt := range ipFilterTests {
+		dd := Devd{}
+		if err := dd.AddIPFilters(tt.allow, tt.deny); err != nil {
+			t.Errorf("Test %d: unexpected error: %s", i, err)
+			continue
+		}
+		if dd.ipAllowed(net.ParseIP(tt.ip), false) != tt.ok {
+			t.Errorf("Test %d: expected %v for %s", i, tt.ok, tt.ip)
+		}
+	}
+
+	dd := Devd{}
+	if err := dd.AddIPFilters([]string{"10.0.0.0/8"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if dd.ipAllowed(net.ParseIP("127.0.0.1"), true) {
+		t.Error("Expected tunnelled loopback requests to be refused")
+	}
+	for _, spec := range []string{"10.0.0.0/33", "foo", "10.0.0"} {
+		if err := dd.AddIPFilters([]string{spec}, nil); err == nil {
+			t.Errorf("Expected error for %s", spec)
+		}
+	}
+}
@@ -3,6 +3,7 @@
 package livereload
 
 import (
+	"encoding/json"
 	"net/http"
 	"regexp"
 	"strings"
@@ -27,6 +28,16 @@ const (
 	EndpointPath = "/.devd.livereload"
 	// ScriptPath is the path to the livereload JavaScript asset
 	ScriptPath = "/.devd.livereload.js"
+
+	// LegacyPort is the port the classic LiveReload tools and browser
+	// extensions connect to
+	LegacyPort = 35729
+	// LegacyEndpointPath is the path to the classic LiveReload websocket
+	LegacyEndpointPath = "/livereload"
+	// LegacyScriptPath is the path to the classic LiveReload JavaScript asset
+	LegacyScriptPath = "/livereload.js"
+
+	legacyProtocol = "http://livereload.com/protocols/official-7"
 )
 
 // Injector for the livereload script
@@ -40,39 +51,117 @@ var Injector = inject.CopyInject{
 // Server implements a Livereload server
 type Server struct {
 	sync.Mutex
-	broadcast chan<- string
+	broadcast chan<- message
+	// Guards broadcast against sends after Close
+	closeLock sync.RWMutex
+	closed    bool
 
 	logger      termlog.Logger
 	name        string
 	connections map[*websocket.Conn]bool
+	// Connections speaking the classic LiveReload protocol
+	legacy map[*websocket.Conn]bool
+	// Connections from directory listings
+	listings map[*websocket.Conn]listing
+
+	// ListingChanged tells us if changes to paths affect the directory
+	// listing served at dir on host. If it's nil, listings are sent every
+	// reload.
+	ListingChanged func(host, dir string, paths []string) bool
+}
+
+// listing is where a directory listing was served
+type listing struct {
+	host string
+	dir  string
+}
+
+// message is a reload, with the paths that caused it
+type message struct {
+	cmd   string
+	paths []string
+}
+
+// legacyMessage is a command in the classic LiveReload protocol
+type legacyMessage struct {
+	Command    string   `json:"command"`
+	Protocols  []string `json:"protocols,omitempty"`
+	ServerName string   `json:"serverName,omitempty"`
+	Path       string   `json:"path,omitempty"`
+	LiveCSS    bool     `json:"liveCSS,omitempty"`
+}
+
+// legacyReloads translates a reload into the classic protocol. Classic
+// clients refresh stylesheets in place for a .css path with liveCSS set, and
+// reload the page for anything else, so a page reload names the first file
+// that isn't a stylesheet.
+func legacyReloads(m message) []legacyMessage {
+	var msgs []legacyMessage
+	for _, path := range m.paths {
+		isCSS := strings.HasSuffix(path, ".css")
+		if m.cmd == cmdCSS || !isCSS {
+			msgs = append(msgs, legacyMessage{Command: "reload", Path: path, LiveCSS: true})
+		}
+		if m.cmd == cmdPage && !isCSS {
+			break
+		}
+	}
+	if len(msgs) == 0 {
+		msgs = append(msgs, legacyMessage{Command: "reload", Path: "*"})
+	}
+	return msgs
 }
 
 // NewServer createss a Server instance
 func NewServer(name string, logger termlog.Logger) *Server {
-	broadcast := make(chan string, 50)
+	broadcast := make(chan message, 50)
 	s := &Server{
 		name:        name,
 		broadcast:   broadcast,
 		connections: make(map[*websocket.Conn]bool),
+		legacy:      make(map[*websocket.Conn]bool),
+		listings:    make(map[*websocket.Conn]listing),
 		logger:      logger,
 	}
 	go s.run(broadcast)
 	return s
 }
 
-func (s *Server) run(broadcast <-chan string) {
+func (s *Server) run(broadcast <-chan message) {
 	for m := range broadcast {
 		s.Lock()
 		for conn := range s.connections {
 			if conn == nil {
 				continue
 			}
-			err := conn.WriteMessage(websocket.TextMessage, []byte(m))
+			err := conn.WriteMessage(websocket.TextMessage, []byte(m.cmd))
 			if err != nil {
 				s.logger.Say("Error: %s", err)
 				delete(s.connections, conn)
 			}
 		}
+		for conn, l := range s.listings {
+			if s.ListingChanged != nil && !s.ListingChanged(l.host, l.dir, m.paths) {
+				continue
+			}
+			err := conn.WriteMessage(websocket.TextMessage, []byte(cmdPage))
+			if err != nil {
+				s.logger.Say("Error: %s", err)
+				delete(s.listings, conn)
+			}
+		}
+		if len(s.legacy) > 0 {
+			msgs := legacyReloads(m)
+			for conn := range s.legacy {
+				for _, lm := range msgs {
+					if err := conn.WriteJSON(lm); err != nil {
+						s.logger.Say("Error: %s", err)
+						delete(s.legacy, conn)
+						break
+					}
+				}
+			}
+		}
 		s.Unlock()
 	}
 	s.Lock()
@@ -81,6 +170,14 @@ func (s *Server) run(broadcast <-chan string) {
 		delete(s.connections, conn)
 		conn.Close()
 	}
+	for conn := range s.legacy {
+		delete(s.legacy, conn)
+		conn.Close()
+	}
+	for conn := range s.listings {
+		delete(s.listings, conn)
+		conn.Close()
+	}
 }
 
 var upgrader = websocket.Upgrader{
@@ -89,6 +186,9 @@ var upgrader = websocket.Upgrader{
 	CheckOrigin:     func(r *http.Request) bool { return true },
 }
 
+// ServeHTTP accepts connections from the livereload script. Directory
+// listings say which directory they show with a listing query parameter, and
+// are only sent reloads that change it.
 func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "GET" {
 		http.Error(w, "Method not allowed", 405)
@@ -101,7 +201,11 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	s.Lock()
-	s.connections[conn] = true
+	if dir := r.URL.Query().Get("listing"); dir != "" {
+		s.listings[conn] = listing{r.Host, dir}
+	} else {
+		s.connections[conn] = true
+	}
 	s.Unlock()
 }
 
@@ -115,7 +219,21 @@ func (s *Server) Reload(paths []string) {
 		}
 	}
 	s.logger.SayAs("debug", "livereload %s, files changed: %s", cmd, paths)
-	s.broadcast <- cmd
+	s.closeLock.RLock()
+	defer s.closeLock.RUnlock()
+	if !s.closed {
+		s.broadcast <- message{cmd, paths}
+	}
+}
+
+// Close disconnects all clients. Reloads after Close are ignored.
+func (s *Server) Close() {
+	s.closeLock.Lock()
+	defer s.closeLock.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.broadcast)
+	}
 }
 
 // Watch montors a channel of lists of paths for reload requests
@@ -136,3 +254,68 @@ func (s *Server) ServeScript(rw http.ResponseWriter, req *http.Request) {
 		s.logger.Warn("Error serving livereload script: %s", err)
 	}
 }
+
+// ServeLegacy is a handler function for the classic LiveReload websocket,
+// which tools and browser extensions that predate devd expect to find at
+// LegacyEndpointPath on LegacyPort. Clients say hello when they connect, and
+// are sent reloads once they have.
+func (s *Server) ServeLegacy(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", 405)
+		return
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		s.logger.Say("Error: %s", err)
+		http.Error(w, "Can't upgrade.", 500)
+		return
+	}
+	go s.readLegacy(conn)
+}
+
+// readLegacy answers a classic client's hello, and forgets the client when
+// it goes away
+func (s *Server) readLegacy(conn *websocket.Conn) {
+	defer func() {
+		s.Lock()
+		delete(s.legacy, conn)
+		s.Unlock()
+		conn.Close()
+	}()
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		var m legacyMessage
+		if json.Unmarshal(data, &m) != nil || m.Command != "hello" {
+			continue
+		}
+		reply := legacyMessage{
+			Command:    "hello",
+			Protocols:  []string{legacyProtocol},
+			ServerName: "devd",
+		}
+		s.Lock()
+		err = conn.WriteJSON(reply)
+		if err == nil {
+			s.legacy[conn] = true
+		}
+		s.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// ServeLegacyScript is a handler function that serves a small client for the
+// classic LiveReload protocol, for pages that load LegacyScriptPath
+// themselves
+func (s *Server) ServeLegacyScript(rw http.ResponseWriter, req *http.Request) {
+	rw.Header().Set("Content-Type", "application/javascript")
+	clientBox := rice.MustFindBox("static")
+	_, err := rw.Write(clientBox.MustBytes("legacy.js"))
+	if err != nil {
+		s.logger.Warn("Error serving livereload script: %s", err)
+	}
+}
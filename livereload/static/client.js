@@ -277,16 +277,47 @@
         proto = "wss://";
     }
 
+    // Directory listings tell the server which directory they show, so that
+    // they're only told about changes to it
+    var listing = document.querySelector('meta[name="devd-listing"]') != null;
+    var endpoint = proto + window.location.host + "/.devd.livereload";
+    if (listing) {
+        endpoint += "?listing=" + encodeURIComponent(window.location.pathname);
+    }
+
     ws = new DevdReconnectingWebSocket(
-        proto + window.location.host + "/.devd.livereload",
+        endpoint,
         null,
         {
             debug: true,
             maxReconnectInterval: 3000,
         }
     )
+    // Directory listings replace their table of files with a fresh copy,
+    // which keeps the page's scroll position
+    function refreshListing() {
+        var xhr = new XMLHttpRequest();
+        xhr.open("GET", window.location.href);
+        xhr.onload = function() {
+            var doc = new DOMParser().parseFromString(xhr.responseText, "text/html");
+            var files = doc.getElementById("files");
+            var current = document.getElementById("files");
+            if (xhr.status != 200 || !files || !current) {
+                location.reload();
+                return;
+            }
+            current.innerHTML = files.innerHTML;
+        };
+        xhr.onerror = function() {
+            location.reload();
+        };
+        xhr.send();
+    }
+
     ws.onmessage = function(event) {
-        if (event.data == "page") {
+        if (listing) {
+            refreshListing();
+        } else if (event.data == "page") {
             ws.close();
             location.reload();
         } else if (event.data == "css") {
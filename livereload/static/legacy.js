@@ -0,0 +1,56 @@
+(function() {
+    if (!('WebSocket' in window)) {
+        return;
+    }
+
+    // Speaks the classic LiveReload protocol, for pages and tools that load
+    // /livereload.js themselves. It connects to port 35729 on the host the
+    // script came from.
+    var host = window.location.hostname;
+    var script = document.currentScript;
+    if (script && script.src) {
+        var a = document.createElement("a");
+        a.href = script.src;
+        host = a.hostname;
+    }
+    var url = "ws://" + host + ":35729/livereload";
+
+    function reloadCSS() {
+        var killcache = '__devd=' + new Date().getTime();
+        var stylesheets = Array.prototype.slice.call(
+            document.querySelectorAll('link[rel="stylesheet"]')
+        );
+        stylesheets.forEach(function (el) {
+            var href = el.href.replace(/(&|\?)__devd\=\d+/, '');
+            el.href = '';
+            el.href = href + (href.indexOf("?") == -1 ? '?' : '&') + killcache;
+        });
+    }
+
+    function connect() {
+        var ws = new WebSocket(url);
+        ws.onopen = function() {
+            ws.send(JSON.stringify({
+                command: "hello",
+                protocols: ["http://livereload.com/protocols/official-7"]
+            }));
+        };
+        ws.onmessage = function(event) {
+            var msg = JSON.parse(event.data);
+            if (msg.command != "reload") {
+                return;
+            }
+            if (msg.liveCSS && /\.css$/.test(msg.path)) {
+                reloadCSS();
+            } else {
+                ws.onclose = null;
+                ws.close();
+                location.reload();
+            }
+        };
+        ws.onclose = function() {
+            setTimeout(connect, 3000);
+        };
+    }
+    connect();
+})();
@@ -10,12 +10,24 @@ import (
 
 // LogHeader logs a header
 func LogHeader(log termlog.Logger, h http.Header) {
+	logHeaderFit(log, h, 0)
+}
+
+// logHeaderFit logs a header, shortening values so that each line fits in
+// width columns. A width of 0 means no limit.
+func logHeaderFit(log termlog.Logger, h http.Header, width int) {
 	max := 0
 	for k := range h {
 		if len(k) > max {
 			max = len(k)
 		}
 	}
+	room := 0
+	if width > 0 {
+		// Header lines are indented twice: once as part of a log entry, and
+		// once more here
+		room = width - 2*tabWidth - max - 2
+	}
 	for k, vals := range h {
 		for _, v := range vals {
 			pad := fmt.Sprintf(fmt.Sprintf("%%%ds", max-len(k)+1), " ")
@@ -24,7 +36,7 @@ func LogHeader(log termlog.Logger, h http.Header) {
 				"\t%s%s%s",
 				color.BlueString(k)+":",
 				pad,
-				v,
+				shorten(v, room),
 			)
 		}
 	}
@@ -0,0 +1,137 @@
+package devd
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// The path of the login form, which is reachable on every host
+	loginPath = "/.devd/login"
+	// The cookie holding a signed session
+	sessionCookie = "devd_session"
+	// How long a login lasts
+	sessionLifetime = 7 * 24 * time.Hour
+)
+
+// loginAuth is a handler that lets browsers log in through a form, rather
+// than an HTTP auth dialog. A successful login sets a session cookie, signed
+// with a secret generated at startup. Requests without a valid session are
+// passed to fallback, except for browser page loads, which are redirected to
+// the form.
+type loginAuth struct {
+	check     func(user, password string, r *http.Request) bool
+	secret    []byte
+	templates *template.Template
+	next      http.Handler
+	fallback  http.Handler
+}
+
+func newLoginAuth(
+	check func(string, string, *http.Request) bool,
+	templates *template.Template,
+	next http.Handler,
+	fallback http.Handler,
+) (*loginAuth, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("Could not generate session secret: %s", err)
+	}
+	return &loginAuth{check, secret, templates, next, fallback}, nil
+}
+
+func (l *loginAuth) sign(user string, expires int64) string {
+	mac := hmac.New(sha256.New, l.secret)
+	mac.Write([]byte(fmt.Sprintf("%s|%d", user, expires)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (l *loginAuth) session(user string, expires time.Time) string {
+	return fmt.Sprintf("%s|%d|%s", user, expires.Unix(), l.sign(user, expires.Unix()))
+}
+
+// validSession checks the signature and expiry of a session cookie value
+func (l *loginAuth) validSession(value string) bool {
+	i := strings.LastIndex(value, "|")
+	if i < 0 {
+		return false
+	}
+	j := strings.LastIndex(value[:i], "|")
+	if j < 0 {
+		return false
+	}
+	user, sig := value[:j], value[i+1:]
+	expires, err := strconv.ParseInt(value[j+1:i], 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return false
+	}
+	return hmac.Equal([]byte(sig), []byte(l.sign(user, expires)))
+}
+
+// safeNext makes sure we only redirect to paths on this server after login
+func safeNext(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
+
+func (l *loginAuth) renderForm(w http.ResponseWriter, next string, errmsg string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if errmsg != "" {
+		w.WriteHeader(http.StatusUnauthorized)
+	}
+	_ = l.templates.Lookup("login.html").Execute(w, map[string]string{
+		"Action":  loginPath,
+		"Next":    next,
+		"Error":   errmsg,
+		"Version": "devd " + Version,
+	})
+}
+
+func (l *loginAuth) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == loginPath {
+		switch r.Method {
+		case "GET", "HEAD":
+			l.renderForm(w, safeNext(r.URL.Query().Get("next")), "")
+		case "POST":
+			next := safeNext(r.PostFormValue("next"))
+			user := r.PostFormValue("user")
+			if !l.check(user, r.PostFormValue("password"), r) {
+				l.renderForm(w, next, "Invalid user or password")
+				return
+			}
+			expires := time.Now().Add(sessionLifetime)
+			http.SetCookie(w, &http.Cookie{
+				Name:     sessionCookie,
+				Value:    l.session(user, expires),
+				Path:     "/",
+				Expires:  expires,
+				HttpOnly: true,
+			})
+			http.Redirect(w, r, next, http.StatusSeeOther)
+		default:
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		}
+		return
+	}
+	if c, err := r.Cookie(sessionCookie); err == nil && l.validSession(c.Value) {
+		l.next.ServeHTTP(w, r)
+		return
+	}
+	isPageLoad := (r.Method == "GET" || r.Method == "HEAD") &&
+		strings.Contains(r.Header.Get("Accept"), "text/html")
+	if isPageLoad && r.Header.Get("Authorization") == "" {
+		http.Redirect(w, r, loginPath+"?next="+template.URLQueryEscaper(r.RequestURI), http.StatusFound)
+		return
+	}
+	l.fallback.ServeHTTP(w, r)
+}
@@ -0,0 +1,84 @@
+package devd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	rice "github.com/GeertJohan/go.rice"
+	"github.com/cortesi/devd/ricetemp"
+)
+
+func TestLoginAuth(t *testing.T) {
+	templates := ricetemp.MustMakeTemplates(rice.MustFindBox("templates"))
+	creds := &Credentials{"user", "pass"}
+	check := func(user, password string, r *http.Request) bool {
+		return creds.Check(user, password)
+	}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	fallback := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+	l, err := newLoginAuth(check, templates, next, fallback)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serve := func(r *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		l.ServeHTTP(w, r)
+		return w
+	}
+
+	r := httptest.NewRequest("GET", "/foo?a=b", nil)
+	r.Header.Set("Accept", "text/html")
+	w := serve(r)
+	AssertCode(t, w, http.StatusFound)
+	if w.Header().Get("Location") != loginPath+"?next=%2Ffoo%3Fa%3Db" {
+		t.Errorf("Unexpected redirect: %s", w.Header().Get("Location"))
+	}
+
+	AssertCode(t, serve(httptest.NewRequest("GET", "/foo", nil)), http.StatusUnauthorized)
+	AssertCode(t, serve(httptest.NewRequest("GET", loginPath, nil)), http.StatusOK)
+
+	login := func(password string, next string) *httptest.ResponseRecorder {
+		form := url.Values{"user": {"user"}, "password": {password}, "next": {next}}
+		r := httptest.NewRequest("POST", loginPath, strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return serve(r)
+	}
+	AssertCode(t, login("wrong", "/foo"), http.StatusUnauthorized)
+	w = login("pass", "//evil.com/")
+	AssertCode(t, w, http.StatusSeeOther)
+	if w.Header().Get("Location") != "/" {
+		t.Errorf("Unexpected redirect: %s", w.Header().Get("Location"))
+	}
+	w = login("pass", "/foo")
+	AssertCode(t, w, http.StatusSeeOther)
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != sessionCookie {
+		t.Fatalf("Expected a session cookie, got %v", cookies)
+	}
+
+	r = httptest.NewRequest("GET", "/foo", nil)
+	r.AddCookie(cookies[0])
+	AssertCode(t, serve(r), http.StatusOK)
+
+	var sessionTests = []struct {
+		value string
+		valid bool
+	}{
+		{l.session("user", time.Now().Add(time.Hour)), true},
+		{l.session("a|b", time.Now().Add(time.Hour)), true},
+		{l.session("user", time.Now().Add(-time.Hour)), false},
+		{"user|99999999999|0000", false},
+		{"garbage", false},
+	}
+	for i, tt := range sessionTests {
+		if l.validSession(tt.value) != tt.valid {
+			t.Errorf("Test %d: expected %v for %s", i, tt.valid, tt.value)
+		}
+	}
+}
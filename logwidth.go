@@ -0,0 +1,44 @@
+package devd
+
+import (
+	"time"
+	"unicode/utf8"
+
+	"github.com/cortesi/termlog"
+)
+
+// Shortened fields are never cut to less than this, however little room
+// there is
+const minFieldWidth = 24
+
+// The width of a tab in the terminal. Lines after the first in a log entry
+// are indented with one.
+const tabWidth = 8
+
+// shorten cuts the middle out of a string that's wider than width, so that
+// both ends - usually the interesting parts of a URL - stay visible. A width
+// of 0 or less means no limit.
+func shorten(s string, width int) string {
+	if width <= 0 || utf8.RuneCountInString(s) <= width {
+		return s
+	}
+	if width < minFieldWidth {
+		width = minFieldWidth
+	}
+	r := []rune(s)
+	if len(r) <= width {
+		return s
+	}
+	head := (width - 1) * 2 / 3
+	tail := width - 1 - head
+	return string(r[:head]) + "…" + string(r[len(r)-tail:])
+}
+
+// timestampWidth is how much of the first line of a log entry the timestamp
+// takes up
+func timestampWidth(log termlog.TermLog) int {
+	if l, ok := log.(*termlog.Log); ok {
+		return utf8.RuneCountInString(time.Now().Format(l.TimeFmt))
+	}
+	return 0
+}
@@ -0,0 +1,33 @@
+package devd
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestShorten(t *testing.T) {
+	long := "/api/users/" + strings.Repeat("x", 60) + "?page=2"
+	var shortenTests = []struct {
+		s        string
+		width    int
+		expected string
+	}{
+		{"/index.html", 0, "/index.html"},
+		{"/index.html", 40, "/index.html"},
+		{long, 0, long},
+		{long, 31, "/api/users/xxxxxxxxx…xxx?page=2"},
+		// Never less than minFieldWidth
+		{long, 5, "/api/users/xxxx…x?page=2"},
+		{"/ünïcödé/" + strings.Repeat("é", 40), 24, "/ünïcödé/éééééé…éééééééé"},
+	}
+	for i, tt := range shortenTests {
+		got := shorten(tt.s, tt.width)
+		if got != tt.expected {
+			t.Errorf("Test %d: expected %q, got %q", i, tt.expected, got)
+		}
+		if tt.width > 0 && utf8.RuneCountInString(got) > tt.width && tt.width >= minFieldWidth {
+			t.Errorf("Test %d: %q is wider than %d", i, got, tt.width)
+		}
+	}
+}
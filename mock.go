@@ -0,0 +1,252 @@
+package devd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/cortesi/devd/httpctx"
+	"github.com/cortesi/devd/inject"
+	"github.com/cortesi/termlog"
+)
+
+func init() {
+	RegisterEndpoint("mock", func(value string) (Endpoint, error) { return newMockEndpoint(value) })
+}
+
+// An endpoint that serves canned API responses from a directory of fixtures.
+// A request for /api/users/ is answered by a file in the api/users directory
+// named after the method, e.g. GET.json. The file name can also give the
+// status code and a delay, as in POST.201.json or GET.500ms.json. Directories
+// named {param} match any path segment, and fixtures are templates that can
+// use the matched values.
+type mockEndpoint struct {
+	Root string
+}
+
+func newMockEndpoint(value string) (*mockEndpoint, error) {
+	u, err := url.Parse(value)
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse route URL: %s", err)
+	}
+	root := u.Opaque
+	if root == "" {
+		root = u.Path
+	}
+	if root == "" {
+		return nil, fmt.Errorf("No fixture directory: %s", value)
+	}
+	fi, err := os.Stat(root)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read fixture directory: %s", err)
+	}
+	if !fi.IsDir() {
+		return nil, fmt.Errorf("Not a directory: %s", root)
+	}
+	return &mockEndpoint{root}, nil
+}
+
+func (ep mockEndpoint) String() string {
+	return "mock API from " + ep.Root
+}
+
+func (ep mockEndpoint) Handler(prefix string, templates *template.Template, ci inject.CopyInject) httpctx.Handler {
+	return httpctx.StripPrefix(prefix, httpctx.HandlerFunc(ep.serve))
+}
+
+// A fixture is a canned response for one method
+type fixture struct {
+	File   string
+	Method string
+	Status int
+	Delay  time.Duration
+}
+
+var fixtureMethods = map[string]bool{
+	"GET": true, "HEAD": true, "POST": true, "PUT": true,
+	"PATCH": true, "DELETE": true, "OPTIONS": true,
+}
+
+// parseFixtureName parses a fixture file name of the form
+// METHOD[.STATUS][.DELAY].EXT
+func parseFixtureName(name string) (*fixture, bool) {
+	parts := strings.Split(name, ".")
+	if len(parts) < 2 {
+		return nil, false
+	}
+	f := &fixture{File: name, Method: parts[0], Status: http.StatusOK}
+	if !fixtureMethods[f.Method] {
+		return nil, false
+	}
+	for _, p := range parts[1 : len(parts)-1] {
+		if code, err := strconv.Atoi(p); err == nil && code >= 100 && code < 600 {
+			f.Status = code
+		} else if d, err := time.ParseDuration(p); err == nil {
+			f.Delay = d
+		} else {
+			return nil, false
+		}
+	}
+	return f, true
+}
+
+// matchFixtureDir finds the directory for a request path, returning it along
+// with the values of any {param} directories it matched. Literal names take
+// precedence over parameters.
+func matchFixtureDir(root string, segments []string, params map[string]string) (string, bool) {
+	if len(segments) == 0 {
+		return root, true
+	}
+	seg := segments[0]
+	if fi, err := os.Stat(filepath.Join(root, seg)); err == nil && fi.IsDir() && !isFixtureParam(seg) {
+		if dir, ok := matchFixtureDir(filepath.Join(root, seg), segments[1:], params); ok {
+			return dir, true
+		}
+	}
+	entries, err := ioutil.ReadDir(root)
+	if err != nil {
+		return "", false
+	}
+	for _, e := range entries {
+		if !e.IsDir() || !isFixtureParam(e.Name()) {
+			continue
+		}
+		name := strings.Trim(e.Name(), "{}")
+		if dir, ok := matchFixtureDir(filepath.Join(root, e.Name()), segments[1:], params); ok {
+			params[name] = seg
+			return dir, true
+		}
+	}
+	return "", false
+}
+
+func isFixtureParam(name string) bool {
+	return len(name) > 2 && strings.HasPrefix(name, "{") && strings.HasSuffix(name, "}")
+}
+
+// fixtures lists the fixtures in a directory by method. If there's more than
+// one for a method, the first by name wins.
+func fixtures(dir string) (map[string]*fixture, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	ret := make(map[string]*fixture)
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		if f, ok := parseFixtureName(e.Name()); ok {
+			if _, exists := ret[f.Method]; !exists {
+				ret[f.Method] = f
+			}
+		}
+	}
+	return ret, nil
+}
+
+// The data available to fixture templates
+type fixtureData struct {
+	Method string
+	Path   string
+	Params map[string]string
+	Query  url.Values
+	Body   string
+}
+
+func (ep mockEndpoint) serve(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	log := termlog.FromContext(ctx)
+	segments := []string{}
+	for _, s := range strings.Split(path.Clean("/"+r.URL.Path), "/") {
+		if s != "" {
+			segments = append(segments, s)
+		}
+	}
+	params := make(map[string]string)
+	dir, ok := matchFixtureDir(ep.Root, segments, params)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	byMethod, err := fixtures(dir)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	method := r.Method
+	if method == "HEAD" && byMethod["HEAD"] == nil {
+		method = "GET"
+	}
+	f, ok := byMethod[method]
+	if !ok {
+		if len(byMethod) == 0 {
+			http.NotFound(w, r)
+			return
+		}
+		allowed := []string{}
+		for m := range byMethod {
+			allowed = append(allowed, m)
+		}
+		sort.Strings(allowed)
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	fpath := filepath.Join(dir, f.File)
+	t, err := texttemplate.ParseFiles(fpath)
+	if err != nil {
+		log.Warn("mock: %s", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var buf bytes.Buffer
+	err = t.Execute(&buf, fixtureData{
+		Method: r.Method,
+		Path:   r.URL.Path,
+		Params: params,
+		Query:  r.URL.Query(),
+		Body:   string(body),
+	})
+	if err != nil {
+		log.Warn("mock: %s", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	log.SayAs("debug", "mock: %s", fpath)
+
+	if f.Delay > 0 {
+		select {
+		case <-time.After(f.Delay):
+		case <-ctx.Done():
+			return
+		}
+	}
+	if ctype := mime.TypeByExtension(filepath.Ext(f.File)); ctype != "" {
+		w.Header().Set("Content-Type", ctype)
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.WriteHeader(f.Status)
+	if r.Method != "HEAD" {
+		w.Write(buf.Bytes())
+	}
+}
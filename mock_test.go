@@ -0,0 +1,122 @@
+package devd
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cortesi/devd/inject"
+	"github.com/cortesi/termlog"
+)
+
+var parseFixtureNameTests = []struct {
+	name string
+	ok   bool
+	f    fixture
+}{
+	{"GET.json", true, fixture{"GET.json", "GET", 200, 0}},
+	{"POST.201.json", true, fixture{"POST.201.json", "POST", 201, 0}},
+	{"GET.404.250ms.json", true, fixture{"GET.404.250ms.json", "GET", 404, time.Millisecond * 250}},
+	{"README.md", false, fixture{}},
+	{"get.json", false, fixture{}},
+	{"GET", false, fixture{}},
+	{"GET.foo.json", false, fixture{}},
+}
+
+func TestParseFixtureName(t *testing.T) {
+	for i, tt := range parseFixtureNameTests {
+		f, ok := parseFixtureName(tt.name)
+		if ok != tt.ok || ok && *f != tt.f {
+			t.Errorf("Test %d: expected %v %#v, got %v %#v", i, tt.ok, tt.f, ok, f)
+		}
+	}
+}
+
+func writeFixtures(t *testing.T, root string, files map[string]string) {
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestMockEndpoint(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "devdtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	writeFixtures(t, tmp, map[string]string{
+		"users/GET.json":           `[]`,
+		"users/POST.201.json":      `{"name": {{printf "%q" .Body}}}`,
+		"users/{id}/GET.json":      `{"id": "{{.Params.id}}", "q": "{{.Query.Get "q"}}"}`,
+		"users/me/GET.json":        `{"id": "me"}`,
+		"slow/GET.100ms.txt":       `slow`,
+		"broken/GET.json":          `{{.Nope`,
+		"users/{id}/notes/GET.txt": `notes for {{.Params.id}}`,
+	})
+	if _, err := newMockEndpoint("mock:" + filepath.Join(tmp, "nonexistent")); err == nil {
+		t.Error("Expected error for missing directory")
+	}
+	ep, err := newMockEndpoint("mock:" + tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := ep.Handler("/api", nil, inject.CopyInject{})
+	logger := termlog.NewLog()
+	logger.Quiet()
+	ctx := termlog.NewContext(context.Background(), logger)
+
+	var mockTests = []struct {
+		method string
+		url    string
+		body   string
+		code   int
+		resp   string
+		ctype  string
+	}{
+		{"GET", "/api/users", "", 200, `[]`, "application/json"},
+		{"HEAD", "/api/users/", "", 200, "", "application/json"},
+		{"POST", "/api/users", "alice", 201, `{"name": "alice"}`, "application/json"},
+		{"DELETE", "/api/users", "", 405, "", ""},
+		{"GET", "/api/users/42?q=x", "", 200, `{"id": "42", "q": "x"}`, "application/json"},
+		{"GET", "/api/users/me", "", 200, `{"id": "me"}`, "application/json"},
+		{"GET", "/api/users/7/notes", "", 200, "notes for 7", "text/plain; charset=utf-8"},
+		{"GET", "/api/nothing", "", 404, "", ""},
+		{"GET", "/api/broken", "", 500, "", ""},
+		{"GET", "/api/slow", "", 200, "slow", "text/plain; charset=utf-8"},
+	}
+	for i, tt := range mockTests {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(tt.method, tt.url, strings.NewReader(tt.body))
+		h.ServeHTTPContext(ctx, rec, req)
+		if rec.Code != tt.code {
+			t.Errorf("Test %d: expected code %d, got %d", i, tt.code, rec.Code)
+			continue
+		}
+		if tt.code >= 300 {
+			continue
+		}
+		if rec.Body.String() != tt.resp {
+			t.Errorf("Test %d: expected body %q, got %q", i, tt.resp, rec.Body.String())
+		}
+		if rec.Header().Get("Content-Type") != tt.ctype {
+			t.Errorf("Test %d: expected type %q, got %q", i, tt.ctype, rec.Header().Get("Content-Type"))
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTPContext(ctx, rec, httptest.NewRequest("PUT", "/api/users", nil))
+	if rec.Header().Get("Allow") != "GET, POST" {
+		t.Errorf("Unexpected Allow header: %q", rec.Header().Get("Allow"))
+	}
+}
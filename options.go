@@ -0,0 +1,519 @@
+package devd
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/cortesi/devd/httpctx"
+	"github.com/cortesi/termlog"
+)
+
+// An Option configures a Devd created with New
+type Option func(*options) error
+
+type options struct {
+	dd          *Devd
+	routes      []string
+	notFound    []string
+	transforms  []string
+	fallbacks   []string
+	resolves    []string
+	ignoreLogs  []string
+	allow       []string
+	deny        []string
+	password    string
+	htpasswd    string
+	address     string
+	port        int
+	certFile    string
+	logger      termlog.TermLog
+	maxBodySize int64
+}
+
+// New creates a Devd configured by a set of options, ready to Start. For
+// example:
+//
+//	dd, err := devd.New(
+//		devd.WithRoutes("/=./static", "/api/=http://localhost:8888"),
+//		devd.WithLivewatch(),
+//	)
+//	url, err := dd.Start()
+//	...
+//	dd.Stop()
+//
+// By default, devd listens on 127.0.0.1 on the first free port from 8000,
+// and logs to stdout.
+func New(opts ...Option) (*Devd, error) {
+	o := &options{
+		dd:      &Devd{ServingScheme: "http"},
+		address: "127.0.0.1",
+	}
+	for _, opt := range opts {
+		if err := opt(o); err != nil {
+			return nil, err
+		}
+	}
+	dd := o.dd
+	if len(o.routes) == 0 {
+		return nil, fmt.Errorf("No routes specified")
+	}
+	if err := dd.AddRoutes(o.routes, o.notFound); err != nil {
+		return nil, err
+	}
+	if err := dd.AddTransforms(o.transforms); err != nil {
+		return nil, err
+	}
+	if err := dd.AddFallbacks(o.fallbacks); err != nil {
+		return nil, err
+	}
+	if err := dd.AddResolves(o.resolves); err != nil {
+		return nil, err
+	}
+	if err := dd.AddIgnores(o.ignoreLogs); err != nil {
+		return nil, err
+	}
+	if err := dd.AddIPFilters(o.allow, o.deny); err != nil {
+		return nil, err
+	}
+	if o.password != "" {
+		creds, err := CredentialsFromSpec(o.password)
+		if err != nil {
+			return nil, err
+		}
+		dd.Credentials = creds
+	}
+	if o.htpasswd != "" {
+		h, err := HtpasswdFromFile(o.htpasswd)
+		if err != nil {
+			return nil, fmt.Errorf("Could not read htpasswd file: %s", err)
+		}
+		dd.Htpasswd = h
+	}
+	if o.certFile != "" {
+		dd.ServingScheme = "https"
+	}
+	dd.MaxBodySize = o.maxBodySize
+	if o.logger == nil {
+		o.logger = termlog.NewLog()
+	}
+	dd.address = o.address
+	dd.port = o.port
+	dd.certFile = o.certFile
+	dd.logger = o.logger
+	return dd, nil
+}
+
+// WithRoutes adds route specifications, in the same format as the devd
+// command line
+func WithRoutes(specs ...string) Option {
+	return func(o *options) error {
+		o.routes = append(o.routes, specs...)
+		return nil
+	}
+}
+
+// WithNotFound adds not found over-ride specifications for static routes
+func WithNotFound(specs ...string) Option {
+	return func(o *options) error {
+		o.notFound = append(o.notFound, specs...)
+		return nil
+	}
+}
+
+// WithTransforms adds transform specifications of the form
+// [ROUTE@]COMMAND. See Transform for the protocol the command speaks.
+func WithTransforms(specs ...string) Option {
+	return func(o *options) error {
+		o.transforms = append(o.transforms, specs...)
+		return nil
+	}
+}
+
+// WithFallbacks adds fallback specifications of the form [ROUTE@]DIR, which
+// serve files from DIR when a proxied route's upstream server returns 404
+func WithFallbacks(specs ...string) Option {
+	return func(o *options) error {
+		o.fallbacks = append(o.fallbacks, specs...)
+		return nil
+	}
+}
+
+// WithResolves adds DNS overrides for upstream servers, of the form
+// HOST:PORT:ADDR
+func WithResolves(specs ...string) Option {
+	return func(o *options) error {
+		o.resolves = append(o.resolves, specs...)
+		return nil
+	}
+}
+
+// WithUpstreamProxy reaches proxied routes' upstream servers through an
+// http:// or socks5:// proxy
+func WithUpstreamProxy(spec string) Option {
+	return func(o *options) error {
+		u, err := ParseUpstreamProxy(spec)
+		if err != nil {
+			return err
+		}
+		o.dd.UpstreamProxy = u
+		return nil
+	}
+}
+
+// WithAddress sets the address to listen on
+func WithAddress(address string) Option {
+	return func(o *options) error {
+		o.address = address
+		return nil
+	}
+}
+
+// WithPort sets the port to listen on. By default, the first free port from
+// 8000 is used.
+func WithPort(port int) Option {
+	return func(o *options) error {
+		if port < 0 || port > 65535 {
+			return fmt.Errorf("Invalid port: %d", port)
+		}
+		o.port = port
+		return nil
+	}
+}
+
+// WithTLS serves TLS using a certificate bundle file
+func WithTLS(certFile string) Option {
+	return func(o *options) error {
+		o.certFile = certFile
+		return nil
+	}
+}
+
+// WithLogger sets the logger
+func WithLogger(logger termlog.TermLog) Option {
+	return func(o *options) error {
+		o.logger = logger
+		return nil
+	}
+}
+
+// WithLivereload enables livereload without watching static routes
+func WithLivereload() Option {
+	return func(o *options) error {
+		o.dd.Livereload = true
+		return nil
+	}
+}
+
+// WithoutInjection serves the livereload endpoints without injecting the
+// livereload script into pages
+func WithoutInjection() Option {
+	return func(o *options) error {
+		o.dd.NoInject = true
+		return nil
+	}
+}
+
+// WithLegacyLivereload also speaks the classic LiveReload protocol, serving
+// its client at /livereload.js and accepting connections on port 35729
+func WithLegacyLivereload() Option {
+	return func(o *options) error {
+		o.dd.LegacyLivereload = true
+		return nil
+	}
+}
+
+// WithLivewatch enables livereload and watches static routes for changes
+func WithLivewatch() Option {
+	return func(o *options) error {
+		o.dd.LivereloadRoutes = true
+		return nil
+	}
+}
+
+// WithWatch enables livereload and watches paths for changes
+func WithWatch(paths ...string) Option {
+	return func(o *options) error {
+		o.dd.WatchPaths = append(o.dd.WatchPaths, paths...)
+		return nil
+	}
+}
+
+// WithExcludes adds glob patterns for files to exclude from livereload
+func WithExcludes(patterns ...string) Option {
+	return func(o *options) error {
+		o.dd.Excludes = append(o.dd.Excludes, patterns...)
+		return nil
+	}
+}
+
+// WithLatency adds latency to every request
+func WithLatency(latency time.Duration) Option {
+	return func(o *options) error {
+		o.dd.Latency = int(latency / time.Millisecond)
+		return nil
+	}
+}
+
+// WithTTFB holds up response headers, with delays of the form
+// [TYPE=]MILLISECONDS - see TTFB
+func WithTTFB(specs ...string) Option {
+	return func(o *options) error {
+		return o.dd.AddTTFBs(specs)
+	}
+}
+
+// WithBandwidth limits the download and upload bandwidth, in kilobytes per
+// second. Zero means no limit.
+func WithBandwidth(downKbps uint, upKbps uint) Option {
+	return func(o *options) error {
+		o.dd.DownKbps = downKbps
+		o.dd.UpKbps = upKbps
+		return nil
+	}
+}
+
+// WithHeaders adds headers to all responses
+func WithHeaders(h http.Header) Option {
+	return func(o *options) error {
+		if o.dd.AddHeaders == nil {
+			o.dd.AddHeaders = &http.Header{}
+		}
+		for k, vals := range h {
+			for _, v := range vals {
+				o.dd.AddHeaders.Add(k, v)
+			}
+		}
+		return nil
+	}
+}
+
+// WithSetCookies sets cookies of the form "name=value" on all responses
+func WithSetCookies(specs ...string) Option {
+	return func(o *options) error {
+		return o.dd.AddSetCookies(specs)
+	}
+}
+
+// WithStripCookies removes the named cookies from requests before they're
+// handled
+func WithStripCookies(names ...string) Option {
+	return func(o *options) error {
+		o.dd.StripCookies = append(o.dd.StripCookies, names...)
+		return nil
+	}
+}
+
+// WithCors sets CORS headers to allow everything
+func WithCors() Option {
+	return func(o *options) error {
+		o.dd.Cors = true
+		return nil
+	}
+}
+
+// WithCorsOrigins enables CORS for a set of origins, which may contain *
+// wildcards
+func WithCorsOrigins(origins ...string) Option {
+	return func(o *options) error {
+		o.dd.Cors = true
+		o.dd.CorsOrigins = append(o.dd.CorsOrigins, origins...)
+		return nil
+	}
+}
+
+// WithCorsPreflight sets the methods and headers allowed by CORS preflight
+// responses, and how long browsers may cache them. Empty values allow
+// whatever the browser asks for.
+func WithCorsPreflight(methods string, headers string, maxAge time.Duration) Option {
+	return func(o *options) error {
+		o.dd.CorsMethods = methods
+		o.dd.CorsHeaders = headers
+		o.dd.CorsMaxAge = maxAge
+		return nil
+	}
+}
+
+// WithCorsExpose sets the response headers that CORS scripts may read
+func WithCorsExpose(headers string) Option {
+	return func(o *options) error {
+		o.dd.CorsExpose = headers
+		return nil
+	}
+}
+
+// WithIgnoreLogs disables logging for requests matching rules of the form
+// [METHOD] REGEX [STATUS], where the regular expression is matched over
+// host/path
+func WithIgnoreLogs(exprs ...string) Option {
+	return func(o *options) error {
+		o.ignoreLogs = append(o.ignoreLogs, exprs...)
+		return nil
+	}
+}
+
+// WithPassword enables basic auth with credentials of the form user:password
+func WithPassword(spec string) Option {
+	return func(o *options) error {
+		o.password = spec
+		return nil
+	}
+}
+
+// WithHtpasswd enables basic auth with users from an htpasswd file
+func WithHtpasswd(path string) Option {
+	return func(o *options) error {
+		o.htpasswd = path
+		return nil
+	}
+}
+
+// WithToken requires a bearer token for access
+func WithToken(token string) Option {
+	return func(o *options) error {
+		o.dd.Token = token
+		return nil
+	}
+}
+
+// WithAllow only allows clients from CIDR ranges or IP addresses
+func WithAllow(specs ...string) Option {
+	return func(o *options) error {
+		o.allow = append(o.allow, specs...)
+		return nil
+	}
+}
+
+// WithDeny refuses clients from CIDR ranges or IP addresses
+func WithDeny(specs ...string) Option {
+	return func(o *options) error {
+		o.deny = append(o.deny, specs...)
+		return nil
+	}
+}
+
+// WithTrustProxy trusts X-Forwarded headers from proxies in CIDR ranges
+func WithTrustProxy(specs ...string) Option {
+	return func(o *options) error {
+		return o.dd.AddTrustedProxies(specs)
+	}
+}
+
+// WithPreload adds Link preload headers to HTML responses, and sends them as
+// early hints on later requests
+func WithPreload() Option {
+	return func(o *options) error {
+		o.dd.Preload = true
+		return nil
+	}
+}
+
+// WithPush pushes the stylesheets and scripts in HTML responses to HTTP/2
+// clients
+func WithPush() Option {
+	return func(o *options) error {
+		o.dd.Push = true
+		return nil
+	}
+}
+
+// WithPretty re-indents JSON and XML responses
+func WithPretty() Option {
+	return func(o *options) error {
+		o.dd.Pretty = true
+		return nil
+	}
+}
+
+// WithCacheBust adds a hash of their contents to the URLs of the stylesheets
+// and scripts that static routes serve, in HTML responses
+func WithCacheBust() Option {
+	return func(o *options) error {
+		o.dd.CacheBust = true
+		return nil
+	}
+}
+
+// WithSourceMaps sets how source maps are handled - SourceMapsBlock to
+// withhold them, or SourceMapsServe to serve them and point browsers at them
+func WithSourceMaps(mode string) Option {
+	return func(o *options) error {
+		if mode != SourceMapsBlock && mode != SourceMapsServe {
+			return fmt.Errorf("Unknown source map mode: %s", mode)
+		}
+		o.dd.SourceMaps = mode
+		return nil
+	}
+}
+
+// WithTraffic counts the bytes going in and out of each route and path. The
+// totals are served at /.devd/stats, and logged when the server stops.
+func WithTraffic() Option {
+	return func(o *options) error {
+		o.dd.CountTraffic = true
+		return nil
+	}
+}
+
+// WithMaxBodySize refuses request bodies larger than size bytes
+func WithMaxBodySize(size int64) Option {
+	return func(o *options) error {
+		o.maxBodySize = size
+		return nil
+	}
+}
+
+// WithDigest uses digest rather than basic auth for WithPassword
+func WithDigest() Option {
+	return func(o *options) error {
+		o.dd.DigestAuth = true
+		return nil
+	}
+}
+
+// WithLoginForm lets browsers log in with a form and session cookie
+func WithLoginForm() Option {
+	return func(o *options) error {
+		o.dd.LoginForm = true
+		return nil
+	}
+}
+
+// WithAuthLockout refuses clients for a duration after a number of
+// authentication failures
+func WithAuthLockout(failures int, duration time.Duration) Option {
+	return func(o *options) error {
+		o.dd.AuthLockout = failures
+		o.dd.AuthLockoutTime = duration
+		return nil
+	}
+}
+
+// WithMiddleware registers middleware that wraps every route handler - see
+// Devd.Use
+func WithMiddleware(middleware ...httpctx.Middleware) Option {
+	return func(o *options) error {
+		o.dd.Use(middleware...)
+		return nil
+	}
+}
+
+// WithHooks sets shell commands that are run on server events
+func WithHooks(hooks Hooks) Option {
+	return func(o *options) error {
+		o.dd.Hooks = hooks
+		return nil
+	}
+}
+
+// WithReplay keeps the last n requests, so that they can be re-issued with
+// Devd.Replay or through the /.devd/replay endpoint
+func WithReplay(n int) Option {
+	return func(o *options) error {
+		if n < 0 {
+			return fmt.Errorf("Invalid replay history size: %d", n)
+		}
+		o.dd.ReplayHistory = n
+		return nil
+	}
+}
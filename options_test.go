@@ -0,0 +1,59 @@
+package devd
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/cortesi/termlog"
+)
+
+func TestNew(t *testing.T) {
+	if _, err := New(); err == nil {
+		t.Error("Expected error without routes")
+	}
+	if _, err := New(WithRoutes("./testdata"), WithPort(70000)); err == nil {
+		t.Error("Expected error for invalid port")
+	}
+	if _, err := New(WithRoutes("foo=ws://%")); err == nil {
+		t.Error("Expected error for invalid route")
+	}
+
+	logger := termlog.NewLog()
+	logger.Quiet()
+	dd, err := New(
+		WithRoutes("./testdata"),
+		WithLogger(logger),
+		WithHeaders(http.Header{"X-Test": {"yes"}}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dd.Stop(); err == nil {
+		t.Error("Expected error stopping an unstarted server")
+	}
+	s, err := dd.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Get("http://127.0.0.1:" + u.Port() + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != 200 || resp.Header.Get("X-Test") != "yes" {
+		t.Errorf("Unexpected response: %d %v", resp.StatusCode, resp.Header)
+	}
+	if err := dd.Stop(); err != nil {
+		t.Error(err)
+	}
+	if _, err := http.Get("http://127.0.0.1:" + u.Port() + "/"); err == nil {
+		t.Error("Expected error after stop")
+	}
+}
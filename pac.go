@@ -0,0 +1,85 @@
+package devd
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PACPath is where devd serves a proxy auto-config file when it has routes
+// on virtual hosts. Pointing a phone or TV's proxy settings at it sends
+// requests for devd's hostnames through devd, without touching DNS.
+const PACPath = "/.devd/proxy.pac"
+
+// ServesPAC tells us if devd serves a proxy auto-config file, which it does
+// when any route is on a virtual host
+func (dd *Devd) ServesPAC() bool {
+	for _, r := range dd.Routes {
+		if r.Host != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// pacHosts returns the hostnames that should be proxied through devd
+func (dd *Devd) pacHosts() []string {
+	seen := map[string]bool{"devd.io": true}
+	for _, r := range dd.Routes {
+		if r.Host != "" {
+			seen[r.Host] = true
+		}
+	}
+	hosts := []string{}
+	for h := range seen {
+		hosts = append(hosts, h)
+	}
+	sort.Strings(hosts)
+	return hosts
+}
+
+// pacFile makes a proxy auto-config file that sends plain HTTP requests for
+// hosts to proxy. Devd doesn't handle CONNECT, so https URLs can't go through
+// it.
+func pacFile(hosts []string, proxy string, tls bool) string {
+	conds := []string{}
+	for _, h := range hosts {
+		conds = append(conds, "host == "+strconv.Quote(h))
+	}
+	kind := "PROXY"
+	if tls {
+		kind = "HTTPS"
+	}
+	return fmt.Sprintf(
+		`function FindProxyForURL(url, host) {
+    if (url.substring(0, 5) == "http:" && (%s)) {
+        return %s;
+    }
+    return "DIRECT";
+}
+`,
+		strings.Join(conds, " || "),
+		strconv.Quote(kind+" "+proxy),
+	)
+}
+
+// servePAC serves the proxy auto-config file. The proxy address is the one
+// the client used to fetch the file, since that's known to be reachable.
+func (dd *Devd) servePAC(w http.ResponseWriter, r *http.Request) {
+	revertOriginalHost(r)
+	tls := dd.ServingScheme == "https"
+	proxy := r.Host
+	if _, _, err := net.SplitHostPort(proxy); err != nil {
+		if tls {
+			proxy = net.JoinHostPort(proxy, "443")
+		} else {
+			proxy = net.JoinHostPort(proxy, "80")
+		}
+	}
+	w.Header().Set("Content-Type", "application/x-ns-proxy-autoconfig")
+	w.Header().Set("Cache-Control", "no-cache")
+	fmt.Fprint(w, pacFile(dd.pacHosts(), proxy, tls))
+}
@@ -0,0 +1,52 @@
+package devd
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPAC(t *testing.T) {
+	dd := Devd{ServingScheme: "http"}
+	if err := dd.AddRoutes([]string{"./static"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if dd.ServesPAC() {
+		t.Error("Expected no PAC file without virtual hosts")
+	}
+	err := dd.AddRoutes([]string{"./static", "app/=./app", "api/=http://localhost:8888", "api/v2/=http://localhost:8889"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !dd.ServesPAC() {
+		t.Error("Expected a PAC file with virtual hosts")
+	}
+	expected := []string{"api.devd.io", "app.devd.io", "devd.io"}
+	if hosts := dd.pacHosts(); !reflect.DeepEqual(hosts, expected) {
+		t.Errorf("Expected hosts %v, got %v", expected, hosts)
+	}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", PACPath, nil)
+	req.Host = "192.168.1.5:8000"
+	dd.servePAC(rec, req)
+	if ct := rec.Header().Get("Content-Type"); ct != "application/x-ns-proxy-autoconfig" {
+		t.Errorf("Unexpected content type: %s", ct)
+	}
+	body := rec.Body.String()
+	for _, s := range []string{`host == "app.devd.io"`, `return "PROXY 192.168.1.5:8000"`, `return "DIRECT"`} {
+		if !strings.Contains(body, s) {
+			t.Errorf("Expected %q in PAC file:\n%s", s, body)
+		}
+	}
+
+	dd.ServingScheme = "https"
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequest("GET", PACPath, nil)
+	req.Host = "devd.example"
+	dd.servePAC(rec, req)
+	if !strings.Contains(rec.Body.String(), `return "HTTPS devd.example:443"`) {
+		t.Errorf("Unexpected PAC file:\n%s", rec.Body.String())
+	}
+}
@@ -0,0 +1,274 @@
+package devd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/cortesi/termlog"
+)
+
+// 103 Early Hints, which net/http only has a name for from Go 1.13
+const statusEarlyHints = 103
+
+// preloadMaxBody is how much of an HTML document we hold back to scan for
+// assets. Longer documents are only scanned up to this point.
+const preloadMaxBody = 1 << 20
+
+var assetTagRegexp = regexp.MustCompile(`(?is)<(link|script)\b([^>]*)>`)
+var attrRegexp = regexp.MustCompile(`(?is)([a-z-]+)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s>]+))`)
+
+func tagAttrs(s string) map[string]string {
+	attrs := make(map[string]string)
+	for _, m := range attrRegexp.FindAllStringSubmatch(s, -1) {
+		attrs[strings.ToLower(m[1])] = m[2] + m[3] + m[4]
+	}
+	return attrs
+}
+
+// asset is a stylesheet or script referenced by an HTML document
+type asset struct {
+	URL string
+	// The preload destination - "style" or "script"
+	As string
+}
+
+func (a asset) link() string {
+	return fmt.Sprintf("<%s>; rel=preload; as=%s", a.URL, a.As)
+}
+
+// findAssets scans HTML for stylesheets and scripts
+func findAssets(html []byte) []asset {
+	assets := []asset{}
+	for _, m := range assetTagRegexp.FindAllSubmatch(html, -1) {
+		attrs := tagAttrs(string(m[2]))
+		switch strings.ToLower(string(m[1])) {
+		case "link":
+			rels := strings.Fields(strings.ToLower(attrs["rel"]))
+			for _, rel := range rels {
+				if rel == "stylesheet" && attrs["href"] != "" {
+					assets = append(assets, asset{attrs["href"], "style"})
+					break
+				}
+			}
+		case "script":
+			if attrs["src"] != "" {
+				assets = append(assets, asset{attrs["src"], "script"})
+			}
+		}
+	}
+	return assets
+}
+
+// preloadLinks scans HTML for stylesheets and scripts, and returns Link
+// header values that preload them
+func preloadLinks(html []byte) []string {
+	links := []string{}
+	for _, a := range findAssets(html) {
+		links = append(links, a.link())
+	}
+	return links
+}
+
+// pushTarget resolves an asset URL against the request it was found in, and
+// returns the path to push. Assets on other hosts can't be pushed.
+func pushTarget(r *http.Request, ref string) (string, bool) {
+	u, err := url.Parse(ref)
+	if err != nil {
+		return "", false
+	}
+	if (u.Scheme != "" || u.Host != "") && u.Host != r.Host {
+		return "", false
+	}
+	base := &url.URL{Path: r.URL.Path}
+	return base.ResolveReference(&url.URL{Path: u.Path, RawQuery: u.RawQuery}).RequestURI(), true
+}
+
+// Request headers passed on to pushed requests, so that they're treated like
+// the browser's own
+var pushHeaders = []string{"Authorization", "Cookie", "User-Agent", "Accept-Language"}
+
+// preloadCache remembers the preload links of the HTML documents we've
+// served, so they can be sent as early hints the next time around
+type preloadCache struct {
+	sync.Mutex
+	links map[string][]string
+}
+
+func newPreloadCache() *preloadCache {
+	return &preloadCache{links: make(map[string][]string)}
+}
+
+func (pc *preloadCache) get(key string) []string {
+	pc.Lock()
+	defer pc.Unlock()
+	return pc.links[key]
+}
+
+func (pc *preloadCache) set(key string, links []string) {
+	pc.Lock()
+	defer pc.Unlock()
+	pc.links[key] = links
+}
+
+// preloadWriter holds back HTML responses, so that they can be scanned for
+// assets to add Link headers for, or to push, before the response header is
+// sent.
+type preloadWriter struct {
+	http.ResponseWriter
+	log termlog.Logger
+	// Where we remember links, or nil if we're not adding Link headers
+	key   string
+	cache *preloadCache
+	// Set if we're pushing assets
+	pusher http.Pusher
+	req    *http.Request
+
+	code        int
+	held        bool
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func isHTML(h http.Header) bool {
+	mt, _, err := mime.ParseMediaType(h.Get("Content-Type"))
+	return err == nil && mt == "text/html"
+}
+
+func (pw *preloadWriter) WriteHeader(code int) {
+	if code >= 100 && code < 200 && code != http.StatusSwitchingProtocols {
+		pw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	pw.wroteHeader = true
+	h := pw.Header()
+	if code == http.StatusOK && h.Get("Content-Encoding") == "" && isHTML(h) {
+		pw.code = code
+		pw.held = true
+		return
+	}
+	pw.ResponseWriter.WriteHeader(code)
+}
+
+func (pw *preloadWriter) Write(data []byte) (int, error) {
+	if !pw.wroteHeader {
+		pw.WriteHeader(http.StatusOK)
+	}
+	if !pw.held {
+		return pw.ResponseWriter.Write(data)
+	}
+	pw.body.Write(data)
+	if pw.body.Len() >= preloadMaxBody {
+		if err := pw.release(); err != nil {
+			return 0, err
+		}
+	}
+	return len(data), nil
+}
+
+// release scans what we've held of the document for assets, and sends the
+// response header and the held body
+func (pw *preloadWriter) release() error {
+	pw.held = false
+	assets := findAssets(pw.body.Bytes())
+	if pw.cache != nil {
+		pw.addLinks(assets)
+	}
+	if pw.pusher != nil {
+		pw.push(assets)
+	}
+	pw.ResponseWriter.WriteHeader(pw.code)
+	_, err := pw.ResponseWriter.Write(pw.body.Bytes())
+	pw.body.Reset()
+	return err
+}
+
+func (pw *preloadWriter) addLinks(assets []asset) {
+	links := []string{}
+	existing := strings.Join(pw.Header()["Link"], ",")
+	for _, a := range assets {
+		l := a.link()
+		links = append(links, l)
+		if !strings.Contains(existing, l) {
+			pw.Header().Add("Link", l)
+		}
+	}
+	pw.cache.set(pw.key, links)
+}
+
+// push pushes assets, which has to happen before the response header is sent
+func (pw *preloadWriter) push(assets []asset) {
+	opts := &http.PushOptions{Header: http.Header{}}
+	for _, h := range pushHeaders {
+		if v, ok := pw.req.Header[h]; ok {
+			opts.Header[h] = v
+		}
+	}
+	for _, a := range assets {
+		target, ok := pushTarget(pw.req, a.URL)
+		if !ok {
+			continue
+		}
+		if err := pw.pusher.Push(target, opts); err != nil {
+			if err != http.ErrNotSupported {
+				pw.log.Warn("push %s: %s", target, err)
+			}
+			return
+		}
+		pw.log.Say("push %s", target)
+	}
+}
+
+// finish sends a held response
+func (pw *preloadWriter) finish() {
+	if pw.held {
+		pw.release()
+	}
+}
+
+// Flush does nothing until we know whether the response is held, and nothing
+// for held responses, which can't be sent until they've been scanned
+func (pw *preloadWriter) Flush() {
+	if !pw.wroteHeader || pw.held {
+		return
+	}
+	if f, ok := pw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (pw *preloadWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return hijack(pw.ResponseWriter)
+}
+
+// preload adds Link preload headers to HTML responses if Preload is set.
+// Links we've seen before for the same URL are sent straight away as 103 Early
+// Hints, where that's supported. If Push is set, the assets are pushed to
+// HTTP/2 clients.
+func (dd *Devd) preload(log termlog.Logger, w http.ResponseWriter, r *http.Request) *preloadWriter {
+	pw := &preloadWriter{ResponseWriter: w, log: log}
+	if dd.Preload {
+		pw.key = r.Host + r.URL.Path
+		pw.cache = dd.preloads
+		if links := dd.preloads.get(pw.key); len(links) > 0 && r.Method == "GET" {
+			for _, l := range links {
+				w.Header().Add("Link", l)
+			}
+			if earlyHintsSupported && r.ProtoAtLeast(1, 1) {
+				w.WriteHeader(statusEarlyHints)
+			}
+		}
+	}
+	if p, ok := w.(http.Pusher); ok && dd.Push && r.ProtoMajor >= 2 && r.Method == "GET" {
+		pw.pusher = p
+		pw.req = r
+	}
+	return pw
+}
@@ -0,0 +1,250 @@
+package devd
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"net/textproto"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/GeertJohan/go.rice"
+	"github.com/cortesi/devd/httpctx"
+	"github.com/cortesi/devd/livereload"
+	"github.com/cortesi/devd/ricetemp"
+	"github.com/cortesi/termlog"
+)
+
+var preloadLinksTests = []struct {
+	html  string
+	links []string
+}{
+	{"<html></html>", []string{}},
+	{
+		`<link rel="stylesheet" href="/style.css"><script src='app.js'></script>`,
+		[]string{"</style.css>; rel=preload; as=style", "<app.js>; rel=preload; as=script"},
+	},
+	{`<LINK REL="Alternate Stylesheet" HREF=alt.css>`, []string{"<alt.css>; rel=preload; as=style"}},
+	{`<link rel="icon" href="favicon.ico"><script>inline()</script>`, []string{}},
+}
+
+func TestPreloadLinks(t *testing.T) {
+	for i, tt := range preloadLinksTests {
+		if links := preloadLinks([]byte(tt.html)); !reflect.DeepEqual(links, tt.links) {
+			t.Errorf("Test %d: expected %#v, got %#v", i, tt.links, links)
+		}
+	}
+}
+
+func TestPreload(t *testing.T) {
+	logger := termlog.NewLog()
+	logger.Quiet()
+	devd := Devd{Preload: true}
+	h := devd.WrapHandler(
+		logger,
+		httpctx.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/empty" {
+				w.Header().Set("Content-Type", "text/html")
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte(`<html><head><link rel="stylesheet" href="s.css"></head></html>`))
+		}),
+	)
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	expected := []string{"<s.css>; rel=preload; as=style"}
+	for i := 0; i < 2; i++ {
+		hints := []int{}
+		trace := &httptrace.ClientTrace{
+			Got1xxResponse: func(code int, header textproto.MIMEHeader) error {
+				hints = append(hints, code)
+				return nil
+			},
+		}
+		req, _ := http.NewRequest("GET", ts.URL+"/", nil)
+		req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != 200 || !reflect.DeepEqual(resp.Header["Link"], expected) {
+			t.Errorf("Request %d: expected %v, got %d %v", i, expected, resp.StatusCode, resp.Header["Link"])
+		}
+		// Links are only known once we've seen the page
+		if i == 1 && earlyHintsSupported && !reflect.DeepEqual(hints, []int{103}) {
+			t.Errorf("Request %d: expected early hints, got %v", i, hints)
+		} else if i == 0 && len(hints) > 0 {
+			t.Errorf("Request %d: unexpected early hints %v", i, hints)
+		}
+	}
+
+	resp, err := http.Get(ts.URL + "/empty")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 200 || len(resp.Header["Link"]) != 0 {
+		t.Errorf("Unexpected response: %d %v", resp.StatusCode, resp.Header["Link"])
+	}
+}
+
+// A page with a script at the end of its body, after livereload's injection
+// point
+const bodyScriptPage = `<html><head><link rel="stylesheet" href="s.css"></head>` +
+	`<body><h1>Page</h1><script src="app.js"></script></body></html>`
+
+// bodyScriptRouter serves bodyScriptPage from a static route, with
+// livereload on
+func bodyScriptRouter(t *testing.T, devd *Devd) (http.Handler, func()) {
+	tmp, err := ioutil.TempDir("", "devdtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(path.Join(tmp, "index.html"), []byte(bodyScriptPage), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := termlog.NewLog()
+	logger.Quiet()
+	templates := ricetemp.MustMakeTemplates(rice.MustFindBox("templates"))
+	devd.Livereload = true
+	if err := devd.AddRoutes([]string{tmp}, nil); err != nil {
+		t.Fatal(err)
+	}
+	h, err := devd.Router(logger, templates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h, func() {
+		devd.shutdown()
+		os.RemoveAll(tmp)
+	}
+}
+
+func TestPreloadBodyScripts(t *testing.T) {
+	devd := &Devd{Preload: true}
+	h, cleanup := bodyScriptRouter(t, devd)
+	defer cleanup()
+	ht := handlerTester{t, h}
+	resp := ht.Request("GET", "/", nil)
+	AssertCode(t, resp, 200)
+	if !strings.Contains(resp.Body.String(), livereload.ScriptPath) {
+		t.Error("Expected livereload to be injected")
+	}
+	links := strings.Join(resp.Header()["Link"], ",")
+	for _, l := range []string{"<s.css>; rel=preload; as=style", "<app.js>; rel=preload; as=script"} {
+		if !strings.Contains(links, l) {
+			t.Errorf("Expected Link %s, got %v", l, resp.Header()["Link"])
+		}
+	}
+}
+
+var pushTargetTests = []struct {
+	path   string
+	ref    string
+	target string
+	ok     bool
+}{
+	{"/", "s.css", "/s.css", true},
+	{"/a/b.html", "../c/d.js?v=1", "/c/d.js?v=1", true},
+	{"/a/", "/x.css", "/x.css", true},
+	{"/", "//devd.io/x.css", "/x.css", true},
+	{"/", "https://cdn.example.com/x.js", "", false},
+}
+
+func TestPushTarget(t *testing.T) {
+	for i, tt := range pushTargetTests {
+		r := httptest.NewRequest("GET", "http://devd.io"+tt.path, nil)
+		target, ok := pushTarget(r, tt.ref)
+		if target != tt.target || ok != tt.ok {
+			t.Errorf("Test %d: expected %q %v, got %q %v", i, tt.target, tt.ok, target, ok)
+		}
+	}
+}
+
+// pushRecorder records pushes, which have to come before the response header
+type pushRecorder struct {
+	*httptest.ResponseRecorder
+	pushed     []string
+	headers    []http.Header
+	headerSent bool
+}
+
+func (pr *pushRecorder) WriteHeader(code int) {
+	pr.headerSent = true
+	pr.ResponseRecorder.WriteHeader(code)
+}
+
+func (pr *pushRecorder) Write(data []byte) (int, error) {
+	pr.headerSent = true
+	return pr.ResponseRecorder.Write(data)
+}
+
+func (pr *pushRecorder) Push(target string, opts *http.PushOptions) error {
+	if pr.headerSent {
+		return fmt.Errorf("Push after response header")
+	}
+	pr.pushed = append(pr.pushed, target)
+	pr.headers = append(pr.headers, opts.Header)
+	return nil
+}
+
+func TestPush(t *testing.T) {
+	logger := termlog.NewLog()
+	logger.Quiet()
+	devd := Devd{Push: true}
+	h := devd.WrapHandler(
+		logger,
+		httpctx.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<link rel=stylesheet href="s.css"><script src="//cdn.example.com/x.js"></script>`))
+		}),
+	)
+
+	req := httptest.NewRequest("GET", "http://devd.io/page/", nil)
+	req.Header.Set("Cookie", "a=b")
+	rec := &pushRecorder{ResponseRecorder: httptest.NewRecorder()}
+	h.ServeHTTP(rec, req)
+	if len(rec.pushed) != 0 {
+		t.Errorf("Pushed over HTTP/1: %v", rec.pushed)
+	}
+
+	req.ProtoMajor, req.ProtoMinor = 2, 0
+	rec = &pushRecorder{ResponseRecorder: httptest.NewRecorder()}
+	h.ServeHTTP(rec, req)
+	if !reflect.DeepEqual(rec.pushed, []string{"/page/s.css"}) {
+		t.Errorf("Unexpected pushes: %v", rec.pushed)
+	}
+	if len(rec.headers) > 0 && rec.headers[0].Get("Cookie") != "a=b" {
+		t.Errorf("Cookie not passed to pushed request: %v", rec.headers[0])
+	}
+	if len(rec.Header()["Link"]) != 0 {
+		t.Errorf("Unexpected Link headers without preload: %v", rec.Header()["Link"])
+	}
+}
+
+func TestPushBodyScripts(t *testing.T) {
+	devd := &Devd{Push: true}
+	h, cleanup := bodyScriptRouter(t, devd)
+	defer cleanup()
+	req := httptest.NewRequest("GET", "http://devd.io/", nil)
+	req.ProtoMajor, req.ProtoMinor = 2, 0
+	rec := &pushRecorder{ResponseRecorder: httptest.NewRecorder()}
+	h.ServeHTTP(rec, req)
+	pushed := strings.Join(rec.pushed, ",")
+	for _, p := range []string{"/s.css", "/app.js"} {
+		if !strings.Contains(pushed, p) {
+			t.Errorf("Expected %s to be pushed, got %v", p, rec.pushed)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package devd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/cortesi/devd/inject"
+)
+
+const prettyIndent = "  "
+
+// prettyKind tells us whether a content type is JSON or XML, returning "json",
+// "xml" or an empty string
+func prettyKind(contentType string) string {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	switch {
+	case mt == "application/json" || strings.HasSuffix(mt, "+json"):
+		return "json"
+	case mt == "application/xml" || mt == "text/xml" || strings.HasSuffix(mt, "+xml"):
+		return "xml"
+	}
+	return ""
+}
+
+func xmlName(n xml.Name) string {
+	if n.Space != "" {
+		return n.Space + ":" + n.Local
+	}
+	return n.Local
+}
+
+// indentXML re-indents an XML document. Elements that hold only text stay on
+// one line, and whitespace between elements is replaced.
+func indentXML(data []byte) ([]byte, error) {
+	var out bytes.Buffer
+	d := xml.NewDecoder(bytes.NewReader(data))
+	depth := 0
+	// Whether the last thing written was a start tag, or a start tag and text
+	open, text := false, false
+	newline := func() {
+		if out.Len() > 0 {
+			out.WriteString("\n")
+		}
+		out.WriteString(strings.Repeat(prettyIndent, depth))
+	}
+	for {
+		tok, err := d.RawToken()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			newline()
+			out.WriteString("<" + xmlName(t.Name))
+			for _, a := range t.Attr {
+				out.WriteString(" " + xmlName(a.Name) + `="`)
+				xml.EscapeText(&out, []byte(a.Value))
+				out.WriteString(`"`)
+			}
+			out.WriteString(">")
+			depth++
+			open, text = true, false
+		case xml.EndElement:
+			depth--
+			if !open {
+				newline()
+			}
+			out.WriteString("</" + xmlName(t.Name) + ">")
+			open, text = false, false
+		case xml.CharData:
+			trimmed := bytes.TrimSpace(t)
+			if len(trimmed) == 0 {
+				continue
+			}
+			if !open || text {
+				newline()
+			}
+			xml.EscapeText(&out, trimmed)
+			text = open
+		case xml.Comment:
+			newline()
+			out.WriteString("<!--" + string(t) + "-->")
+			open, text = false, false
+		case xml.ProcInst:
+			newline()
+			out.WriteString("<?" + t.Target)
+			if len(t.Inst) > 0 {
+				out.WriteString(" " + string(t.Inst))
+			}
+			out.WriteString("?>")
+			open, text = false, false
+		case xml.Directive:
+			newline()
+			out.WriteString("<!" + string(t) + ">")
+			open, text = false, false
+		}
+	}
+	if depth != 0 {
+		return nil, fmt.Errorf("Unbalanced XML")
+	}
+	out.WriteString("\n")
+	return out.Bytes(), nil
+}
+
+// prettify re-indents a JSON or XML body
+func prettify(kind string, body []byte) ([]byte, error) {
+	if kind == "xml" {
+		return indentXML(body)
+	}
+	var out bytes.Buffer
+	if err := json.Indent(&out, body, "", prettyIndent); err != nil {
+		return nil, err
+	}
+	out.WriteString("\n")
+	return out.Bytes(), nil
+}
+
+// prettyWriter holds JSON and XML responses until they're complete, and
+// re-indents them. Other responses, and ones that are compressed or partial,
+// are passed straight through. Responses to HEAD requests have no body to
+// re-indent, so they get the headers a GET would, minus the Content-Length,
+// which can't be known.
+type prettyWriter struct {
+	http.ResponseWriter
+	head        bool
+	kind        string
+	code        int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (pw *prettyWriter) WriteHeader(code int) {
+	if pw.wroteHeader {
+		return
+	}
+	if code >= 100 && code < 200 {
+		pw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	pw.wroteHeader = true
+	h := pw.Header()
+	if code != http.StatusPartialContent && h.Get("Content-Encoding") == "" {
+		pw.kind = prettyKind(h.Get("Content-Type"))
+	}
+	if pw.kind != "" {
+		inject.BodyChanged(h)
+	}
+	if pw.kind != "" && pw.head {
+		h.Del("Content-Length")
+		pw.kind = ""
+	}
+	if pw.kind == "" {
+		pw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	pw.code = code
+}
+
+func (pw *prettyWriter) Write(data []byte) (int, error) {
+	if !pw.wroteHeader {
+		if pw.Header().Get("Content-Type") == "" {
+			pw.Header().Set("Content-Type", http.DetectContentType(data))
+		}
+		pw.WriteHeader(http.StatusOK)
+	}
+	if pw.kind == "" {
+		return pw.ResponseWriter.Write(data)
+	}
+	return pw.body.Write(data)
+}
+
+// finish sends a held response, re-indented if it parses. Bodies that don't
+// parse are sent as they are, though their validators have already been
+// weakened, so that they match what a HEAD request reports.
+func (pw *prettyWriter) finish() {
+	if pw.kind == "" {
+		return
+	}
+	kind, body := pw.kind, pw.body.Bytes()
+	pw.kind = ""
+	if len(body) == 0 {
+		pw.ResponseWriter.WriteHeader(pw.code)
+		return
+	}
+	if pretty, err := prettify(kind, body); err == nil {
+		body = pretty
+	}
+	pw.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	pw.ResponseWriter.WriteHeader(pw.code)
+	pw.ResponseWriter.Write(body)
+}
+
+// Flush does nothing until we know whether the response is held, and nothing
+// for held responses, which can't be sent until they're complete
+func (pw *prettyWriter) Flush() {
+	if !pw.wroteHeader || pw.kind != "" {
+		return
+	}
+	if f, ok := pw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (pw *prettyWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return hijack(pw.ResponseWriter)
+}
@@ -0,0 +1,135 @@
+package devd
+
+import (
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/GeertJohan/go.rice"
+	"github.com/cortesi/devd/ricetemp"
+	"github.com/cortesi/termlog"
+)
+
+var prettifyTests = []struct {
+	kind string
+	in   string
+	out  string
+	ok   bool
+}{
+	{"json", `{"a":[1,2],"b":{}}`, "{\n  \"a\": [\n    1,\n    2\n  ],\n  \"b\": {}\n}\n", true},
+	{"json", `{"a":`, "", false},
+	{
+		"xml",
+		`<?xml version="1.0"?><a x="1&amp;2"><b>text</b><c><d/></c></a>`,
+		"<?xml version=\"1.0\"?>\n<a x=\"1&amp;2\">\n  <b>text</b>\n  <c>\n    <d></d>\n  </c>\n</a>\n",
+		true,
+	},
+	{"xml", `<ns:a xmlns:ns="urn:x">  <ns:b/> </ns:a>`, "<ns:a xmlns:ns=\"urn:x\">\n  <ns:b></ns:b>\n</ns:a>\n", true},
+	{"xml", `<a><b></a>`, "", false},
+}
+
+func TestPrettify(t *testing.T) {
+	for i, tt := range prettifyTests {
+		out, err := prettify(tt.kind, []byte(tt.in))
+		if (err == nil) != tt.ok {
+			t.Errorf("Test %d: unexpected error state: %v", i, err)
+			continue
+		}
+		if tt.ok && string(out) != tt.out {
+			t.Errorf("Test %d: expected\n%q\ngot\n%q", i, tt.out, string(out))
+		}
+	}
+}
+
+func TestPrettyKind(t *testing.T) {
+	kinds := map[string]string{
+		"application/json; charset=utf-8": "json",
+		"application/hal+json":            "json",
+		"text/xml":                        "xml",
+		"application/atom+xml":            "xml",
+		"text/html":                       "",
+		"":                                "",
+	}
+	for ct, kind := range kinds {
+		if got := prettyKind(ct); got != kind {
+			t.Errorf("Expected %q for %q, got %q", kind, ct, got)
+		}
+	}
+}
+
+func TestPretty(t *testing.T) {
+	logger := termlog.NewLog()
+	logger.Quiet()
+	templates := ricetemp.MustMakeTemplates(rice.MustFindBox("templates"))
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := `{"a":1}`
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Etag", `"abc"`)
+		w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+		if r.Header.Get("Accept-Encoding") == "br" {
+			t.Error("Accept-Encoding was passed upstream")
+		}
+		// Go's transport asks for gzip itself, and decompresses it
+		if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			w.Header().Set("Content-Encoding", "gzip")
+			gz := gzip.NewWriter(w)
+			gz.Write([]byte(body))
+			gz.Close()
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.Write([]byte(body))
+	}))
+	defer backend.Close()
+
+	devd := Devd{Pretty: true}
+	if err := devd.AddRoutes([]string{"/api/=" + backend.URL, "./testdata"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	h, err := devd.Router(logger, templates)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("GET", "/api/", nil)
+	req.Header.Set("Accept-Encoding", "br")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	expected := "{\n  \"a\": 1\n}\n"
+	if rec.Body.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, rec.Body.String())
+	}
+	if rec.Header().Get("Content-Length") != strconv.Itoa(len(expected)) {
+		t.Errorf("Wrong Content-Length: %s", rec.Header().Get("Content-Length"))
+	}
+	for _, method := range []string{"GET", "HEAD"} {
+		rec = httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(method, "/api/", nil))
+		if etag := rec.Header().Get("Etag"); etag != `W/"abc+devd"` {
+			t.Errorf("%s: expected a weakened ETag, got %q", method, etag)
+		}
+		if rec.Header().Get("Last-Modified") != "" {
+			t.Errorf("%s: expected Last-Modified to be dropped", method)
+		}
+	}
+	if cl := rec.Header().Get("Content-Length"); cl != "" {
+		t.Errorf("HEAD: expected no Content-Length, got %s", cl)
+	}
+
+	req = httptest.NewRequest("GET", "/api/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Body.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != 200 || rec.Body.Len() == 0 {
+		t.Errorf("Unexpected response for HTML: %d %q", rec.Code, rec.Body.String())
+	}
+}
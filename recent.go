@@ -0,0 +1,77 @@
+package devd
+
+import (
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// How long a file counts as recently changed in directory listings
+const recentWindow = 5 * time.Minute
+
+// recentChanges keeps track of the files devd's watchers have seen change,
+// so directory listings can point them out
+type recentChanges struct {
+	sync.Mutex
+	window  time.Duration
+	changed map[string]time.Time
+}
+
+func newRecentChanges(window time.Duration) *recentChanges {
+	return &recentChanges{window: window, changed: make(map[string]time.Time)}
+}
+
+// add records a batch of changes, marking the directories that hold changed
+// files as well. Watchers give paths relative to the working directory.
+func (rc *recentChanges) add(c Change) {
+	if c.Mod == nil {
+		return
+	}
+	rc.Lock()
+	defer rc.Unlock()
+	now := time.Now()
+	for p, t := range rc.changed {
+		if now.Sub(t) > rc.window {
+			delete(rc.changed, p)
+		}
+	}
+	for _, p := range append(c.Mod.Added, c.Mod.Changed...) {
+		abs, err := filepath.Abs(p)
+		if err != nil {
+			continue
+		}
+		for {
+			rc.changed[abs] = now
+			parent := filepath.Dir(abs)
+			if parent == abs {
+				break
+			}
+			abs = parent
+		}
+	}
+	for _, p := range c.Mod.Deleted {
+		if abs, err := filepath.Abs(p); err == nil {
+			delete(rc.changed, abs)
+		}
+	}
+}
+
+// recent tells us if a file changed within the window
+func (rc *recentChanges) recent(path string) bool {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	rc.Lock()
+	defer rc.Unlock()
+	t, ok := rc.changed[abs]
+	return ok && time.Since(t) <= rc.window
+}
+
+// under returns a function that checks paths relative to a root directory,
+// for the fileserver
+func (rc *recentChanges) under(root string) func(string) bool {
+	return func(name string) bool {
+		return rc.recent(filepath.Join(root, filepath.FromSlash(name)))
+	}
+}
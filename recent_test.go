@@ -0,0 +1,44 @@
+package devd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cortesi/moddwatch"
+)
+
+func TestRecentChanges(t *testing.T) {
+	rc := newRecentChanges(time.Hour)
+	rc.add(Change{"/", &moddwatch.Mod{
+		Added:   []string{"site/new.html"},
+		Changed: []string{filepath.Join("site", "css", "main.css")},
+	}})
+	recent := rc.under("site")
+	for name, expected := range map[string]bool{
+		"/new.html":     true,
+		"/css":          true,
+		"/css/main.css": true,
+		"/old.html":     false,
+	} {
+		if recent(name) != expected {
+			t.Errorf("%s: expected %v", name, expected)
+		}
+	}
+	wd, _ := os.Getwd()
+	if !rc.recent(filepath.Join(wd, "site", "new.html")) {
+		t.Error("Expected absolute paths to match")
+	}
+
+	rc.add(Change{"/", &moddwatch.Mod{Deleted: []string{"site/new.html"}}})
+	if recent("/new.html") {
+		t.Error("Expected a deleted file not to be recent")
+	}
+
+	rc.window = 0
+	rc.add(Change{"/", &moddwatch.Mod{}})
+	if recent("/css/main.css") {
+		t.Error("Expected changes to expire")
+	}
+}
@@ -0,0 +1,308 @@
+package devd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultReplayHistory is the number of requests kept for replay by the
+// command-line tool
+const DefaultReplayHistory = 20
+
+// replayPath is the admin endpoint that lists and replays recent requests
+const replayPath = "/.devd/replay"
+
+// replayHeader must be set on POSTs to the replay endpoint. Browsers can't
+// send it cross-origin without a preflight, so pages can't replay requests
+// behind the user's back.
+const replayHeader = "X-Devd-Replay"
+
+// Headers that are hidden when the history is listed over HTTP
+var redactedHeaders = []string{"Authorization", "Cookie", "Proxy-Authorization"}
+
+// Request bodies are kept up to this size. Requests with larger bodies are
+// listed, but can't be replayed.
+const maxReplayBody = 1024 * 1024
+
+// RecordedRequest is a request kept for replay
+type RecordedRequest struct {
+	ID        int         `json:"id"`
+	Time      time.Time   `json:"time"`
+	Method    string      `json:"method"`
+	Host      string      `json:"host"`
+	URI       string      `json:"uri"`
+	Header    http.Header `json:"headers"`
+	Truncated bool        `json:"truncated"`
+
+	body       []byte
+	remoteAddr string
+}
+
+// requestHistory keeps the most recent requests, oldest first
+type requestHistory struct {
+	sync.Mutex
+	size    int
+	lastID  int
+	entries []*RecordedRequest
+}
+
+func newRequestHistory(size int) *requestHistory {
+	return &requestHistory{size: size}
+}
+
+func (h *requestHistory) add(rr *RecordedRequest) {
+	h.Lock()
+	defer h.Unlock()
+	h.lastID++
+	rr.ID = h.lastID
+	h.entries = append(h.entries, rr)
+	if len(h.entries) > h.size {
+		h.entries = h.entries[len(h.entries)-h.size:]
+	}
+}
+
+// get finds a request by ID, or the most recent request if id is 0
+func (h *requestHistory) get(id int) *RecordedRequest {
+	h.Lock()
+	defer h.Unlock()
+	if id == 0 && len(h.entries) > 0 {
+		return h.entries[len(h.entries)-1]
+	}
+	for _, rr := range h.entries {
+		if rr.ID == id {
+			return rr
+		}
+	}
+	return nil
+}
+
+// list returns the requests in the history, most recent first
+func (h *requestHistory) list() []*RecordedRequest {
+	h.Lock()
+	defer h.Unlock()
+	ret := make([]*RecordedRequest, 0, len(h.entries))
+	for i := len(h.entries) - 1; i >= 0; i-- {
+		ret = append(ret, h.entries[i])
+	}
+	return ret
+}
+
+func cloneHeader(h http.Header) http.Header {
+	ret := make(http.Header, len(h))
+	for k, vals := range h {
+		ret[k] = append([]string(nil), vals...)
+	}
+	return ret
+}
+
+// bodyRecorder keeps a copy of a request body as the handler reads it
+type bodyRecorder struct {
+	io.ReadCloser
+	buf       bytes.Buffer
+	truncated bool
+}
+
+func (br *bodyRecorder) Read(p []byte) (int, error) {
+	n, err := br.ReadCloser.Read(p)
+	if room := maxReplayBody - br.buf.Len(); n > room {
+		br.buf.Write(p[:room])
+		br.truncated = true
+	} else {
+		br.buf.Write(p[:n])
+	}
+	return n, err
+}
+
+// record starts recording a request. The returned function adds it to the
+// history, and should be called once the request has been handled, so that
+// the body the handler read is complete.
+func (h *requestHistory) record(r *http.Request) func() {
+	rr := &RecordedRequest{
+		Time:       time.Now(),
+		Method:     r.Method,
+		Host:       r.Host,
+		URI:        r.RequestURI,
+		Header:     cloneHeader(r.Header),
+		remoteAddr: r.RemoteAddr,
+	}
+	var body *bodyRecorder
+	if r.Body != nil && r.Body != http.NoBody {
+		body = &bodyRecorder{ReadCloser: r.Body}
+		r.Body = body
+	}
+	return func() {
+		if body != nil {
+			rr.body = body.buf.Bytes()
+			rr.Truncated = body.truncated
+		}
+		h.add(rr)
+	}
+}
+
+type replayKey struct{}
+
+// replayID returns the ID of the recorded request that r replays, if any
+func replayID(r *http.Request) (int, bool) {
+	id, ok := r.Context().Value(replayKey{}).(int)
+	return id, ok
+}
+
+// redacted returns a copy of the request with credentials hidden
+func (rr *RecordedRequest) redacted() *RecordedRequest {
+	ret := *rr
+	ret.Header = cloneHeader(rr.Header)
+	for _, h := range redactedHeaders {
+		if _, ok := ret.Header[h]; ok {
+			ret.Header.Set(h, "[redacted]")
+		}
+	}
+	return &ret
+}
+
+// sameOrigin tells us if a request has no Origin header, or one that names
+// the host it was sent to
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = r.Host
+	}
+	return strings.EqualFold(u.Hostname(), host)
+}
+
+// History returns the requests kept for replay, most recent first
+func (dd *Devd) History() []*RecordedRequest {
+	if dd.history == nil {
+		return nil
+	}
+	return dd.history.list()
+}
+
+// Replay re-issues a recorded request against the running server, as if it
+// came from the original client. An id of 0 replays the most recent request.
+// Headers in the header argument replace those of the original request, and
+// headers with an empty value are removed. Replay returns the status code of
+// the response, which is otherwise logged and discarded.
+func (dd *Devd) Replay(id int, header http.Header) (int, error) {
+	if dd.history == nil || dd.router == nil {
+		return 0, fmt.Errorf("Replay is not enabled")
+	}
+	rr := dd.history.get(id)
+	if rr == nil {
+		if id == 0 {
+			return 0, fmt.Errorf("No requests to replay")
+		}
+		return 0, fmt.Errorf("No request %d in history", id)
+	}
+	if rr.Truncated {
+		return 0, fmt.Errorf("The body of request %d was too large to keep", rr.ID)
+	}
+	ctx := context.WithValue(context.Background(), replayKey{}, rr.ID)
+	req, err := http.NewRequest(rr.Method, rr.URI, bytes.NewReader(rr.body))
+	if err != nil {
+		return 0, fmt.Errorf("Could not replay request %d: %s", rr.ID, err)
+	}
+	req = req.WithContext(ctx)
+	req.Host = rr.Host
+	req.RequestURI = rr.URI
+	req.RemoteAddr = rr.remoteAddr
+	req.Header = cloneHeader(rr.Header)
+	for k, vals := range header {
+		req.Header.Del(k)
+		for _, v := range vals {
+			if v != "" {
+				req.Header.Add(k, v)
+			}
+		}
+	}
+	if len(rr.body) > 0 {
+		req.Header.Del("Content-Length")
+	}
+	resp := &bufferedResponse{header: make(http.Header)}
+	dd.router.ServeHTTP(resp, req)
+	if resp.status == 0 {
+		resp.status = http.StatusOK
+	}
+	return resp.status, nil
+}
+
+// ParseReplayHeaders parses header specifications of the form "Name: value"
+// for Replay. An empty value removes the header.
+func ParseReplayHeaders(specs []string) (http.Header, error) {
+	h := make(http.Header)
+	for _, s := range specs {
+		parts := strings.SplitN(s, ":", 2)
+		name := strings.TrimSpace(parts[0])
+		if len(parts) != 2 || name == "" {
+			return nil, fmt.Errorf("Invalid header specification: %s", s)
+		}
+		h.Add(name, strings.TrimSpace(parts[1]))
+	}
+	return h, nil
+}
+
+// serveReplay lists recent requests in response to a GET, with credentials
+// hidden, and replays one in response to a POST. The POST form can specify
+// the request id, and header values of the form "Name: value" that replace
+// the original ones. POSTs must carry the X-Devd-Replay header, and come from
+// the same origin if they have one.
+func (dd *Devd) serveReplay(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET", "HEAD":
+		history := dd.History()
+		for i, rr := range history {
+			history[i] = rr.redacted()
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(history)
+	case "POST":
+		if r.Header.Get(replayHeader) == "" || !sameOrigin(r) {
+			http.Error(
+				w,
+				"Replays need an "+replayHeader+" header, and can't come from other sites",
+				http.StatusForbidden,
+			)
+			return
+		}
+		id := 0
+		if v := r.FormValue("id"); v != "" {
+			var err error
+			if id, err = strconv.Atoi(v); err != nil {
+				http.Error(w, "Invalid request id", http.StatusBadRequest)
+				return
+			}
+		}
+		header, err := ParseReplayHeaders(r.Form["header"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		status, err := dd.Replay(id, header)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]int{"status": status})
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,161 @@
+package devd
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/cortesi/devd/httpctx"
+	"github.com/cortesi/termlog"
+)
+
+type seenRequest struct {
+	method string
+	uri    string
+	body   string
+	header string
+}
+
+func TestReplay(t *testing.T) {
+	logger := termlog.NewLog()
+	logger.Quiet()
+	dd := Devd{ReplayHistory: 2}
+	if _, err := dd.Replay(0, nil); err == nil {
+		t.Error("Expected error before the router is built")
+	}
+	seen := []seenRequest{}
+	h := dd.WrapHandler(
+		logger,
+		httpctx.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			seen = append(seen, seenRequest{r.Method, r.RequestURI, string(body), r.Header.Get("X-Test")})
+			w.WriteHeader(http.StatusCreated)
+		}),
+	)
+	dd.router = h
+	if _, err := dd.Replay(0, nil); err == nil {
+		t.Error("Expected error with an empty history")
+	}
+	for _, p := range []string{"/one", "/two", "/three?a=b"} {
+		req := httptest.NewRequest("POST", p, strings.NewReader("body "+p))
+		req.Header.Set("X-Test", "original")
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	history := dd.History()
+	if len(history) != 2 || history[0].ID != 3 || history[1].ID != 2 {
+		t.Fatalf("Unexpected history: %#v", history)
+	}
+	if _, err := dd.Replay(1, nil); err == nil {
+		t.Error("Expected error for a request that has been dropped")
+	}
+
+	header, err := ParseReplayHeaders([]string{"X-Test: changed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, err := dd.Replay(0, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status != http.StatusCreated {
+		t.Errorf("Expected status 201, got %d", status)
+	}
+	expected := seenRequest{"POST", "/three?a=b", "body /three?a=b", "changed"}
+	if seen[len(seen)-1] != expected {
+		t.Errorf("Expected %#v, got %#v", expected, seen[len(seen)-1])
+	}
+	if h := dd.History(); len(h) != 2 || h[0].ID != 3 {
+		t.Error("Replayed requests should not be recorded")
+	}
+
+	header, _ = ParseReplayHeaders([]string{"X-Test:"})
+	if _, err := dd.Replay(2, header); err != nil {
+		t.Fatal(err)
+	}
+	expected = seenRequest{"POST", "/two", "body /two", ""}
+	if seen[len(seen)-1] != expected {
+		t.Errorf("Expected %#v, got %#v", expected, seen[len(seen)-1])
+	}
+
+	if _, err := ParseReplayHeaders([]string{"nocolon"}); err == nil {
+		t.Error("Expected error for an invalid header")
+	}
+}
+
+func TestServeReplay(t *testing.T) {
+	logger := termlog.NewLog()
+	logger.Quiet()
+	dd := Devd{ReplayHistory: 5}
+	var lastHeader string
+	h := dd.WrapHandler(
+		logger,
+		httpctx.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			lastHeader = r.Header.Get("X-Test")
+		}),
+	)
+	dd.router = h
+	req := httptest.NewRequest("GET", "/foo", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	req.Header.Set("Cookie", "session=secret")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	rec := httptest.NewRecorder()
+	dd.serveReplay(rec, httptest.NewRequest("GET", replayPath, nil))
+	list := []RecordedRequest{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].URI != "/foo" {
+		t.Fatalf("Unexpected history: %#v", list)
+	}
+	if strings.Contains(rec.Body.String(), "secret") {
+		t.Errorf("Expected credentials to be redacted, got %s", rec.Body.String())
+	}
+	if list[0].Header.Get("Cookie") != "[redacted]" {
+		t.Errorf("Expected the cookie to be redacted, got %q", list[0].Header.Get("Cookie"))
+	}
+	if dd.History()[0].Header.Get("Authorization") != "Bearer secret" {
+		t.Error("Expected the recorded request to keep its credentials")
+	}
+
+	form := url.Values{"id": {"1"}, "header": {"X-Test: yes"}}
+	post := func(origin string, marked bool) *http.Request {
+		req := httptest.NewRequest("POST", "http://devd.io"+replayPath, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		if marked {
+			req.Header.Set(replayHeader, "1")
+		}
+		return req
+	}
+	for _, req := range []*http.Request{post("", false), post("http://evil.com", true)} {
+		rec = httptest.NewRecorder()
+		dd.serveReplay(rec, req)
+		AssertCode(t, rec, http.StatusForbidden)
+	}
+	if lastHeader != "" {
+		t.Errorf("Expected refused replays not to run, got %q", lastHeader)
+	}
+
+	req = post("http://devd.io:8000", true)
+	rec = httptest.NewRecorder()
+	dd.serveReplay(rec, req)
+	AssertCode(t, rec, http.StatusOK)
+	if lastHeader != "yes" {
+		t.Errorf("Expected the replay to have the new header, got %q", lastHeader)
+	}
+
+	req = httptest.NewRequest("POST", replayPath+"?id=9", nil)
+	req.Header.Set(replayHeader, "1")
+	rec = httptest.NewRecorder()
+	dd.serveReplay(rec, req)
+	AssertCode(t, rec, http.StatusNotFound)
+}
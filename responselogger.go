@@ -1,9 +1,12 @@
 package devd
 
 import (
+	"bufio"
 	"fmt"
+	"net"
 	"net/http"
 	"strconv"
+	"sync/atomic"
 
 	"github.com/cortesi/devd/timer"
 	"github.com/cortesi/termlog"
@@ -13,11 +16,24 @@ import (
 
 // ResponseLogWriter is a ResponseWriter that logs
 type ResponseLogWriter struct {
-	Log         termlog.Logger
-	Resp        http.ResponseWriter
-	Flusher     http.Flusher
-	Timer       *timer.Timer
+	// Updated atomically, so it comes first for 64-bit alignment on 32-bit
+	// platforms
+	size int64
+
+	Log     termlog.Logger
+	Resp    http.ResponseWriter
+	Flusher http.Flusher
+	Timer   *timer.Timer
+	// Header values are shortened to fit lines in this many columns, if
+	// it's set
+	Width int
+	// Add a Server-Timing header with devd's timings to the response
+	ServerTiming bool
+
 	wroteHeader bool
+	status      int
+	// The Content-Length given when the header was written, or -1
+	declared int64
 }
 
 func (rl *ResponseLogWriter) logCode(code int, status string) {
@@ -34,17 +50,26 @@ func (rl *ResponseLogWriter) logCode(code int, status string) {
 	default:
 		codestr = fmt.Sprintf("%d %s", code, status)
 	}
-	cl := rl.Header().Get("content-length")
-	clstr := ""
-	if cl != "" {
-		cli, err := strconv.Atoi(cl)
-		if err != nil {
-			rl.Log.Warn("Invalid content-length header")
-		} else if cli > 0 {
-			clstr = fmt.Sprintf("%s", humanize.Bytes(uint64(cli)))
-		}
+	rl.Log.Say("<- %s", codestr)
+}
+
+// Finish logs the size of the response body once it has been written, and
+// warns if it doesn't match the Content-Length the response declared
+func (rl *ResponseLogWriter) Finish(method string) {
+	size := rl.Size()
+	if size > 0 {
+		rl.Log.Say("sent %s", humanize.Bytes(uint64(size)))
+	}
+	if !rl.wroteHeader || rl.declared < 0 || method == "HEAD" || size == rl.declared {
+		return
+	}
+	if rl.status == http.StatusNotModified || rl.status == http.StatusNoContent {
+		return
 	}
-	rl.Log.Say("<- %s %s", codestr, clstr)
+	rl.Log.Warn(
+		"Content-Length was %d, but the body was %d bytes",
+		rl.declared, size,
+	)
 }
 
 // Header returns the header map that will be sent by WriteHeader.
@@ -64,6 +89,8 @@ func (rl *ResponseLogWriter) Write(data []byte) (int, error) {
 		rl.WriteHeader(http.StatusOK)
 	}
 	ret, err := rl.Resp.Write(data)
+	atomic.AddInt64(&rl.size, int64(ret))
+	rl.Timer.ResponseBody(ret)
 	rl.Timer.ResponseDone()
 	return ret, err
 }
@@ -74,9 +101,29 @@ func (rl *ResponseLogWriter) Write(data []byte) (int, error) {
 // Thus explicit calls to WriteHeader are mainly used to
 // send error codes.
 func (rl *ResponseLogWriter) WriteHeader(code int) {
+	if code >= 100 && code < 200 && code != http.StatusSwitchingProtocols {
+		// Informational responses come before the real one
+		rl.logCode(code, http.StatusText(code))
+		rl.Resp.WriteHeader(code)
+		return
+	}
 	rl.wroteHeader = true
+	rl.status = code
+	rl.declared = -1
+	if cl := rl.Header().Get("Content-Length"); cl != "" {
+		n, err := strconv.ParseInt(cl, 10, 64)
+		if err != nil || n < 0 {
+			rl.Log.Warn("Invalid content-length header")
+		} else {
+			rl.declared = n
+		}
+	}
 	rl.logCode(code, http.StatusText(code))
-	LogHeader(rl.Log, rl.Resp.Header())
+	if rl.ServerTiming {
+		// Upstream servers may have added timings of their own
+		rl.Resp.Header().Add("Server-Timing", rl.Timer.ServerTiming())
+	}
+	logHeaderFit(rl.Log, rl.Resp.Header(), rl.Width)
 	rl.Timer.ResponseHeaders()
 	rl.Resp.WriteHeader(code)
 	rl.Timer.ResponseDone()
@@ -87,3 +134,50 @@ func (rl *ResponseLogWriter) Flush() {
 		rl.Flusher.Flush()
 	}
 }
+
+// hijack takes over the connection behind a ResponseWriter, for the wrappers
+// that pass Hijack through
+func hijack(w http.ResponseWriter) (net.Conn, *bufio.ReadWriter, error) {
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("Connection does not support hijacking")
+	}
+	return hj.Hijack()
+}
+
+// Hijack lets a handler take over the connection, which is needed for
+// websockets.
+func (rl *ResponseLogWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, brw, err := hijack(rl.Resp)
+	if err != nil {
+		return nil, nil, err
+	}
+	rl.wroteHeader = true
+	rl.status = http.StatusSwitchingProtocols
+	rl.Timer.ResponseHeaders()
+	return conn, brw, nil
+}
+
+// Push starts an HTTP/2 server push, where the connection supports it
+func (rl *ResponseLogWriter) Push(target string, opts *http.PushOptions) error {
+	p, ok := rl.Resp.(http.Pusher)
+	if !ok {
+		return http.ErrNotSupported
+	}
+	return p.Push(target, opts)
+}
+
+// Status returns the response status code, which is 200 if the handler
+// didn't write a response at all.
+func (rl *ResponseLogWriter) Status() int {
+	if rl.status == 0 {
+		return http.StatusOK
+	}
+	return rl.status
+}
+
+// Size returns the number of body bytes written so far. It's safe to call
+// while the response is being written.
+func (rl *ResponseLogWriter) Size() int64 {
+	return atomic.LoadInt64(&rl.size)
+}
@@ -0,0 +1,70 @@
+package devd
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/cortesi/devd/timer"
+)
+
+// recordingLog keeps the lines logged through it. Named channels are off,
+// as they are by default.
+type recordingLog struct {
+	lines []string
+	warns []string
+}
+
+func (l *recordingLog) Say(format string, args ...interface{}) {
+	l.lines = append(l.lines, fmt.Sprintf(format, args...))
+}
+func (l *recordingLog) Notice(format string, args ...interface{}) { l.Say(format, args...) }
+func (l *recordingLog) Warn(format string, args ...interface{}) {
+	l.warns = append(l.warns, fmt.Sprintf(format, args...))
+}
+func (l *recordingLog) Shout(format string, args ...interface{})                 { l.Warn(format, args...) }
+func (l *recordingLog) SayAs(name string, format string, args ...interface{})    {}
+func (l *recordingLog) NoticeAs(name string, format string, args ...interface{}) {}
+func (l *recordingLog) WarnAs(name string, format string, args ...interface{})   {}
+func (l *recordingLog) ShoutAs(name string, format string, args ...interface{})  {}
+
+func TestResponseLogWriterSize(t *testing.T) {
+	var sizeTests = []struct {
+		method   string
+		status   int
+		length   string
+		body     string
+		sent     string
+		mismatch bool
+	}{
+		{"GET", 200, "5", "hello", "sent 5 B", false},
+		{"GET", 200, "", "streamed", "sent 8 B", false},
+		{"GET", 200, "100", "short", "sent 5 B", true},
+		{"HEAD", 200, "100", "", "", false},
+		{"GET", 304, "100", "", "", false},
+		{"GET", 200, "bogus", "hello", "sent 5 B", true},
+	}
+	for i, tt := range sizeTests {
+		log := &recordingLog{}
+		rl := &ResponseLogWriter{Log: log, Resp: httptest.NewRecorder(), Timer: &timer.Timer{}}
+		if tt.length != "" {
+			rl.Header().Set("Content-Length", tt.length)
+		}
+		rl.WriteHeader(tt.status)
+		if tt.body != "" {
+			rl.Write([]byte(tt.body))
+		}
+		rl.Finish(tt.method)
+		last := log.lines[len(log.lines)-1]
+		if tt.sent != "" && last != tt.sent {
+			t.Errorf("Test %d: expected %q, got %q", i, tt.sent, last)
+		}
+		if tt.sent == "" && last != fmt.Sprintf("<- %d %s", tt.status, http.StatusText(tt.status)) {
+			t.Errorf("Test %d: unexpected size line %q", i, last)
+		}
+		if (len(log.warns) > 0) != tt.mismatch {
+			t.Errorf("Test %d: unexpected warnings %v", i, log.warns)
+		}
+	}
+}
@@ -4,21 +4,19 @@
 package reverseproxy
 
 import (
-	"fmt"
+	"context"
 	"io"
 	"net"
 	"net/http"
 	"net/url"
-	"strconv"
+	"sort"
 	"strings"
 	"sync"
 	"time"
 
-	"golang.org/x/net/context"
-
 	"github.com/cortesi/devd/inject"
+	"github.com/cortesi/devd/timer"
 	"github.com/cortesi/termlog"
-	humanize "github.com/dustin/go-humanize"
 )
 
 // onExitFlushLoop is a callback set by tests to detect the state of the
@@ -103,6 +101,24 @@ func copyHeader(dst, src http.Header) {
 	}
 }
 
+// The error returned by http.MaxBytesReader when a body exceeds its limit
+const errBodyTooLarge = "http: request body too large"
+
+// bodyReader records errors reading the incoming request body, so that we can
+// tell them apart from errors talking to the upstream server
+type bodyReader struct {
+	io.ReadCloser
+	err error
+}
+
+func (b *bodyReader) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && err != io.EOF {
+		b.err = err
+	}
+	return n, err
+}
+
 // Hop-by-hop headers. These are removed when sent to the backend.
 // http://www.w3.org/Protocols/rfc2616/rfc2616-sec13.html
 var hopHeaders = []string{
@@ -110,12 +126,24 @@ var hopHeaders = []string{
 	"Keep-Alive",
 	"Proxy-Authenticate",
 	"Proxy-Authorization",
-	"Te", // canonicalized version of "TE"
-	"Trailers",
+	"Te",      // canonicalized version of "TE"
+	"Trailer", // not Trailers - see https://www.rfc-editor.org/errata/eid4522
 	"Transfer-Encoding",
 	"Upgrade",
 }
 
+// acceptsTrailers tells us if a TE header lists "trailers"
+func acceptsTrailers(te []string) bool {
+	for _, v := range te {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), "trailers") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // ServeHTTPContext serves HTTP with a context
 func (p *ReverseProxy) ServeHTTPContext(
 	ctx context.Context, rw http.ResponseWriter, req *http.Request,
@@ -151,6 +179,10 @@ func (p *ReverseProxy) ServeHTTPContext(
 			outreq.Header.Del(h)
 		}
 	}
+	// gRPC servers insist on being told that the client understands trailers
+	if acceptsTrailers(req.Header["Te"]) {
+		outreq.Header.Set("Te", "trailers")
+	}
 
 	if clientIP, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
 		// If we aren't the first proxy retain prior
@@ -162,41 +194,115 @@ func (p *ReverseProxy) ServeHTTPContext(
 		outreq.Header.Set("X-Forwarded-For", clientIP)
 	}
 
+	// Injected responses carry marked ETags, and no Last-Modified - see
+	// inject.AdjustHeaders - while the upstream server only knows the
+	// original validators. A client that asks for a page with validators
+	// that aren't marked holds a copy without the payload, so it gets a
+	// fresh one.
+	marked := false
+	if p.Inject.Enabled() {
+		if !copiedHeaders {
+			outreq.Header = make(http.Header)
+			copyHeader(outreq.Header, req.Header)
+		}
+		page := strings.Contains(req.Header.Get("Accept"), "text/html")
+		if inm := outreq.Header.Get("If-None-Match"); inm != "" {
+			inm, marked = inject.UnmarkETags(inm, page)
+			if inm != "" {
+				outreq.Header.Set("If-None-Match", inm)
+			} else {
+				outreq.Header.Del("If-None-Match")
+			}
+		}
+		if page {
+			outreq.Header.Del("If-Modified-Since")
+		}
+	}
+
+	var body *bodyReader
+	if outreq.Body != nil {
+		body = &bodyReader{ReadCloser: outreq.Body}
+		outreq.Body = body
+	}
+
+	start := time.Now()
 	res, err := transport.RoundTrip(outreq)
+	timer.FromContext(ctx).Upstream(time.Since(start))
 	if err != nil {
 		log.Shout("reverse proxy error: %v", err)
-		rw.WriteHeader(http.StatusInternalServerError)
+		switch {
+		case body != nil && body.err != nil && body.err.Error() == errBodyTooLarge:
+			rw.WriteHeader(http.StatusRequestEntityTooLarge)
+		case body != nil && body.err != nil:
+			rw.WriteHeader(http.StatusBadRequest)
+		default:
+			rw.WriteHeader(http.StatusInternalServerError)
+		}
 		return
 	}
 	defer res.Body.Close()
-	if req.ContentLength > 0 {
-		log.Say(fmt.Sprintf("%s uploaded", humanize.Bytes(uint64(req.ContentLength))))
-	}
 
-	inject, err := p.Inject.Sniff(res.Body, res.Header.Get("Content-Type"))
+	injector, err := p.Inject.Sniff(res.Body, res.Header.Get("Content-Type"))
 	if err != nil {
 		log.Shout("reverse proxy error: %v", err)
 		rw.WriteHeader(http.StatusInternalServerError)
 		return
 	}
 
-	if inject.Found() {
-		cl, err := strconv.ParseInt(res.Header.Get("Content-Length"), 10, 32)
-		if err == nil {
-			cl = cl + int64(inject.Extra())
-			res.Header.Set("Content-Length", strconv.FormatInt(cl, 10))
+	inject.AdjustHeaders(res.Header, injector)
+	if res.StatusCode == http.StatusNotModified && marked {
+		// The client's copy is injected, so the validators are too
+		if etag := res.Header.Get("Etag"); etag != "" {
+			res.Header.Set("Etag", inject.MarkETag(etag))
 		}
+		res.Header.Del("Last-Modified")
 	}
 	copyHeader(rw.Header(), res.Header)
+	// devd may already have set Vary, e.g. for CORS
+	inject.AddVary(rw.Header())
+
+	// The transport moves the Trailer header into res.Trailer, so we announce
+	// the trailers ourselves
+	announced := len(res.Trailer)
+	if announced > 0 {
+		keys := make([]string, 0, announced)
+		for k := range res.Trailer {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		rw.Header().Add("Trailer", strings.Join(keys, ", "))
+	}
 	rw.WriteHeader(res.StatusCode)
-	p.copyResponse(ctx, rw, inject)
+	if announced > 0 {
+		// Flushing forces a chunked response, which is the only way to send
+		// trailers over HTTP/1.1. Otherwise net/http may set Content-Length on
+		// a short body.
+		if fl, ok := rw.(http.Flusher); ok {
+			fl.Flush()
+		}
+	}
+	p.copyResponse(ctx, rw, injector)
+
+	// The trailers are only filled in once the body has been read
+	res.Body.Close()
+	if len(res.Trailer) == announced {
+		copyHeader(rw.Header(), res.Trailer)
+		return
+	}
+	// Trailers that weren't announced can still be sent, using the prefix
+	// net/http provides for them
+	for k, vv := range res.Trailer {
+		for _, v := range vv {
+			rw.Header().Add(http.TrailerPrefix+k, v)
+		}
+	}
 }
 
 func (p *ReverseProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	p.ServeHTTPContext(context.Background(), w, r)
+	p.ServeHTTPContext(r.Context(), w, r)
 }
 
-func (p *ReverseProxy) copyResponse(ctx context.Context, dst io.Writer, inject inject.Injector) {
+func (p *ReverseProxy) copyResponse(ctx context.Context, dst io.Writer, injector inject.Injector) {
 	log := termlog.FromContext(ctx)
 	if p.FlushInterval != 0 {
 		if wf, ok := dst.(writeFlusher); ok {
@@ -210,7 +316,7 @@ func (p *ReverseProxy) copyResponse(ctx context.Context, dst io.Writer, inject i
 			dst = mlw
 		}
 	}
-	_, err := inject.Copy(dst)
+	_, err := injector.Copy(dst)
 	if err != nil {
 		log.Shout("Error forwarding data: %s", err)
 	}
@@ -11,6 +11,8 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"reflect"
+	"regexp"
 	"strings"
 	"testing"
 	"time"
@@ -84,6 +86,51 @@ func TestReverseProxy(t *testing.T) {
 	}
 }
 
+func TestReverseProxyTrailers(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if te := r.Header.Get("Te"); te != "trailers" {
+			t.Errorf("backend got TE %q, expected \"trailers\"", te)
+		}
+		w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+		w.Header().Set("Content-Type", "application/grpc-web")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("body"))
+		w.Header().Set("Grpc-Status", "0")
+		w.Header().Set("Grpc-Message", "ok")
+		w.Header().Set(http.TrailerPrefix+"X-Unannounced", "late")
+	}))
+	defer backend.Close()
+	backendURL, err := url.Parse(backend.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frontend := httptest.NewServer(NewSingleHostReverseProxy(backendURL, inject.CopyInject{}))
+	defer frontend.Close()
+
+	req, _ := http.NewRequest("GET", frontend.URL, nil)
+	req.Header.Set("TE", "gzip, trailers")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if _, ok := res.Trailer["Grpc-Status"]; !ok {
+		t.Errorf("Expected Grpc-Status to be announced, got trailers %v", res.Trailer)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if string(body) != "body" {
+		t.Errorf("got body %q", body)
+	}
+	expected := http.Header{
+		"Grpc-Status":   {"0"},
+		"Grpc-Message":  {"ok"},
+		"X-Unannounced": {"late"},
+	}
+	if !reflect.DeepEqual(res.Trailer, expected) {
+		t.Errorf("got trailers %v, expected %v", res.Trailer, expected)
+	}
+}
+
 func TestXForwardedFor(t *testing.T) {
 	const prevForwardedFor = "client ip"
 	const backendResponse = "I am the backend"
@@ -203,3 +250,102 @@ func TestReverseProxyFlushInterval(t *testing.T) {
 		t.Error("maxLatencyWriter flushLoop() never exited")
 	}
 }
+
+func TestReverseProxyInjectHeaders(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("Etag", `"v1"`)
+		w.Header().Set("Vary", "Accept-Encoding, Origin")
+		w.Write([]byte("<html><head></head></html>"))
+	}))
+	defer backend.Close()
+	backendURL, err := url.Parse(backend.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ci := inject.CopyInject{
+		Within:      1024,
+		ContentType: "text/html",
+		Marker:      regexp.MustCompile(`</head>`),
+		Payload:     []byte("<script></script>"),
+	}
+	proxyHandler := NewSingleHostReverseProxy(backendURL, ci)
+	frontend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Vary", "Origin")
+		proxyHandler.ServeHTTP(w, r)
+	}))
+	defer frontend.Close()
+
+	res, err := http.Get(frontend.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if res.ContentLength != int64(len(body)) {
+		t.Errorf("Content-Length %d doesn't match body length %d", res.ContentLength, len(body))
+	}
+	if g, e := res.Header.Get("Etag"), `W/"v1+devd"`; g != e {
+		t.Errorf("got Etag %q; expected %q", g, e)
+	}
+	if g, e := res.Header["Vary"], []string{"Origin, Accept-Encoding"}; !reflect.DeepEqual(g, e) {
+		t.Errorf("got Vary %q; expected %q", g, e)
+	}
+}
+
+func TestReverseProxyInjectValidators(t *testing.T) {
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Etag", `"v1"`)
+		if inject.ETagMatch(r.Header.Get("If-None-Match"), `"v1"`) || r.Header.Get("If-Modified-Since") != "" {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+		w.Write([]byte("<html><head></head></html>"))
+	}))
+	defer backend.Close()
+	backendURL, err := url.Parse(backend.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ci := inject.CopyInject{
+		Within:      1024,
+		ContentType: "text/html",
+		Marker:      regexp.MustCompile(`</head>`),
+		Payload:     []byte("<script></script>"),
+	}
+	frontend := httptest.NewServer(NewSingleHostReverseProxy(backendURL, ci))
+	defer frontend.Close()
+
+	var validatorTests = []struct {
+		header map[string]string
+		status int
+		etag   string
+	}{
+		{map[string]string{"Accept": "text/html"}, 200, `W/"v1+devd"`},
+		{map[string]string{"Accept": "text/html", "If-None-Match": `W/"v1+devd"`}, 304, `W/"v1+devd"`},
+		// Copies from before injection are replaced
+		{map[string]string{"Accept": "text/html", "If-None-Match": `"v1"`}, 200, `W/"v1+devd"`},
+		{map[string]string{"Accept": "text/html", "If-Modified-Since": "Mon, 02 Jan 2006 15:04:05 GMT"}, 200, `W/"v1+devd"`},
+		// Other resources are revalidated as usual
+		{map[string]string{"Accept": "*/*", "If-None-Match": `"v1"`}, 304, `"v1"`},
+	}
+	for i, tt := range validatorTests {
+		req, _ := http.NewRequest("GET", frontend.URL, nil)
+		for k, v := range tt.header {
+			req.Header.Set(k, v)
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		if res.StatusCode != tt.status || res.Header.Get("Etag") != tt.etag {
+			t.Errorf("Test %d: expected %d %s, got %d %s", i, tt.status, tt.etag, res.StatusCode, res.Header.Get("Etag"))
+		}
+		if res.Header.Get("Last-Modified") != "" {
+			t.Errorf("Test %d: unexpected Last-Modified", i)
+		}
+	}
+}
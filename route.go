@@ -1,12 +1,15 @@
 package devd
 
 import (
-	"crypto/tls"
 	"errors"
 	"fmt"
 	"html/template"
 	"net/http"
 	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/cortesi/devd/fileserver"
@@ -14,24 +17,79 @@ import (
 	"github.com/cortesi/devd/inject"
 	"github.com/cortesi/devd/reverseproxy"
 	"github.com/cortesi/devd/routespec"
+	"github.com/cortesi/devd/websocketproxy"
 )
 
 // Endpoint is the destination of a Route - either on the filesystem or
 // forwarding to another URL
-type endpoint interface {
+type Endpoint interface {
 	Handler(prefix string, templates *template.Template, ci inject.CopyInject) httpctx.Handler
 	String() string
 }
 
+// An EndpointFactory makes an Endpoint from a route value with a URL scheme,
+// e.g. "http://localhost:8080"
+type EndpointFactory func(value string) (Endpoint, error)
+
+var endpointFactories = map[string]EndpointFactory{}
+var endpointLock sync.RWMutex
+
+// RegisterEndpoint lets routes use a new URL scheme. Route values with the
+// scheme are passed to factory to make the route's Endpoint. Registering a
+// scheme again replaces its factory.
+func RegisterEndpoint(scheme string, factory EndpointFactory) {
+	endpointLock.Lock()
+	defer endpointLock.Unlock()
+	endpointFactories[scheme] = factory
+	routespec.AddScheme(scheme)
+}
+
+func init() {
+	forward := func(value string) (Endpoint, error) { return newForwardEndpoint(value) }
+	websocket := func(value string) (Endpoint, error) { return newWebsocketEndpoint(value) }
+	RegisterEndpoint("http", forward)
+	RegisterEndpoint("https", forward)
+	RegisterEndpoint("ws", websocket)
+	RegisterEndpoint("wss", websocket)
+}
+
+// newURLEndpoint makes an Endpoint for a route value with a URL scheme, and
+// returns the scheme
+func newURLEndpoint(value string) (Endpoint, string, error) {
+	u, err := url.Parse(value)
+	if err != nil {
+		return nil, "", err
+	}
+	endpointLock.RLock()
+	factory, ok := endpointFactories[u.Scheme]
+	endpointLock.RUnlock()
+	if !ok {
+		return nil, "", fmt.Errorf("Unknown scheme '%s': %s", u.Scheme, value)
+	}
+	ep, err := factory(value)
+	if err != nil {
+		return nil, "", err
+	}
+	return ep, u.Scheme, nil
+}
+
+// How long proxied requests that expect 100 Continue wait for the upstream
+// server before sending their bodies anyway
+const expectContinueTimeout = 1 * time.Second
+
 // An endpoint that forwards to an upstream URL
 type forwardEndpoint url.URL
 
 func (ep forwardEndpoint) Handler(prefix string, templates *template.Template, ci inject.CopyInject) httpctx.Handler {
+	return ep.handler(prefix, ci, nil)
+}
+
+// handler makes the endpoint's handler, connecting to the upstream server
+// through up
+func (ep forwardEndpoint) handler(prefix string, ci inject.CopyInject, up *upstream) httpctx.Handler {
 	u := url.URL(ep)
 	rp := reverseproxy.NewSingleHostReverseProxy(&u, ci)
-	rp.Transport = &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-	}
+	rp.Transport = up.transport()
 	rp.FlushInterval = 200 * time.Millisecond
 	return httpctx.StripPrefix(prefix, rp)
 }
@@ -49,13 +107,56 @@ func (ep forwardEndpoint) String() string {
 	return "forward to " + ep.Scheme + "://" + ep.Host + ep.Path
 }
 
+// An endpoint that proxies websocket connections to an upstream ws:// or
+// wss:// URL
+type websocketEndpoint url.URL
+
+func (ep websocketEndpoint) Handler(prefix string, templates *template.Template, ci inject.CopyInject) httpctx.Handler {
+	return ep.handler(prefix, nil)
+}
+
+// handler makes the endpoint's handler, connecting to the upstream server
+// through up
+func (ep websocketEndpoint) handler(prefix string, up *upstream) httpctx.Handler {
+	u := url.URL(ep)
+	p := websocketproxy.NewProxy(&u)
+	p.Dialer = up.dialer()
+	return httpctx.StripPrefix(prefix, p)
+}
+
+func newWebsocketEndpoint(path string) (*websocketEndpoint, error) {
+	url, err := url.Parse(path)
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse route URL: %s", err)
+	}
+	w := websocketEndpoint(*url)
+	return &w, nil
+}
+
+func (ep websocketEndpoint) String() string {
+	return "websocket proxy to " + ep.Scheme + "://" + ep.Host + ep.Path
+}
+
 // An enpoint that serves a filesystem location
 type filesystemEndpoint struct {
 	Root           string
 	notFoundRoutes []routespec.RouteSpec
+	// Set by the router to highlight recently changed files in listings,
+	// and to keep listings up to date
+	recent        *recentChanges
+	pinRecent     bool
+	listingInject inject.CopyInject
 }
 
 func newFilesystemEndpoint(path string, notfound []string) (*filesystemEndpoint, error) {
+	rparts, err := parseNotFound(notfound)
+	if err != nil {
+		return nil, err
+	}
+	return &filesystemEndpoint{Root: path, notFoundRoutes: rparts}, nil
+}
+
+func parseNotFound(notfound []string) ([]routespec.RouteSpec, error) {
 	rparts := []routespec.RouteSpec{}
 	for _, p := range notfound {
 		rp, err := routespec.ParseRouteSpec(p)
@@ -67,29 +168,70 @@ func newFilesystemEndpoint(path string, notfound []string) (*filesystemEndpoint,
 		}
 		rparts = append(rparts, *rp)
 	}
-	return &filesystemEndpoint{path, rparts}, nil
+	return rparts, nil
 }
 
 func (ep filesystemEndpoint) Handler(prefix string, templates *template.Template, ci inject.CopyInject) httpctx.Handler {
-	return &fileserver.FileServer{
+	opts := fileserver.Options{
 		Version:        "devd " + Version,
 		Root:           http.Dir(ep.Root),
 		Inject:         ci,
 		Templates:      templates,
 		NotFoundRoutes: ep.notFoundRoutes,
 		Prefix:         prefix,
+		PinRecent:      ep.pinRecent,
+		ListingInject:  ep.listingInject,
+	}
+	if ep.recent != nil {
+		opts.Recent = ep.recent.under(ep.Root)
 	}
+	return fileserver.New(opts)
 }
 
 func (ep filesystemEndpoint) String() string {
 	return "reads files from " + ep.Root
 }
 
+// Not found over-rides, fallbacks and transforms can be scoped to a single
+// route by prefixing them with the route's anchor and an @, e.g.
+// "/app/@index.html". Since @ can also appear in paths, as in
+// "/img@2x/=/fallback.png", the prefix is only taken to be a scope if it's the
+// anchor of one of routes. splitRouteScope returns the MuxMatch of the scope,
+// or an empty string if the specification applies to all routes.
+func splitRouteScope(spec string, routes RouteCollection) (scope string, rest string) {
+	seq := strings.SplitN(spec, "@", 2)
+	if len(seq) == 1 || !strings.Contains(seq[0], "/") || strings.Contains(seq[0], "=") {
+		return "", spec
+	}
+	rp, err := routespec.ParseRouteSpec(seq[0] + "=scope")
+	if err != nil {
+		return "", spec
+	}
+	if _, ok := routes[rp.MuxMatch()]; !ok {
+		return "", spec
+	}
+	return rp.MuxMatch(), seq[1]
+}
+
+// Returns the not found specifications that apply to a route
+func notFoundForRoute(match string, notfound []string, routes RouteCollection) []string {
+	ret := []string{}
+	for _, nf := range notfound {
+		scope, spec := splitRouteScope(nf, routes)
+		if scope == "" || scope == match {
+			ret = append(ret, spec)
+		}
+	}
+	return ret
+}
+
 // Route is a mapping from a (host, path) tuple to an endpoint.
 type Route struct {
 	Host     string
 	Path     string
-	Endpoint endpoint
+	Endpoint Endpoint
+	// The URL scheme the endpoint was made from, or empty for directories
+	scheme string
 }
 
 // Constructs a new route from a string specifcation. Specifcations are of the
@@ -100,17 +242,18 @@ func newRoute(s string, notfound []string) (*Route, error) {
 		return nil, err
 	}
 
-	var ep endpoint
+	var ep Endpoint
+	var scheme string
 
 	if rp.IsURL {
-		ep, err = newForwardEndpoint(rp.Value)
+		ep, scheme, err = newURLEndpoint(rp.Value)
 	} else {
 		ep, err = newFilesystemEndpoint(rp.Value, notfound)
 	}
 	if err != nil {
 		return nil, err
 	}
-	return &Route{rp.Host, rp.Path, ep}, nil
+	return &Route{rp.Host, rp.Path, ep, scheme}, nil
 }
 
 // MuxMatch produces a match clause suitable for passing to a Mux
@@ -122,6 +265,35 @@ func (f Route) MuxMatch() string {
 // RouteCollection is a collection of routes
 type RouteCollection map[string]Route
 
+// staticRoute finds the static route that serves a path on a host, or nil if
+// there isn't one
+func (f RouteCollection) staticRoute(host, urlPath string) *Route {
+	var match *Route
+	for _, r := range f {
+		r := r
+		if _, ok := r.Endpoint.(*filesystemEndpoint); !ok {
+			continue
+		}
+		if (r.Host != "" && r.Host != host) || !strings.HasPrefix(urlPath, r.Path) {
+			continue
+		}
+		if match == nil || len(r.Host+r.Path) > len(match.Host+match.Path) {
+			match = &r
+		}
+	}
+	return match
+}
+
+// openStatic opens the file a static route serves at a path on a host
+func (f RouteCollection) openStatic(host, urlPath string) (http.File, error) {
+	match := f.staticRoute(host, urlPath)
+	if match == nil {
+		return nil, os.ErrNotExist
+	}
+	root := http.Dir(match.Endpoint.(*filesystemEndpoint).Root)
+	return root.Open(path.Clean("/" + strings.TrimPrefix(urlPath, match.Path)))
+}
+
 func (f *RouteCollection) String() string {
 	return fmt.Sprintf("%v", *f)
 }
@@ -2,11 +2,13 @@ package devd
 
 import (
 	"fmt"
+	"html/template"
 	"reflect"
 	"strings"
 	"testing"
 
 	"github.com/GeertJohan/go.rice"
+	"github.com/cortesi/devd/httpctx"
 	"github.com/cortesi/devd/inject"
 	"github.com/cortesi/devd/ricetemp"
 )
@@ -21,6 +23,11 @@ func tForwardEndpoint(s string) *forwardEndpoint {
 	return e
 }
 
+func tWebsocketEndpoint(s string) *websocketEndpoint {
+	e, _ := newWebsocketEndpoint(s)
+	return e
+}
+
 func within(s string, e error) bool {
 	s = strings.ToLower(s)
 	estr := strings.ToLower(fmt.Sprint(e))
@@ -34,34 +41,60 @@ var newSpecTests = []struct {
 }{
 	{
 		"/one=two",
-		&Route{"", "/one", tFilesystemEndpoint("two")},
+		&Route{"", "/one", tFilesystemEndpoint("two"), ""},
 		"",
 	},
 	{
 		"/one=two=three",
-		&Route{"", "/one", tFilesystemEndpoint("two=three")},
+		&Route{"", "/one", tFilesystemEndpoint("two=three"), ""},
 		"",
 	},
 	{
 		"one",
-		&Route{"", "/", tFilesystemEndpoint("one")},
+		&Route{"", "/", tFilesystemEndpoint("one"), ""},
 		"invalid spec",
 	},
 	{"=one", nil, "invalid spec"},
+	{
+		`/one\=two=three`,
+		&Route{"", "/one=two", tFilesystemEndpoint("three"), ""},
+		"",
+	},
+	{
+		`"/one=two"=three`,
+		&Route{"", "/one=two", tFilesystemEndpoint("three"), ""},
+		"",
+	},
+	{
+		`/one="my dir"`,
+		&Route{"", "/one", tFilesystemEndpoint("my dir"), ""},
+		"",
+	},
+	{
+		`/one=C:\My Files\site`,
+		&Route{"", "/one", tFilesystemEndpoint(`C:\My Files\site`), ""},
+		"",
+	},
+	{
+		`/one=\"two\"`,
+		&Route{"", "/one", tFilesystemEndpoint(`"two"`), ""},
+		"",
+	},
+	{`"/one=two`, nil, "unterminated quote"},
 	{"one=", nil, "invalid spec"},
 	{
 		"one/two=three",
-		&Route{"one.devd.io", "/two", tFilesystemEndpoint("three")},
+		&Route{"one.devd.io", "/two", tFilesystemEndpoint("three"), ""},
 		"",
 	},
 	{
 		"one=three",
-		&Route{"one.devd.io", "/", tFilesystemEndpoint("three")},
+		&Route{"one.devd.io", "/", tFilesystemEndpoint("three"), ""},
 		"",
 	},
 	{
 		"one=http://three",
-		&Route{"one.devd.io", "/", tForwardEndpoint("http://three")},
+		&Route{"one.devd.io", "/", tForwardEndpoint("http://three"), "http"},
 		"",
 	},
 	{
@@ -76,12 +109,12 @@ var newSpecTests = []struct {
 	},
 	{
 		"one=ws://three",
-		nil,
-		"Websocket protocol not supported: ws://three",
+		&Route{"one.devd.io", "/", tWebsocketEndpoint("ws://three"), "ws"},
+		"",
 	},
 	{
 		"one=:1234",
-		&Route{"one.devd.io", "/", tForwardEndpoint("http://localhost:1234")},
+		&Route{"one.devd.io", "/", tForwardEndpoint("http://localhost:1234"), "http"},
 		"",
 	},
 }
@@ -201,3 +234,77 @@ func TestNotFound(t *testing.T) {
 	e, _ := newFilesystemEndpoint("/test", []string{})
 	fmt.Println(e)
 }
+
+func TestNotFoundScope(t *testing.T) {
+	notfound := []string{"index.html", "/app/@/app.html", "foo/@foo.html", "/img@2x/=fallback.png"}
+	dd := Devd{}
+	routes := []string{"./static", "/app/=./app", "foo/=./foo", "/api/=http://localhost:8000"}
+	if err := dd.AddRoutes(routes, notfound); err != nil {
+		t.Fatal(err)
+	}
+	var notFoundScopeTests = []struct {
+		match string
+		roots []string
+	}{
+		{"/", []string{"index.html", "fallback.png"}},
+		{"/app/", []string{"index.html", "/app.html", "fallback.png"}},
+		{"foo.devd.io/", []string{"index.html", "foo.html", "fallback.png"}},
+		{"/api/", nil},
+	}
+	for i, tt := range notFoundScopeTests {
+		r, ok := dd.Routes[tt.match]
+		if !ok {
+			t.Errorf("Test %d, no route for %s", i, tt.match)
+			continue
+		}
+		ep, ok := r.Endpoint.(*filesystemEndpoint)
+		if !ok {
+			if tt.roots != nil {
+				t.Errorf("Test %d, expected a filesystem endpoint", i)
+			}
+			continue
+		}
+		values := []string{}
+		for _, rs := range ep.notFoundRoutes {
+			values = append(values, rs.Value)
+		}
+		if !reflect.DeepEqual(values, tt.roots) {
+			t.Errorf("Test %d, expected %v, got %v", i, tt.roots, values)
+		}
+	}
+	if p := dd.Routes["/"].Endpoint.(*filesystemEndpoint).notFoundRoutes[1].Path; p != "/img@2x/" {
+		t.Errorf("Expected an @ in a path to be left alone, got %s", p)
+	}
+}
+
+type testEndpoint string
+
+func (ep testEndpoint) Handler(prefix string, templates *template.Template, ci inject.CopyInject) httpctx.Handler {
+	return nil
+}
+
+func (ep testEndpoint) String() string {
+	return string(ep)
+}
+
+func TestRegisterEndpoint(t *testing.T) {
+	if _, err := newRoute("/foo=devdtest:bar", nil); err == nil {
+		t.Error("Expected error for unregistered scheme")
+	}
+	RegisterEndpoint("devdtest", func(value string) (Endpoint, error) {
+		if value == "devdtest:error" {
+			return nil, fmt.Errorf("Test error")
+		}
+		return testEndpoint(value), nil
+	})
+	r, err := newRoute("/foo=devdtest:bar", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Endpoint != testEndpoint("devdtest:bar") {
+		t.Errorf("Unexpected endpoint: %#v", r.Endpoint)
+	}
+	if _, err := newRoute("/foo=devdtest:error", nil); err == nil {
+		t.Error("Expected factory error")
+	}
+}
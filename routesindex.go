@@ -0,0 +1,194 @@
+package devd
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/cortesi/termlog"
+)
+
+// routesPath is the control endpoint that shows how the server is wired up
+const routesPath = "/.devd/routes"
+
+// routeSummary describes a route on the routes page
+type routeSummary struct {
+	Match  string
+	Kind   string
+	Target string
+	Notes  []string
+}
+
+// setting is a name and value shown on the routes page
+type setting struct {
+	Name  string
+	Value string
+}
+
+// endpointKind names the kind of a route's endpoint. Endpoints made from URLs
+// are named by their schemes, so that registered endpoint types get names too.
+func endpointKind(route Route) string {
+	if _, ok := route.Endpoint.(*filesystemEndpoint); ok {
+		return "static"
+	}
+	switch route.scheme {
+	case "http", "https":
+		return "proxy"
+	case "ws", "wss":
+		return "websocket"
+	case "":
+		return "other"
+	default:
+		return route.scheme
+	}
+}
+
+// routeSummaries describes the server's routes, sorted by their matches
+func (dd *Devd) routeSummaries() []routeSummary {
+	matches := make([]string, 0, len(dd.Routes))
+	for m := range dd.Routes {
+		matches = append(matches, m)
+	}
+	sort.Strings(matches)
+	ret := make([]routeSummary, 0, len(matches))
+	for _, m := range matches {
+		route := dd.Routes[m]
+		s := routeSummary{
+			Match:  m,
+			Kind:   endpointKind(route),
+			Target: route.Endpoint.String(),
+		}
+		switch ep := route.Endpoint.(type) {
+		case *filesystemEndpoint:
+			if dd.LivereloadRoutes {
+				s.Notes = append(s.Notes, "watched for livereload")
+			}
+			for _, nf := range ep.notFoundRoutes {
+				s.Notes = append(s.Notes, fmt.Sprintf("not found: %s -> %s", nf.Path, nf.Value))
+			}
+		case *forwardEndpoint:
+			if fb := dd.fallbackFor(m); fb != nil {
+				s.Notes = append(s.Notes, "falls back to "+fb.Root)
+			}
+		}
+		for _, t := range dd.transformsFor(m) {
+			s.Notes = append(s.Notes, "transform: "+t.Command)
+		}
+		ret = append(ret, s)
+	}
+	return ret
+}
+
+// settings describes what applies across routes. Passwords, tokens and
+// header values are never shown, since headers often carry credentials.
+func (dd *Devd) settings() []setting {
+	ret := []setting{}
+	add := func(name, format string, args ...interface{}) {
+		ret = append(ret, setting{name, fmt.Sprintf(format, args...)})
+	}
+	switch {
+	case !dd.HasLivereload():
+		add("livereload", "off")
+	case dd.NoInject:
+		add("livereload", "on, without injection")
+	default:
+		add("livereload", "on")
+	}
+	for _, p := range dd.WatchPaths {
+		add("watch", "%s", p)
+	}
+	for _, p := range dd.Excludes {
+		add("exclude", "%s", p)
+	}
+	if dd.Credentials != nil {
+		if dd.DigestAuth {
+			add("auth", "password, digest")
+		} else {
+			add("auth", "password")
+		}
+	}
+	if dd.Htpasswd != nil {
+		add("auth", "htpasswd, %d users", len(dd.Htpasswd))
+	}
+	if dd.Token != "" {
+		add("auth", "token")
+	}
+	if dd.LoginForm {
+		add("auth", "login form")
+	}
+	for _, n := range dd.Allow {
+		add("allow", "%s", n)
+	}
+	for _, n := range dd.Deny {
+		add("deny", "%s", n)
+	}
+	if dd.Cors {
+		origins := "all origins"
+		if len(dd.CorsOrigins) > 0 {
+			origins = strings.Join(dd.CorsOrigins, ", ")
+		}
+		add("cors", "%s", origins)
+	}
+	if dd.AddHeaders != nil {
+		names := []string{}
+		for h := range *dd.AddHeaders {
+			names = append(names, h)
+		}
+		sort.Strings(names)
+		for _, h := range names {
+			add("header", "%s", h)
+		}
+	}
+	for _, c := range dd.SetCookies {
+		add("set cookie", "%s", c.Name)
+	}
+	for _, n := range dd.StripCookies {
+		add("strip cookie", "%s", n)
+	}
+	if dd.Latency > 0 {
+		add("latency", "%dms", dd.Latency)
+	}
+	if dd.DownKbps > 0 || dd.UpKbps > 0 {
+		add("throttle", "down %d kb/s, up %d kb/s (0 is unlimited)", dd.DownKbps, dd.UpKbps)
+	}
+	for _, t := range dd.TTFB {
+		ct := t.ContentType
+		if ct == "" {
+			ct = "all responses"
+		}
+		add("ttfb", "%s after %s", ct, t.Delay)
+	}
+	if dd.UpstreamProxy != nil {
+		add("upstream", "via %s://%s", dd.UpstreamProxy.Scheme, dd.UpstreamProxy.Host)
+	}
+	resolved := make([]string, 0, len(dd.Resolve))
+	for host := range dd.Resolve {
+		resolved = append(resolved, host)
+	}
+	sort.Strings(resolved)
+	for _, host := range resolved {
+		add("resolve", "%s -> %s", host, dd.Resolve[host])
+	}
+	for _, r := range dd.IgnoreLogs {
+		add("ignore", "%s", r)
+	}
+	return ret
+}
+
+// serveRoutes serves a page that shows how the server is wired up - its
+// routes, and the settings that apply to all of them
+func (dd *Devd) serveRoutes(templates *template.Template, logger termlog.TermLog) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		err := templates.Lookup("routes.html").Execute(w, map[string]interface{}{
+			"Routes":   dd.routeSummaries(),
+			"Settings": dd.settings(),
+			"Version":  "devd " + Version,
+		})
+		if err != nil {
+			logger.Shout("Could not execute template: %s", err)
+		}
+	})
+}
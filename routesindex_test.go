@@ -0,0 +1,96 @@
+package devd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/GeertJohan/go.rice"
+	"github.com/cortesi/devd/ricetemp"
+	"github.com/cortesi/termlog"
+)
+
+func TestRoutesIndex(t *testing.T) {
+	logger := termlog.NewLog()
+	logger.Quiet()
+	templates := ricetemp.MustMakeTemplates(rice.MustFindBox("templates"))
+
+	creds, err := CredentialsFromSpec("user:secretpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	devd := Devd{
+		Credentials:      creds,
+		Token:            "secrettoken",
+		LivereloadRoutes: true,
+		Excludes:         []string{"*.tmp"},
+		AddHeaders:       &http.Header{"X-Api-Key": []string{"secretkey"}},
+		RemoteControl:    true,
+	}
+	RegisterEndpoint("devdindex", func(value string) (Endpoint, error) {
+		return testEndpoint(value), nil
+	})
+	routes := []string{
+		"/=./testdata", "/api/=http://localhost:8888", "/ws/=ws://localhost:8889",
+		"/custom/=devdindex:foo",
+	}
+	if err := devd.AddRoutes(routes, []string{"/index.html"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := devd.AddFallbacks([]string{"/api/@./testdata"}); err != nil {
+		t.Fatal(err)
+	}
+	h, err := devd.Router(logger, templates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer devd.shutdown()
+
+	req, err := http.NewRequest("GET", routesPath, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer secrettoken")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	AssertCode(t, w, 200)
+	body := w.Body.String()
+	expected := []string{
+		"/api/", "proxy", "forward to http://localhost:8888", "falls back to ./testdata",
+		"websocket", "static", "watched for livereload", "not found: / -&gt; /index.html",
+		"*.tmp", "X-Api-Key", "password", "token", "devdindex",
+	}
+	for _, e := range expected {
+		if !strings.Contains(body, e) {
+			t.Errorf("Expected the page to contain %q", e)
+		}
+	}
+	if strings.Contains(body, "other") {
+		t.Error("Expected every route to have a kind")
+	}
+	for _, secret := range []string{"secretpass", "secrettoken", "secretkey"} {
+		if strings.Contains(body, secret) {
+			t.Errorf("The page gives away %q", secret)
+		}
+	}
+}
+
+func TestEndpointKind(t *testing.T) {
+	// A registered scheme that shares the proxy's endpoint type mustn't
+	// change what proxy routes are called
+	RegisterEndpoint("devdkind", func(value string) (Endpoint, error) {
+		return newForwardEndpoint("http://localhost:8888")
+	})
+	devd := Devd{}
+	routes := []string{"/=./testdata", "/api/=http://localhost:8888", "/other/=devdkind:foo", "/ws/=ws://localhost:8889"}
+	if err := devd.AddRoutes(routes, nil); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{"/": "static", "/api/": "proxy", "/other/": "devdkind", "/ws/": "websocket"}
+	for match, kind := range expected {
+		if k := endpointKind(devd.Routes[match]); k != kind {
+			t.Errorf("Expected %s to be %s, got %s", match, kind, k)
+		}
+	}
+}
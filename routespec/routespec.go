@@ -5,10 +5,30 @@ import (
 	"fmt"
 	"net/url"
 	"strings"
+	"sync"
 )
 
 const defaultDomain = "devd.io"
 
+// URL schemes that route values can use. Anything else with a scheme is an
+// error.
+var schemes = map[string]bool{"http": true, "https": true}
+var schemesLock sync.RWMutex
+
+// AddScheme lets route values use a URL scheme, so that they're treated as
+// URLs rather than filesystem paths
+func AddScheme(scheme string) {
+	schemesLock.Lock()
+	defer schemesLock.Unlock()
+	schemes[scheme] = true
+}
+
+func knownScheme(scheme string) bool {
+	schemesLock.RLock()
+	defer schemesLock.RUnlock()
+	return schemes[scheme]
+}
+
 func checkURL(s string) (isURL bool, err error) {
 	var parsed *url.URL
 
@@ -20,10 +40,10 @@ func checkURL(s string) (isURL bool, err error) {
 	switch {
 	case parsed.Scheme == "": // No scheme means local file system
 		isURL = false
-	case parsed.Scheme == "http", parsed.Scheme == "https":
+	case len(parsed.Scheme) == 1: // A Windows drive letter, like C:\site
+		isURL = false
+	case knownScheme(parsed.Scheme):
 		isURL = true
-	case parsed.Scheme == "ws":
-		err = fmt.Errorf("Websocket protocol not supported: %s", s)
 	default:
 		// A route of "localhost:1234/abc" without the "http" or "https" triggers this case.
 		// Unfortunately a route of "localhost/abc" just looks like a file and is not caught here.
@@ -46,9 +66,42 @@ func (rp *RouteSpec) MuxMatch() string {
 	return rp.Host + rp.Path
 }
 
+// splitSpec splits a specification at its first "=", and unescapes both
+// halves. An "=" or a double quote preceded by a backslash is taken
+// literally, as is everything inside double quotes, so a path containing an
+// "=" can be written as /a\=b=dir or "/a=b"=dir. Other backslashes are left
+// alone, so Windows paths need no escaping.
+func splitSpec(s string) ([]string, error) {
+	seq := []string{}
+	var current strings.Builder
+	quoted := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s) && (s[i+1] == '=' || s[i+1] == '"'):
+			i++
+			current.WriteByte(s[i])
+		case c == '"':
+			quoted = !quoted
+		case c == '=' && !quoted && len(seq) == 0:
+			seq = append(seq, current.String())
+			current.Reset()
+		default:
+			current.WriteByte(c)
+		}
+	}
+	if quoted {
+		return nil, errors.New("Invalid specification: unterminated quote")
+	}
+	return append(seq, current.String()), nil
+}
+
 // ParseRouteSpec parses a string route specification
 func ParseRouteSpec(s string) (*RouteSpec, error) {
-	seq := strings.SplitN(s, "=", 2)
+	seq, err := splitSpec(s)
+	if err != nil {
+		return nil, err
+	}
 	var path, value, host string
 	if len(seq) == 1 {
 		path = "/"
@@ -1,20 +1,22 @@
 package devd
 
 import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
 	"crypto/tls"
 	"fmt"
 	"html/template"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
-	"regexp"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
 
-	"golang.org/x/net/context"
-
 	rice "github.com/GeertJohan/go.rice"
 	"github.com/goji/httpauth"
 
@@ -52,19 +54,67 @@ func pickPort(addr string, low int, high int, tls bool) (net.Listener, error) {
 	return nil, fmt.Errorf("Could not find open port.")
 }
 
-func getTLSConfig(path string) (t *tls.Config, err error) {
+// AutoPort returns the port devd would pick on address when no port is
+// given. The port isn't held, so it may be taken by the time it's used.
+func AutoPort(address string, tls bool) (int, error) {
+	l, err := pickPort(address, portLow, portHigh, tls)
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+// getTLSConfig loads the default certificate bundle, and the bundles for
+// particular host names. Either may be empty. Connections that ask for a
+// host without its own certificate get the default.
+func getTLSConfig(path string, hosts map[string]string) (t *tls.Config, err error) {
 	config := &tls.Config{}
 	if config.NextProtos == nil {
-		config.NextProtos = []string{"http/1.1"}
+		config.NextProtos = []string{"h2", "http/1.1"}
 	}
-	config.Certificates = make([]tls.Certificate, 1)
-	config.Certificates[0], err = tls.LoadX509KeyPair(path, path)
-	if err != nil {
-		return nil, err
+	if path != "" {
+		config.Certificates = make([]tls.Certificate, 1)
+		config.Certificates[0], err = tls.LoadX509KeyPair(path, path)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(hosts) > 0 {
+		certs := make(map[string]*tls.Certificate, len(hosts))
+		for host, p := range hosts {
+			cert, err := tls.LoadX509KeyPair(p, p)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", host, err)
+			}
+			certs[strings.ToLower(host)] = &cert
+		}
+		config.GetCertificate = func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			if cert := matchHostCert(certs, hello.ServerName); cert != nil {
+				return cert, nil
+			}
+			if len(config.Certificates) == 0 {
+				return nil, fmt.Errorf("No certificate for %q", hello.ServerName)
+			}
+			return nil, nil
+		}
 	}
 	return config, nil
 }
 
+// matchHostCert finds the certificate for a server name, trying the name
+// itself and then a wildcard for its parent domain
+func matchHostCert(certs map[string]*tls.Certificate, name string) *tls.Certificate {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	if cert, ok := certs[name]; ok {
+		return cert
+	}
+	if i := strings.Index(name, "."); i > 0 {
+		return certs["*"+name[i:]]
+	}
+	return nil
+}
+
 // This filthy hack works in conjunction with hostPortStrip to restore the
 // original request host after mux match.
 func revertOriginalHost(r *http.Request) {
@@ -89,15 +139,6 @@ func hostPortStrip(next http.Handler) http.Handler {
 	})
 }
 
-func matchStringAny(regexps []*regexp.Regexp, s string) bool {
-	for _, r := range regexps {
-		if r.MatchString(s) {
-			return true
-		}
-	}
-	return false
-}
-
 func formatURL(tls bool, httpIP string, port int) string {
 	proto := "http"
 	if tls {
@@ -131,6 +172,16 @@ func CredentialsFromSpec(spec string) (*Credentials, error) {
 	return &Credentials{parts[0], parts[1]}, nil
 }
 
+// Check checks a user name and password against the credentials
+func (c *Credentials) Check(user, password string) bool {
+	givenUser := sha256.Sum256([]byte(user))
+	givenPass := sha256.Sum256([]byte(password))
+	wantUser := sha256.Sum256([]byte(c.username))
+	wantPass := sha256.Sum256([]byte(c.password))
+	return subtle.ConstantTimeCompare(givenUser[:], wantUser[:]) == 1 &&
+		subtle.ConstantTimeCompare(givenPass[:], wantPass[:]) == 1
+}
+
 // Devd represents the devd server options
 type Devd struct {
 	Routes RouteCollection
@@ -140,43 +191,205 @@ type Devd struct {
 	DownKbps      uint
 	UpKbps        uint
 	ServingScheme string
+	// Delays for response headers, by content type - see TTFB
+	TTFB []TTFB
 
 	// Add headers
 	AddHeaders *http.Header
+	// Cookies set on every response
+	SetCookies []*http.Cookie
+	// Names of cookies removed from requests before they're handled
+	StripCookies []string
 
 	// Livereload and watch static routes
 	LivereloadRoutes bool
 	// Livereload, but don't watch static routes
 	Livereload bool
-	WatchPaths []string
-	Excludes   []string
+	// Serve the livereload endpoints, but don't inject the script into pages,
+	// for apps that load it themselves
+	NoInject bool
+	// Also speak the classic LiveReload protocol, serving its client at
+	// /livereload.js and accepting connections on port 35729, for tools and
+	// browser extensions that expect it
+	LegacyLivereload bool
+	WatchPaths       []string
+	Excludes         []string
 
 	// Add Access-Control-Allow-Origin header
 	Cors bool
+	// Origins that CORS allows, with * wildcards, or empty to allow all
+	CorsOrigins []string
+	// Comma-separated methods and headers allowed by preflight responses. If
+	// empty, whatever the browser asks for is allowed.
+	CorsMethods string
+	CorsHeaders string
+	// How long browsers may cache preflight responses, or 0 for their default
+	CorsMaxAge time.Duration
+	// Comma-separated response headers that scripts may read
+	CorsExpose string
 
 	// Logging
-	IgnoreLogs []*regexp.Regexp
+	IgnoreLogs []IgnoreRule
 
 	// Password protection
 	Credentials *Credentials
+	Htpasswd    Htpasswd
+	// Use digest rather than basic authentication for Credentials
+	DigestAuth bool
+	// Let browsers log in with a form rather than an HTTP auth dialog
+	LoginForm bool
+	// A bearer token that grants access - see tokenAuth
+	Token string
+	// Lock out client addresses for AuthLockoutTime after this many
+	// authentication failures, or never if 0
+	AuthLockout     int
+	AuthLockoutTime time.Duration
+
+	// Add Link preload headers for the stylesheets and scripts in HTML
+	// responses, and send them as early hints on later requests
+	Preload bool
+	// Push the stylesheets and scripts in HTML responses to HTTP/2 clients
+	Push bool
+	// Re-indent JSON and XML responses
+	Pretty bool
+	// Add a hash of their contents to the URLs of the stylesheets and
+	// scripts that static routes serve, in HTML responses
+	CacheBust bool
+	// SourceMapsBlock to withhold source maps, SourceMapsServe to serve them
+	// and point browsers at them, or empty to leave them alone
+	SourceMaps string
+
+	// Maximum size of request bodies in bytes, or 0 for no limit
+	MaxBodySize int64
+
+	// Note requests that are still running after this long, and again each
+	// time the wait doubles. Zero turns the notes off.
+	InFlightNotice time.Duration
+
+	// Add a Server-Timing header to responses, so browser developer tools
+	// show the time spent in devd and upstream servers
+	ServerTiming bool
+
+	// Shorten long URLs and header values in request logs, so lines fit in
+	// this many columns. Zero means no limit.
+	LogWidth int
+
+	// Close each connection after one response, as proxies and load
+	// balancers that don't allow persistent connections do
+	NoKeepAlive bool
+
+	// Client address ranges that are allowed or denied access
+	Allow []*net.IPNet
+	Deny  []*net.IPNet
+	// Proxies whose X-Forwarded headers are trusted
+	TrustProxy []*net.IPNet
+
+	// Shell commands run on server events
+	Hooks Hooks
+	// Commands that rewrite requests and responses
+	Transforms []Transform
+	// Directories that serve what proxied routes' upstream servers don't have
+	Fallbacks []Fallback
+	// Addresses that proxied routes connect to in place of upstream
+	// host:port pairs, overriding DNS - see AddResolves
+	Resolve map[string]string
+	// A proxy that proxied routes reach upstream servers through, or nil to
+	// connect directly - see ParseUpstreamProxy
+	UpstreamProxy *url.URL
+	// Number of recent requests kept for replay, or 0 to keep none
+	ReplayHistory int
+	// When a site has no favicon, devd serves its own. If FaviconName is set,
+	// the icon shows its first letter, in a colour picked by the name.
+	FaviconName string
+	// Log a summary of the requests made by each page once it has loaded
+	Waterfall bool
+	// Count the bytes going in and out of each route and path, serve the
+	// totals at /.devd/stats, and log them on shutdown
+	CountTraffic bool
+	// List files that livereload saw change in the last few minutes first in
+	// directory listings. They're highlighted either way.
+	PinRecent bool
+	// Let other machines use devd's control endpoints, like /.devd/replay
+	// and /.devd/events. By default only clients on this machine can.
+	RemoteControl bool
+	// Certificate bundles for particular host names, chosen by SNI. A name
+	// like "*.example.com" covers its subdomains. Other hosts get the bundle
+	// passed to Serve, and TLS is on if either is given.
+	HostCerts map[string]string
+	// If set, Serve also listens on a loopback address for a tunnel relay to
+	// forward public connections to, and calls Tunnel with it once serving.
+	// Requests that arrive there are treated as remote, so they don't get
+	// loopback-only control endpoints or skip the allow list.
+	Tunnel func(addr string)
+
+	lrserver  livereload.Reloader
+	legacyLR  http.Handler
+	audit     *authAudit
+	preloads  *preloadCache
+	history   *requestHistory
+	waterfall *waterfall
+	traffic   *traffic
+	versions  *assetVersions
+	// The listener that tunnelled connections arrive on
+	tunnelListener net.Listener
+	// The complete handler built by Router, used to replay requests
+	router     http.Handler
+	middleware []httpctx.Middleware
+	// Called with each batch of file changes - see OnChange
+	changeFuncs []func(Change)
+	// Run when the server shuts down, to stop watchers and the like
+	cleanup []func()
+
+	// Set by New, and used by Start
+	address  string
+	port     int
+	certFile string
+	logger   termlog.TermLog
+	server   *http.Server
+}
 
-	lrserver *livereload.Server
+// Use registers middleware that wraps every route handler. Middleware runs
+// inside devd's own logging and shaping, in the order it was registered, and
+// must be added before the Router is built.
+func (dd *Devd) Use(middleware ...httpctx.Middleware) {
+	dd.middleware = append(dd.middleware, middleware...)
 }
 
 // WrapHandler wraps an httpctx.Handler in the paraphernalia needed by devd for
 // logging, latency, and so forth.
 func (dd *Devd) WrapHandler(log termlog.TermLog, next httpctx.Handler) http.Handler {
+	next = httpctx.Chain(next, dd.middleware...)
+	if dd.Preload && dd.preloads == nil {
+		dd.preloads = newPreloadCache()
+	}
+	if dd.ReplayHistory > 0 && dd.history == nil {
+		dd.history = newRequestHistory(dd.ReplayHistory)
+	}
+	if dd.CacheBust && dd.versions == nil {
+		dd.versions = newAssetVersions()
+	}
+	if dd.Waterfall && dd.waterfall == nil {
+		dd.waterfall = newWaterfall(log, waterfallSettle)
+	}
+	hdrTemplates, err := dd.parseHeaderTemplates()
+	if err != nil {
+		log.Warn("%s", err)
+	}
+	tsWidth := timestampWidth(log)
 	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		r.URL.Scheme = dd.ServingScheme
+		r.URL.Scheme = dd.requestScheme(r)
 		revertOriginalHost(r)
 		timr := timer.Timer{}
+		start := time.Now()
 		sublog := log.Group()
 		defer func() {
 			timing := termlog.DefaultPalette.Timestamp.SprintFunc()("timing: ")
 			sublog.SayAs("timer", timing+timr.String())
 			sublog.Done()
 		}()
-		if matchStringAny(dd.IgnoreLogs, fmt.Sprintf("%s%s", r.URL.Host, r.RequestURI)) {
+		target := fmt.Sprintf("%s%s", r.URL.Host, r.RequestURI)
+		ignored := ignoreRequest(dd.IgnoreLogs, r.Method, target)
+		if ignored {
 			sublog.Quiet()
 		}
 		timr.RequestHeaders()
@@ -186,38 +399,146 @@ func (dd *Devd) WrapHandler(log termlog.TermLog, next httpctx.Handler) http.Hand
 		if !strings.HasPrefix(dpath, "/") {
 			dpath = "/" + dpath
 		}
-		sublog.Say("%s %s", r.Method, dpath)
-		LogHeader(sublog, r.Header)
-		ctx := timr.NewContext(context.Background())
+		pathRoom := 0
+		if dd.LogWidth > 0 {
+			pathRoom = dd.LogWidth - tsWidth - len(r.Method) - 1
+		}
+		sublog.Say("%s %s", r.Method, shorten(dpath, pathRoom))
+		if id, ok := replayID(r); ok {
+			sublog.Say("replay of request %d", id)
+		} else if dd.history != nil && r.Header.Get("Upgrade") == "" {
+			defer dd.history.record(r)()
+		}
+		logHeaderFit(sublog, r.Header, dd.LogWidth)
+		ctx := timr.NewContext(r.Context())
 		ctx = termlog.NewContext(ctx, sublog)
 		if dd.AddHeaders != nil {
 			for h, vals := range *dd.AddHeaders {
 				for _, v := range vals {
+					v, err := hdrTemplates.expand(v, r)
+					if err != nil {
+						sublog.Warn("header %s: %s", h, err)
+						continue
+					}
 					w.Header().Set(h, v)
 				}
 			}
 		}
+		for _, c := range dd.SetCookies {
+			http.SetCookie(w, c)
+		}
+		if len(dd.StripCookies) > 0 {
+			stripCookies(r, dd.StripCookies)
+		}
 		if dd.Cors {
-			origin := r.Header.Get("Origin")
-			if origin == "" {
-				origin = "*"
+			dd.corsHeaders(w, r)
+		}
+		flusher, _ := w.(http.Flusher)
+		rlw := &ResponseLogWriter{
+			Log:     sublog,
+			Resp:    w,
+			Flusher: flusher,
+			Timer:   &timr,
+			Width:   dd.LogWidth,
+
+			ServerTiming: dd.ServerTiming,
+		}
+		// The request's own log entry only appears once it's done, so notes
+		// about slow requests go to the main log
+		if dd.InFlightNotice > 0 && !ignored && r.Header.Get("Upgrade") == "" {
+			defer watchInFlight(log.Say, dd.InFlightNotice, r.Method+" "+dpath, rlw.Size)()
+		}
+		// Handlers may rewrite the URL, so we take a note of it for the hook
+		reqURL := fmt.Sprintf("%s://%s%s", r.URL.Scheme, r.Host, r.URL.RequestURI())
+		defer func() {
+			dd.requestHook(log, r.Method, reqURL, rlw.Status(), time.Since(start), r.RemoteAddr)
+		}()
+		if dd.waterfall != nil && r.Header.Get("Upgrade") == "" {
+			defer func() {
+				dd.waterfall.add(r, reqURL, rlw.Header(), waterfallEntry{
+					path:     dpath,
+					start:    start,
+					duration: time.Since(start),
+					size:     rlw.Size(),
+				})
+			}()
+		}
+		if dd.DownKbps > 0 {
+			// Show how throttling plays out for the responses that are big
+			// enough for it to matter
+			defer func() {
+				if rate := timr.Rate(); rate > 0 && rlw.Size() > int64(dd.DownKbps)*1024/10 {
+					sublog.Say(
+						"rate %s, throttled to %s",
+						timer.FormatRate(rate),
+						timer.FormatRate(float64(dd.DownKbps)*1024),
+					)
+				}
+			}()
+		}
+		if !ignored && len(dd.IgnoreLogs) > 0 {
+			// Rules that check the status are applied once the response is
+			// done, which is before the request's log entry appears
+			method := r.Method
+			defer func() {
+				if ignoreResponse(dd.IgnoreLogs, method, target, rlw.Status()) {
+					sublog.Quiet()
+				}
+			}()
+		}
+		defer rlw.Finish(r.Method)
+		var rw http.ResponseWriter = rlw
+		if len(dd.TTFB) > 0 && r.Header.Get("Upgrade") == "" {
+			rw = &ttfbWriter{ResponseWriter: rw, ctx: r.Context(), ttfbs: dd.TTFB}
+		}
+		if dd.Preload || dd.Push {
+			pw := dd.preload(sublog, rlw, r)
+			defer pw.finish()
+			rw = pw
+		}
+		if dd.Pretty && r.Header.Get("Upgrade") == "" {
+			// Upstream servers mustn't compress what we re-indent
+			r.Header.Del("Accept-Encoding")
+			pw := &prettyWriter{ResponseWriter: rw, head: r.Method == "HEAD"}
+			defer pw.finish()
+			rw = pw
+		}
+		if dd.CacheBust && r.Method != "HEAD" && r.Header.Get("Upgrade") == "" {
+			if strings.Contains(r.Header.Get("Accept"), "text/html") {
+				// Pages must be sent whole, and uncompressed, to be rewritten.
+				// They change with their assets, so a page the browser has
+				// cached may be stale even if its own file isn't.
+				r.Header.Del("Accept-Encoding")
+				r.Header.Del("If-Modified-Since")
+				r.Header.Del("If-None-Match")
 			}
-			w.Header().Set("Access-Control-Allow-Origin", origin)
-			requestHeaders := r.Header.Get("Access-Control-Request-Headers")
-			if requestHeaders != "" {
-				w.Header().Set("Access-Control-Allow-Headers", requestHeaders)
+			cw := &cacheBustWriter{ResponseWriter: rw, version: dd.cacheBust(r, r.URL.Path)}
+			defer cw.finish()
+			rw = cw
+		}
+		if dd.Cors && isPreflight(r) {
+			// Preflights are answered here, since the handlers behind us
+			// generally don't know about OPTIONS
+			rlw.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if dd.MaxBodySize > 0 {
+			if r.ContentLength > dd.MaxBodySize {
+				http.Error(rlw, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+				return
 			}
-			requestMethod := r.Header.Get("Access-Control-Request-Method")
-			if requestMethod != "" {
-				w.Header().Set("Access-Control-Allow-Methods", requestMethod)
+			r.Body = http.MaxBytesReader(rlw, r.Body, dd.MaxBodySize)
+		}
+		if r.Header.Get("Upgrade") == "" {
+			defer watchUpload(sublog.Say, r, uploadProgressInterval)()
+		}
+		if dd.SourceMaps != "" && r.Header.Get("Upgrade") == "" {
+			var ok bool
+			if rw, ok = dd.sourceMaps(rw, r); !ok {
+				return
 			}
 		}
-		flusher, _ := w.(http.Flusher)
-		next.ServeHTTPContext(
-			ctx,
-			&ResponseLogWriter{Log: sublog, Resp: w, Flusher: flusher, Timer: &timr},
-			r,
-		)
+		next.ServeHTTPContext(ctx, rw, r)
 	})
 	return h
 }
@@ -234,27 +555,42 @@ func (dd *Devd) HasLivereload() bool {
 func (dd *Devd) AddRoutes(specs []string, notfound []string) error {
 	dd.Routes = make(RouteCollection)
 	for _, s := range specs {
-		err := dd.Routes.Add(s, notfound)
+		err := dd.Routes.Add(s, nil)
 		if err != nil {
 			return fmt.Errorf("Invalid route specification: %s", err)
 		}
 	}
-	return nil
-}
-
-// AddIgnores adds log ignore patterns to the server
-func (dd *Devd) AddIgnores(specs []string) error {
-	dd.IgnoreLogs = make([]*regexp.Regexp, 0, 0)
-	for _, expr := range specs {
-		v, err := regexp.Compile(expr)
+	// Not found over-rides can be scoped to any of the routes, so they're
+	// added once we know them all
+	for match, route := range dd.Routes {
+		ep, ok := route.Endpoint.(*filesystemEndpoint)
+		if !ok {
+			continue
+		}
+		rparts, err := parseNotFound(notFoundForRoute(match, notfound, dd.Routes))
 		if err != nil {
-			return fmt.Errorf("%s", err)
+			return fmt.Errorf("Invalid not found over-ride: %s", err)
 		}
-		dd.IgnoreLogs = append(dd.IgnoreLogs, v)
+		ep.notFoundRoutes = rparts
 	}
 	return nil
 }
 
+// checkPassword accepts a user that matches either the password credentials
+// or the htpasswd file
+func (dd *Devd) checkPassword(user, password string, r *http.Request) bool {
+	if dd.Credentials != nil && dd.Credentials.Check(user, password) {
+		return true
+	}
+	if dd.Htpasswd != nil && dd.Htpasswd.Check(user, password) {
+		return true
+	}
+	if dd.audit != nil {
+		dd.audit.failed(r, user)
+	}
+	return false
+}
+
 // HandleNotFound handles pages not found. In particular, this handler is used
 // when we have no matching route for a request. This also means it's not
 // useful to inject the livereload paraphernalia here.
@@ -269,30 +605,103 @@ func HandleNotFound(templates *template.Template) httpctx.Handler {
 	})
 }
 
+// Check reports settings that only make sense together with others. Router
+// refuses configurations that fail it.
+func (dd *Devd) Check() error {
+	if !dd.HasLivereload() {
+		switch {
+		case dd.NoInject:
+			return fmt.Errorf("Turning off livereload injection needs livereload")
+		case dd.LegacyLivereload:
+			return fmt.Errorf("The livereload compatibility mode needs livereload")
+		case dd.Hooks.OnReload != "":
+			return fmt.Errorf("The on-reload hook needs livereload")
+		}
+	}
+	return nil
+}
+
 // Router constructs the main Devd router that serves all requests
 func (dd *Devd) Router(logger termlog.TermLog, templates *template.Template) (http.Handler, error) {
+	if err := dd.Check(); err != nil {
+		return nil, err
+	}
 	mux := http.NewServeMux()
 	hasGlobal := false
 
 	ci := inject.CopyInject{}
-	if dd.HasLivereload() {
+	if dd.HasLivereload() && !dd.NoInject {
 		ci = livereload.Injector
 	}
 
+	favicon, err := makeFavicon(dd.FaviconName)
+	if err != nil {
+		return nil, fmt.Errorf("Could not make favicon: %s", err)
+	}
+
+	var recent *recentChanges
+	if dd.HasLivereload() {
+		recent = newRecentChanges(recentWindow)
+		dd.OnChange(recent.add)
+	}
+
+	if dd.CountTraffic {
+		dd.traffic = newTraffic()
+		dd.handleControl(mux, statsPath, http.HandlerFunc(dd.serveStats))
+		dd.cleanup = append(dd.cleanup, func() { dd.traffic.report(logger) })
+	}
+
+	up := dd.upstream()
 	for match, route := range dd.Routes {
 		if match == "/" {
 			hasGlobal = true
 		}
-		handler := dd.WrapHandler(
-			logger,
-			route.Endpoint.Handler(route.Path, templates, ci),
-		)
+		if ep, ok := route.Endpoint.(*filesystemEndpoint); ok {
+			ep.recent, ep.pinRecent = recent, dd.PinRecent
+			if dd.HasLivereload() {
+				// Listings are devd's own pages, so they refresh themselves
+				// even with injection off
+				ep.listingInject = livereload.Injector
+			}
+		}
+		var h httpctx.Handler
+		switch ep := route.Endpoint.(type) {
+		case *forwardEndpoint:
+			h = ep.handler(route.Path, ci, up)
+			if fb := dd.fallbackFor(match); fb != nil {
+				static := &filesystemEndpoint{Root: fb.Root}
+				h = fb.handler(h, static.Handler(route.Path, templates, ci))
+			}
+		case *websocketEndpoint:
+			h = ep.handler(route.Path, up)
+		default:
+			h = route.Endpoint.Handler(route.Path, templates, ci)
+		}
+		if route.Path == "/" {
+			h = faviconFallback(favicon, h)
+		}
+		transforms := dd.transformsFor(match)
+		for i := len(transforms) - 1; i >= 0; i-- {
+			h = transforms[i].handler(h)
+		}
+		if dd.traffic != nil {
+			h = dd.traffic.handler(match, h)
+		}
+		handler := dd.WrapHandler(logger, h)
 		mux.Handle(match, handler)
 	}
 	if dd.HasLivereload() {
 		lr := livereload.NewServer("livereload", logger)
+		lr.ListingChanged = dd.listingChanged
+		var reloader livereload.Reloader = lr
+		if dd.Hooks.OnReload != "" {
+			reloader = &hookReloader{lr, dd.Hooks.OnReload, logger}
+		}
+		events := newChangeBroker()
+		dd.OnChange(events.publish)
 		mux.Handle(livereload.EndpointPath, lr)
 		mux.Handle(livereload.ScriptPath, http.HandlerFunc(lr.ServeScript))
+		dd.handleControl(mux, EventsPath, events)
 		seen := make(map[string]bool)
 		for _, route := range dd.Routes {
 			if _, ok := seen[route.Host]; route.Host != "" && ok == false {
@@ -304,55 +713,125 @@ func (dd *Devd) Router(logger termlog.TermLog, templates *template.Template) (ht
 				seen[route.Host] = true
 			}
 		}
+		dd.cleanup = append(dd.cleanup, lr.Close, events.Close)
+		if dd.LegacyLivereload {
+			script := http.HandlerFunc(lr.ServeLegacyScript)
+			mux.Handle(livereload.LegacyScriptPath, script)
+			for host := range seen {
+				mux.Handle(host+livereload.LegacyScriptPath, script)
+			}
+			legacy := http.NewServeMux()
+			legacy.Handle(livereload.LegacyScriptPath, script)
+			legacy.Handle(livereload.LegacyEndpointPath, http.HandlerFunc(lr.ServeLegacy))
+			dd.legacyLR = legacy
+		}
 		if dd.LivereloadRoutes {
-			err := WatchRoutes(dd.Routes, lr, dd.Excludes, logger)
+			watchers, err := watchRoutes(dd.Routes, reloader, dd.Excludes, logger, dd.notifyChange)
 			if err != nil {
+				dd.shutdown()
 				return nil, fmt.Errorf("Could not watch routes for livereload: %s", err)
 			}
+			dd.cleanup = append(dd.cleanup, func() { stopWatchers(watchers) })
 		}
 		if len(dd.WatchPaths) > 0 {
-			err := WatchPaths(dd.WatchPaths, dd.Excludes, lr, logger)
+			watchers, err := watchPaths(dd.WatchPaths, dd.Excludes, reloader, logger, dd.notifyChange)
 			if err != nil {
+				dd.shutdown()
 				return nil, fmt.Errorf("Could not watch path for livereload: %s", err)
 			}
+			dd.cleanup = append(dd.cleanup, func() { stopWatchers(watchers) })
 		}
-		dd.lrserver = lr
+		dd.lrserver = reloader
+	}
+	if dd.ReplayHistory > 0 {
+		dd.handleControl(mux, replayPath, http.HandlerFunc(dd.serveReplay))
+	}
+	dd.handleControl(mux, routesPath, dd.serveRoutes(templates, logger))
+	if dd.ServesPAC() {
+		mux.Handle(PACPath, http.HandlerFunc(dd.servePAC))
 	}
 	if !hasGlobal {
 		mux.Handle(
 			"/",
-			dd.WrapHandler(logger, HandleNotFound(templates)),
+			dd.WrapHandler(logger, faviconFallback(favicon, HandleNotFound(templates))),
 		)
 	}
 	var h = http.Handler(mux)
-	if dd.Credentials != nil {
-		h = httpauth.SimpleBasicAuth(
-			dd.Credentials.username, dd.Credentials.password,
-		)(h)
+	hasAuth := dd.Credentials != nil || dd.Htpasswd != nil || dd.Token != ""
+	if hasAuth {
+		dd.audit = newAuthAudit(logger, dd.AuthLockout, dd.AuthLockoutTime)
+	}
+	if dd.DigestAuth {
+		if dd.Credentials == nil || dd.Htpasswd != nil {
+			return nil, fmt.Errorf("Digest authentication needs a password, and can't be used with htpasswd files")
+		}
+		da, err := newDigestAuth("Restricted", dd.Credentials, h, dd.audit.failed)
+		if err != nil {
+			return nil, err
+		}
+		h = da
+	} else if dd.Credentials != nil || dd.Htpasswd != nil {
+		h = httpauth.BasicAuth(httpauth.AuthOptions{
+			Realm:    "Restricted",
+			AuthFunc: dd.checkPassword,
+		})(h)
+	}
+	if dd.LoginForm {
+		if dd.Credentials == nil && dd.Htpasswd == nil {
+			return nil, fmt.Errorf("The login form needs a password or htpasswd file")
+		}
+		la, err := newLoginAuth(dd.checkPassword, templates, mux, h)
+		if err != nil {
+			return nil, err
+		}
+		h = la
+	}
+	if dd.Token != "" {
+		// A password is an alternative to the token, so requests without the
+		// token get the password challenge if there is one.
+		var fallback http.Handler = http.HandlerFunc(tokenUnauthorized)
+		if dd.Credentials != nil || dd.Htpasswd != nil {
+			fallback = h
+		}
+		h = &tokenAuth{dd.Token, mux, fallback, dd.audit.failed}
+	}
+	if hasAuth {
+		h = dd.audit.handler(h)
+	}
+	if hasAuth && dd.Cors {
+		h = dd.answerPreflights(logger, h)
 	}
-	return hostPortStrip(h), nil
+	if len(dd.Allow) > 0 || len(dd.Deny) > 0 {
+		h = dd.ipFilter(logger, h)
+	}
+	h = hostPortStrip(h)
+	if len(dd.TrustProxy) > 0 {
+		h = dd.trustProxy(h)
+	}
+	dd.router = h
+	return h, nil
 }
 
-// Serve starts the devd server. The callback is called with the serving URL
-// just before service starts.
-func (dd *Devd) Serve(address string, port int, certFile string, logger termlog.TermLog, callback func(string)) error {
+// listen sets up the router and a listener for the devd server. It returns
+// the server and listener, and the URL the server is reachable at.
+func (dd *Devd) listen(address string, port int, certFile string, logger termlog.TermLog) (*http.Server, net.Listener, string, error) {
 	templates, err := ricetemp.MakeTemplates(rice.MustFindBox("templates"))
 	if err != nil {
-		return fmt.Errorf("Error loading templates: %s", err)
-	}
-	mux, err := dd.Router(logger, templates)
-	if err != nil {
-		return err
+		return nil, nil, "", fmt.Errorf("Error loading templates: %s", err)
 	}
 	var tlsConfig *tls.Config
 	var tlsEnabled bool
-	if certFile != "" {
-		tlsConfig, err = getTLSConfig(certFile)
+	if certFile != "" || len(dd.HostCerts) > 0 {
+		tlsConfig, err = getTLSConfig(certFile, dd.HostCerts)
 		if err != nil {
-			return fmt.Errorf("Could not load certs: %s", err)
+			return nil, nil, "", fmt.Errorf("Could not load certs: %s", err)
 		}
 		tlsEnabled = true
 	}
+	mux, err := dd.Router(logger, templates)
+	if err != nil {
+		return nil, nil, "", err
+	}
 
 	var hl net.Listener
 	if port > 0 {
@@ -361,32 +840,180 @@ func (dd *Devd) Serve(address string, port int, certFile string, logger termlog.
 		hl, err = pickPort(address, portLow, portHigh, tlsEnabled)
 	}
 	if err != nil {
-		return err
+		dd.shutdown()
+		return nil, nil, "", err
 	}
 
-	if tlsConfig != nil {
-		hl = tls.NewListener(hl, tlsConfig)
+	wrap := func(l net.Listener) net.Listener {
+		l = slowdown.NewSlowListener(l, dd.UpKbps*1024, dd.DownKbps*1024)
+		// TLS goes on the outside, so that net/http sees TLS connections and
+		// can negotiate HTTP/2
+		if tlsConfig != nil {
+			l = tls.NewListener(l, tlsConfig)
+		}
+		return l
+	}
+	hl = wrap(hl)
+	if dd.Tunnel != nil {
+		tl, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			hl.Close()
+			dd.shutdown()
+			return nil, nil, "", fmt.Errorf("Could not listen for tunnel: %s", err)
+		}
+		dd.tunnelListener = wrap(tl)
+	}
+	if dd.legacyLR != nil {
+		err = dd.listenLegacy(address, logger)
+		if err != nil {
+			hl.Close()
+			dd.shutdown()
+			return nil, nil, "", err
+		}
 	}
-
-	hl = slowdown.NewSlowListener(hl, dd.UpKbps*1024, dd.DownKbps*1024)
 	url := formatURL(tlsEnabled, address, hl.Addr().(*net.TCPAddr).Port)
 	logger.Say("Listening on %s (%s)", url, hl.Addr().String())
 	server := &http.Server{Addr: hl.Addr().String(), Handler: mux}
+	server.BaseContext = func(l net.Listener) context.Context {
+		if l == dd.tunnelListener {
+			return withTunnel(context.Background())
+		}
+		return context.Background()
+	}
+	if dd.NoKeepAlive {
+		server.SetKeepAlivesEnabled(false)
+	}
+	return server, hl, url, nil
+}
+
+// listenLegacy serves the classic LiveReload websocket and script, set up by
+// Router, on port 35729 of the address devd listens on, until the server
+// shuts down
+func (dd *Devd) listenLegacy(address string, logger termlog.TermLog) error {
+	l, err := net.Listen("tcp", net.JoinHostPort(address, strconv.Itoa(livereload.LegacyPort)))
+	if err != nil {
+		return fmt.Errorf("Could not listen on the LiveReload port: %s", err)
+	}
+	server := &http.Server{Handler: dd.legacyLR}
+	go server.Serve(l)
+	dd.cleanup = append(dd.cleanup, func() { server.Close() })
+	logger.Say("LiveReload compatibility on %s", l.Addr().String())
+	return nil
+}
+
+// Start starts a Devd created with New in the background, and returns the
+// URL it's serving on.
+func (dd *Devd) Start() (string, error) {
+	if dd.logger == nil {
+		return "", fmt.Errorf("Start needs a Devd created with New")
+	}
+	if dd.server != nil {
+		return "", fmt.Errorf("Already started")
+	}
+	server, hl, url, err := dd.listen(dd.address, dd.port, dd.certFile, dd.logger)
+	if err != nil {
+		return "", err
+	}
+	dd.server = server
+	dd.startHook(dd.logger, url)
+	go func() {
+		err := server.Serve(hl)
+		if err != http.ErrServerClosed {
+			dd.logger.Shout("Server stopped: %v", err)
+		}
+	}()
+	dd.serveTunnel(server)
+	return url, nil
+}
+
+// serveTunnel serves the tunnel listener, if there is one, and hands its
+// address to the Tunnel callback. The listener is closed with the server.
+func (dd *Devd) serveTunnel(server *http.Server) {
+	if dd.tunnelListener == nil {
+		return
+	}
+	go func() { _ = server.Serve(dd.tunnelListener) }()
+	dd.Tunnel(dd.tunnelListener.Addr().String())
+}
+
+// Stop stops a Devd started with Start, closing all connections
+func (dd *Devd) Stop() error {
+	if dd.server == nil {
+		return fmt.Errorf("Not started")
+	}
+	err := dd.server.Close()
+	dd.server = nil
+	dd.shutdown()
+	return err
+}
+
+// Reload tells livereload clients that the given paths have changed. A path
+// of "*" reloads everything. Reload does nothing if livereload is off or the
+// server hasn't started yet.
+func (dd *Devd) Reload(paths []string) {
+	if dd.lrserver != nil {
+		dd.lrserver.Reload(paths)
+	}
+}
+
+// shutdown stops everything the Router started alongside the server
+func (dd *Devd) shutdown() {
+	for _, f := range dd.cleanup {
+		f()
+	}
+	dd.cleanup = nil
+}
+
+// Serve starts the devd server. The callback is called with the serving URL
+// just before service starts.
+func (dd *Devd) Serve(address string, port int, certFile string, logger termlog.TermLog, callback func(string)) error {
+	return dd.ServeContext(context.Background(), address, port, certFile, logger, callback)
+}
+
+// ServeContext is like Serve, but the server is shut down when ctx is
+// cancelled. The listener, file watchers and livereload server are all
+// stopped before ServeContext returns.
+func (dd *Devd) ServeContext(ctx context.Context, address string, port int, certFile string, logger termlog.TermLog, callback func(string)) error {
+	server, hl, url, err := dd.listen(address, port, certFile, logger)
+	if err != nil {
+		return err
+	}
+	defer dd.shutdown()
 	callback(url)
+	dd.startHook(logger, url)
 
 	if dd.HasLivereload() {
 		c := make(chan os.Signal, 1)
 		signal.Notify(c, syscall.SIGHUP)
+		done := make(chan struct{})
+		defer func() {
+			signal.Stop(c)
+			close(done)
+		}()
 		go func() {
 			for {
-				<-c
-				logger.Say("Received signal - reloading")
-				dd.lrserver.Reload([]string{"*"})
+				select {
+				case <-c:
+					logger.Say("Received signal - reloading")
+					dd.Reload([]string{"*"})
+				case <-done:
+					return
+				}
 			}
 		}()
 	}
 
-	err = server.Serve(hl)
-	logger.Shout("Server stopped: %v", err)
+	served := make(chan error, 1)
+	go func() { served <- server.Serve(hl) }()
+	dd.serveTunnel(server)
+	select {
+	case err = <-served:
+		if err != http.ErrServerClosed {
+			return fmt.Errorf("Server stopped: %s", err)
+		}
+	case <-ctx.Done():
+		server.Close()
+		<-served
+	}
 	return nil
 }
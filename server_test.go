@@ -1,13 +1,27 @@
 package devd
 
 import (
+	"context"
+	"crypto/tls"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/GeertJohan/go.rice"
+	"github.com/cortesi/devd/httpctx"
 	"github.com/cortesi/devd/inject"
+	"github.com/cortesi/devd/livereload"
 	"github.com/cortesi/devd/ricetemp"
 	"github.com/cortesi/termlog"
+	"github.com/gorilla/websocket"
 )
 
 var formatURLTests = []struct {
@@ -41,6 +55,13 @@ func TestPickPort(t *testing.T) {
 	if err == nil {
 		t.Errorf("Expected not to be able to bind to any port")
 	}
+	port, err := AutoPort("127.0.0.1", false)
+	if err != nil {
+		t.Errorf("Could not find an automatic port: %s", err)
+	}
+	if port != 80 && (port < portLow || port >= portHigh) {
+		t.Errorf("Unexpected automatic port: %d", port)
+	}
 
 }
 
@@ -52,7 +73,7 @@ func fsEndpoint(s string) *filesystemEndpoint {
 func TestDevdRouteHandler(t *testing.T) {
 	logger := termlog.NewLog()
 	logger.Quiet()
-	r := Route{"", "/", fsEndpoint("./testdata")}
+	r := Route{"", "/", fsEndpoint("./testdata"), ""}
 	templates := ricetemp.MustMakeTemplates(rice.MustFindBox("templates"))
 	ci := inject.CopyInject{}
 
@@ -83,17 +104,405 @@ func TestDevdHandler(t *testing.T) {
 	AssertCode(t, ht.Request("GET", "/nonexistent", nil), 404)
 }
 
+func TestNoInject(t *testing.T) {
+	logger := termlog.NewLog()
+	logger.Quiet()
+	templates := ricetemp.MustMakeTemplates(rice.MustFindBox("templates"))
+	for _, noInject := range []bool{false, true} {
+		devd := Devd{Livereload: true, NoInject: noInject}
+		if err := devd.AddRoutes([]string{"./testdata"}, nil); err != nil {
+			t.Fatal(err)
+		}
+		h, err := devd.Router(logger, templates)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ht := handlerTester{t, h}
+		resp := ht.Request("GET", "/", nil)
+		AssertCode(t, resp, 200)
+		injected := strings.Contains(resp.Body.String(), livereload.ScriptPath)
+		if injected == noInject {
+			t.Errorf("With NoInject %v, expected injection %v", noInject, !noInject)
+		}
+		AssertCode(t, ht.Request("GET", livereload.ScriptPath, nil), 200)
+		devd.shutdown()
+	}
+}
+
+func TestListingLivereload(t *testing.T) {
+	logger := termlog.NewLog()
+	logger.Quiet()
+	templates := ricetemp.MustMakeTemplates(rice.MustFindBox("templates"))
+	tmp, err := ioutil.TempDir("", "devdtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	for _, noInject := range []bool{false, true} {
+		devd := Devd{Livereload: true, NoInject: noInject}
+		if err := devd.AddRoutes([]string{tmp}, nil); err != nil {
+			t.Fatal(err)
+		}
+		h, err := devd.Router(logger, templates)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ht := handlerTester{t, h}
+		resp := ht.Request("GET", "/", nil)
+		AssertCode(t, resp, 200)
+		if !strings.Contains(resp.Body.String(), livereload.ScriptPath) {
+			t.Errorf("With NoInject %v, expected the listing to load livereload", noInject)
+		}
+		devd.shutdown()
+	}
+}
+
+func TestLegacyLivereload(t *testing.T) {
+	logger := termlog.NewLog()
+	logger.Quiet()
+	templates := ricetemp.MustMakeTemplates(rice.MustFindBox("templates"))
+	devd := Devd{Livereload: true, LegacyLivereload: true}
+	if err := devd.AddRoutes([]string{"./testdata"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	h, err := devd.Router(logger, templates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer devd.shutdown()
+	ht := handlerTester{t, h}
+	AssertCode(t, ht.Request("GET", livereload.LegacyScriptPath, nil), 200)
+
+	ts := httptest.NewServer(devd.legacyLR)
+	defer ts.Close()
+	u := "ws" + strings.TrimPrefix(ts.URL, "http") + livereload.LegacyEndpointPath
+	conn, _, err := websocket.DefaultDialer.Dial(u, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	hello := map[string]interface{}{
+		"command":   "hello",
+		"protocols": []string{"http://livereload.com/protocols/official-7"},
+	}
+	if err := conn.WriteJSON(hello); err != nil {
+		t.Fatal(err)
+	}
+	var msg map[string]interface{}
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg["command"] != "hello" {
+		t.Fatalf("Expected a hello, got %v", msg)
+	}
+
+	devd.Reload([]string{"style.css"})
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg["command"] != "reload" || msg["path"] != "style.css" || msg["liveCSS"] != true {
+		t.Errorf("Expected a CSS reload, got %v", msg)
+	}
+	devd.Reload([]string{"style.css", "index.html"})
+	msg = nil
+	if err := conn.ReadJSON(&msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg["command"] != "reload" || msg["path"] != "index.html" {
+		t.Errorf("Expected a page reload, got %v", msg)
+	}
+}
+
+func TestServerTiming(t *testing.T) {
+	logger := termlog.NewLog()
+	logger.Quiet()
+	templates := ricetemp.MustMakeTemplates(rice.MustFindBox("templates"))
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(20 * time.Millisecond)
+		w.Header().Set("Server-Timing", "db;dur=5")
+	}))
+	defer backend.Close()
+
+	devd := Devd{ServerTiming: true}
+	if err := devd.AddRoutes([]string{"/api/=" + backend.URL, "./testdata"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	h, err := devd.Router(logger, templates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ht := handlerTester{t, h}
+
+	st := ht.Request("GET", "/", nil).Header()["Server-Timing"]
+	if len(st) != 1 || !strings.HasPrefix(st[0], "devd;dur=") || strings.Contains(st[0], "upstream") {
+		t.Errorf("Unexpected Server-Timing for a file: %v", st)
+	}
+	st = ht.Request("GET", "/api/", nil).Header()["Server-Timing"]
+	if len(st) != 2 || st[0] != "db;dur=5" || !strings.Contains(st[1], "devd-upstream;dur=") {
+		t.Errorf("Unexpected Server-Timing for a proxied request: %v", st)
+	}
+}
+
+// watchedReader notes whether its body has been read
+type watchedReader struct {
+	r    *strings.Reader
+	read int32
+}
+
+func (w *watchedReader) Read(p []byte) (int, error) {
+	atomic.StoreInt32(&w.read, 1)
+	return w.r.Read(p)
+}
+
+func TestProxyExpectContinue(t *testing.T) {
+	logger := termlog.NewLog()
+	logger.Quiet()
+	templates := ricetemp.MustMakeTemplates(rice.MustFindBox("templates"))
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/reject" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Write(body)
+	}))
+	defer backend.Close()
+
+	devd := Devd{}
+	if err := devd.AddRoutes([]string{backend.URL}, nil); err != nil {
+		t.Fatal(err)
+	}
+	h, err := devd.Router(logger, templates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frontend := httptest.NewServer(h)
+	defer frontend.Close()
+	// Longer than the test should take, so that we know the 100 Continue
+	// came through rather than the client giving up waiting for it
+	client := &http.Client{Transport: &http.Transport{ExpectContinueTimeout: 10 * time.Second}}
+
+	var expectTests = []struct {
+		path string
+		code int
+		read bool
+	}{
+		{"/echo", http.StatusOK, true},
+		{"/reject", http.StatusUnauthorized, false},
+	}
+	for _, tt := range expectTests {
+		body := &watchedReader{r: strings.NewReader("data")}
+		req, err := http.NewRequest("POST", frontend.URL+tt.path, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.ContentLength = 4
+		req.Header.Set("Expect", "100-continue")
+		start := time.Now()
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.code || (atomic.LoadInt32(&body.read) == 1) != tt.read {
+			t.Errorf("%s: expected %d with body read %v, got %d", tt.path, tt.code, tt.read, resp.StatusCode)
+		}
+		if time.Since(start) > 5*time.Second {
+			t.Errorf("%s: took %s", tt.path, time.Since(start))
+		}
+	}
+}
+
+func TestMaxBodySize(t *testing.T) {
+	logger := termlog.NewLog()
+	logger.Quiet()
+	devd := Devd{MaxBodySize: 10}
+	h := devd.WrapHandler(
+		logger,
+		httpctx.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			if _, err := ioutil.ReadAll(r.Body); err != nil {
+				w.WriteHeader(http.StatusRequestEntityTooLarge)
+			}
+		}),
+	)
+	ht := handlerTester{t, h}
+
+	AssertCode(t, ht.Request("POST", "/", url.Values{"a": {"b"}}), 200)
+	AssertCode(t, ht.Request("POST", "/", url.Values{"a": {"0123456789"}}), 413)
+
+	req := httptest.NewRequest("POST", "/", ioutil.NopCloser(strings.NewReader("0123456789abc")))
+	req.ContentLength = -1
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	AssertCode(t, w, 413)
+}
+
+func TestUse(t *testing.T) {
+	logger := termlog.NewLog()
+	logger.Quiet()
+	tag := func(name string) httpctx.Middleware {
+		return func(next httpctx.Handler) httpctx.Handler {
+			return httpctx.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+				w.Header().Add("X-Order", name)
+				next.ServeHTTPContext(ctx, w, r)
+			})
+		}
+	}
+	devd := Devd{}
+	devd.Use(tag("a"), tag("b"))
+	devd.Use(tag("c"))
+	h := devd.WrapHandler(
+		logger,
+		httpctx.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("X-Order", "handler")
+		}),
+	)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	expected := []string{"a", "b", "c", "handler"}
+	if !reflect.DeepEqual(w.Header()["X-Order"], expected) {
+		t.Errorf("Expected %v, got %v", expected, w.Header()["X-Order"])
+	}
+}
+
+func TestServeContext(t *testing.T) {
+	logger := termlog.NewLog()
+	logger.Quiet()
+	devd := Devd{LivereloadRoutes: true}
+	if err := devd.AddRoutes([]string{"./testdata"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	urls := make(chan string, 1)
+	served := make(chan error, 1)
+	go func() {
+		served <- devd.ServeContext(ctx, "127.0.0.1", 0, "", logger, func(u string) { urls <- u })
+	}()
+	u, err := url.Parse(<-urls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := "http://127.0.0.1:" + u.Port() + "/"
+	resp, err := http.Get(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	cancel()
+	select {
+	case err := <-served:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("ServeContext did not return after cancellation")
+	}
+	if _, err := http.Get(addr); err == nil {
+		t.Error("Expected error after cancellation")
+	}
+	// Reloads after shutdown are ignored
+	devd.Reload([]string{"foo"})
+}
+
+func TestNoKeepAlive(t *testing.T) {
+	logger := termlog.NewLog()
+	logger.Quiet()
+	for _, disabled := range []bool{false, true} {
+		devd := Devd{NoKeepAlive: disabled}
+		if err := devd.AddRoutes([]string{"./testdata"}, nil); err != nil {
+			t.Fatal(err)
+		}
+		server, hl, _, err := devd.listen("127.0.0.1", 0, "", logger)
+		if err != nil {
+			t.Fatal(err)
+		}
+		go server.Serve(hl)
+		resp, err := http.Get("http://" + hl.Addr().String() + "/")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		server.Close()
+		devd.shutdown()
+		if resp.Close != disabled {
+			t.Errorf("Expected Close to be %v with NoKeepAlive %v", disabled, disabled)
+		}
+	}
+}
+
+func TestReload(t *testing.T) {
+	devd := Devd{}
+	devd.Reload([]string{"foo"})
+	tr := &testReloader{}
+	devd.lrserver = tr
+	devd.Reload([]string{"foo.css"})
+	if !reflect.DeepEqual(tr.paths, [][]string{{"foo.css"}}) {
+		t.Errorf("Unexpected reloads: %v", tr.paths)
+	}
+}
+
 func TestGetTLSConfig(t *testing.T) {
-	_, err := getTLSConfig("nonexistent")
+	_, err := getTLSConfig("nonexistent", nil)
 	if err == nil {
 		t.Error("Expected failure, found success.")
 	}
-	_, err = getTLSConfig("./testdata/certbundle.pem")
+	_, err = getTLSConfig("./testdata/certbundle.pem", nil)
 	if err != nil {
 		t.Errorf("Could not get TLS config: %s", err)
 	}
 }
 
+func TestGetTLSConfigHosts(t *testing.T) {
+	d, err := ioutil.TempDir("", "devdtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+	other := filepath.Join(d, "certbundle")
+	if err := GenerateCert(other); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := getTLSConfig("", map[string]string{"app.test": "nonexistent"}); err == nil {
+		t.Error("Expected failure, found success.")
+	}
+
+	hosts := map[string]string{"app.test": other, "*.api.test": other}
+	config, err := getTLSConfig("./testdata/certbundle.pem", hosts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hostTests = []struct {
+		name    string
+		matched bool
+	}{
+		{"app.test", true},
+		{"APP.test.", true},
+		{"v1.api.test", true},
+		{"api.test", false},
+		{"other.test", false},
+		{"", false},
+	}
+	for _, tt := range hostTests {
+		cert, err := config.GetCertificate(&tls.ClientHelloInfo{ServerName: tt.name})
+		if err != nil {
+			t.Errorf("%q: %s", tt.name, err)
+		}
+		if (cert != nil) != tt.matched {
+			t.Errorf("%q: expected a match %v, got %v", tt.name, tt.matched, cert != nil)
+		}
+	}
+
+	config, err = getTLSConfig("", hosts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := config.GetCertificate(&tls.ClientHelloInfo{ServerName: "other.test"}); err == nil {
+		t.Error("Expected an error without a default certificate")
+	}
+}
+
 var credentialsTests = []struct {
 	spec  string
 	creds *Credentials
@@ -113,3 +522,28 @@ func TestCredentials(t *testing.T) {
 		}
 	}
 }
+
+func TestCheck(t *testing.T) {
+	logger := termlog.NewLog()
+	logger.Quiet()
+	templates := ricetemp.MustMakeTemplates(rice.MustFindBox("templates"))
+	for _, dd := range []Devd{
+		{NoInject: true},
+		{LegacyLivereload: true},
+		{Hooks: Hooks{OnReload: "true"}},
+	} {
+		if err := dd.AddRoutes([]string{"./testdata"}, nil); err != nil {
+			t.Fatal(err)
+		}
+		if dd.Check() == nil {
+			t.Errorf("Expected %+v to fail the check", dd)
+		}
+		if _, err := dd.Router(logger, templates); err == nil {
+			t.Errorf("Expected Router to refuse %+v", dd)
+		}
+		dd.LivereloadRoutes = true
+		if err := dd.Check(); err != nil {
+			t.Errorf("Unexpected error with livereload: %s", err)
+		}
+	}
+}
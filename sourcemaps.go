@@ -0,0 +1,117 @@
+package devd
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"path"
+	"strings"
+)
+
+const (
+	// SourceMapsBlock withholds source maps, as many production sites do
+	SourceMapsBlock = "block"
+	// SourceMapsServe serves source maps as JSON, and points browsers at them
+	// from scripts and stylesheets
+	SourceMapsServe = "serve"
+)
+
+// The response headers that point browsers at a source map
+var sourceMapHeaders = []string{"SourceMap", "X-SourceMap"}
+
+func isSourceMap(p string) bool {
+	return strings.HasSuffix(p, ".map")
+}
+
+// hasSourceMap tells us if a path is a script or stylesheet, which might be
+// accompanied by a source map
+func hasSourceMap(p string) bool {
+	switch path.Ext(p) {
+	case ".js", ".mjs", ".css":
+		return true
+	}
+	return false
+}
+
+// sourceMapWriter adjusts the headers of scripts, stylesheets and source maps
+// to suit a SourceMaps mode
+type sourceMapWriter struct {
+	http.ResponseWriter
+	mode string
+	path string
+	// Set if a static route has a source map for the path
+	mapped      bool
+	wroteHeader bool
+}
+
+func (sw *sourceMapWriter) WriteHeader(code int) {
+	if sw.wroteHeader {
+		return
+	}
+	if code >= 200 {
+		sw.wroteHeader = true
+		h := sw.Header()
+		switch {
+		case sw.mode == SourceMapsBlock:
+			for _, name := range sourceMapHeaders {
+				h.Del(name)
+			}
+		case code != http.StatusOK:
+		case isSourceMap(sw.path):
+			h.Set("Content-Type", "application/json; charset=utf-8")
+		case sw.mapped && h.Get("SourceMap") == "" && h.Get("X-SourceMap") == "":
+			hint := path.Base(sw.path) + ".map"
+			for _, name := range sourceMapHeaders {
+				h.Set(name, hint)
+			}
+		}
+	}
+	sw.ResponseWriter.WriteHeader(code)
+}
+
+func (sw *sourceMapWriter) Write(data []byte) (int, error) {
+	if !sw.wroteHeader {
+		sw.WriteHeader(http.StatusOK)
+	}
+	return sw.ResponseWriter.Write(data)
+}
+
+func (sw *sourceMapWriter) Flush() {
+	if f, ok := sw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (sw *sourceMapWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return hijack(sw.ResponseWriter)
+}
+
+// sourceMaps applies the SourceMaps mode to a request. If it returns false,
+// the request was for a withheld source map, and has been answered.
+func (dd *Devd) sourceMaps(w http.ResponseWriter, r *http.Request) (http.ResponseWriter, bool) {
+	if dd.SourceMaps == SourceMapsBlock && isSourceMap(r.URL.Path) {
+		http.NotFound(w, r)
+		return w, false
+	}
+	sw := &sourceMapWriter{ResponseWriter: w, mode: dd.SourceMaps, path: r.URL.Path}
+	if dd.SourceMaps == SourceMapsServe && hasSourceMap(r.URL.Path) {
+		sw.mapped = dd.hasStaticFile(r, r.URL.Path+".map")
+	}
+	return sw, true
+}
+
+// hasStaticFile tells us if a static route serves a file at a path, on the
+// host a request was made to
+func (dd *Devd) hasStaticFile(r *http.Request, urlPath string) bool {
+	host, _, err := net.SplitHostPort(r.Host)
+	if err != nil {
+		host = r.Host
+	}
+	f, err := dd.Routes.openStatic(host, urlPath)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	return err == nil && !fi.IsDir()
+}
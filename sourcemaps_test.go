@@ -0,0 +1,72 @@
+package devd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/GeertJohan/go.rice"
+	"github.com/cortesi/devd/ricetemp"
+	"github.com/cortesi/termlog"
+)
+
+func TestSourceMaps(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "devdtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	files := map[string]string{
+		"app.js":     "//# sourceMappingURL=app.js.map\n",
+		"app.js.map": `{"version":3}`,
+		"other.js":   "other()\n",
+		"index.html": "<html></html>",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(tmp, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	logger := termlog.NewLog()
+	logger.Quiet()
+	templates := ricetemp.MustMakeTemplates(rice.MustFindBox("templates"))
+
+	var sourceMapTests = []struct {
+		mode   string
+		path   string
+		code   int
+		header string
+		value  string
+	}{
+		{"", "/app.js", 200, "SourceMap", ""},
+		{"", "/app.js.map", 200, "SourceMap", ""},
+		{SourceMapsBlock, "/app.js", 200, "SourceMap", ""},
+		{SourceMapsBlock, "/app.js.map", 404, "SourceMap", ""},
+		{SourceMapsServe, "/app.js", 200, "SourceMap", "app.js.map"},
+		{SourceMapsServe, "/app.js", 200, "X-SourceMap", "app.js.map"},
+		{SourceMapsServe, "/", 200, "SourceMap", ""},
+		{SourceMapsServe, "/app.js.map", 200, "Content-Type", "application/json; charset=utf-8"},
+		{SourceMapsServe, "/missing.js", 404, "SourceMap", ""},
+		{SourceMapsServe, "/other.js", 200, "SourceMap", ""},
+		{SourceMapsServe, "/other.js", 200, "X-SourceMap", ""},
+	}
+	for i, tt := range sourceMapTests {
+		devd := Devd{SourceMaps: tt.mode}
+		if err := devd.AddRoutes([]string{tmp}, nil); err != nil {
+			t.Fatal(err)
+		}
+		h, err := devd.Router(logger, templates)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ht := handlerTester{t, h}
+		resp := ht.Request("GET", tt.path, nil)
+		if resp.Code != tt.code || resp.Header().Get(tt.header) != tt.value {
+			t.Errorf(
+				"Test %d: expected %d with %s %q, got %d with %q",
+				i, tt.code, tt.header, tt.value, resp.Code, resp.Header().Get(tt.header),
+			)
+		}
+	}
+}
@@ -3,10 +3,11 @@
 package timer
 
 import (
+	"context"
 	"fmt"
 	"time"
 
-	"golang.org/x/net/context"
+	"github.com/dustin/go-humanize"
 )
 
 // Timer collects request and response timing information
@@ -18,18 +19,64 @@ type Timer struct {
 	tsResponseHeaders int64
 	// When the response is completely written
 	tsResponseDone int64
+	// The number of response body bytes written
+	bytes int64
+	// Time spent waiting for an upstream server, in nanoseconds
+	upstream int64
 }
 
 func (t Timer) String() string {
 	if t.tsRequestHeaders == 0 {
 		return "timer"
 	}
-	return fmt.Sprintf(
+	s := fmt.Sprintf(
 		"%.2fms total, %.2fms to response headers, %.2fms sending response body",
 		float64(t.tsResponseDone-t.tsRequestHeaders)/1000000.0,
 		float64(t.tsResponseHeaders-t.tsRequestHeaders)/1000000.0,
 		float64(t.tsResponseDone-t.tsResponseHeaders)/1000000.0,
 	)
+	if t.upstream > 0 {
+		s += fmt.Sprintf(", %.2fms upstream", float64(t.upstream)/1000000.0)
+	}
+	if rate := t.Rate(); rate > 0 {
+		s += fmt.Sprintf(" (%s at %s)", humanize.IBytes(uint64(t.bytes)), FormatRate(rate))
+	}
+	return s
+}
+
+// Rate returns the effective rate at which the response body was sent, in
+// bytes per second, or 0 if nothing was sent
+func (t Timer) Rate() float64 {
+	d := t.tsResponseDone - t.tsResponseHeaders
+	if t.bytes == 0 || d <= 0 {
+		return 0
+	}
+	return float64(t.bytes) / (float64(d) / float64(time.Second))
+}
+
+// ServerTiming describes the timings known so far as a Server-Timing header
+// value, for browser developer tools. Since the header goes out before the
+// body, it can only cover the time to the response headers.
+func (t Timer) ServerTiming() string {
+	if t.tsRequestHeaders == 0 {
+		return ""
+	}
+	s := fmt.Sprintf(
+		"devd;dur=%.2f;desc=\"devd\"",
+		float64(time.Now().UnixNano()-t.tsRequestHeaders)/1000000.0,
+	)
+	if t.upstream > 0 {
+		s += fmt.Sprintf(
+			", devd-upstream;dur=%.2f;desc=\"upstream\"",
+			float64(t.upstream)/1000000.0,
+		)
+	}
+	return s
+}
+
+// FormatRate formats a rate in bytes per second
+func FormatRate(rate float64) string {
+	return humanize.IBytes(uint64(rate)) + "/s"
 }
 
 // RequestHeaders sets the time at which request headers were received
@@ -47,6 +94,16 @@ func (t *Timer) ResponseDone() {
 	t.tsResponseDone = time.Now().UnixNano()
 }
 
+// Upstream adds to the time spent waiting for an upstream server
+func (t *Timer) Upstream(d time.Duration) {
+	t.upstream += int64(d)
+}
+
+// ResponseBody adds to the number of response body bytes written
+func (t *Timer) ResponseBody(n int) {
+	t.bytes += int64(n)
+}
+
 // NewContext creates a new context with the timer included
 func (t *Timer) NewContext(ctx context.Context) context.Context {
 	return context.WithValue(ctx, "timer", t)
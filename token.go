@@ -0,0 +1,86 @@
+package devd
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+)
+
+// The cookie that holds a hash of the access token for browsers
+const tokenCookie = "devd_token"
+
+// tokenAuth is a handler that requires a bearer token. Browsers can't easily
+// send an Authorization header, so a ?token= query parameter is also
+// accepted. This sets a cookie, and redirects to the same URL without the
+// token. Requests without a valid token are passed to fallback.
+type tokenAuth struct {
+	token    string
+	next     http.Handler
+	fallback http.Handler
+	// Called when a client presents an invalid token
+	failed func(r *http.Request, user string)
+}
+
+func (t *tokenAuth) cookieValue() string {
+	sum := sha256.Sum256([]byte("devd:" + t.token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (t *tokenAuth) matches(s string) bool {
+	given := sha256.Sum256([]byte(s))
+	want := sha256.Sum256([]byte(t.token))
+	return subtle.ConstantTimeCompare(given[:], want[:]) == 1
+}
+
+func (t *tokenAuth) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	const bearer = "Bearer "
+	if auth := r.Header.Get("Authorization"); len(auth) > len(bearer) && auth[:len(bearer)] == bearer {
+		if t.matches(auth[len(bearer):]) {
+			// The token is ours, so don't pass it upstream
+			r.Header.Del("Authorization")
+			t.next.ServeHTTP(w, r)
+			return
+		}
+		t.fail(r)
+	}
+	if c, err := r.Cookie(tokenCookie); err == nil {
+		if subtle.ConstantTimeCompare([]byte(c.Value), []byte(t.cookieValue())) == 1 {
+			t.next.ServeHTTP(w, r)
+			return
+		}
+	}
+	q := r.URL.Query()
+	token := q.Get("token")
+	if token != "" && !t.matches(token) {
+		t.fail(r)
+	}
+	if token != "" && t.matches(token) && (r.Method == "GET" || r.Method == "HEAD") {
+		http.SetCookie(w, &http.Cookie{
+			Name:     tokenCookie,
+			Value:    t.cookieValue(),
+			Path:     "/",
+			HttpOnly: true,
+		})
+		q.Del("token")
+		u := *r.URL
+		u.Scheme = ""
+		u.Host = ""
+		u.RawQuery = q.Encode()
+		http.Redirect(w, r, u.String(), http.StatusFound)
+		return
+	}
+	t.fallback.ServeHTTP(w, r)
+}
+
+func (t *tokenAuth) fail(r *http.Request) {
+	if t.failed != nil {
+		t.failed(r, "token")
+	}
+}
+
+// tokenUnauthorized is the fallback when only token authentication is enabled
+func tokenUnauthorized(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="Restricted"`)
+	http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+}
@@ -0,0 +1,54 @@
+package devd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTokenAuth(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" {
+			t.Errorf("Token was passed on: %s", r.Header.Get("Authorization"))
+		}
+	})
+	ta := &tokenAuth{"secret", next, http.HandlerFunc(tokenUnauthorized), nil}
+
+	var tokenTests = []struct {
+		url      string
+		header   string
+		cookie   string
+		status   int
+		location string
+	}{
+		{"/foo", "", "", http.StatusUnauthorized, ""},
+		{"/foo", "Bearer secret", "", http.StatusOK, ""},
+		{"/foo", "Bearer wrong", "", http.StatusUnauthorized, ""},
+		{"/foo", "", ta.cookieValue(), http.StatusOK, ""},
+		{"/foo", "", "wrong", http.StatusUnauthorized, ""},
+		{"/foo?a=b&token=secret", "", "", http.StatusFound, "/foo?a=b"},
+		{"/foo?token=wrong", "", "", http.StatusUnauthorized, ""},
+	}
+	for i, tt := range tokenTests {
+		r := httptest.NewRequest("GET", tt.url, nil)
+		if tt.header != "" {
+			r.Header.Set("Authorization", tt.header)
+		}
+		if tt.cookie != "" {
+			r.AddCookie(&http.Cookie{Name: tokenCookie, Value: tt.cookie})
+		}
+		w := httptest.NewRecorder()
+		ta.ServeHTTP(w, r)
+		if w.Code != tt.status {
+			t.Errorf("Test %d: expected status %d, got %d", i, tt.status, w.Code)
+		}
+		if tt.location != "" {
+			if w.Header().Get("Location") != tt.location {
+				t.Errorf("Test %d: unexpected redirect to %s", i, w.Header().Get("Location"))
+			}
+			if w.Header().Get("Set-Cookie") == "" {
+				t.Errorf("Test %d: expected a cookie to be set", i)
+			}
+		}
+	}
+}
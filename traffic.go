@@ -0,0 +1,196 @@
+package devd
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	humanize "github.com/dustin/go-humanize"
+
+	"github.com/cortesi/devd/httpctx"
+	"github.com/cortesi/termlog"
+)
+
+// statsPath is the control endpoint that serves the traffic totals
+const statsPath = "/.devd/stats"
+
+// The number of heaviest paths listed in traffic summaries
+const trafficTopPaths = 10
+
+// TrafficCount is the traffic through a route or path. In and Out count the
+// bytes of request and response bodies.
+type TrafficCount struct {
+	Name     string `json:"name"`
+	Requests int64  `json:"requests"`
+	In       int64  `json:"in"`
+	Out      int64  `json:"out"`
+}
+
+// TrafficStats is a summary of the traffic a server has handled
+type TrafficStats struct {
+	// Every route, heaviest first
+	Routes []TrafficCount `json:"routes"`
+	// The heaviest paths, heaviest first
+	Paths []TrafficCount `json:"paths"`
+}
+
+// traffic totals the bytes going in and out of each route and path
+type traffic struct {
+	sync.Mutex
+	routes map[string]*TrafficCount
+	paths  map[string]*TrafficCount
+}
+
+func newTraffic() *traffic {
+	return &traffic{
+		routes: make(map[string]*TrafficCount),
+		paths:  make(map[string]*TrafficCount),
+	}
+}
+
+func addTraffic(counts map[string]*TrafficCount, name string, in, out int64) {
+	c, ok := counts[name]
+	if !ok {
+		c = &TrafficCount{Name: name}
+		counts[name] = c
+	}
+	c.Requests++
+	c.In += in
+	c.Out += out
+}
+
+func (t *traffic) add(route, path string, in, out int64) {
+	t.Lock()
+	defer t.Unlock()
+	addTraffic(t.routes, route, in, out)
+	addTraffic(t.paths, path, in, out)
+}
+
+// heaviest lists counts by the bytes sent, then received, most first. At
+// most n are returned, or all of them if n is 0.
+func heaviest(counts map[string]*TrafficCount, n int) []TrafficCount {
+	ret := make([]TrafficCount, 0, len(counts))
+	for _, c := range counts {
+		ret = append(ret, *c)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Out != ret[j].Out {
+			return ret[i].Out > ret[j].Out
+		}
+		if ret[i].In != ret[j].In {
+			return ret[i].In > ret[j].In
+		}
+		return ret[i].Name < ret[j].Name
+	})
+	if n > 0 && len(ret) > n {
+		ret = ret[:n]
+	}
+	return ret
+}
+
+func (t *traffic) stats(top int) TrafficStats {
+	t.Lock()
+	defer t.Unlock()
+	return TrafficStats{
+		Routes: heaviest(t.routes, 0),
+		Paths:  heaviest(t.paths, top),
+	}
+}
+
+// trafficWriter counts the bytes of a response body
+type trafficWriter struct {
+	http.ResponseWriter
+	n int64
+}
+
+func (tw *trafficWriter) Write(data []byte) (int, error) {
+	n, err := tw.ResponseWriter.Write(data)
+	tw.n += int64(n)
+	return n, err
+}
+
+func (tw *trafficWriter) Flush() {
+	if f, ok := tw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// handler counts the traffic of a route's requests. Websocket connections
+// aren't counted.
+func (t *traffic) handler(route string, next httpctx.Handler) httpctx.Handler {
+	return httpctx.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "" {
+			next.ServeHTTPContext(ctx, w, r)
+			return
+		}
+		// The route's handlers strip its prefix from the path in place. Paths
+		// on routes with a host are keyed by host too, as the routes are.
+		path := r.URL.Path
+		if i := strings.Index(route, "/"); i > 0 {
+			path = route[:i] + path
+		}
+		var body *countingBody
+		if r.Body != nil && r.Body != http.NoBody {
+			body = &countingBody{ReadCloser: r.Body}
+			r.Body = body
+		}
+		tw := &trafficWriter{ResponseWriter: w}
+		next.ServeHTTPContext(ctx, tw, r)
+		in := int64(0)
+		if body != nil {
+			in = body.count()
+		}
+		t.add(route, path, in, tw.n)
+	})
+}
+
+// report logs the traffic totals
+func (t *traffic) report(logger termlog.TermLog) {
+	s := t.stats(trafficTopPaths)
+	if len(s.Routes) == 0 {
+		return
+	}
+	log := logger.Group()
+	defer log.Done()
+	for _, c := range s.Routes {
+		log.Say(
+			"route %s: %d requests, %s in, %s out",
+			c.Name, c.Requests, humanize.Bytes(uint64(c.In)), humanize.Bytes(uint64(c.Out)),
+		)
+	}
+	for _, c := range s.Paths {
+		log.Say(
+			"%s out, %s in, %d requests %s",
+			humanize.Bytes(uint64(c.Out)), humanize.Bytes(uint64(c.In)), c.Requests, c.Name,
+		)
+	}
+}
+
+// Traffic returns the traffic totals, with up to top of the heaviest paths.
+// It returns nil unless the Traffic option is on and the server has started.
+func (dd *Devd) Traffic(top int) *TrafficStats {
+	if dd.traffic == nil {
+		return nil
+	}
+	s := dd.traffic.stats(top)
+	return &s
+}
+
+// serveStats serves the traffic totals as JSON. The "top" parameter sets how
+// many paths are listed.
+func (dd *Devd) serveStats(w http.ResponseWriter, r *http.Request) {
+	top := trafficTopPaths
+	if v := r.FormValue("top"); v != "" {
+		var err error
+		if top, err = strconv.Atoi(v); err != nil || top < 0 {
+			http.Error(w, "Invalid top parameter", http.StatusBadRequest)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(dd.Traffic(top))
+}
@@ -0,0 +1,97 @@
+package devd
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/GeertJohan/go.rice"
+	"github.com/cortesi/devd/ricetemp"
+	"github.com/cortesi/termlog"
+)
+
+func TestTraffic(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "devdtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	files := map[string]string{
+		"big.js":   strings.Repeat("x", 1000),
+		"small.js": "x",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(tmp, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Write(body)
+		w.Write(body)
+	}))
+	defer backend.Close()
+	logger := termlog.NewLog()
+	logger.Quiet()
+	templates := ricetemp.MustMakeTemplates(rice.MustFindBox("templates"))
+
+	devd := Devd{CountTraffic: true, RemoteControl: true}
+	if devd.Traffic(0) != nil {
+		t.Error("Expected no totals before the server starts")
+	}
+	routes := []string{"/=" + tmp, "/api/=" + backend.URL, "static/=" + tmp}
+	if err := devd.AddRoutes(routes, nil); err != nil {
+		t.Fatal(err)
+	}
+	h, err := devd.Router(logger, templates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer devd.shutdown()
+	ht := handlerTester{t, h}
+	ht.Request("GET", "/big.js", nil)
+	ht.Request("GET", "/big.js", nil)
+	ht.Request("GET", "/small.js", nil)
+	// The form is 5 bytes, echoed twice
+	ht.Request("POST", "/api/echo", url.Values{"a": {"bcd"}})
+	ht.Request("GET", "http://static.devd.io/small.js", nil)
+
+	expected := TrafficStats{
+		Routes: []TrafficCount{
+			{"/", 3, 0, 2001},
+			{"/api/", 1, 5, 10},
+			{"static.devd.io/", 1, 0, 1},
+		},
+		Paths: []TrafficCount{
+			{"/big.js", 2, 0, 2000},
+		},
+	}
+	if got := devd.Traffic(1); !reflect.DeepEqual(*got, expected) {
+		t.Errorf("Expected %v, got %v", expected, *got)
+	}
+
+	found := false
+	for _, c := range devd.Traffic(0).Paths {
+		found = found || c.Name == "static.devd.io/small.js"
+	}
+	if !found {
+		t.Errorf("Expected paths on a host route to be keyed by host, got %v", devd.Traffic(0).Paths)
+	}
+
+	resp := ht.Request("GET", statsPath+"?top=1", nil)
+	got := TrafficStats{}
+	if err := json.Unmarshal(resp.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v from the endpoint, got %v", expected, got)
+	}
+	AssertCode(t, ht.Request("GET", statsPath+"?top=x", nil), http.StatusBadRequest)
+}
@@ -0,0 +1,277 @@
+package devd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/cortesi/devd/httpctx"
+	"github.com/cortesi/devd/inject"
+	"github.com/cortesi/termlog"
+)
+
+// transformTimeout is how long a transform command may run before it's
+// killed, and the request or response is passed on unchanged
+var transformTimeout = time.Second * 5
+
+// A Transform is a shell command that can rewrite the requests and responses
+// of a route. The command is an external process, started twice for each
+// request - once before the request is handled, and once before the response
+// is sent. Each time it gets a JSON description of the request (and response)
+// on stdin, and can print a JSON description of changes to make on stdout.
+type Transform struct {
+	// The MuxMatch of the route the transform applies to, or empty for all
+	// routes
+	Scope   string
+	Command string
+}
+
+// AddTransforms adds transforms from specifications of the form
+// [ROUTE@]COMMAND
+func (dd *Devd) AddTransforms(specs []string) error {
+	for _, s := range specs {
+		scope, cmd := splitRouteScope(s, dd.Routes)
+		if strings.TrimSpace(cmd) == "" {
+			return fmt.Errorf("Empty transform command: %s", s)
+		}
+		dd.Transforms = append(dd.Transforms, Transform{scope, cmd})
+	}
+	return nil
+}
+
+// transformsFor returns the transforms that apply to a route
+func (dd *Devd) transformsFor(match string) []Transform {
+	ret := []Transform{}
+	for _, t := range dd.Transforms {
+		if t.Scope == "" || t.Scope == match {
+			ret = append(ret, t)
+		}
+	}
+	return ret
+}
+
+type transformRequest struct {
+	Method  string      `json:"method"`
+	URL     string      `json:"url"`
+	Path    string      `json:"path"`
+	Headers http.Header `json:"headers"`
+	// Missing if the body isn't UTF-8 text
+	Body *string `json:"body"`
+}
+
+type transformResponse struct {
+	Status  int         `json:"status"`
+	Headers http.Header `json:"headers"`
+	Body    *string     `json:"body"`
+}
+
+// transformEvent is what a transform command gets on stdin
+type transformEvent struct {
+	// "request" or "response"
+	Phase    string             `json:"phase"`
+	Request  transformRequest   `json:"request"`
+	Response *transformResponse `json:"response,omitempty"`
+}
+
+// transformEdit describes changes to a request or response. Empty fields are
+// left alone.
+type transformEdit struct {
+	// Requests only
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	// Responses only
+	Status int `json:"status"`
+
+	Headers       map[string]string `json:"headers"`
+	RemoveHeaders []string          `json:"remove_headers"`
+	Body          *string           `json:"body"`
+}
+
+// transformResult is what a transform command prints on stdout. A response
+// in the request phase is sent straight back, without handling the request.
+type transformResult struct {
+	Request  *transformEdit `json:"request"`
+	Response *transformEdit `json:"response"`
+}
+
+func textBody(b []byte) *string {
+	if !utf8.Valid(b) {
+		return nil
+	}
+	s := string(b)
+	return &s
+}
+
+func (e *transformEdit) applyHeaders(h http.Header) {
+	for _, k := range e.RemoveHeaders {
+		h.Del(k)
+	}
+	for k, v := range e.Headers {
+		h.Set(k, v)
+	}
+}
+
+// run runs a transform command. It returns nil if the command failed or
+// printed nothing, in which case nothing should change.
+func (t Transform) run(ctx context.Context, log termlog.Logger, ev transformEvent) *transformResult {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		log.Warn("transform: could not encode event: %s", err)
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, transformTimeout)
+	defer cancel()
+	stdout, stderr, err := runCommand(ctx, t.Command, append(data, '\n'))
+	if ctx.Err() != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			log.Warn("transform: %s: killed after %s", t.Command, transformTimeout)
+		}
+		return nil
+	}
+	if s := strings.TrimSpace(string(stderr)); s != "" {
+		log.Say("transform: %s", s)
+	}
+	if err != nil {
+		log.Warn("transform: %s: %s", t.Command, err)
+		return nil
+	}
+	if len(bytes.TrimSpace(stdout)) == 0 {
+		return nil
+	}
+	res := &transformResult{}
+	if err := json.Unmarshal(stdout, res); err != nil {
+		log.Warn("transform: %s: invalid output: %s", t.Command, err)
+		return nil
+	}
+	return res
+}
+
+// bufferedResponse holds a response until the transform has seen it. It
+// shares its header map with the real ResponseWriter, which isn't written to
+// until the response is sent.
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (br *bufferedResponse) Header() http.Header {
+	return br.header
+}
+
+func (br *bufferedResponse) WriteHeader(code int) {
+	if br.status == 0 && code >= 200 {
+		br.status = code
+	}
+}
+
+func (br *bufferedResponse) Write(data []byte) (int, error) {
+	if br.status == 0 {
+		br.status = http.StatusOK
+	}
+	return br.body.Write(data)
+}
+
+// apply edits the response. A new body invalidates the validators of the
+// old one, unless the edit sets them itself.
+func (br *bufferedResponse) apply(e *transformEdit) {
+	if e.Status != 0 {
+		br.status = e.Status
+	}
+	if e.Body != nil {
+		br.body.Reset()
+		br.body.WriteString(*e.Body)
+		br.header.Del("Content-Length")
+		inject.BodyChanged(br.header)
+	}
+	e.applyHeaders(br.header)
+}
+
+func (br *bufferedResponse) send(w http.ResponseWriter) {
+	if br.status == 0 {
+		br.status = http.StatusOK
+	}
+	if br.header.Get("Content-Length") != "" || br.header.Get("Content-Encoding") == "" {
+		br.header.Set("Content-Length", strconv.Itoa(br.body.Len()))
+	}
+	w.WriteHeader(br.status)
+	w.Write(br.body.Bytes())
+}
+
+func describeRequest(r *http.Request, body []byte) transformRequest {
+	return transformRequest{
+		Method:  r.Method,
+		URL:     r.URL.String(),
+		Path:    r.URL.Path,
+		Headers: r.Header,
+		Body:    textBody(body),
+	}
+}
+
+// handler wraps a route handler so that the transform sees its requests and
+// responses. Websocket upgrades are passed straight through.
+func (t Transform) handler(next httpctx.Handler) httpctx.Handler {
+	return httpctx.HandlerFunc(func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "" {
+			next.ServeHTTPContext(ctx, w, r)
+			return
+		}
+		log := termlog.FromContext(ctx)
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, "Could not read request body", http.StatusBadRequest)
+			return
+		}
+
+		res := t.run(ctx, log, transformEvent{Phase: "request", Request: describeRequest(r, body)})
+		if res != nil && res.Request != nil {
+			e := res.Request
+			if e.Method != "" {
+				r.Method = e.Method
+			}
+			if e.Path != "" {
+				r.URL.Path = e.Path
+				r.URL.RawPath = ""
+			}
+			e.applyHeaders(r.Header)
+			if e.Body != nil {
+				body = []byte(*e.Body)
+				r.ContentLength = int64(len(body))
+				r.Header.Del("Content-Length")
+			}
+		}
+		br := &bufferedResponse{header: w.Header()}
+		if res != nil && res.Response != nil {
+			log.Say("transform: synthetic response")
+			br.apply(res.Response)
+			br.send(w)
+			return
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+		next.ServeHTTPContext(ctx, br, r)
+
+		ev := transformEvent{
+			Phase:   "response",
+			Request: describeRequest(r, body),
+			Response: &transformResponse{
+				Status:  br.status,
+				Headers: br.header,
+				Body:    textBody(br.body.Bytes()),
+			},
+		}
+		if ev.Response.Status == 0 {
+			ev.Response.Status = http.StatusOK
+		}
+		if res := t.run(ctx, log, ev); res != nil && res.Response != nil {
+			br.apply(res.Response)
+		}
+		br.send(w)
+	})
+}
@@ -0,0 +1,135 @@
+package devd
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cortesi/devd/httpctx"
+	"github.com/cortesi/termlog"
+)
+
+// A transform command that answers each phase with its own JSON
+func phaseCommand(request, response string) string {
+	return fmt.Sprintf(
+		`ev=$(cat); case "$ev" in *'"phase":"request"'*) echo '%s';; *) echo '%s';; esac`,
+		request, response,
+	)
+}
+
+var echoHandler = httpctx.HandlerFunc(
+	func(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("X-Method", r.Method)
+		w.Header().Set("X-Added", r.Header.Get("X-Added"))
+		w.Header().Set("Etag", `"v1"`)
+		w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+		w.Header().Set("Content-Length", fmt.Sprint(len(r.URL.Path)+len(body)))
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprint(w, r.URL.Path)
+		w.Write(body)
+	},
+)
+
+func TestTransform(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Transform tests need a POSIX shell")
+	}
+	logger := termlog.NewLog()
+	logger.Quiet()
+	ctx := termlog.NewContext(context.Background(), logger)
+	defer func(d time.Duration) { transformTimeout = d }(transformTimeout)
+	transformTimeout = time.Millisecond * 200
+
+	var transformTests = []struct {
+		command string
+		body    string
+		code    int
+		resp    string
+		headers map[string]string
+	}{
+		{"true", "data", http.StatusAccepted, "/foodata", map[string]string{"X-Method": "POST", "Etag": `"v1"`}},
+		{"sleep 5", "data", http.StatusAccepted, "/foodata", nil},
+		{"exit 1", "data", http.StatusAccepted, "/foodata", nil},
+		{"echo nonsense", "data", http.StatusAccepted, "/foodata", nil},
+		{
+			phaseCommand(
+				`{"request":{"method":"PUT","path":"/bar","headers":{"X-Added":"yes"},"body":"new"}}`,
+				`{}`,
+			),
+			"data", http.StatusAccepted, "/barnew",
+			map[string]string{"X-Method": "PUT", "X-Added": "yes", "Content-Length": "7"},
+		},
+		{
+			phaseCommand(
+				`{}`,
+				`{"response":{"status":200,"headers":{"X-New":"1"},"remove_headers":["X-Method"],"body":"rewritten"}}`,
+			),
+			"data", http.StatusOK, "rewritten",
+			map[string]string{
+				"X-Method": "", "X-New": "1", "Content-Length": "9",
+				"Etag": `W/"v1+devd"`, "Last-Modified": "",
+			},
+		},
+		{
+			phaseCommand(`{"response":{"status":418,"body":"short"}}`, `{"response":{"body":"never"}}`),
+			"data", http.StatusTeapot, "short",
+			map[string]string{"X-Method": ""},
+		},
+		{
+			`grep -q '"body":"/foodata"' && echo '{"response":{"body":"saw body"}}'`,
+			"data", http.StatusAccepted, "saw body", nil,
+		},
+	}
+	for i, tt := range transformTests {
+		h := Transform{Command: tt.command}.handler(echoHandler)
+		req := httptest.NewRequest("POST", "/foo", strings.NewReader(tt.body))
+		rr := httptest.NewRecorder()
+		h.ServeHTTPContext(ctx, rr, req)
+		if rr.Code != tt.code {
+			t.Errorf("Test %d: expected code %d, got %d", i, tt.code, rr.Code)
+		}
+		if rr.Body.String() != tt.resp {
+			t.Errorf("Test %d: expected body %q, got %q", i, tt.resp, rr.Body.String())
+		}
+		for k, v := range tt.headers {
+			if rr.Header().Get(k) != v {
+				t.Errorf("Test %d: expected %s %q, got %q", i, k, v, rr.Header().Get(k))
+			}
+		}
+	}
+}
+
+func TestAddTransforms(t *testing.T) {
+	dd := Devd{}
+	if err := dd.AddRoutes([]string{"./static", "/api/=http://localhost:8888"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := dd.AddTransforms([]string{"/api/@"}); err == nil {
+		t.Error("Expected error for an empty command")
+	}
+	dd.Transforms = nil
+	if err := dd.AddTransforms([]string{"cat", "/api/@jq ."}); err != nil {
+		t.Fatal(err)
+	}
+	if len(dd.transformsFor("/")) != 1 {
+		t.Errorf("Expected one transform for /, got %v", dd.transformsFor("/"))
+	}
+	if tr := dd.transformsFor("/api/"); len(tr) != 2 || tr[1].Command != "jq ." {
+		t.Errorf("Unexpected transforms for /api/: %v", tr)
+	}
+	// A prefix that isn't a route's anchor is part of the command
+	dd.Transforms = nil
+	if err := dd.AddTransforms([]string{"/app/@cat"}); err != nil {
+		t.Fatal(err)
+	}
+	if tr := dd.transformsFor("/"); len(tr) != 1 || tr[0].Command != "/app/@cat" {
+		t.Errorf("Unexpected transforms for /: %v", tr)
+	}
+}
@@ -0,0 +1,97 @@
+package devd
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+)
+
+type contextKey string
+
+// The scheme a trusted proxy says the client used
+const forwardedProtoKey = contextKey("forwardedProto")
+
+// AddTrustedProxies adds CIDR ranges of proxies whose X-Forwarded headers we
+// believe
+func (dd *Devd) AddTrustedProxies(specs []string) error {
+	nets, err := parseIPNets(specs)
+	if err != nil {
+		return err
+	}
+	dd.TrustProxy = append(dd.TrustProxy, nets...)
+	return nil
+}
+
+// forwardedClient finds the client address in an X-Forwarded-For chain. We
+// walk the chain from the right, for as long as the addresses are trusted
+// proxies. It returns the client, and the remaining entries to its left,
+// which we have no way to verify.
+func forwardedClient(remote net.IP, xff string, trusted []*net.IPNet) (net.IP, []string) {
+	parts := strings.Split(xff, ",")
+	client := remote
+	n := len(parts)
+	for n > 0 && ipInAny(client, trusted) {
+		ip := net.ParseIP(strings.TrimSpace(parts[n-1]))
+		if ip == nil {
+			break
+		}
+		client = ip
+		n--
+	}
+	return client, parts[:n]
+}
+
+// firstHeaderValue returns the first of a comma-separated list of header
+// values, which is what the outermost proxy saw
+func firstHeaderValue(v string) string {
+	return strings.TrimSpace(strings.SplitN(v, ",", 2)[0])
+}
+
+// trustProxy rewrites requests from trusted proxies so that they look like
+// they came from the original client: the remote address, host and scheme are
+// taken from the X-Forwarded-For, X-Forwarded-Host and X-Forwarded-Proto
+// headers. The forwarding headers we've used are removed, so our reverse
+// proxy regenerates them from the rewritten request.
+func (dd *Devd) trustProxy(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, port, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		remote := net.ParseIP(host)
+		if remote == nil || !ipInAny(remote, dd.TrustProxy) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+			client, rest := forwardedClient(remote, xff, dd.TrustProxy)
+			r.RemoteAddr = net.JoinHostPort(client.String(), port)
+			if len(rest) > 0 {
+				r.Header.Set("X-Forwarded-For", strings.Join(rest, ","))
+			} else {
+				r.Header.Del("X-Forwarded-For")
+			}
+		}
+		if fh := firstHeaderValue(r.Header.Get("X-Forwarded-Host")); fh != "" {
+			r.Host = fh
+			r.Header.Del("X-Forwarded-Host")
+		}
+		switch proto := strings.ToLower(firstHeaderValue(r.Header.Get("X-Forwarded-Proto"))); proto {
+		case "http", "https":
+			r = r.WithContext(context.WithValue(r.Context(), forwardedProtoKey, proto))
+			r.Header.Del("X-Forwarded-Proto")
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requestScheme is the scheme the client used to talk to us, which is the
+// serving scheme unless a trusted proxy told us otherwise
+func (dd *Devd) requestScheme(r *http.Request) string {
+	if proto, ok := r.Context().Value(forwardedProtoKey).(string); ok {
+		return proto
+	}
+	return dd.ServingScheme
+}
@@ -0,0 +1,68 @@
+package devd
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+var forwardedClientTests = []struct {
+	remote string
+	xff    string
+	client string
+	rest   []string
+}{
+	{"10.0.0.1", "1.2.3.4", "1.2.3.4", []string{}},
+	{"10.0.0.1", "5.5.5.5, 1.2.3.4", "1.2.3.4", []string{"5.5.5.5"}},
+	{"10.0.0.1", "1.2.3.4, 10.0.0.2", "1.2.3.4", []string{}},
+	{"10.0.0.1", "garbage, 10.0.0.2", "10.0.0.2", []string{"garbage"}},
+	{"1.1.1.1", "1.2.3.4", "1.1.1.1", []string{"1.2.3.4"}},
+}
+
+func TestForwardedClient(t *testing.T) {
+	trusted, _ := parseIPNets([]string{"10.0.0.0/8"})
+	for i, tt := range forwardedClientTests {
+		client, rest := forwardedClient(net.ParseIP(tt.remote), tt.xff, trusted)
+		if client.String() != tt.client || !reflect.DeepEqual(rest, tt.rest) {
+			t.Errorf("Test %d: got %s %#v", i, client, rest)
+		}
+	}
+}
+
+func TestTrustProxy(t *testing.T) {
+	dd := Devd{ServingScheme: "http"}
+	if err := dd.AddTrustedProxies([]string{"10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := dd.AddTrustedProxies([]string{"nonsense"}); err == nil {
+		t.Error("Expected error for invalid range")
+	}
+	var seen *http.Request
+	h := dd.trustProxy(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r
+	}))
+	request := func(remote string) *http.Request {
+		r := httptest.NewRequest("GET", "http://devd.io/", nil)
+		r.RemoteAddr = remote + ":1234"
+		r.Header.Set("X-Forwarded-For", "1.2.3.4")
+		r.Header.Set("X-Forwarded-Host", "example.com, other.com")
+		r.Header.Set("X-Forwarded-Proto", "https")
+		h.ServeHTTP(httptest.NewRecorder(), r)
+		return seen
+	}
+
+	r := request("10.1.1.1")
+	if r.RemoteAddr != "1.2.3.4:1234" || r.Host != "example.com" || dd.requestScheme(r) != "https" {
+		t.Errorf("Forwarded headers not applied: %s %s %s", r.RemoteAddr, r.Host, dd.requestScheme(r))
+	}
+	if r.Header.Get("X-Forwarded-For") != "" || r.Header.Get("X-Forwarded-Host") != "" {
+		t.Errorf("Forwarded headers not removed: %v", r.Header)
+	}
+
+	r = request("1.1.1.1")
+	if r.RemoteAddr != "1.1.1.1:1234" || r.Host != "devd.io" || dd.requestScheme(r) != "http" {
+		t.Errorf("Untrusted forwarded headers applied: %s %s %s", r.RemoteAddr, r.Host, dd.requestScheme(r))
+	}
+}
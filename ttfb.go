@@ -0,0 +1,126 @@
+package devd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A TTFB delays the headers of responses, simulating a server that is slow to
+// start answering. Unlike Latency, the delay comes after the request has been
+// handled, and only holds up the headers - a body that's streamed still
+// arrives as it's written.
+type TTFB struct {
+	// A media type like "text/html", a wildcard like "image/*", or empty for
+	// all responses
+	ContentType string
+	Delay       time.Duration
+}
+
+// AddTTFBs adds time to first byte delays from specifications of the form
+// [TYPE=]MILLISECONDS
+func (dd *Devd) AddTTFBs(specs []string) error {
+	for _, s := range specs {
+		ct, ms := "", s
+		if i := strings.LastIndex(s, "="); i >= 0 {
+			ct, ms = strings.ToLower(strings.TrimSpace(s[:i])), s[i+1:]
+			if !strings.Contains(ct, "/") {
+				return fmt.Errorf("Invalid ttfb %s: expected a media type like text/html", s)
+			}
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(ms))
+		if err != nil || n < 0 {
+			return fmt.Errorf("Invalid ttfb %s: expected a number of milliseconds", s)
+		}
+		dd.TTFB = append(dd.TTFB, TTFB{ct, time.Duration(n) * time.Millisecond})
+	}
+	return nil
+}
+
+// ttfbFor finds the delay for a content type. An exact media type beats a
+// wildcard, which beats a delay for all responses.
+func ttfbFor(ttfbs []TTFB, contentType string) time.Duration {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mt = ""
+	}
+	wildcard := ""
+	if i := strings.Index(mt, "/"); i >= 0 {
+		wildcard = mt[:i] + "/*"
+	}
+	best, rank := time.Duration(0), 0
+	for _, t := range ttfbs {
+		r := 0
+		switch {
+		case mt != "" && t.ContentType == mt:
+			r = 3
+		case wildcard != "" && t.ContentType == wildcard:
+			r = 2
+		case t.ContentType == "":
+			r = 1
+		}
+		if r > rank {
+			best, rank = t.Delay, r
+		}
+	}
+	return best
+}
+
+// ttfbWriter holds up the response header for the delay that applies to its
+// content type
+type ttfbWriter struct {
+	http.ResponseWriter
+	ctx         context.Context
+	ttfbs       []TTFB
+	wroteHeader bool
+}
+
+func (tw *ttfbWriter) WriteHeader(code int) {
+	if tw.wroteHeader {
+		return
+	}
+	if code >= 100 && code < 200 {
+		tw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	tw.wroteHeader = true
+	if d := ttfbFor(tw.ttfbs, tw.Header().Get("Content-Type")); d > 0 {
+		t := time.NewTimer(d)
+		select {
+		case <-t.C:
+		case <-tw.ctx.Done():
+			t.Stop()
+		}
+	}
+	tw.ResponseWriter.WriteHeader(code)
+}
+
+func (tw *ttfbWriter) Write(data []byte) (int, error) {
+	if !tw.wroteHeader {
+		if tw.Header().Get("Content-Type") == "" {
+			tw.Header().Set("Content-Type", http.DetectContentType(data))
+		}
+		tw.WriteHeader(http.StatusOK)
+	}
+	return tw.ResponseWriter.Write(data)
+}
+
+// Flush sends the header, so it has to wait out the delay too
+func (tw *ttfbWriter) Flush() {
+	if !tw.wroteHeader {
+		tw.WriteHeader(http.StatusOK)
+	}
+	if f, ok := tw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (tw *ttfbWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return hijack(tw.ResponseWriter)
+}
@@ -0,0 +1,113 @@
+package devd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/GeertJohan/go.rice"
+	"github.com/cortesi/devd/ricetemp"
+	"github.com/cortesi/termlog"
+)
+
+var addTTFBsTests = []struct {
+	spec   string
+	expect TTFB
+	err    bool
+}{
+	{"300", TTFB{"", 300 * time.Millisecond}, false},
+	{"text/html=50", TTFB{"text/html", 50 * time.Millisecond}, false},
+	{"Image/*=0", TTFB{"image/*", 0}, false},
+	{"html=50", TTFB{}, true},
+	{"text/html=", TTFB{}, true},
+	{"-1", TTFB{}, true},
+	{"1s", TTFB{}, true},
+}
+
+func TestAddTTFBs(t *testing.T) {
+	for i, tt := range addTTFBsTests {
+		dd := Devd{}
+		err := dd.AddTTFBs([]string{tt.spec})
+		if (err != nil) != tt.err {
+			t.Errorf("Test %d: expected error %v, got %v", i, tt.err, err)
+			continue
+		}
+		if !tt.err && dd.TTFB[0] != tt.expect {
+			t.Errorf("Test %d: expected %v, got %v", i, tt.expect, dd.TTFB[0])
+		}
+	}
+}
+
+var ttfbForTests = []struct {
+	contentType string
+	expect      time.Duration
+}{
+	{"text/html; charset=utf-8", 3},
+	{"image/png", 2},
+	{"application/javascript", 1},
+	{"", 1},
+}
+
+func TestTTFBFor(t *testing.T) {
+	ttfbs := []TTFB{{"", 1}, {"image/*", 2}, {"text/html", 3}}
+	for i, tt := range ttfbForTests {
+		if got := ttfbFor(ttfbs, tt.contentType); got != tt.expect {
+			t.Errorf("Test %d: expected %s, got %s", i, tt.expect, got)
+		}
+	}
+	if got := ttfbFor([]TTFB{{"text/html", 3}}, "image/png"); got != 0 {
+		t.Errorf("Expected no delay, got %s", got)
+	}
+}
+
+func TestTTFB(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "devdtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	files := map[string]string{
+		"index.html": "<html></html>",
+		"app.js":     "var x;",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(tmp, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	logger := termlog.NewLog()
+	logger.Quiet()
+	templates := ricetemp.MustMakeTemplates(rice.MustFindBox("templates"))
+
+	delay := 100 * time.Millisecond
+	devd := Devd{}
+	if err := devd.AddTTFBs([]string{"text/html=100"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := devd.AddRoutes([]string{tmp}, nil); err != nil {
+		t.Fatal(err)
+	}
+	h, err := devd.Router(logger, templates)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ht := handlerTester{t, h}
+
+	start := time.Now()
+	resp := ht.Request("GET", "/", nil)
+	if elapsed := time.Since(start); elapsed < delay {
+		t.Errorf("Expected the page to take at least %s, took %s", delay, elapsed)
+	}
+	AssertCode(t, resp, 200)
+
+	start = time.Now()
+	resp = ht.Request("GET", "/app.js", nil)
+	if elapsed := time.Since(start); elapsed >= delay {
+		t.Errorf("Expected the script not to be delayed, took %s", elapsed)
+	}
+	if resp.Body.String() != files["app.js"] {
+		t.Errorf("Unexpected body: %q", resp.Body.String())
+	}
+}
@@ -0,0 +1,224 @@
+// Package tunnel exposes a local server to the internet through an SSH reverse
+// tunnel to a relay host. This works with public relays like localhost.run,
+// and with any self-hosted SSH server that permits remote port forwarding.
+package tunnel
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cortesi/termlog"
+	"github.com/mitchellh/go-homedir"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const (
+	defaultUser = "devd"
+	defaultPort = "22"
+	// The port we ask the relay to forward to us
+	remotePort = 80
+	// How long we wait for the relay to tell us the public URL
+	urlWait = time.Second * 5
+)
+
+var urlRegexp = regexp.MustCompile(`https://[^\s"'<>]+`)
+
+// Tunnel is an established reverse tunnel
+type Tunnel struct {
+	// URL is the public URL of the tunnel, if the relay reported one
+	URL string
+
+	client   *ssh.Client
+	listener net.Listener
+	log      termlog.Logger
+}
+
+// Parse a [user@]host[:port] relay specification
+func parseSpec(spec string) (user string, addr string, err error) {
+	user = defaultUser
+	if i := strings.LastIndex(spec, "@"); i >= 0 {
+		user = spec[:i]
+		spec = spec[i+1:]
+	}
+	if spec == "" || user == "" {
+		return "", "", fmt.Errorf("Invalid tunnel specification")
+	}
+	if _, _, err := net.SplitHostPort(spec); err != nil {
+		spec = net.JoinHostPort(spec, defaultPort)
+	}
+	return user, spec, nil
+}
+
+// authMethods offers the SSH agent's keys, unencrypted keys from ~/.ssh, and
+// an empty keyboard-interactive response, which is what public relays expect
+// from clients without keys.
+func authMethods() []ssh.AuthMethod {
+	methods := []ssh.AuthMethod{}
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			methods = append(methods, ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+		}
+	}
+	if home, err := homedir.Dir(); err == nil {
+		signers := []ssh.Signer{}
+		for _, name := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+			data, err := ioutil.ReadFile(path.Join(home, ".ssh", name))
+			if err != nil {
+				continue
+			}
+			if s, err := ssh.ParsePrivateKey(data); err == nil {
+				signers = append(signers, s)
+			}
+		}
+		if len(signers) > 0 {
+			methods = append(methods, ssh.PublicKeys(signers...))
+		}
+	}
+	methods = append(
+		methods,
+		ssh.KeyboardInteractive(
+			func(user, instruction string, questions []string, echos []bool) ([]string, error) {
+				return make([]string, len(questions)), nil
+			},
+		),
+	)
+	return methods
+}
+
+// hostKeyCallback checks host keys against ~/.ssh/known_hosts. Hosts that
+// aren't listed are refused, unless insecure is set, in which case they're
+// accepted with a warning. A mismatched key for a known host is always an
+// error.
+func hostKeyCallback(log termlog.Logger, insecure bool) ssh.HostKeyCallback {
+	var known ssh.HostKeyCallback
+	if home, err := homedir.Dir(); err == nil {
+		known, _ = knownhosts.New(path.Join(home, ".ssh", "known_hosts"))
+	}
+	return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		if known != nil {
+			err := known(hostname, remote, key)
+			kerr, ok := err.(*knownhosts.KeyError)
+			if err == nil || !ok || len(kerr.Want) > 0 {
+				return err
+			}
+		}
+		if !insecure {
+			return fmt.Errorf(
+				"host %s is not in known_hosts, key fingerprint %s",
+				hostname, ssh.FingerprintSHA256(key),
+			)
+		}
+		log.Warn(
+			"tunnel: host %s is not in known_hosts, key fingerprint %s",
+			hostname, ssh.FingerprintSHA256(key),
+		)
+		return nil
+	}
+}
+
+// Open establishes a tunnel through the relay given by spec, which has the
+// form [user@]host[:port]. Connections to the relay are forwarded to local,
+// which is the host:port address devd is listening on. Relays must be listed
+// in ~/.ssh/known_hosts unless insecure is set.
+func Open(spec string, local string, insecure bool, log termlog.Logger) (*Tunnel, error) {
+	user, addr, err := parseSpec(spec)
+	if err != nil {
+		return nil, err
+	}
+	client, err := ssh.Dial("tcp", addr, &ssh.ClientConfig{
+		User:            user,
+		Auth:            authMethods(),
+		HostKeyCallback: hostKeyCallback(log, insecure),
+		Timeout:         time.Second * 10,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Could not connect to tunnel relay: %s", err)
+	}
+	listener, err := client.ListenTCP(&net.TCPAddr{IP: net.IPv4zero, Port: remotePort})
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("Tunnel relay refused port forwarding: %s", err)
+	}
+	t := &Tunnel{client: client, listener: listener, log: log}
+	go t.serve(local)
+	t.URL = t.readURL()
+	return t, nil
+}
+
+// readURL opens a shell session on the relay and waits for it to announce a
+// public URL. Relays that don't do this yield an empty string.
+func (t *Tunnel) readURL() string {
+	session, err := t.client.NewSession()
+	if err != nil {
+		return ""
+	}
+	out, err := session.StdoutPipe()
+	if err != nil {
+		return ""
+	}
+	if err := session.Shell(); err != nil {
+		return ""
+	}
+	found := make(chan string, 1)
+	go func() {
+		var once sync.Once
+		scanner := bufio.NewScanner(out)
+		for scanner.Scan() {
+			t.log.SayAs("debug", "tunnel: %s", scanner.Text())
+			if u := urlRegexp.FindString(scanner.Text()); u != "" {
+				once.Do(func() { found <- u })
+			}
+		}
+	}()
+	select {
+	case u := <-found:
+		return u
+	case <-time.After(urlWait):
+		return ""
+	}
+}
+
+func (t *Tunnel) serve(local string) {
+	for {
+		remote, err := t.listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer remote.Close()
+			conn, err := net.Dial("tcp", local)
+			if err != nil {
+				t.log.Warn("tunnel: could not connect to %s: %s", local, err)
+				return
+			}
+			defer conn.Close()
+			done := make(chan bool, 2)
+			go func() {
+				_, _ = io.Copy(conn, remote)
+				done <- true
+			}()
+			go func() {
+				_, _ = io.Copy(remote, conn)
+				done <- true
+			}()
+			<-done
+		}()
+	}
+}
+
+// Close shuts the tunnel down
+func (t *Tunnel) Close() error {
+	t.listener.Close()
+	return t.client.Close()
+}
@@ -0,0 +1,101 @@
+package tunnel
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/cortesi/termlog"
+	"github.com/mitchellh/go-homedir"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+var parseSpecTests = []struct {
+	spec string
+	user string
+	addr string
+	err  bool
+}{
+	{"localhost.run", "devd", "localhost.run:22", false},
+	{"nokey@localhost.run", "nokey", "localhost.run:22", false},
+	{"me@relay.example.com:2222", "me", "relay.example.com:2222", false},
+	{"relay:2222", "devd", "relay:2222", false},
+	{"a@b@relay", "a@b", "relay:22", false},
+	{"[::1]:2222", "devd", "[::1]:2222", false},
+	{"", "", "", true},
+	{"me@", "", "", true},
+	{"@relay", "", "", true},
+}
+
+func TestParseSpec(t *testing.T) {
+	for i, tt := range parseSpecTests {
+		user, addr, err := parseSpec(tt.spec)
+		if (err != nil) != tt.err {
+			t.Errorf("Test %d: expected error %v, got %v", i, tt.err, err)
+			continue
+		}
+		if user != tt.user || addr != tt.addr {
+			t.Errorf("Test %d: expected %s at %s, got %s at %s", i, tt.user, tt.addr, user, addr)
+		}
+	}
+}
+
+func newHostKey(t *testing.T) ssh.PublicKey {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestHostKeyCallback(t *testing.T) {
+	home, err := ioutil.TempDir("", "devdtunnel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+	defer os.Setenv("HOME", os.Getenv("HOME"))
+	os.Setenv("HOME", home)
+	defer func(disabled bool) { homedir.DisableCache = disabled }(homedir.DisableCache)
+	homedir.DisableCache = true
+
+	known, other := newHostKey(t), newHostKey(t)
+	if err := os.Mkdir(path.Join(home, ".ssh"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	line := knownhosts.Line([]string{"known.example.com"}, known) + "\n"
+	if err := ioutil.WriteFile(path.Join(home, ".ssh", "known_hosts"), []byte(line), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	logger := termlog.NewLog()
+	logger.Quiet()
+	remote := &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 22}
+	tests := []struct {
+		host     string
+		key      ssh.PublicKey
+		insecure bool
+		ok       bool
+	}{
+		{"known.example.com:22", known, false, true},
+		{"known.example.com:22", other, false, false},
+		{"known.example.com:22", other, true, false},
+		{"unknown.example.com:22", other, false, false},
+		{"unknown.example.com:22", other, true, true},
+	}
+	for i, tt := range tests {
+		err := hostKeyCallback(logger, tt.insecure)(tt.host, remote, tt.key)
+		if (err == nil) != tt.ok {
+			t.Errorf("Test %d: expected ok %v, got error %v", i, tt.ok, err)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package devd
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	humanize "github.com/dustin/go-humanize"
+
+	"github.com/cortesi/devd/timer"
+)
+
+// Request bodies larger than this get progress notes while they upload.
+// Bodies of unknown length get them once this much has been read.
+const uploadProgressSize = 1024 * 1024
+
+// How often upload progress is noted
+const uploadProgressInterval = 2 * time.Second
+
+// countingBody counts the bytes read from a request body
+type countingBody struct {
+	io.ReadCloser
+	n int64
+}
+
+func (c *countingBody) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	atomic.AddInt64(&c.n, int64(n))
+	return n, err
+}
+
+func (c *countingBody) count() int64 {
+	return atomic.LoadInt64(&c.n)
+}
+
+// describeUpload describes how far an upload has got. A total of -1 means the
+// length is unknown.
+func describeUpload(read, total int64, elapsed time.Duration) string {
+	s := humanize.Bytes(uint64(read))
+	if total > 0 {
+		s += fmt.Sprintf(" of %s (%d%%)", humanize.Bytes(uint64(total)), read*100/total)
+	}
+	if secs := elapsed.Seconds(); secs > 0 {
+		s += ", " + timer.FormatRate(float64(read)/secs)
+	}
+	return s
+}
+
+// watchUpload notes the progress of a large request body every interval,
+// until the body has been read or the returned function is called. Notes
+// stop while the upload is stalled, which the in-flight notes cover. Smaller
+// bodies get a single note once they've been read in full.
+func watchUpload(say func(string, ...interface{}), r *http.Request, interval time.Duration) func() {
+	total := r.ContentLength
+	if r.Body == nil || r.Body == http.NoBody || total == 0 {
+		return func() {}
+	}
+	body := &countingBody{ReadCloser: r.Body}
+	r.Body = body
+	if total > 0 && total < uploadProgressSize {
+		return func() {
+			if body.count() == total {
+				say("%s uploaded", humanize.Bytes(uint64(total)))
+			}
+		}
+	}
+	t := time.NewTicker(interval)
+	stop := noteUpload(say, body, total, t.C)
+	return func() {
+		t.Stop()
+		stop()
+	}
+}
+
+// noteUpload notes the progress of a body on each tick, until the returned
+// function is called. A total of -1 means the length is unknown.
+func noteUpload(say func(string, ...interface{}), body *countingBody, total int64, ticks <-chan time.Time) func() {
+	done := make(chan struct{})
+	go func() {
+		start := time.Now()
+		last := int64(0)
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticks:
+				n := body.count()
+				if n == last || (total > 0 && n >= total) || (total < 0 && n < uploadProgressSize) {
+					continue
+				}
+				last = n
+				say("uploading %s", describeUpload(n, total, time.Since(start)))
+			}
+		}
+	}()
+	return func() { close(done) }
+}
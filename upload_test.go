@@ -0,0 +1,84 @@
+package devd
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var describeUploadTests = []struct {
+	read    int64
+	total   int64
+	elapsed time.Duration
+	expect  string
+}{
+	{1024, 4096, time.Second, "1.0 kB of 4.1 kB (25%), 1.0 KiB/s"},
+	{2048, -1, 2 * time.Second, "2.0 kB, 1.0 KiB/s"},
+	{0, 100, 0, "0 B of 100 B (0%)"},
+}
+
+func TestDescribeUpload(t *testing.T) {
+	for i, tt := range describeUploadTests {
+		if got := describeUpload(tt.read, tt.total, tt.elapsed); got != tt.expect {
+			t.Errorf("Test %d: expected %q, got %q", i, tt.expect, got)
+		}
+	}
+}
+
+func TestWatchUpload(t *testing.T) {
+	lines := []string{}
+	say := func(format string, args ...interface{}) {
+		lines = append(lines, fmt.Sprintf(format, args...))
+	}
+	small := httptest.NewRequest("POST", "/", strings.NewReader("data"))
+	stop := watchUpload(say, small, time.Hour)
+	ioutil.ReadAll(small.Body)
+	stop()
+	if len(lines) != 1 || lines[0] != "4 B uploaded" {
+		t.Errorf("Unexpected notes for a small body: %v", lines)
+	}
+
+	lines = lines[:0]
+	unread := httptest.NewRequest("POST", "/", strings.NewReader("data"))
+	watchUpload(say, unread, time.Hour)()
+	if len(lines) != 0 {
+		t.Errorf("Expected no notes for a body that wasn't read, got %v", lines)
+	}
+}
+
+func TestNoteUpload(t *testing.T) {
+	notes := make(chan string, 10)
+	say := func(format string, args ...interface{}) {
+		notes <- fmt.Sprintf(format, args...)
+	}
+	size := uploadProgressSize * 2
+	body := &countingBody{ReadCloser: ioutil.NopCloser(strings.NewReader(strings.Repeat("x", size)))}
+	ticks := make(chan time.Time)
+	stop := noteUpload(say, body, int64(size), ticks)
+	defer stop()
+
+	buf := make([]byte, size/2)
+	if _, err := io.ReadFull(body, buf); err != nil {
+		t.Fatal(err)
+	}
+	ticks <- time.Now()
+	if note := <-notes; !strings.HasPrefix(note, "uploading 1.0 MB of 2.1 MB (50%)") {
+		t.Errorf("Unexpected note: %q", note)
+	}
+	// Nothing more is noted while the upload is stalled, or once the whole
+	// body has been read. Each tick is only taken once the previous one has
+	// been dealt with.
+	ticks <- time.Now()
+	ioutil.ReadAll(body)
+	ticks <- time.Now()
+	ticks <- time.Now()
+	select {
+	case note := <-notes:
+		t.Errorf("Unexpected note: %q", note)
+	default:
+	}
+}
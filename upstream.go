@@ -0,0 +1,143 @@
+package devd
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+// AddResolves adds DNS overrides for upstream servers, from specifications of
+// the form HOST:PORT:ADDR, as curl's --resolve takes them. Proxied routes
+// connect to ADDR on PORT in place of HOST, while the Host header and TLS
+// server name stay the same.
+func (dd *Devd) AddResolves(specs []string) error {
+	for _, s := range specs {
+		parts := strings.SplitN(s, ":", 3)
+		if len(parts) != 3 || parts[0] == "" || parts[2] == "" {
+			return fmt.Errorf("Invalid resolve %s: expected HOST:PORT:ADDR", s)
+		}
+		port, err := strconv.Atoi(parts[1])
+		if err != nil || port < 1 || port > 65535 {
+			return fmt.Errorf("Invalid resolve %s: bad port %s", s, parts[1])
+		}
+		addr := strings.TrimSuffix(strings.TrimPrefix(parts[2], "["), "]")
+		if dd.Resolve == nil {
+			dd.Resolve = make(map[string]string)
+		}
+		host := net.JoinHostPort(strings.ToLower(parts[0]), parts[1])
+		dd.Resolve[host] = net.JoinHostPort(addr, parts[1])
+	}
+	return nil
+}
+
+// ParseUpstreamProxy parses the URL of a proxy that proxied routes reach
+// upstream servers through - an http:// proxy, or a socks5:// one. Either
+// may include a user name and password.
+func ParseUpstreamProxy(spec string) (*url.URL, error) {
+	u, err := url.Parse(spec)
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse upstream proxy: %s", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "socks5" {
+		return nil, fmt.Errorf("Upstream proxy must be an http:// or socks5:// URL: %s", spec)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("Upstream proxy has no host: %s", spec)
+	}
+	return u, nil
+}
+
+// upstream holds how devd connects to the servers that routes forward to. A
+// nil upstream connects directly.
+type upstream struct {
+	// Addresses to connect to in place of host:port pairs
+	resolve map[string]string
+	// A proxy to connect through, or nil
+	proxy *url.URL
+}
+
+// upstream returns how the server's routes connect to upstream servers
+func (dd *Devd) upstream() *upstream {
+	if len(dd.Resolve) == 0 && dd.UpstreamProxy == nil {
+		return nil
+	}
+	return &upstream{resolve: dd.Resolve, proxy: dd.UpstreamProxy}
+}
+
+// hostPort returns a URL's host and port, filling in the port its scheme
+// implies
+func hostPort(u *url.URL) string {
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" || u.Scheme == "wss" {
+			port = "443"
+		}
+	}
+	return net.JoinHostPort(strings.ToLower(u.Hostname()), port)
+}
+
+// proxyFor picks the proxy for a request. Servers on this machine, and those
+// given addresses with --resolve, are connected to directly.
+func (u *upstream) proxyFor(r *http.Request) (*url.URL, error) {
+	host := r.URL.Hostname()
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return nil, nil
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return nil, nil
+	}
+	if _, ok := u.resolve[hostPort(r.URL)]; ok {
+		return nil, nil
+	}
+	return u.proxy, nil
+}
+
+func (u *upstream) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	if to, ok := u.resolve[strings.ToLower(addr)]; ok {
+		addr = to
+	}
+	var d net.Dialer
+	return d.DialContext(ctx, network, addr)
+}
+
+// transport makes the Transport that forward routes proxy requests with
+func (u *upstream) transport() *http.Transport {
+	t := &http.Transport{
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		// Requests with "Expect: 100-continue" wait for the upstream server
+		// to ask for the body, and only then is it read from the client -
+		// which is when the client gets its own 100 Continue. Servers that
+		// don't answer in time get the body anyway.
+		ExpectContinueTimeout: expectContinueTimeout,
+	}
+	if u != nil {
+		t.DialContext = u.dial
+		if u.proxy != nil {
+			t.Proxy = u.proxyFor
+		}
+	}
+	return t
+}
+
+// dialer makes the Dialer that websocket routes connect with
+func (u *upstream) dialer() *websocket.Dialer {
+	d := &websocket.Dialer{
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+	}
+	if u != nil {
+		d.NetDialContext = u.dial
+		if u.proxy != nil {
+			d.Proxy = u.proxyFor
+		}
+	}
+	return d
+}
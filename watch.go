@@ -1,7 +1,13 @@
 package devd
 
 import (
+	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"path"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/cortesi/devd/livereload"
@@ -11,11 +17,72 @@ import (
 
 const batchTime = time.Millisecond * 200
 
+// The number of files of each kind listed when a reload is logged
+const changesListed = 5
+
+// describeMod summarises a batch of changes, grouping the files by whether
+// they were added, changed or deleted
+func describeMod(mod *moddwatch.Mod) string {
+	groups := []string{}
+	for _, g := range []struct {
+		name  string
+		paths []string
+	}{
+		{"added", mod.Added},
+		{"changed", mod.Changed},
+		{"deleted", mod.Deleted},
+	} {
+		if len(g.paths) == 0 {
+			continue
+		}
+		paths := g.paths
+		more := ""
+		if len(paths) > changesListed {
+			more = fmt.Sprintf(" and %d more", len(paths)-changesListed)
+			paths = paths[:changesListed]
+		}
+		groups = append(groups, g.name+" "+strings.Join(paths, ", ")+more)
+	}
+	return strings.Join(groups, "; ")
+}
+
+// A Change is a batch of file changes seen by one of devd's watchers
+type Change struct {
+	// The mux match of the route whose files changed, or "" for watch paths
+	Route string
+	Mod   *moddwatch.Mod
+}
+
+// OnChange registers a function that's called with every batch of changes
+// devd's file watchers see - the same changes that trigger livereload.
+// Watchers only run with livereload enabled, and functions must be added
+// before the Router is built. Functions are called from watcher goroutines,
+// and shouldn't block.
+func (dd *Devd) OnChange(f func(Change)) {
+	dd.changeFuncs = append(dd.changeFuncs, f)
+}
+
+func (dd *Devd) notifyChange(c Change) {
+	for _, f := range dd.changeFuncs {
+		f(c)
+	}
+}
+
 // Watch watches an endpoint for changes, if it supports them.
 func (r Route) Watch(
 	ch chan []string,
 	excludePatterns []string,
 	log termlog.Logger,
+) (*moddwatch.Watcher, error) {
+	return r.watch(ch, excludePatterns, log, nil)
+}
+
+// watch is Watch, with an optional function that sees each change
+func (r Route) watch(
+	ch chan []string,
+	excludePatterns []string,
+	log termlog.Logger,
+	notify func(Change),
 ) (*moddwatch.Watcher, error) {
 	wd, err := os.Getwd()
 	if err != nil {
@@ -36,9 +103,14 @@ func (r Route) Watch(
 		if err != nil {
 			return nil, err
 		}
+		route := r.MuxMatch()
 		go func() {
 			for mod := range modchan {
 				if !mod.Empty() {
+					log.Say("livereload: %s", describeMod(mod))
+					if notify != nil {
+						notify(Change{route, mod})
+					}
 					ch <- mod.All()
 				}
 			}
@@ -47,16 +119,56 @@ func (r Route) Watch(
 	return watcher, nil
 }
 
+// listingChanged tells us if changes to paths affect the directory listing
+// served at dir on host - that is, if any of them are in the directory it
+// shows. A path of "*" is a change to everything.
+func (dd *Devd) listingChanged(host, dir string, paths []string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if d, err := url.PathUnescape(dir); err == nil {
+		dir = d
+	}
+	route := dd.Routes.staticRoute(host, dir)
+	if route == nil {
+		return false
+	}
+	root := route.Endpoint.(*filesystemEndpoint).Root
+	listed, err := filepath.Abs(
+		filepath.Join(root, filepath.FromSlash(path.Clean("/"+strings.TrimPrefix(dir, route.Path)))),
+	)
+	if err != nil {
+		return false
+	}
+	for _, p := range paths {
+		if p == "*" {
+			return true
+		}
+		if abs, err := filepath.Abs(p); err == nil && filepath.Dir(abs) == listed {
+			return true
+		}
+	}
+	return false
+}
+
 // WatchPaths watches a set of paths, and broadcasts changes through reloader.
 func WatchPaths(paths, excludePatterns []string, reloader livereload.Reloader, log termlog.Logger) error {
+	_, err := watchPaths(paths, excludePatterns, reloader, log, nil)
+	return err
+}
+
+// watchPaths is WatchPaths, returning the watchers so they can be stopped,
+// with an optional function that sees each change
+func watchPaths(paths, excludePatterns []string, reloader livereload.Reloader, log termlog.Logger, notify func(Change)) ([]*moddwatch.Watcher, error) {
 	wd, err := os.Getwd()
 	if err != nil {
-		return err
+		return nil, err
 	}
 	ch := make(chan []string, 1)
+	watchers := []*moddwatch.Watcher{}
 	for _, path := range paths {
 		modchan := make(chan *moddwatch.Mod, 1)
-		_, err := moddwatch.Watch(
+		watcher, err := moddwatch.Watch(
 			wd,
 			[]string{path},
 			excludePatterns,
@@ -64,29 +176,53 @@ func WatchPaths(paths, excludePatterns []string, reloader livereload.Reloader, l
 			modchan,
 		)
 		if err != nil {
-			return err
+			stopWatchers(watchers)
+			return nil, err
 		}
+		watchers = append(watchers, watcher)
 		go func() {
 			for mod := range modchan {
 				if !mod.Empty() {
+					log.Say("livereload: %s", describeMod(mod))
+					if notify != nil {
+						notify(Change{"", mod})
+					}
 					ch <- mod.All()
 				}
 			}
 		}()
 	}
 	go reloader.Watch(ch)
-	return nil
+	return watchers, nil
 }
 
 // WatchRoutes watches the route collection, and broadcasts changes through reloader.
 func WatchRoutes(routes RouteCollection, reloader livereload.Reloader, excludePatterns []string, log termlog.Logger) error {
+	_, err := watchRoutes(routes, reloader, excludePatterns, log, nil)
+	return err
+}
+
+// watchRoutes is WatchRoutes, returning the watchers so they can be stopped,
+// with an optional function that sees each change
+func watchRoutes(routes RouteCollection, reloader livereload.Reloader, excludePatterns []string, log termlog.Logger, notify func(Change)) ([]*moddwatch.Watcher, error) {
 	c := make(chan []string, 1)
+	watchers := []*moddwatch.Watcher{}
 	for i := range routes {
-		_, err := routes[i].Watch(c, excludePatterns, log)
+		watcher, err := routes[i].watch(c, excludePatterns, log, notify)
 		if err != nil {
-			return err
+			stopWatchers(watchers)
+			return nil, err
+		}
+		if watcher != nil {
+			watchers = append(watchers, watcher)
 		}
 	}
 	go reloader.Watch(c)
-	return nil
+	return watchers, nil
+}
+
+func stopWatchers(watchers []*moddwatch.Watcher) {
+	for _, w := range watchers {
+		w.Stop()
+	}
 }
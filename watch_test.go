@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"sync"
 	"testing"
 	"time"
@@ -93,3 +94,105 @@ func TestRouteWatch(t *testing.T) {
 		t.Errorf("wanted 3 changed files, got %d", len(changedFiles))
 	}
 }
+
+func TestOnChange(t *testing.T) {
+	logger := termlog.NewLog()
+	logger.Quiet()
+
+	tmpFolder, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpFolder)
+
+	// Earlier tests may leave us in a directory that's been removed
+	os.Chdir(tmpFolder)
+
+	dd := Devd{}
+	changes := make(chan Change, 10)
+	dd.OnChange(func(c Change) { changes <- c })
+
+	routes := make(RouteCollection)
+	if err := routes.Add(".", nil); err != nil {
+		t.Fatal(err)
+	}
+	ch := make(chan []string, 10)
+	for r := range routes {
+		watcher, err := routes[r].watch(ch, nil, logger, dd.notifyChange)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer watcher.Stop()
+	}
+
+	addTempFile(t, tmpFolder, "a.txt", "foo\n")
+	select {
+	case c := <-changes:
+		if c.Route != "/" || c.Mod.Empty() {
+			t.Errorf("Unexpected change: %#v", c)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("No change seen")
+	}
+}
+
+func TestDescribeMod(t *testing.T) {
+	var describeTests = []struct {
+		mod      moddwatch.Mod
+		expected string
+	}{
+		{moddwatch.Mod{Changed: []string{"a.css"}}, "changed a.css"},
+		{
+			moddwatch.Mod{Added: []string{"new.js"}, Changed: []string{"a.css", "b.css"}, Deleted: []string{"old.js"}},
+			"added new.js; changed a.css, b.css; deleted old.js",
+		},
+		{
+			moddwatch.Mod{Changed: []string{"1", "2", "3", "4", "5", "6", "7"}},
+			"changed 1, 2, 3, 4, 5 and 2 more",
+		},
+	}
+	for i, tt := range describeTests {
+		if got := describeMod(&tt.mod); got != tt.expected {
+			t.Errorf("Test %d: expected %q, got %q", i, tt.expected, got)
+		}
+	}
+}
+
+func TestListingChanged(t *testing.T) {
+	root, err := ioutil.TempDir("", "devdtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	docs := filepath.Join(root, "docs")
+	if err := os.Mkdir(docs, 0755); err != nil {
+		t.Fatal(err)
+	}
+	dd := Devd{}
+	routes := []string{"/=" + root, "/docs/=" + docs, "other/=" + docs}
+	if err := dd.AddRoutes(routes, nil); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		host    string
+		dir     string
+		path    string
+		changed bool
+	}{
+		{"devd.io:8000", "/", filepath.Join(root, "a.txt"), true},
+		{"devd.io", "/", filepath.Join(root, "sub", "a.txt"), false},
+		{"devd.io", "/sub/", filepath.Join(root, "sub", "a.txt"), true},
+		{"devd.io", "/sub", filepath.Join(root, "sub", "a.txt"), true},
+		{"devd.io", "/my%20dir/", filepath.Join(root, "my dir", "a.txt"), true},
+		{"devd.io", "/docs/", filepath.Join(docs, "a.txt"), true},
+		{"devd.io", "/docs/", filepath.Join(root, "a.txt"), false},
+		{"other.devd.io", "/", filepath.Join(docs, "a.txt"), true},
+		{"other.devd.io", "/", filepath.Join(root, "a.txt"), false},
+		{"devd.io", "/", "*", true},
+	}
+	for i, tt := range tests {
+		if changed := dd.listingChanged(tt.host, tt.dir, []string{tt.path}); changed != tt.changed {
+			t.Errorf("Test %d: expected %v, got %v", i, tt.changed, changed)
+		}
+	}
+}
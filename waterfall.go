@@ -0,0 +1,128 @@
+package devd
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cortesi/termlog"
+	"github.com/dustin/go-humanize"
+)
+
+// How long a page has to go without requests before its waterfall is logged
+const waterfallSettle = 1500 * time.Millisecond
+
+// The number of slowest requests listed for a page
+const waterfallSlowest = 3
+
+// waterfallEntry is a request made for a page
+type waterfallEntry struct {
+	path     string
+	start    time.Time
+	duration time.Duration
+	size     int64
+}
+
+// pageLoad collects the requests made while loading a page
+type pageLoad struct {
+	path    string
+	entries []waterfallEntry
+	timer   *time.Timer
+}
+
+// A waterfall groups requests by the page that made them, using the Referer
+// header, and logs a summary of each page load once it settles
+type waterfall struct {
+	sync.Mutex
+	log    termlog.TermLog
+	settle time.Duration
+	// Page loads in progress, by page URL
+	pages map[string]*pageLoad
+}
+
+func newWaterfall(log termlog.TermLog, settle time.Duration) *waterfall {
+	return &waterfall{log: log, settle: settle, pages: make(map[string]*pageLoad)}
+}
+
+// isPageLoad tells us if a request was for a page the browser is navigating
+// to, rather than something a page needs
+func isPageLoad(r *http.Request, h http.Header) bool {
+	mt, _, _ := mime.ParseMediaType(h.Get("Content-Type"))
+	if mt != "text/html" || r.Method != "GET" {
+		return false
+	}
+	if dest := r.Header.Get("Sec-Fetch-Dest"); dest != "" {
+		return dest == "document"
+	}
+	return strings.Contains(r.Header.Get("Accept"), "text/html")
+}
+
+// add records a completed request. URL is the request's full URL.
+func (wf *waterfall) add(r *http.Request, url string, h http.Header, e waterfallEntry) {
+	wf.Lock()
+	defer wf.Unlock()
+	if isPageLoad(r, h) {
+		if p, ok := wf.pages[url]; ok {
+			// The page was loaded again before the last load settled
+			p.timer.Stop()
+			wf.report(p)
+		}
+		p := &pageLoad{path: e.path, entries: []waterfallEntry{e}}
+		p.timer = time.AfterFunc(wf.settle, func() { wf.finish(url, p) })
+		wf.pages[url] = p
+		return
+	}
+	p, ok := wf.pages[r.Header.Get("Referer")]
+	if !ok {
+		return
+	}
+	p.entries = append(p.entries, e)
+	p.timer.Reset(wf.settle)
+}
+
+func (wf *waterfall) finish(url string, p *pageLoad) {
+	wf.Lock()
+	defer wf.Unlock()
+	if wf.pages[url] == p {
+		delete(wf.pages, url)
+		wf.report(p)
+	}
+}
+
+func ms(d time.Duration) string {
+	return fmt.Sprintf("%.0fms", float64(d)/float64(time.Millisecond))
+}
+
+// report logs a summary of a page load
+func (wf *waterfall) report(p *pageLoad) {
+	start := p.entries[0].start
+	var end time.Time
+	var size int64
+	for _, e := range p.entries {
+		size += e.size
+		if t := e.start.Add(e.duration); t.After(end) {
+			end = t
+		}
+	}
+	log := wf.log.Group()
+	defer log.Done()
+	log.Say(
+		"page %s: %d requests, %s in %s",
+		p.path, len(p.entries), humanize.Bytes(uint64(size)), ms(end.Sub(start)),
+	)
+	assets := append([]waterfallEntry(nil), p.entries[1:]...)
+	sort.SliceStable(assets, func(i, j int) bool { return assets[i].duration > assets[j].duration })
+	if len(assets) > waterfallSlowest {
+		assets = assets[:waterfallSlowest]
+	}
+	for _, e := range assets {
+		log.Say(
+			"%s at +%s, %s %s",
+			ms(e.duration), ms(e.start.Sub(start)), humanize.Bytes(uint64(e.size)), e.path,
+		)
+	}
+}
@@ -0,0 +1,83 @@
+package devd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/cortesi/termlog"
+)
+
+func TestIsPageLoad(t *testing.T) {
+	var pageTests = []struct {
+		method string
+		header map[string]string
+		ctype  string
+		page   bool
+	}{
+		{"GET", map[string]string{"Accept": "text/html,*/*"}, "text/html; charset=utf-8", true},
+		{"GET", map[string]string{"Sec-Fetch-Dest": "document"}, "text/html", true},
+		{"GET", map[string]string{"Sec-Fetch-Dest": "iframe", "Accept": "text/html"}, "text/html", false},
+		{"GET", map[string]string{"Accept": "*/*"}, "text/html", false},
+		{"GET", map[string]string{"Accept": "text/html"}, "text/css", false},
+		{"POST", map[string]string{"Accept": "text/html"}, "text/html", false},
+	}
+	for i, tt := range pageTests {
+		r := httptest.NewRequest(tt.method, "/", nil)
+		for k, v := range tt.header {
+			r.Header.Set(k, v)
+		}
+		h := http.Header{"Content-Type": []string{tt.ctype}}
+		if page := isPageLoad(r, h); page != tt.page {
+			t.Errorf("Test %d: expected %v, got %v", i, tt.page, page)
+		}
+	}
+}
+
+func TestWaterfall(t *testing.T) {
+	logger := termlog.NewLog()
+	logger.Quiet()
+	wf := newWaterfall(logger, time.Hour)
+	html := http.Header{"Content-Type": []string{"text/html"}}
+	css := http.Header{"Content-Type": []string{"text/css"}}
+	start := time.Now()
+
+	page := httptest.NewRequest("GET", "/", nil)
+	page.Header.Set("Accept", "text/html")
+	wf.add(page, "http://devd.io/", html, waterfallEntry{path: "/", start: start})
+
+	for _, p := range []string{"/a.css", "/b.css"} {
+		r := httptest.NewRequest("GET", p, nil)
+		r.Header.Set("Referer", "http://devd.io/")
+		wf.add(r, "http://devd.io"+p, css, waterfallEntry{path: p, start: start, size: 10})
+	}
+	r := httptest.NewRequest("GET", "/c.css", nil)
+	r.Header.Set("Referer", "http://devd.io/other")
+	wf.add(r, "http://devd.io/c.css", css, waterfallEntry{path: "/c.css", start: start})
+
+	p := wf.pages["http://devd.io/"]
+	if p == nil || len(p.entries) != 3 {
+		t.Fatalf("Expected a page load with 3 requests, got %#v", p)
+	}
+
+	// A reload starts a new page load
+	wf.add(page, "http://devd.io/", html, waterfallEntry{path: "/", start: start})
+	if len(wf.pages["http://devd.io/"].entries) != 1 {
+		t.Error("Expected a reload to start a new page load")
+	}
+	wf.finish("http://devd.io/", p)
+	if len(wf.pages) != 1 {
+		t.Error("Expected a finished page load not to remove its replacement")
+	}
+	wf.finish("http://devd.io/", wf.pages["http://devd.io/"])
+	if len(wf.pages) != 0 {
+		t.Error("Expected the page load to be finished")
+	}
+}
+
+func TestMs(t *testing.T) {
+	if s := ms(1500 * time.Microsecond); s != "2ms" {
+		t.Errorf("Unexpected duration %q", s)
+	}
+}
@@ -0,0 +1,220 @@
+// Package websocketproxy is a reverse proxy for websocket connections. The
+// incoming connection is upgraded, a matching connection is made to the
+// backend, and messages are relayed between the two.
+package websocketproxy
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/cortesi/termlog"
+	"github.com/gorilla/websocket"
+)
+
+// Headers from the incoming request that are passed on to the backend
+var passHeaders = []string{
+	"Origin",
+	"Cookie",
+	"Authorization",
+	"User-Agent",
+}
+
+// WebsocketProxy is a Handler that proxies websocket connections to a
+// backend.
+type WebsocketProxy struct {
+	// Backend returns the ws:// or wss:// URL to connect to for an incoming
+	// request.
+	Backend func(*http.Request) *url.URL
+
+	// Upgrader is used to upgrade the incoming connection. If nil, a default
+	// upgrader that accepts all origins is used.
+	Upgrader *websocket.Upgrader
+
+	// Dialer is used to connect to the backend. If nil, a dialer that doesn't
+	// verify TLS certificates is used.
+	Dialer *websocket.Dialer
+
+	// The subprotocols the client asks for are always passed on to the
+	// backend, and the client gets the one the backend picks. Likewise,
+	// permessage-deflate compression is asked of the backend if the client
+	// offers it, and agreed with the client if the backend accepts.
+	// DisableCompression turns compression off on both connections.
+	DisableCompression bool
+}
+
+// offersDeflate tells us if a handshake's headers offer or accept the
+// permessage-deflate extension
+func offersDeflate(h http.Header) bool {
+	for _, v := range h["Sec-Websocket-Extensions"] {
+		for _, ext := range strings.Split(v, ",") {
+			name := strings.TrimSpace(strings.SplitN(ext, ";", 2)[0])
+			if strings.EqualFold(name, "permessage-deflate") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func singleJoiningSlash(a, b string) string {
+	aslash := strings.HasSuffix(a, "/")
+	bslash := strings.HasPrefix(b, "/")
+	switch {
+	case b == "":
+		return a
+	case aslash && bslash:
+		return a + b[1:]
+	case !aslash && !bslash:
+		return a + "/" + b
+	}
+	return a + b
+}
+
+// NewProxy returns a WebsocketProxy that connects to target. The path of the
+// incoming request is appended to the target's path.
+func NewProxy(target *url.URL) *WebsocketProxy {
+	backend := func(req *http.Request) *url.URL {
+		u := *target
+		u.Path = singleJoiningSlash(target.Path, req.URL.Path)
+		if u.Path == "" {
+			u.Path = "/"
+		}
+		switch {
+		case target.RawQuery == "":
+			u.RawQuery = req.URL.RawQuery
+		case req.URL.RawQuery != "":
+			u.RawQuery = target.RawQuery + "&" + req.URL.RawQuery
+		}
+		return &u
+	}
+	return &WebsocketProxy{Backend: backend}
+}
+
+// ServeHTTPContext serves HTTP with a context
+func (p *WebsocketProxy) ServeHTTPContext(
+	ctx context.Context, rw http.ResponseWriter, req *http.Request,
+) {
+	log := termlog.FromContext(ctx)
+	if !websocket.IsWebSocketUpgrade(req) {
+		http.Error(rw, "Expected a websocket upgrade", http.StatusBadRequest)
+		return
+	}
+	dialer := p.Dialer
+	if dialer == nil {
+		dialer = &websocket.Dialer{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		}
+	}
+	upgrader := p.Upgrader
+	if upgrader == nil {
+		upgrader = &websocket.Upgrader{
+			CheckOrigin: func(r *http.Request) bool { return true },
+		}
+	}
+
+	outHeader := http.Header{}
+	for _, h := range passHeaders {
+		for _, v := range req.Header[h] {
+			outHeader.Add(h, v)
+		}
+	}
+	if clientIP, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		if prior, ok := req.Header["X-Forwarded-For"]; ok {
+			clientIP = strings.Join(prior, ", ") + ", " + clientIP
+		}
+		outHeader.Set("X-Forwarded-For", clientIP)
+	}
+	outHeader.Set("X-Forwarded-Host", req.Host)
+
+	// Negotiate with the backend on the client's behalf
+	d := *dialer
+	d.Subprotocols = websocket.Subprotocols(req)
+	d.EnableCompression = !p.DisableCompression && offersDeflate(req.Header)
+
+	backend := p.Backend(req)
+	connBackend, resp, err := d.Dial(backend.String(), outHeader)
+	if err != nil {
+		log.Shout("websocket proxy error: %v", err)
+		if resp != nil {
+			// The backend refused the handshake - pass its response on
+			for k, vv := range resp.Header {
+				for _, v := range vv {
+					rw.Header().Add(k, v)
+				}
+			}
+			rw.WriteHeader(resp.StatusCode)
+			if resp.Body != nil {
+				_, _ = io.Copy(rw, resp.Body)
+			}
+		} else {
+			http.Error(rw, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+		}
+		return
+	}
+	defer connBackend.Close()
+
+	upgradeHeader := http.Header{}
+	for _, v := range resp.Header["Set-Cookie"] {
+		upgradeHeader.Add("Set-Cookie", v)
+	}
+	// ... and give the client whatever the backend agreed to
+	u := *upgrader
+	u.Subprotocols = nil
+	u.EnableCompression = d.EnableCompression && offersDeflate(resp.Header)
+	notes := ""
+	if proto := connBackend.Subprotocol(); proto != "" {
+		upgradeHeader.Set("Sec-WebSocket-Protocol", proto)
+		notes += ", protocol " + proto
+	}
+	if u.EnableCompression {
+		notes += ", compressed"
+	}
+	connPub, err := u.Upgrade(rw, req, upgradeHeader)
+	if err != nil {
+		log.Shout("websocket proxy error: %v", err)
+		return
+	}
+	defer connPub.Close()
+	log.Say("<- 101 websocket connected to %s%s", backend, notes)
+
+	errc := make(chan error, 2)
+	go relay(connPub, connBackend, errc)
+	go relay(connBackend, connPub, errc)
+	err = <-errc
+	if e, ok := err.(*websocket.CloseError); !ok || e.Code == websocket.CloseAbnormalClosure {
+		log.Say("websocket closed: %v", err)
+	} else {
+		log.Say("websocket closed: %d %s", e.Code, e.Text)
+	}
+}
+
+// relay copies messages from src to dst until src is closed. A close message
+// from src is passed on to dst.
+func relay(dst, src *websocket.Conn, errc chan error) {
+	for {
+		mt, msg, err := src.ReadMessage()
+		if err != nil {
+			m := websocket.FormatCloseMessage(websocket.CloseNormalClosure, err.Error())
+			if e, ok := err.(*websocket.CloseError); ok && e.Code != websocket.CloseNoStatusReceived {
+				m = websocket.FormatCloseMessage(e.Code, e.Text)
+			}
+			_ = dst.WriteMessage(websocket.CloseMessage, m)
+			errc <- err
+			return
+		}
+		if err := dst.WriteMessage(mt, msg); err != nil {
+			errc <- err
+			return
+		}
+	}
+}
+
+func (p *WebsocketProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.ServeHTTPContext(r.Context(), w, r)
+}
@@ -0,0 +1,133 @@
+package websocketproxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestWebsocketProxy(t *testing.T) {
+	upgrader := websocket.Upgrader{}
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/base/socket" {
+			t.Errorf("Unexpected backend path: %s", r.URL.Path)
+		}
+		if r.URL.RawQuery != "a=b" {
+			t.Errorf("Unexpected backend query: %s", r.URL.RawQuery)
+		}
+		if r.Header.Get("X-Forwarded-For") == "" {
+			t.Errorf("Didn't get X-Forwarded-For header")
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		for {
+			mt, msg, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err := conn.WriteMessage(mt, append([]byte("echo: "), msg...)); err != nil {
+				return
+			}
+		}
+	}))
+	defer backend.Close()
+
+	target, err := url.Parse("ws" + strings.TrimPrefix(backend.URL, "http") + "/base")
+	if err != nil {
+		t.Fatal(err)
+	}
+	frontend := httptest.NewServer(NewProxy(target))
+	defer frontend.Close()
+
+	u := "ws" + strings.TrimPrefix(frontend.URL, "http") + "/socket?a=b"
+	conn, _, err := websocket.DefaultDialer.Dial(u, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := conn.WriteMessage(websocket.TextMessage, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	_, msg, err := conn.ReadMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(msg) != "echo: hello" {
+		t.Errorf("Unexpected message: %s", msg)
+	}
+
+	resp, err := http.Get(frontend.URL + "/socket")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected %d for a plain request, got %d", http.StatusBadRequest, resp.StatusCode)
+	}
+}
+
+func TestWebsocketProxyNegotiation(t *testing.T) {
+	upgrader := websocket.Upgrader{Subprotocols: []string{"chat"}, EnableCompression: true}
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		mt, msg, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		conn.WriteMessage(mt, msg)
+	}))
+	defer backend.Close()
+	target, err := url.Parse("ws" + strings.TrimPrefix(backend.URL, "http"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var negotiationTests = []struct {
+		protocols  []string
+		compress   bool
+		disable    bool
+		protocol   string
+		compressed bool
+	}{
+		{[]string{"other", "chat"}, true, false, "chat", true},
+		{[]string{"other"}, false, false, "", false},
+		{nil, true, true, "", false},
+	}
+	for i, tt := range negotiationTests {
+		proxy := NewProxy(target)
+		proxy.DisableCompression = tt.disable
+		frontend := httptest.NewServer(proxy)
+		dialer := websocket.Dialer{Subprotocols: tt.protocols, EnableCompression: tt.compress}
+		conn, resp, err := dialer.Dial("ws"+strings.TrimPrefix(frontend.URL, "http"), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if conn.Subprotocol() != tt.protocol || offersDeflate(resp.Header) != tt.compressed {
+			t.Errorf(
+				"Test %d: expected protocol %q and compression %v, got %q and %v",
+				i, tt.protocol, tt.compressed, conn.Subprotocol(), offersDeflate(resp.Header),
+			)
+		}
+		if err := conn.WriteMessage(websocket.TextMessage, []byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+		if _, msg, err := conn.ReadMessage(); err != nil || string(msg) != "hello" {
+			t.Errorf("Test %d: unexpected message %q, %v", i, msg, err)
+		}
+		conn.Close()
+		frontend.Close()
+	}
+}